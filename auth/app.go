@@ -2,25 +2,44 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"golang.org/x/xerrors"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
 // DefaultAdminToken is the default admin token which is for local client user
 const DefaultAdminTokenName = "defaultLocalToken"
 
 type OAuthApp interface {
-	verify(token string) (*JWTPayload, error)
-	GetDefaultAdminToken() (string, error)
+	verify(clientIP, token string) (*JWTPayload, error)
+	verifyClientCert(clientIP string, cert *x509.Certificate) (*JWTPayload, error)
+	// returns the admin token of `defaultLocalToken`, followers wait for the leader creating it until ctx done
+	GetDefaultAdminToken(ctx context.Context) (string, error)
+	Reconcile(ctx context.Context, cnf *config.ReconcileConfig)
+	Reap(ctx context.Context, cnf *config.ReaperConfig)
+	Retain(ctx context.Context, cnf *config.RetentionConfig)
+	// posts the events to webhooks until ctx done, while this node is the leader
+	DeliverWebhooks(ctx context.Context, cnf *config.WebhookConfig)
+	// applies the reloaded `[rateLimit]` section
+	SetDefaultRateLimit(cnf *config.RateLimitConfig)
+	// flushes the usages of tokens and closes the store, called after the server shut down
+	Close() error
+	// ends the event streams, called when the server starts shutting down
+	CloseEvents()
 
 	Verify(c *gin.Context)
+	VerifyBatch(c *gin.Context)
 	GenerateToken(c *gin.Context)
 	RemoveToken(c *gin.Context)
 	RecoverToken(c *gin.Context)
@@ -36,6 +55,13 @@ type OAuthApp interface {
 	DeleteUser(c *gin.Context)
 	RecoverUser(c *gin.Context)
 
+	CreateOrg(c *gin.Context)
+	GetOrg(c *gin.Context)
+	ListOrgs(c *gin.Context)
+	DeleteOrg(c *gin.Context)
+	ListOrgUsers(c *gin.Context)
+	SetOrgMember(c *gin.Context)
+
 	AddUserRateLimit(c *gin.Context)
 	UpsertUserRateLimit(c *gin.Context)
 	GetUserRateLimit(c *gin.Context)
@@ -47,6 +73,8 @@ type OAuthApp interface {
 	ListMiners(c *gin.Context)
 	DeleteMiner(c *gin.Context)
 	GetUserByMiner(c *gin.Context)
+	TransferMiner(c *gin.Context)
+	UpdateMinerLabels(c *gin.Context)
 
 	RegisterSigners(c *gin.Context)
 	SignerExistInUser(c *gin.Context)
@@ -55,14 +83,42 @@ type OAuthApp interface {
 	HasSigner(c *gin.Context)
 	DelSigner(c *gin.Context)
 	GetUserBySigner(c *gin.Context)
+	UpdateSignerPolicy(c *gin.Context)
+	CheckSignerPolicy(c *gin.Context)
+
+	BulkApply(c *gin.Context)
+
+	GetMe(c *gin.Context)
+	UpdateMe(c *gin.Context)
+	GetMyTokens(c *gin.Context)
+	GenerateMyToken(c *gin.Context)
+	ListMyMiners(c *gin.Context)
+	ListMySigners(c *gin.Context)
+	RegisterMySigners(c *gin.Context)
+	GetMyRateLimits(c *gin.Context)
+
+	ListReaperReports(c *gin.Context)
+	Purge(c *gin.Context)
+
+	ReplicaSnapshot(c *gin.Context)
+	ReplicaChanges(c *gin.Context)
+
+	SubscribeEvents(c *gin.Context)
+
+	CreateWebhook(c *gin.Context)
+	UpdateWebhook(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	ListWebhooks(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	ListWebhookDeliveries(c *gin.Context)
 }
 
 type oauthApp struct {
 	srv OAuthService
 }
 
-func NewOAuthApp(dbPath string, cnf *config.DBConfig) (OAuthApp, error) {
-	srv, err := NewOAuthService(dbPath, cnf)
+func NewOAuthApp(dbPath string, cnf *config.DBConfig, opts ...ServiceOption) (OAuthApp, error) {
+	srv, err := NewOAuthService(dbPath, cnf, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,9 +127,32 @@ func NewOAuthApp(dbPath string, cnf *config.DBConfig) (OAuthApp, error) {
 	}, nil
 }
 
+// BadResponse responds err with the status of its code, see `errcode.Code`
 func BadResponse(c *gin.Context, err error) {
 	c.Error(err) // nolint
-	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	code := errorCode(err)
+	c.JSON(code.HTTPStatus(), errcode.ErrMsg{Error: err.Error(), Code: code})
+}
+
+// errorCode classifies err by the code it's marked with, then the well known errors of auth and store
+func errorCode(err error) errcode.Code {
+	if code, ok := errcode.CodeOf(err); ok {
+		return code
+	}
+	switch {
+	case errors.Is(err, ErrorNonRegisteredToken), errors.Is(err, ErrorVerificationFailed),
+		errors.Is(err, ErrorPermissionNotFound):
+		return errcode.CodeUnauthenticated
+	case errors.Is(err, ErrorPermissionDeny):
+		return errcode.CodePermissionDenied
+	case errors.Is(err, ErrorUsernameNotFound), storage.IsNotFound(err):
+		return errcode.CodeNotFound
+	case storage.IsAlreadyExists(err):
+		return errcode.CodeAlreadyExists
+	case storage.IsUnavailable(err):
+		return errcode.CodeUnavailable
+	}
+	return errcode.CodeUnknown
 }
 
 func SuccessResponse(c *gin.Context, obj interface{}) {
@@ -89,31 +168,65 @@ func Response(c *gin.Context, err error) {
 }
 
 // verify only called by inner, so use readCtx constant to bypass perm check
-func (o *oauthApp) verify(token string) (*JWTPayload, error) {
-	return o.srv.Verify(core.CtxWithPerm(context.Background(), core.PermRead), token)
+func (o *oauthApp) verify(clientIP, token string) (*JWTPayload, error) {
+	return o.srv.Verify(core.CtxWithClientIP(core.CtxWithPerm(context.Background(), core.PermRead), clientIP), token)
 }
 
-func (o *oauthApp) GetDefaultAdminToken() (string, error) {
-	adminCtx := core.CtxWithPerm(context.Background(), core.PermAdmin)
-	// if not found, create one
-	token, err := o.srv.GetTokenByName(adminCtx, DefaultAdminTokenName)
-	if err != nil {
-		return "", err
-	}
-	for _, t := range token {
-		if t.Perm == core.PermAdmin {
-			return t.Token, nil
+func (o *oauthApp) verifyClientCert(clientIP string, cert *x509.Certificate) (*JWTPayload, error) {
+	return o.srv.VerifyClientCert(core.CtxWithClientIP(context.Background(), clientIP), cert)
+}
+
+func (o *oauthApp) SetDefaultRateLimit(cnf *config.RateLimitConfig) {
+	o.srv.SetDefaultRateLimit(cnf)
+}
+
+func (o *oauthApp) Close() error {
+	return o.srv.Close()
+}
+
+func (o *oauthApp) CloseEvents() {
+	o.srv.CloseEvents()
+}
+
+func (o *oauthApp) DeliverWebhooks(ctx context.Context, cnf *config.WebhookConfig) {
+	log.Infof("deliver events to webhooks, %d attempts at most, backoff from %s to %s", cnf.MaxAttempts, cnf.MinBackoff, cnf.MaxBackoff)
+	o.srv.DeliverWebhooks(ctx, cnf)
+}
+
+func (o *oauthApp) GetDefaultAdminToken(ctx context.Context) (string, error) {
+	adminCtx := core.CtxWithPerm(ctx, core.PermAdmin)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		token, err := o.srv.GetTokenByName(adminCtx, DefaultAdminTokenName)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range token {
+			if t.Perm == core.PermAdmin {
+				return t.Token, nil
+			}
+		}
+		// if not found, the leader creates one, and followers wait for it replicated
+		if o.srv.IsLeader() {
+			break
+		}
+		log.Infof("wait for the default admin token created by the leader")
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
 		}
 	}
 	// create one
-	_, err = o.srv.CreateUser(adminCtx, &CreateUserRequest{Name: DefaultAdminTokenName})
+	_, err := o.srv.CreateUser(adminCtx, &CreateUserRequest{Name: DefaultAdminTokenName})
 	if err != nil {
 		return "", fmt.Errorf("create default user for admin token: %w", err)
 	}
 	ret, err := o.srv.GenerateToken(adminCtx, &JWTPayload{
 		Name: DefaultAdminTokenName,
 		Perm: core.PermAdmin,
-	})
+	}, &TokenMeta{Description: "default admin token"})
 	if err != nil {
 		return "", fmt.Errorf("create default admin token: %w", err)
 	}
@@ -124,16 +237,11 @@ func (o *oauthApp) GetDefaultAdminToken() (string, error) {
 func (o *oauthApp) Verify(c *gin.Context) {
 	req := new(VerifyRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
-	res, err := o.srv.Verify(c, req.Token)
+	res, err := o.srv.Verify(core.CtxWithClientIP(c, c.ClientIP()), req.Token)
 	if err != nil {
-		if err == ErrorNonRegisteredToken || err == ErrorVerificationFailed {
-			c.Error(err) // nolint
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			return
-		}
 		BadResponse(c, err)
 		return
 	}
@@ -141,17 +249,31 @@ func (o *oauthApp) Verify(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+func (o *oauthApp) VerifyBatch(c *gin.Context) {
+	req := new(VerifyBatchRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.VerifyBatch(core.CtxWithClientIP(c, c.ClientIP()), req.Tokens)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
 func (o *oauthApp) GenerateToken(c *gin.Context) {
 	req := new(GenTokenRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.GenerateToken(c, &JWTPayload{
 		Name:  req.Name,
 		Perm:  req.Perm,
 		Extra: req.Extra,
-	})
+	}, &req.TokenMeta)
 	if err != nil {
 		BadResponse(c, err)
 		return
@@ -165,7 +287,7 @@ func (o *oauthApp) GenerateToken(c *gin.Context) {
 func (o *oauthApp) RemoveToken(c *gin.Context) {
 	req := new(RemoveTokenRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.RemoveToken(c, req.Token)
@@ -175,7 +297,7 @@ func (o *oauthApp) RemoveToken(c *gin.Context) {
 func (o *oauthApp) RecoverToken(c *gin.Context) {
 	req := new(RecoverTokenRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.RecoverToken(c, req.Token)
@@ -185,11 +307,11 @@ func (o *oauthApp) RecoverToken(c *gin.Context) {
 func (o *oauthApp) GetToken(c *gin.Context) {
 	req := new(GetTokenRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	if len(req.Name) == 0 && len(req.Token) == 0 {
-		BadResponse(c, xerrors.Errorf("`name` and `token` both empty"))
+		BadResponse(c, errcode.Errorf(errcode.CodeInvalidArgument, "`name` and `token` both empty"))
 		return
 	}
 	var res []*TokenInfo
@@ -215,7 +337,7 @@ func (o *oauthApp) GetToken(c *gin.Context) {
 func (o *oauthApp) Tokens(c *gin.Context) {
 	req := new(GetTokensRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.Tokens(c, req.GetSkip(), req.GetLimit())
@@ -229,7 +351,7 @@ func (o *oauthApp) Tokens(c *gin.Context) {
 func (o *oauthApp) CreateUser(c *gin.Context) {
 	req := new(CreateUserRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -244,7 +366,7 @@ func (o *oauthApp) CreateUser(c *gin.Context) {
 func (o *oauthApp) UpdateUser(c *gin.Context) {
 	req := new(UpdateUserRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.UpdateUser(c, req)
@@ -254,7 +376,7 @@ func (o *oauthApp) UpdateUser(c *gin.Context) {
 func (o *oauthApp) ListUsers(c *gin.Context) {
 	req := new(ListUsersRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -269,7 +391,7 @@ func (o *oauthApp) ListUsers(c *gin.Context) {
 func (o *oauthApp) GetUserByMiner(c *gin.Context) {
 	req := new(GetUserByMinerRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.GetUserByMiner(c, req)
@@ -283,7 +405,7 @@ func (o *oauthApp) GetUserByMiner(c *gin.Context) {
 func (o *oauthApp) GetUser(c *gin.Context) {
 	req := new(GetUserRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.GetUser(c, req)
@@ -297,7 +419,7 @@ func (o *oauthApp) GetUser(c *gin.Context) {
 func (o *oauthApp) VerifyUsers(c *gin.Context) {
 	req := new(VerifyUsersReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -308,7 +430,7 @@ func (o *oauthApp) VerifyUsers(c *gin.Context) {
 func (o *oauthApp) HasUser(c *gin.Context) {
 	req := new(HasUserRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	has, err := o.srv.HasUser(c, req)
@@ -322,7 +444,7 @@ func (o *oauthApp) HasUser(c *gin.Context) {
 func (o *oauthApp) DeleteUser(c *gin.Context) {
 	req := new(DeleteUserRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.DeleteUser(c, req)
@@ -332,17 +454,88 @@ func (o *oauthApp) DeleteUser(c *gin.Context) {
 func (o *oauthApp) RecoverUser(c *gin.Context) {
 	req := new(RecoverUserRequest)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.RecoverUser(c, req)
 	Response(c, err)
 }
 
+func (o *oauthApp) CreateOrg(c *gin.Context) {
+	req := new(CreateOrgRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.CreateOrg(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GetOrg(c *gin.Context) {
+	req := new(GetOrgRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.GetOrg(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListOrgs(c *gin.Context) {
+	res, err := o.srv.ListOrgs(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) DeleteOrg(c *gin.Context) {
+	req := new(DeleteOrgRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	err := o.srv.DeleteOrg(c, req)
+	Response(c, err)
+}
+
+func (o *oauthApp) ListOrgUsers(c *gin.Context) {
+	req := new(ListOrgUsersRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.ListOrgUsers(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) SetOrgMember(c *gin.Context) {
+	req := new(SetOrgMemberRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	err := o.srv.SetOrgMember(c, req)
+	Response(c, err)
+}
+
 func (o *oauthApp) AddUserRateLimit(c *gin.Context) {
 	req := new(UpsertUserRateLimitReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -357,7 +550,7 @@ func (o *oauthApp) AddUserRateLimit(c *gin.Context) {
 func (o *oauthApp) UpsertUserRateLimit(c *gin.Context) {
 	req := new(UpsertUserRateLimitReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -372,7 +565,7 @@ func (o *oauthApp) UpsertUserRateLimit(c *gin.Context) {
 func (o *oauthApp) GetUserRateLimit(c *gin.Context) {
 	req := new(GetUserRateLimitsReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 
@@ -387,7 +580,7 @@ func (o *oauthApp) GetUserRateLimit(c *gin.Context) {
 func (o *oauthApp) DelUserRateLimit(c *gin.Context) {
 	req := new(DelUserRateLimitReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.DelUserRateLimit(c, req)
@@ -401,7 +594,7 @@ func (o *oauthApp) DelUserRateLimit(c *gin.Context) {
 func (o *oauthApp) UpsertMiner(c *gin.Context) {
 	req := new(UpsertMinerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	isCreate, err := o.srv.UpsertMiner(c, req)
@@ -415,7 +608,7 @@ func (o *oauthApp) UpsertMiner(c *gin.Context) {
 func (o *oauthApp) HasMiner(c *gin.Context) {
 	req := new(HasMinerRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.HasMiner(c, req)
@@ -429,7 +622,7 @@ func (o *oauthApp) HasMiner(c *gin.Context) {
 func (o *oauthApp) MinerExistInUser(c *gin.Context) {
 	req := new(MinerExistInUserRequest)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.MinerExistInUser(c, req)
@@ -443,7 +636,7 @@ func (o *oauthApp) MinerExistInUser(c *gin.Context) {
 func (o *oauthApp) ListMiners(c *gin.Context) {
 	req := new(ListMinerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.ListMiners(c, req)
@@ -457,7 +650,7 @@ func (o *oauthApp) ListMiners(c *gin.Context) {
 func (o *oauthApp) DeleteMiner(c *gin.Context) {
 	req := new(DelMinerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 	}
 	res, err := o.srv.DelMiner(c, req)
 	if err != nil {
@@ -467,10 +660,38 @@ func (o *oauthApp) DeleteMiner(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+func (o *oauthApp) TransferMiner(c *gin.Context) {
+	req := new(TransferMinerReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.TransferMiner(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) UpdateMinerLabels(c *gin.Context) {
+	req := new(UpdateMinerLabelsReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.UpdateMinerLabels(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
 func (o *oauthApp) RegisterSigners(c *gin.Context) {
 	req := new(RegisterSignersReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.RegisterSigners(c, req)
@@ -480,7 +701,7 @@ func (o *oauthApp) RegisterSigners(c *gin.Context) {
 func (o *oauthApp) SignerExistInUser(c *gin.Context) {
 	req := new(SignerExistInUserReq)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.SignerExistInUser(c, req)
@@ -494,7 +715,7 @@ func (o *oauthApp) SignerExistInUser(c *gin.Context) {
 func (o *oauthApp) ListSigner(c *gin.Context) {
 	req := new(ListSignerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.ListSigner(c, req)
@@ -508,7 +729,7 @@ func (o *oauthApp) ListSigner(c *gin.Context) {
 func (o *oauthApp) UnregisterSigners(c *gin.Context) {
 	req := new(UnregisterSignersReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	err := o.srv.UnregisterSigners(c, req)
@@ -518,7 +739,7 @@ func (o *oauthApp) UnregisterSigners(c *gin.Context) {
 func (o *oauthApp) HasSigner(c *gin.Context) {
 	req := new(HasSignerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 	}
 	res, err := o.srv.HasSigner(c, req)
 	if err != nil {
@@ -531,7 +752,7 @@ func (o *oauthApp) HasSigner(c *gin.Context) {
 func (o *oauthApp) DelSigner(c *gin.Context) {
 	req := new(DelSignerReq)
 	if err := c.ShouldBind(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 	}
 	res, err := o.srv.DelSigner(c, req)
 	if err != nil {
@@ -544,7 +765,7 @@ func (o *oauthApp) DelSigner(c *gin.Context) {
 func (o *oauthApp) GetUserBySigner(c *gin.Context) {
 	req := new(GetUserBySignerReq)
 	if err := c.ShouldBindQuery(req); err != nil {
-		BadResponse(c, err)
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
 		return
 	}
 	res, err := o.srv.GetUserBySigner(c, req)
@@ -554,3 +775,323 @@ func (o *oauthApp) GetUserBySigner(c *gin.Context) {
 	}
 	SuccessResponse(c, res)
 }
+
+func (o *oauthApp) UpdateSignerPolicy(c *gin.Context) {
+	req := new(UpdateSignerPolicyReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.UpdateSignerPolicy(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) CheckSignerPolicy(c *gin.Context) {
+	req := new(CheckSignerPolicyReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.CheckSignerPolicy(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) BulkApply(c *gin.Context) {
+	req := new(BulkApplyReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.BulkApply(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+// meName returns the name of the caller for the `/me` apis, responses an error if it's missing
+func meName(c *gin.Context) (string, bool) {
+	name, err := callerName(c)
+	if err != nil {
+		BadResponse(c, err)
+		return "", false
+	}
+	return name, true
+}
+
+func (o *oauthApp) GetMe(c *gin.Context) {
+	name, ok := meName(c)
+	if !ok {
+		return
+	}
+	res, err := o.srv.GetUser(c, &GetUserRequest{Name: name})
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) UpdateMe(c *gin.Context) {
+	req := new(UpdateMeReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	err := o.srv.UpdateMe(c, req)
+	Response(c, err)
+}
+
+func (o *oauthApp) GetMyTokens(c *gin.Context) {
+	name, ok := meName(c)
+	if !ok {
+		return
+	}
+	res, err := o.srv.GetTokenByName(c, name)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GenerateMyToken(c *gin.Context) {
+	req := new(GenerateMyTokenReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.GenerateMyToken(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, &GenTokenResponse{Token: res})
+}
+
+func (o *oauthApp) ListMyMiners(c *gin.Context) {
+	name, ok := meName(c)
+	if !ok {
+		return
+	}
+	res, err := o.srv.ListMiners(c, &ListMinerReq{User: name})
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListMySigners(c *gin.Context) {
+	name, ok := meName(c)
+	if !ok {
+		return
+	}
+	res, err := o.srv.ListSigner(c, &ListSignerReq{User: name})
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) RegisterMySigners(c *gin.Context) {
+	req := new(RegisterMySignersReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	err := o.srv.RegisterMySigners(c, req)
+	Response(c, err)
+}
+
+func (o *oauthApp) GetMyRateLimits(c *gin.Context) {
+	res, err := o.srv.GetMyRateLimits(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListReaperReports(c *gin.Context) {
+	res, err := o.srv.ListReaperReports(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) Purge(c *gin.Context) {
+	req := new(PurgeReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.Purge(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ReplicaSnapshot(c *gin.Context) {
+	res, err := o.srv.ReplicaSnapshot(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ReplicaChanges(c *gin.Context) {
+	req := new(ReplicaChangesReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.ReplicaChanges(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+// eventKeepAlive how often a comment is sent while no events, so the proxies don't close the stream
+const eventKeepAlive = 15 * time.Second
+
+// SubscribeEvents streams the events as server-sent events, whose ids are the ids of events
+func (o *oauthApp) SubscribeEvents(c *gin.Context) {
+	req := new(SubscribeEventsReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	if len(req.LastEventID) == 0 {
+		req.LastEventID = c.GetHeader("Last-Event-ID")
+	}
+	events, err := o.srv.SubscribeEvents(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+
+	// the stream lasts longer than the write timeout of server
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debugf("clear write deadline of event stream: %s", err)
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev)
+			_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		case <-ticker.C:
+			_, err = fmt.Fprint(c.Writer, ": keepalive\n\n")
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func (o *oauthApp) CreateWebhook(c *gin.Context) {
+	req := new(CreateWebhookReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.CreateWebhook(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) UpdateWebhook(c *gin.Context) {
+	req := new(UpdateWebhookReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.UpdateWebhook(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GetWebhook(c *gin.Context) {
+	req := new(GetWebhookReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.GetWebhook(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListWebhooks(c *gin.Context) {
+	res, err := o.srv.ListWebhooks(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) DeleteWebhook(c *gin.Context) {
+	req := new(DeleteWebhookReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	err := o.srv.DeleteWebhook(c, req)
+	Response(c, err)
+}
+
+func (o *oauthApp) ListWebhookDeliveries(c *gin.Context) {
+	req := new(ListWebhookDeliveriesReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, errcode.WithCode(errcode.CodeInvalidArgument, err))
+		return
+	}
+	res, err := o.srv.ListWebhookDeliveries(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+// auditLog records an operation which changes the ownership of resources,
+// `op` is used as the measurement, so the record can be collected by log hooks(eg. influxdb)
+func auditLog(ctx context.Context, op string, fields log.Fields) {
+	fields[core.MTMethod] = op
+	if operator, ok := core.CtxGetName(ctx); ok {
+		fields[core.FieldOperator] = operator
+	}
+	log.WithFields(fields).Infof("audit: %s", op)
+}
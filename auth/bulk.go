@@ -0,0 +1,671 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// Manifest declares the desired state of users and the resources bound to them
+type Manifest struct {
+	Users []*ManifestUser `json:"users" yaml:"users"`
+}
+
+type ManifestUser struct {
+	Name string `json:"name" yaml:"name"`
+	// nil means comment of an existing user is left untouched
+	Comment *string        `json:"comment,omitempty" yaml:"comment"`
+	State   core.UserState `json:"state" yaml:"state"` // 0: keep as is, 1: enable, 2: disable
+
+	Miners     []*ManifestMiner     `json:"miners,omitempty" yaml:"miners"`
+	Signers    []string             `json:"signers,omitempty" yaml:"signers"`
+	RateLimits []*ManifestRateLimit `json:"rateLimits,omitempty" yaml:"rateLimits"`
+	Tokens     []*ManifestToken     `json:"tokens,omitempty" yaml:"tokens"`
+}
+
+type ManifestMiner struct {
+	Miner string `json:"miner" yaml:"miner"`
+	// default to true
+	OpenMining *bool `json:"openMining,omitempty" yaml:"openMining"`
+	// nil means labels of an existing miner are left untouched, otherwise labels are replaced
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels"`
+}
+
+type ManifestRateLimit struct {
+	Service  string        `json:"service" yaml:"service"`
+	API      string        `json:"api" yaml:"api"`
+	Cap      int64         `json:"cap" yaml:"cap"`
+	ResetDur time.Duration `json:"resetDur" yaml:"resetDur"`
+}
+
+// ManifestToken a token is minted only if user has no token with the same perm and extra
+type ManifestToken struct {
+	Perm  core.Permission `json:"perm" yaml:"perm"`
+	Extra string          `json:"extra,omitempty" yaml:"extra"`
+}
+
+const (
+	ChangeKindUser  = "user"
+	ChangeKindMiner = "miner"
+	// labels of miner are planned separately, since they are stored apart from the binding
+	ChangeKindMinerLabels = "miner-labels"
+	ChangeKindSigner      = "signer"
+	ChangeKindRateLimit   = "ratelimit"
+	ChangeKindToken       = "token"
+
+	ChangeActionCreate = "create"
+	ChangeActionUpdate = "update"
+	ChangeActionDelete = "delete"
+)
+
+type ApplyChange struct {
+	Kind   string `json:"kind"`
+	Action string `json:"action"`
+	User   string `json:"user"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+
+	apply func(store storage.Store) error
+	// called after all changes committed, used to update metrics
+	done func(ctx context.Context)
+	// the change of user disables it
+	disables bool
+}
+
+type GeneratedToken struct {
+	User  string          `json:"user"`
+	Perm  core.Permission `json:"perm"`
+	Extra string          `json:"extra,omitempty"`
+	Token string          `json:"token"`
+}
+
+// LoadManifest reads manifest from a yaml file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %s: %w", path, err)
+	}
+	manifest := new(Manifest)
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+func (m *Manifest) validate() error {
+	users := make(map[string]struct{}, len(m.Users))
+	for _, u := range m.Users {
+		if len(u.Name) == 0 {
+			return errors.New("user name is required")
+		}
+		if _, ok := users[u.Name]; ok {
+			return fmt.Errorf("duplicate user %s", u.Name)
+		}
+		users[u.Name] = struct{}{}
+		if u.State != core.UserStateUndefined && u.State != core.UserStateEnabled && u.State != core.UserStateDisabled {
+			return fmt.Errorf("user %s: invalid state %d", u.Name, u.State)
+		}
+
+		for _, m := range u.Miners {
+			mAddr, err := address.NewFromString(m.Miner)
+			if err != nil {
+				return fmt.Errorf("user %s: parse miner %s: %w", u.Name, m.Miner, err)
+			}
+			if mAddr.Protocol() == address.Unknown {
+				return fmt.Errorf("user %s: invalid protocol type of miner %s: %v", u.Name, m.Miner, mAddr.Protocol())
+			}
+			if err := checkMinerLabels(m.Labels); err != nil {
+				return fmt.Errorf("user %s: miner %s: %w", u.Name, m.Miner, err)
+			}
+		}
+		for _, signer := range u.Signers {
+			addr, err := address.NewFromString(signer)
+			if err != nil {
+				return fmt.Errorf("user %s: parse signer %s: %w", u.Name, signer, err)
+			}
+			if !IsSignerAddress(addr) {
+				return fmt.Errorf("user %s: invalid protocol type of signer %s: %v", u.Name, signer, addr.Protocol())
+			}
+		}
+		for _, l := range u.RateLimits {
+			if l.Cap <= 0 || l.ResetDur <= 0 {
+				return fmt.Errorf("user %s: cap and reset duration of rate limit %s/%s must be positive", u.Name, l.Service, l.API)
+			}
+		}
+		for _, tk := range u.Tokens {
+			if !core.IsValid(tk.Perm) {
+				return fmt.Errorf("user %s: invalid perm %s of token", u.Name, tk.Perm)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveMiners replaces miners of the validated manifest with their ID addresses, which miners are stored by
+func (o *jwtOAuth) resolveMiners(ctx context.Context, m *Manifest) error {
+	miners := make(map[address.Address]string)
+	for _, u := range m.Users {
+		for _, mm := range u.Miners {
+			mAddr, _ := address.NewFromString(mm.Miner)
+			idAddr, err := o.resolveMiner(ctx, mAddr)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", u.Name, err)
+			}
+			if owner, ok := miners[idAddr]; ok {
+				return errcode.Errorf(errcode.CodeInvalidArgument, "invalid manifest: miner %s is declared by both user %s and %s", idAddr, owner, u.Name)
+			}
+			miners[idAddr] = u.Name
+			mm.Miner = idAddr.String()
+		}
+	}
+	return nil
+}
+
+type planOptions struct {
+	// remove resources absent from the manifest
+	prune bool
+	// users and their resources never removed by prune
+	protected map[string]struct{}
+}
+
+func newPlanOptions(prune bool, protected []string) *planOptions {
+	opts := &planOptions{
+		prune:     prune,
+		protected: map[string]struct{}{DefaultAdminTokenName: {}},
+	}
+	for _, name := range protected {
+		opts.protected[name] = struct{}{}
+	}
+	return opts
+}
+
+func (opts *planOptions) shouldPrune(user string) bool {
+	if !opts.prune {
+		return false
+	}
+	_, ok := opts.protected[user]
+	return !ok
+}
+
+// plan compares manifest with the store, returns changes which make the store satisfy the manifest
+func (o *jwtOAuth) plan(m *Manifest, opts *planOptions) ([]*ApplyChange, error) {
+	var changes []*ApplyChange
+	declared := make(map[string]struct{}, len(m.Users))
+	for _, mu := range m.Users {
+		declared[mu.Name] = struct{}{}
+		userChanges, err := o.planUser(mu, opts)
+		if err != nil {
+			return nil, fmt.Errorf("plan user %s: %w", mu.Name, err)
+		}
+		changes = append(changes, userChanges...)
+	}
+
+	if !opts.prune {
+		return changes, nil
+	}
+	users, err := o.store.ListUsers(0, 0, core.UserStateUndefined)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if _, ok := declared[user.Name]; ok || !opts.shouldPrune(user.Name) {
+			continue
+		}
+		changes = append(changes, newUserDeleteChange(user))
+	}
+	return changes, nil
+}
+
+func (o *jwtOAuth) planUser(mu *ManifestUser, opts *planOptions) ([]*ApplyChange, error) {
+	var changes []*ApplyChange
+	name := mu.Name
+
+	exist, err := o.store.HasUser(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		changes = append(changes, newUserChange(mu))
+	} else {
+		user, err := o.store.GetUser(name)
+		if err != nil {
+			return nil, err
+		}
+		var details []string
+		var done func(ctx context.Context)
+		disables := mu.State == core.UserStateDisabled && user.State != core.UserStateDisabled
+		if mu.Comment != nil && *mu.Comment != user.Comment {
+			details = append(details, fmt.Sprintf("comment: %q -> %q", user.Comment, *mu.Comment))
+			user.Comment = *mu.Comment
+		}
+		if mu.State != core.UserStateUndefined && mu.State != user.State {
+			details = append(details, fmt.Sprintf("state: %s -> %s", user.State, mu.State))
+			prev := user.State
+			user.State = mu.State
+			done = func(ctx context.Context) {
+				core.UserGauge.Inc(ctx, prev.String(), -1)
+				core.UserGauge.Inc(ctx, user.State.String(), 1)
+			}
+		}
+		if len(details) != 0 {
+			changes = append(changes, &ApplyChange{
+				Kind: ChangeKindUser, Action: ChangeActionUpdate, User: name, Target: name,
+				Detail: strings.Join(details, ", "),
+				apply: func(store storage.Store) error {
+					user.UpdateTime = time.Now().Local()
+					return store.UpdateUser(user)
+				},
+				done:     done,
+				disables: disables,
+			})
+		}
+	}
+
+	// miners
+	current := make(map[string]*OutputMiner)
+	if exist {
+		miners, err := o.store.ListMiners(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range miners {
+			out := o.mp.ToOutPutMiner(m)
+			current[out.Miner.String()] = out
+		}
+	}
+	for _, mm := range mu.Miners {
+		mAddr, _ := address.NewFromString(mm.Miner)
+		openMining := true
+		if mm.OpenMining != nil {
+			openMining = *mm.OpenMining
+		}
+		if cur, ok := current[mAddr.String()]; ok {
+			if cur.OpenMining != openMining {
+				changes = append(changes, newMinerChange(name, mAddr, openMining, ChangeActionUpdate,
+					fmt.Sprintf("openMining: %v -> %v", cur.OpenMining, openMining)))
+			}
+			if mm.Labels != nil && !maps.Equal(cur.Labels, mm.Labels) {
+				changes = append(changes, newMinerLabelsChange(name, mAddr, cur.Labels, mm.Labels))
+			}
+			continue
+		}
+		has, err := o.store.HasMiner(mAddr)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			return nil, fmt.Errorf("miner %s is bound to another user, transfer it first", mAddr)
+		}
+		changes = append(changes, newMinerChange(name, mAddr, openMining, ChangeActionCreate,
+			fmt.Sprintf("openMining: %v", openMining)))
+		if len(mm.Labels) != 0 {
+			changes = append(changes, newMinerLabelsChange(name, mAddr, nil, mm.Labels))
+		}
+	}
+
+	// signers
+	for _, signer := range mu.Signers {
+		addr, _ := address.NewFromString(signer)
+		if exist {
+			has, err := o.store.SignerExistInUser(addr, name)
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				continue
+			}
+		}
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindSigner, Action: ChangeActionCreate, User: name, Target: addr.String(),
+			apply: func(store storage.Store) error {
+				return store.RegisterSigner(addr, name)
+			},
+		})
+	}
+
+	// rate limits, matched by service and api
+	var limits []*storage.UserRateLimit
+	if exist {
+		if limits, err = o.store.GetRateLimits(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, ml := range mu.RateLimits {
+		limit := &storage.UserRateLimit{
+			Name:     name,
+			Service:  ml.Service,
+			API:      ml.API,
+			ReqLimit: storage.ReqLimit{Cap: ml.Cap, ResetDur: ml.ResetDur},
+		}
+		action, detail := ChangeActionCreate, fmt.Sprintf("cap: %d, resetDur: %s", ml.Cap, ml.ResetDur)
+		var matched bool
+		for _, l := range limits {
+			if l.Service != ml.Service || l.API != ml.API {
+				continue
+			}
+			matched = true
+			if l.ReqLimit.Cap != ml.Cap || l.ReqLimit.ResetDur != ml.ResetDur {
+				limit.Id = l.Id
+				action = ChangeActionUpdate
+				detail = fmt.Sprintf("cap: %d -> %d, resetDur: %s -> %s", l.ReqLimit.Cap, ml.Cap, l.ReqLimit.ResetDur, ml.ResetDur)
+				matched = false
+			}
+			break
+		}
+		if matched {
+			continue
+		}
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindRateLimit, Action: action, User: name, Target: rateLimitTarget(ml.Service, ml.API), Detail: detail,
+			apply: func(store storage.Store) error {
+				_, err := store.PutRateLimit(limit)
+				return err
+			},
+		})
+	}
+
+	// tokens
+	var kps []*storage.KeyPair
+	if exist {
+		if kps, err = o.store.ByName(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, mt := range mu.Tokens {
+		var found bool
+		for _, kp := range kps {
+			if kp.Perm == string(mt.Perm) && kp.Extra == mt.Extra {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindToken, Action: ChangeActionCreate, User: name, Target: string(mt.Perm), Detail: mt.Extra,
+		})
+	}
+
+	if exist && opts.shouldPrune(name) {
+		pruneChanges, err := o.planPruneOfUser(mu, current, limits)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, pruneChanges...)
+	}
+
+	return changes, nil
+}
+
+// planPruneOfUser returns changes which remove miners, signers and rate limits of user absent from the manifest,
+// tokens are never removed, since they can't be recovered from the manifest.
+func (o *jwtOAuth) planPruneOfUser(mu *ManifestUser, miners map[string]*OutputMiner, limits []*storage.UserRateLimit) ([]*ApplyChange, error) {
+	var changes []*ApplyChange
+	name := mu.Name
+
+	declaredMiners := make(map[string]struct{}, len(mu.Miners))
+	for _, mm := range mu.Miners {
+		mAddr, _ := address.NewFromString(mm.Miner)
+		declaredMiners[mAddr.String()] = struct{}{}
+	}
+	keys := make([]string, 0, len(miners))
+	for key := range miners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := declaredMiners[key]; ok {
+			continue
+		}
+		mAddr := miners[key].Miner
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindMiner, Action: ChangeActionDelete, User: name, Target: mAddr.String(),
+			apply: func(store storage.Store) error {
+				_, err := store.DelMiner(mAddr)
+				return err
+			},
+		})
+	}
+
+	declaredSigners := make(map[string]struct{}, len(mu.Signers))
+	for _, signer := range mu.Signers {
+		addr, _ := address.NewFromString(signer)
+		declaredSigners[addr.String()] = struct{}{}
+	}
+	signers, err := o.store.ListSigner(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, signer := range signers {
+		addr := signer.Signer.Address()
+		if _, ok := declaredSigners[addr.String()]; ok {
+			continue
+		}
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindSigner, Action: ChangeActionDelete, User: name, Target: addr.String(),
+			apply: func(store storage.Store) error {
+				return store.UnregisterSigner(addr, name)
+			},
+		})
+	}
+
+	for _, l := range limits {
+		var found bool
+		for _, ml := range mu.RateLimits {
+			if l.Service == ml.Service && l.API == ml.API {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		id := l.Id
+		changes = append(changes, &ApplyChange{
+			Kind: ChangeKindRateLimit, Action: ChangeActionDelete, User: name, Target: rateLimitTarget(l.Service, l.API),
+			Detail: fmt.Sprintf("id: %s", id),
+			apply: func(store storage.Store) error {
+				return store.DelRateLimit(name, id)
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+func newUserChange(mu *ManifestUser) *ApplyChange {
+	user := &storage.User{
+		Name:      mu.Name,
+		State:     mu.State,
+		IsDeleted: core.NotDelete,
+	}
+	if mu.Comment != nil {
+		user.Comment = *mu.Comment
+	}
+	return &ApplyChange{
+		Kind: ChangeKindUser, Action: ChangeActionCreate, User: mu.Name, Target: mu.Name,
+		Detail: fmt.Sprintf("state: %s", mu.State),
+		apply: func(store storage.Store) error {
+			user.Id = uuid.NewString()
+			user.CreateTime = time.Now().Local()
+			user.UpdateTime = user.CreateTime
+			return store.PutUser(user)
+		},
+		done: func(ctx context.Context) {
+			core.UserGauge.Inc(ctx, user.State.String(), 1)
+		},
+	}
+}
+
+// newUserDeleteChange soft deletes user, miners and signers of the user are removed along with it
+func newUserDeleteChange(user *storage.User) *ApplyChange {
+	name, state := user.Name, user.State
+	return &ApplyChange{
+		Kind: ChangeKindUser, Action: ChangeActionDelete, User: name, Target: name,
+		apply: func(store storage.Store) error {
+			return store.DeleteUser(name, false)
+		},
+		done: func(ctx context.Context) {
+			core.UserGauge.Inc(ctx, state.String(), -1)
+		},
+	}
+}
+
+// newMinerLabelsChange replaces labels of miner with 'labels'
+func newMinerLabelsChange(user string, mAddr address.Address, current, labels map[string]string) *ApplyChange {
+	var unset []string
+	for k := range current {
+		if _, ok := labels[k]; !ok {
+			unset = append(unset, k)
+		}
+	}
+	sort.Strings(unset)
+	action := ChangeActionUpdate
+	if len(current) == 0 {
+		action = ChangeActionCreate
+	}
+	return &ApplyChange{
+		Kind: ChangeKindMinerLabels, Action: action, User: user, Target: mAddr.String(),
+		Detail: fmt.Sprintf("labels: %v -> %v", current, labels),
+		apply: func(store storage.Store) error {
+			_, err := store.UpdateMinerLabels(mAddr, labels, unset)
+			return err
+		},
+	}
+}
+
+func newMinerChange(user string, mAddr address.Address, openMining bool, action, detail string) *ApplyChange {
+	return &ApplyChange{
+		Kind: ChangeKindMiner, Action: action, User: user, Target: mAddr.String(), Detail: detail,
+		apply: func(store storage.Store) error {
+			_, err := store.UpsertMiner(mAddr, user, &openMining)
+			return err
+		},
+	}
+}
+
+// event of the change applied, the previous owners of the miners taken are unknown
+func (c *ApplyChange) event() *Event {
+	ev := &Event{User: c.User}
+	switch c.Kind {
+	case ChangeKindUser:
+		ev.Type = EventUserUpdated
+		if c.disables {
+			ev.Type = EventUserDisabled
+		}
+		switch c.Action {
+		case ChangeActionCreate:
+			ev.Type = EventUserCreated
+		case ChangeActionDelete:
+			ev.Type = EventUserDeleted
+		}
+	case ChangeKindMiner, ChangeKindMinerLabels:
+		ev.Type, ev.Miner = EventMinerUpserted, c.Target
+		if c.Kind == ChangeKindMiner && c.Action == ChangeActionDelete {
+			ev.Type = EventMinerDeleted
+		}
+	case ChangeKindSigner:
+		ev.Type, ev.Signer = EventSignerRegistered, c.Target
+		if c.Action == ChangeActionDelete {
+			ev.Type = EventSignerUnregistered
+		}
+	case ChangeKindRateLimit:
+		ev.Type = EventRateLimitChanged
+	case ChangeKindToken:
+		ev.Type, ev.Perm = EventTokenGenerated, c.Target
+	}
+	return ev
+}
+
+func rateLimitTarget(service, api string) string {
+	if len(service) == 0 {
+		service = "*"
+	}
+	if len(api) == 0 {
+		api = "*"
+	}
+	return service + "/" + api
+}
+
+func (o *jwtOAuth) BulkApply(ctx context.Context, req *BulkApplyReq) (*BulkApplyResp, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if err := req.Manifest.validate(); err != nil {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "invalid manifest: %w", err)
+	}
+	if err := o.resolveMiners(ctx, &req.Manifest); err != nil {
+		return nil, err
+	}
+	changes, err := o.plan(&req.Manifest, newPlanOptions(req.Prune, req.Protected))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BulkApplyResp{Changes: changes}
+	if req.DryRun || len(changes) == 0 {
+		return resp, nil
+	}
+
+	var tokens []*GeneratedToken
+	for _, change := range changes {
+		if change.Kind != ChangeKindToken {
+			continue
+		}
+		kp, err := newKeyPair(&JWTPayload{Name: change.User, Perm: core.Permission(change.Target), Extra: change.Detail})
+		if err != nil {
+			return nil, err
+		}
+		change.apply = func(store storage.Store) error {
+			return store.Put(kp)
+		}
+		change.done = func(ctx context.Context) {
+			core.TokenGauge.Inc(ctx, kp.Perm, 1)
+		}
+		tokens = append(tokens, &GeneratedToken{User: kp.Name, Perm: core.Permission(kp.Perm), Extra: kp.Extra, Token: kp.Token.String()})
+	}
+
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		events := make([]*Event, 0, len(changes))
+		for _, change := range changes {
+			if change.apply != nil {
+				if err := change.apply(store); err != nil {
+					return nil, fmt.Errorf("%s %s %s of user %s: %w", change.Action, change.Kind, change.Target, change.User, err)
+				}
+			}
+			events = append(events, change.event())
+		}
+		return events, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// miners may be taken from users absent from the manifest, so the replicas sync all
+	o.changeLog.reset()
+
+	for _, change := range changes {
+		if change.done != nil {
+			change.done(ctx)
+		}
+	}
+	auditLog(ctx, "bulkApply", log.Fields{"changes": len(changes)})
+	resp.Tokens = tokens
+	return resp, nil
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// EventType what an event is about
+type EventType string
+
+const (
+	EventUserCreated EventType = "user_created"
+	EventUserUpdated EventType = "user_updated"
+	// the user is disabled, emitted instead of `user_updated`
+	EventUserDisabled EventType = "user_disabled"
+	// the miners and signers of the user are deleted and recovered along with it, no events of them
+	EventUserDeleted   EventType = "user_deleted"
+	EventUserRecovered EventType = "user_recovered"
+
+	EventTokenGenerated EventType = "token_generated"
+	EventTokenRemoved   EventType = "token_removed"
+	EventTokenRecovered EventType = "token_recovered"
+
+	// the miner is bound to `User`, moved from `PrevUser` if it's set, or its labels are updated
+	EventMinerUpserted EventType = "miner_upserted"
+	EventMinerDeleted  EventType = "miner_deleted"
+
+	EventSignerRegistered   EventType = "signer_registered"
+	EventSignerUnregistered EventType = "signer_unregistered"
+	// the policy of the signer of `User` is updated
+	EventSignerUpdated EventType = "signer_updated"
+
+	// `User` is empty if the default rate limit changed
+	EventRateLimitChanged EventType = "ratelimit_changed"
+
+	// EventReset tells the events after the last received one can't be replayed, such as sophon-auth restarted
+	// or the subscriber fell too far behind, what the subscriber cares should be listed again
+	EventReset EventType = "reset"
+)
+
+// EventTypes all the types except `EventReset`, which is always delivered
+var EventTypes = []EventType{
+	EventUserCreated, EventUserUpdated, EventUserDisabled, EventUserDeleted, EventUserRecovered,
+	EventTokenGenerated, EventTokenRemoved, EventTokenRecovered,
+	EventMinerUpserted, EventMinerDeleted,
+	EventSignerRegistered, EventSignerUnregistered, EventSignerUpdated,
+	EventRateLimitChanged,
+}
+
+func isEventType(t EventType) bool {
+	for _, et := range EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event an entity changed, the tokens themselves are never carried
+type Event struct {
+	// resume the stream after the event by `Last-Event-ID`
+	ID       string    `json:"id"`
+	Type     EventType `json:"type"`
+	User     string    `json:"user,omitempty"`
+	PrevUser string    `json:"prevUser,omitempty"`
+	Miner    string    `json:"miner,omitempty"`
+	Signer   string    `json:"signer,omitempty"`
+	// permission of the token
+	Perm string    `json:"perm,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// eventBufferSize how many events are kept for the subscribers to resume
+const eventBufferSize = 4096
+
+type eventEntry struct {
+	seq uint64
+	ev  *Event
+}
+
+// eventHub keeps the latest events in memory, the ids are `<epoch>-<seq>`, and the epoch changes when the
+// service restarted, so a subscriber resuming by an id of another epoch or dropped from the buffer is reset.
+type eventHub struct {
+	lk      sync.Mutex
+	epoch   string
+	seq     uint64
+	entries []eventEntry
+	// closed and replaced when events published
+	notify chan struct{}
+	closed bool
+	done   chan struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{epoch: uuid.NewString(), notify: make(chan struct{}), done: make(chan struct{})}
+}
+
+// publish a nil hub publishes nothing
+func (h *eventHub) publish(events ...*Event) {
+	if h == nil || len(events) == 0 {
+		return
+	}
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	now := time.Now()
+	for _, ev := range events {
+		h.seq++
+		ev.ID = h.id(h.seq)
+		if ev.Time.IsZero() {
+			ev.Time = now
+		}
+		h.entries = append(h.entries, eventEntry{seq: h.seq, ev: ev})
+	}
+	if over := len(h.entries) - eventBufferSize; over > 0 {
+		h.entries = append(h.entries[:0], h.entries[over:]...)
+	}
+	close(h.notify)
+	h.notify = make(chan struct{})
+}
+
+// stamp sets the ids and time the events are to be published with, so the publishing must follow the stamping
+// without other events published in between
+func (h *eventHub) stamp(events ...*Event) {
+	now := time.Now()
+	for _, ev := range events {
+		if ev.Time.IsZero() {
+			ev.Time = now
+		}
+	}
+	if h == nil {
+		return
+	}
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	for i, ev := range events {
+		ev.ID = h.id(h.seq + uint64(i) + 1)
+	}
+}
+
+// close ends the subscriptions
+func (h *eventHub) close() {
+	if h == nil {
+		return
+	}
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+}
+
+func (h *eventHub) id(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// after returns the events after id and the id to resume from, they are a reset event if the events
+// after id can't be told. The channel returned is closed when more events published.
+func (h *eventHub) after(id string) ([]*Event, string, <-chan struct{}) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	current := h.id(h.seq)
+	if len(id) == 0 || id == current {
+		return nil, current, h.notify
+	}
+
+	// the epoch is an uuid, so the seq is after the last '-'
+	epoch, seq, ok := id, uint64(0), false
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		var err error
+		epoch = id[:i]
+		seq, err = strconv.ParseUint(id[i+1:], 10, 64)
+		ok = err == nil
+	}
+	// the entries are never empty once published, and the one after seq should be kept
+	if !ok || epoch != h.epoch || seq > h.seq || seq+1 < h.entries[0].seq {
+		return []*Event{{ID: current, Type: EventReset, Time: time.Now()}}, current, h.notify
+	}
+	var events []*Event
+	for _, e := range h.entries {
+		if e.seq > seq {
+			events = append(events, e.ev)
+		}
+	}
+	return events, current, h.notify
+}
+
+// subscribe delivers the events after lastID passing filter, until ctx done or the hub closed,
+// then the channel is closed. Reset events are always delivered.
+func (h *eventHub) subscribe(ctx context.Context, lastID string, filter func(*Event) bool) <-chan *Event {
+	// the events from now on are those after the current one, which should be got before returning
+	id := lastID
+	if len(id) == 0 {
+		h.lk.Lock()
+		id = h.id(h.seq)
+		h.lk.Unlock()
+	}
+	ch := make(chan *Event, 64)
+	go func() {
+		defer close(ch)
+		for {
+			events, next, notify := h.after(id)
+			for _, ev := range events {
+				if ev.Type != EventReset && filter != nil && !filter(ev) {
+					continue
+				}
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				case <-h.done:
+					return
+				}
+			}
+			id = next
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			case <-h.done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// commit runs write and enqueues the deliveries of webhooks for the events it returns in one transaction,
+// then emits the events. Commits are serialized, so the ids stamped before enqueued are those published.
+func (o *jwtOAuth) commit(write func(store storage.Store) ([]*Event, error)) error {
+	o.commitLk.Lock()
+	defer o.commitLk.Unlock()
+	var events []*Event
+	var enqueued bool
+	err := o.store.Transaction(func(store storage.Store) error {
+		var err error
+		if events, err = write(store); err != nil {
+			return err
+		}
+		o.events.stamp(events...)
+		enqueued, err = o.enqueueWebhooks(store, events)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	o.emit(events...)
+	if enqueued {
+		select {
+		case o.webhookWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// emit publishes events after the changes committed, and records the users changed for replica clients
+func (o *jwtOAuth) emit(events ...*Event) {
+	for _, ev := range events {
+		switch ev.Type {
+		case EventTokenGenerated, EventTokenRemoved, EventTokenRecovered:
+			// replicas have no tokens
+		default:
+			o.changeLog.record(ev.User, ev.PrevUser)
+		}
+	}
+	o.events.publish(events...)
+}
+
+// SubscribeEvents streams the events after `LastEventID`, or those from now on if it's empty
+func (o *jwtOAuth) SubscribeEvents(ctx context.Context, req *SubscribeEventsReq) (<-chan *Event, error) {
+	if err := permCheck(ctx, core.PermAdmin); err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	types := make(map[EventType]struct{})
+	for _, t := range req.Types {
+		if !isEventType(t) {
+			return nil, errcode.Errorf(errcode.CodeInvalidArgument, "unknown event type %s", t)
+		}
+		types[t] = struct{}{}
+	}
+	filter := func(ev *Event) bool {
+		if _, ok := types[ev.Type]; len(types) != 0 && !ok {
+			return false
+		}
+		return len(req.User) == 0 || ev.User == req.User || ev.PrevUser == req.User
+	}
+	return o.events.subscribe(ctx, req.LastEventID, filter), nil
+}
+
+// CloseEvents ends the event streams, so they don't hold the server shutting down
+func (o *jwtOAuth) CloseEvents() {
+	o.events.close()
+}
@@ -2,12 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gbrlsnchs/jwt/v3"
@@ -17,8 +19,12 @@ import (
 
 	"github.com/filecoin-project/go-address"
 
+	"github.com/ipfs-force-community/sophon-auth/chain"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/replication"
 	"github.com/ipfs-force-community/sophon-auth/storage"
 	"github.com/ipfs-force-community/sophon-auth/util"
 )
@@ -38,8 +44,10 @@ type VerifyAop interface {
 }
 
 type OAuthService interface {
-	GenerateToken(ctx context.Context, cp *JWTPayload) (string, error)
+	GenerateToken(ctx context.Context, cp *JWTPayload, meta *TokenMeta) (string, error)
 	Verify(ctx context.Context, token string) (*JWTPayload, error)
+	VerifyBatch(ctx context.Context, tokens []string) (VerifyBatchResponse, error)
+	VerifyClientCert(ctx context.Context, cert *x509.Certificate) (*JWTPayload, error)
 	RemoveToken(ctx context.Context, token string) error
 	RecoverToken(ctx context.Context, token string) error
 	Tokens(ctx context.Context, skip, limit int64) ([]*TokenInfo, error)
@@ -55,7 +63,15 @@ type OAuthService interface {
 	DeleteUser(ctx context.Context, req *DeleteUserRequest) error
 	RecoverUser(ctx context.Context, req *RecoverUserRequest) error
 
+	CreateOrg(ctx context.Context, req *CreateOrgRequest) (*OutputOrg, error)
+	GetOrg(ctx context.Context, req *GetOrgRequest) (*OutputOrg, error)
+	ListOrgs(ctx context.Context) (ListOrgsResponse, error)
+	DeleteOrg(ctx context.Context, req *DeleteOrgRequest) error
+	ListOrgUsers(ctx context.Context, req *ListOrgUsersRequest) (ListUsersResponse, error)
+	SetOrgMember(ctx context.Context, req *SetOrgMemberRequest) error
+
 	GetUserRateLimits(ctx context.Context, req *GetUserRateLimitsReq) (GetUserRateLimitResponse, error)
+	SetDefaultRateLimit(cnf *config.RateLimitConfig)
 	UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateLimitReq) (string, error)
 	DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error
 
@@ -65,6 +81,8 @@ type OAuthService interface {
 	ListMiners(ctx context.Context, req *ListMinerReq) (ListMinerResp, error)
 	DelMiner(ctx context.Context, req *DelMinerReq) (bool, error)
 	GetUserByMiner(ctx context.Context, req *GetUserByMinerRequest) (*OutputUser, error)
+	TransferMiner(ctx context.Context, req *TransferMinerReq) (*TransferMinerResp, error)
+	UpdateMinerLabels(ctx context.Context, req *UpdateMinerLabelsReq) (*UpdateMinerLabelsResp, error)
 
 	RegisterSigners(ctx context.Context, req *RegisterSignersReq) error
 	SignerExistInUser(ctx context.Context, req *SignerExistInUserReq) (bool, error)
@@ -73,11 +91,94 @@ type OAuthService interface {
 	HasSigner(ctx context.Context, req *HasSignerReq) (bool, error)
 	DelSigner(ctx context.Context, req *DelSignerReq) (bool, error)
 	GetUserBySigner(ctx context.Context, req *GetUserBySignerReq) ([]*OutputUser, error)
+	UpdateSignerPolicy(ctx context.Context, req *UpdateSignerPolicyReq) (*UpdateSignerPolicyResp, error)
+	CheckSignerPolicy(ctx context.Context, req *CheckSignerPolicyReq) (*CheckSignerPolicyResp, error)
+
+	BulkApply(ctx context.Context, req *BulkApplyReq) (*BulkApplyResp, error)
+
+	Reap(ctx context.Context, cnf *config.ReaperConfig) (*ReaperReport, error)
+	ListReaperReports(ctx context.Context) ([]*ReaperReport, error)
+	Purge(ctx context.Context, req *PurgeReq) (*PurgeResp, error)
+
+	// apis of the caller itself
+	GenerateMyToken(ctx context.Context, req *GenerateMyTokenReq) (string, error)
+	UpdateMe(ctx context.Context, req *UpdateMeReq) error
+	RegisterMySigners(ctx context.Context, req *RegisterMySignersReq) error
+	GetMyRateLimits(ctx context.Context) (GetUserRateLimitResponse, error)
+
+	// users with their miners, signers and rate limits for replica clients, see `jwtclient.ReplicaClient`
+	ReplicaSnapshot(ctx context.Context) (*ReplicaSnapshot, error)
+	ReplicaChanges(ctx context.Context, req *ReplicaChangesReq) (*ReplicaChanges, error)
+
+	// streams the changes of entities, the channel is closed when ctx done or the events closed
+	SubscribeEvents(ctx context.Context, req *SubscribeEventsReq) (<-chan *Event, error)
+	CloseEvents()
+
+	// webhooks the events are posted to
+	CreateWebhook(ctx context.Context, req *CreateWebhookReq) (*OutputWebhook, error)
+	UpdateWebhook(ctx context.Context, req *UpdateWebhookReq) (*OutputWebhook, error)
+	GetWebhook(ctx context.Context, req *GetWebhookReq) (*OutputWebhook, error)
+	ListWebhooks(ctx context.Context) (ListWebhooksResp, error)
+	DeleteWebhook(ctx context.Context, req *DeleteWebhookReq) error
+	ListWebhookDeliveries(ctx context.Context, req *ListWebhookDeliveriesReq) (ListWebhookDeliveriesResp, error)
+	// delivers the outbox of webhooks until ctx done, while this node is the leader
+	DeliverWebhooks(ctx context.Context, cnf *config.WebhookConfig)
+
+	// whether this node writes the store, it's always true without replication
+	IsLeader() bool
+	// flushes the usages of tokens and closes the store
+	Close() error
 }
 
 type jwtOAuth struct {
 	store storage.Store
 	mp    Mapper
+	// resolves non-ID miner addresses, nil if no chain node is configured
+	resolver chain.Resolver
+	// what users can do for themselves, nothing beyond the default if nil
+	selfService *config.SelfServiceConfig
+	// usages of tokens are not recorded if nil
+	usage *tokenUsageRecorder
+	// reports of the latest runs of reaper
+	reports *reaperReports
+	// the rate limit of users without a limit of their own
+	rateLimit *defaultRateLimit
+	// permission of requests authenticated by client certificates, they are not accepted if empty
+	clientCertPerm core.Permission
+	// replicates the store among nodes, nil if it's a single node
+	replica *replication.Node
+	// users changed for replica clients, nothing is recorded if nil
+	changeLog *changeLog
+	// the latest events for subscribers, nothing is published if nil
+	events *eventHub
+	// serializes the commits of changes, so the events are published in the order they are stamped
+	commitLk sync.Mutex
+	// wakes up the delivery of webhooks when deliveries enqueued
+	webhookWake chan struct{}
+}
+
+// ServiceOption sets optional dependencies of the service
+type ServiceOption func(*jwtOAuth)
+
+// WithResolver resolves robust and delegated miner addresses to ID addresses through the chain
+func WithResolver(resolver chain.Resolver) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.resolver = resolver
+	}
+}
+
+// WithSelfService sets the policy of the `/me` apis
+func WithSelfService(cnf *config.SelfServiceConfig) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.selfService = cnf
+	}
+}
+
+// WithReplication replicates the store among the nodes, this node writes only if it's the leader
+func WithReplication(node *replication.Node) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.replica = node
+	}
 }
 
 type JWTPayload struct {
@@ -86,7 +187,13 @@ type JWTPayload struct {
 	Extra string          `json:"ext"`
 }
 
-func NewOAuthService(dbPath string, cnf *config.DBConfig) (OAuthService, error) {
+// TokenMeta describes what a token is for, it's stored along with the token but not signed into it
+type TokenMeta struct {
+	Description string            `form:"description" json:"description"`
+	Labels      map[string]string `json:"labels"`
+}
+
+func NewOAuthService(dbPath string, cnf *config.DBConfig, opts ...ServiceOption) (OAuthService, error) {
 	ctx := context.Background()
 	store, err := storage.NewStore(cnf, dbPath)
 	if err != nil {
@@ -128,55 +235,127 @@ func NewOAuthService(dbPath string, cnf *config.DBConfig) (OAuthService, error)
 		core.UserGauge.Set(ctx, state.String(), count)
 	}
 
+	// check records written under another network
+	records, err := store.CheckNetwork()
+	if err != nil {
+		return nil, fmt.Errorf("check network: %w", err)
+	}
+	for _, r := range records {
+		log.Warnf("%s %s of user %s was not written under network %s, it's unreachable", r.Kind, r.Address, r.User, core.CurrentNetwork)
+	}
+	if len(records) != 0 {
+		log.Warnf("found %d miners and signers not written under network %s, check the `network` in config", len(records), core.CurrentNetwork)
+	}
+
 	jwtOAuthInstance = &jwtOAuth{
-		store: store,
-		mp:    newMapper(),
+		store:     store,
+		mp:        newMapper(),
+		usage:     newTokenUsageRecorder(store),
+		reports:   &reaperReports{},
+		rateLimit: &defaultRateLimit{},
+		changeLog: newChangeLog(),
+		events:    newEventHub(),
+		// enqueued ones wait for the current round at most
+		webhookWake: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(jwtOAuthInstance)
+	}
+	if node := jwtOAuthInstance.replica; node != nil {
+		if err := node.Start(store); err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("start replication: %w", err)
+		}
+		// followers write by the leader
+		jwtOAuthInstance.usage.writer = node
 	}
+	jwtOAuthInstance.usage.start()
 	return jwtOAuthInstance, nil
 }
 
-func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload) (string, error) {
-	err := permCheck(ctx, core.PermAdmin)
+// IsLeader whether this node writes the store, it's always true without replication
+func (o *jwtOAuth) IsLeader() bool {
+	return o.replica == nil || o.replica.IsLeader()
+}
+
+// Close flushes the usages of tokens and closes the store, the service shouldn't be used after closed
+func (o *jwtOAuth) Close() error {
+	o.events.close()
+	if o.usage != nil {
+		if err := o.usage.close(); err != nil {
+			log.Warnf("flush usages of tokens failed: %v", err)
+		}
+	}
+	if o.replica != nil {
+		o.replica.Close()
+	}
+	return o.store.Close()
+}
+
+func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload, meta *TokenMeta) (string, error) {
+	err := o.orgAdminCheck(ctx, pl.Name)
 	if err != nil {
-		return "", fmt.Errorf("need admin prem: %w", err)
+		return "", fmt.Errorf("need admin prem or org admin of user %s: %w", pl.Name, err)
+	}
+	// org admins can't grant the admin permission
+	if pl.Perm == core.PermAdmin {
+		if err := permCheck(ctx, core.PermAdmin); err != nil {
+			return "", fmt.Errorf("need admin prem to generate admin token: %w", err)
+		}
 	}
 
+	return o.generateToken(ctx, pl, meta)
+}
+
+func (o *jwtOAuth) generateToken(ctx context.Context, pl *JWTPayload, meta *TokenMeta) (string, error) {
 	exist, err := o.store.HasUser(pl.Name)
 	if err != nil {
 		return "", fmt.Errorf("check user %s exist failed: %w", pl.Name, err)
 	}
 	if !exist {
-		return "", fmt.Errorf("token must be based on an existing user %s to generate", pl.Name)
+		return "", errcode.Errorf(errcode.CodeNotFound, "token must be based on an existing user %s to generate", pl.Name)
 	}
 
-	// one token, one secret
-	secret, err := config.RandSecret()
-	if err != nil {
-		return "", xerrors.Errorf("rand secret %v", err)
-	}
-	tk, err := jwt.Sign(pl, jwt.NewHS256(secret))
+	kp, err := newKeyPair(pl)
 	if err != nil {
-		return core.EmptyString, xerrors.Errorf("gen token failed :%s", err)
+		return core.EmptyString, err
 	}
-	token := storage.Token(tk)
-	has, err := o.store.Has(token)
+	has, err := o.store.Has(kp.Token)
 	if err != nil {
 		return core.EmptyString, err
 	}
 	if has {
-		return token.String(), nil
+		return kp.Token.String(), nil
+	}
+	if meta != nil {
+		kp.Description, kp.Labels = meta.Description, meta.Labels
 	}
 
-	err = o.store.Put(&storage.KeyPair{
-		Token: token, Secret: hex.EncodeToString(secret), CreateTime: time.Now(),
-		Name: pl.Name, Perm: pl.Perm, Extra: pl.Extra, IsDeleted: core.NotDelete,
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventTokenGenerated, User: kp.Name, Perm: kp.Perm}}, store.Put(kp)
 	})
 	if err != nil {
 		return core.EmptyString, xerrors.Errorf("store token failed :%s", err)
 	}
 
 	core.TokenGauge.Inc(ctx, pl.Perm, 1)
-	return token.String(), nil
+	return kp.Token.String(), nil
+}
+
+// newKeyPair signs a new token for payload, one token, one secret
+func newKeyPair(pl *JWTPayload) (*storage.KeyPair, error) {
+	secret, err := config.RandSecret()
+	if err != nil {
+		return nil, xerrors.Errorf("rand secret %v", err)
+	}
+	tk, err := jwt.Sign(pl, jwt.NewHS256(secret))
+	if err != nil {
+		return nil, xerrors.Errorf("gen token failed :%s", err)
+	}
+	return &storage.KeyPair{
+		Token: storage.Token(tk), Secret: hex.EncodeToString(secret), CreateTime: time.Now(),
+		Name: pl.Name, Perm: pl.Perm, Extra: pl.Extra, IsDeleted: core.NotDelete,
+	}, nil
 }
 
 func (o *jwtOAuth) Verify(ctx context.Context, token string) (payload *JWTPayload, err error) {
@@ -207,7 +386,12 @@ func (o *jwtOAuth) Verify(ctx context.Context, token string) (payload *JWTPayloa
 
 	kp, err := o.store.Get(storage.Token(token))
 	if err != nil {
-		err = xerrors.Errorf("get token: %v", err)
+		// a token not in store is not issued by us, the caller is not authenticated
+		if storage.IsNotFound(err) {
+			err = errcode.Errorf(errcode.CodeUnauthenticated, "get token: %v", err)
+		} else {
+			err = xerrors.Errorf("get token: %w", err)
+		}
 		return
 	}
 	secret, err := hex.DecodeString(kp.Secret)
@@ -219,15 +403,51 @@ func (o *jwtOAuth) Verify(ctx context.Context, token string) (payload *JWTPayloa
 		err = ErrorVerificationFailed
 		return
 	}
+	if o.usage != nil {
+		ip, _ := core.CtxGetClientIP(ctx)
+		o.usage.record(kp.Token, ip)
+	}
 	return
 }
 
+// MaxVerifyBatch the most tokens verified in a batch
+const MaxVerifyBatch = 1000
+
+// VerifyBatch verifies the tokens one by one, a token failed doesn't fail the others,
+// its error is in the result along with the code
+func (o *jwtOAuth) VerifyBatch(ctx context.Context, tokens []string) (VerifyBatchResponse, error) {
+	err := permCheck(ctx, core.PermRead)
+	if err != nil {
+		return nil, fmt.Errorf("need read prem: %w", err)
+	}
+	if len(tokens) > MaxVerifyBatch {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "verify %d tokens, at most %d in a batch", len(tokens), MaxVerifyBatch)
+	}
+
+	out := make(VerifyBatchResponse, len(tokens))
+	for idx, token := range tokens {
+		payload, err := o.Verify(ctx, token)
+		if err != nil {
+			out[idx] = &VerifyResult{Error: &errcode.ErrMsg{Error: err.Error(), Code: errorCode(err)}}
+			continue
+		}
+		out[idx] = &VerifyResult{Payload: payload}
+	}
+	return out, nil
+}
+
 type TokenInfo struct {
 	Token      string    `json:"token"`
 	Name       string    `json:"name"`
 	Perm       string    `json:"perm"`
 	Custom     string    `json:"custom"`
 	CreateTime time.Time `json:"createTime"`
+
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	// nil if the token was never used since the usage is recorded
+	LastUsedTime *time.Time `json:"lastUsedTime"`
+	LastUsedIP   string     `json:"lastUsedIP"`
 }
 
 func toTokenInfo(kp *storage.KeyPair) (*TokenInfo, error) {
@@ -236,10 +456,15 @@ func toTokenInfo(kp *storage.KeyPair) (*TokenInfo, error) {
 		return nil, err
 	}
 	return &TokenInfo{
-		Token:      kp.Token.String(),
-		CreateTime: kp.CreateTime,
-		Name:       jwtPayload["name"].(string),
-		Perm:       jwtPayload["perm"].(string),
+		Token:        kp.Token.String(),
+		CreateTime:   kp.CreateTime,
+		Name:         jwtPayload["name"].(string),
+		Perm:         jwtPayload["perm"].(string),
+		Custom:       kp.Extra,
+		Description:  kp.Description,
+		Labels:       kp.Labels,
+		LastUsedTime: kp.LastUsedTime,
+		LastUsedIP:   kp.LastUsedIP,
 	}, nil
 }
 
@@ -257,7 +482,7 @@ func (o *jwtOAuth) GetToken(ctx context.Context, token string) (*TokenInfo, erro
 }
 
 func (o *jwtOAuth) GetTokenByName(ctx context.Context, username string) ([]*TokenInfo, error) {
-	err := userPermCheck(ctx, username)
+	err := o.orgUserPermCheck(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("need admin prem or user %s does not match: %w", username, err)
 	}
@@ -304,12 +529,14 @@ func (o *jwtOAuth) RemoveToken(ctx context.Context, token string) error {
 		return fmt.Errorf("need admin prem or token %s check failed: %w", token, err)
 	}
 
-	err = o.store.Delete(storage.Token(token))
+	payload, _ := DecodeToken(token)
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventTokenRemoved, User: payload.Name, Perm: payload.Perm}}, store.Delete(storage.Token(token))
+	})
 	if err != nil {
 		return fmt.Errorf("remove token %s: %w", token, err)
 	}
 
-	payload, _ := DecodeToken(token)
 	core.TokenGauge.Inc(ctx, payload.Perm, -1)
 	return nil
 }
@@ -320,20 +547,31 @@ func (o *jwtOAuth) RecoverToken(ctx context.Context, token string) error {
 		return fmt.Errorf("need admin prem or token %s check failed: %w", token, err)
 	}
 
-	err = o.store.Recover(storage.Token(token))
+	payload, _ := DecodeToken(token)
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventTokenRecovered, User: payload.Name, Perm: payload.Perm}}, store.Recover(storage.Token(token))
+	})
 	if err != nil {
 		return fmt.Errorf("recover token %s: %w", token, err)
 	}
 
-	payload, _ := DecodeToken(token)
 	core.TokenGauge.Inc(ctx, payload.Perm, 1)
 	return nil
 }
 
 func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error) {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminOf(ctx, req.Org)
 	if err != nil {
-		return nil, fmt.Errorf("need admin prem: %w", err)
+		return nil, fmt.Errorf("need admin prem or org admin of %q: %w", req.Org, err)
+	}
+	if len(req.Org) != 0 {
+		exist, err := o.store.HasOrg(req.Org)
+		if err != nil {
+			return nil, err
+		}
+		if !exist {
+			return nil, errcode.Errorf(errcode.CodeNotFound, "organization %s not exists", req.Org)
+		}
 	}
 
 	exist, err := o.store.HasUser(req.Name)
@@ -341,7 +579,7 @@ func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*Cre
 		return nil, err
 	}
 	if exist {
-		return nil, errors.New("user already exists")
+		return nil, errcode.Errorf(errcode.CodeAlreadyExists, "user already exists")
 	}
 	uid, err := uuid.NewRandom()
 	if err != nil {
@@ -354,11 +592,14 @@ func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*Cre
 		CreateTime: time.Now().Local(),
 		UpdateTime: time.Now().Local(),
 		IsDeleted:  core.NotDelete,
+		Org:        req.Org,
 	}
 	if req.Comment != nil {
 		userNew.Comment = *req.Comment
 	}
-	err = o.store.PutUser(userNew)
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventUserCreated, User: userNew.Name}}, store.PutUser(userNew)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -367,9 +608,9 @@ func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*Cre
 }
 
 func (o *jwtOAuth) UpdateUser(ctx context.Context, req *UpdateUserRequest) error {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return fmt.Errorf("need admin prem: %w", err)
+		return fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
 
 	user, err := o.store.GetUser(req.Name)
@@ -380,10 +621,16 @@ func (o *jwtOAuth) UpdateUser(ctx context.Context, req *UpdateUserRequest) error
 	if req.Comment != nil {
 		user.Comment = *req.Comment
 	}
+	ev := &Event{Type: EventUserUpdated, User: user.Name}
 	if req.State != core.UserStateUndefined {
+		if req.State == core.UserStateDisabled && user.State != core.UserStateDisabled {
+			ev.Type = EventUserDisabled
+		}
 		user.State = req.State
 	}
-	return o.store.UpdateUser(user)
+	return o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{ev}, store.UpdateUser(user)
+	})
 }
 
 func (o *jwtOAuth) VerifyUsers(ctx context.Context, req *VerifyUsersReq) error {
@@ -409,20 +656,22 @@ func (o *jwtOAuth) ListUsers(ctx context.Context, req *ListUsersRequest) (ListUs
 }
 
 func (o *jwtOAuth) HasUser(ctx context.Context, req *HasUserRequest) (bool, error) {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return false, fmt.Errorf("need admin prem: %w", err)
+		return false, fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
 
 	return o.store.HasUser(req.Name)
 }
 
 func (o *jwtOAuth) DeleteUser(ctx context.Context, req *DeleteUserRequest) error {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return fmt.Errorf("need admin prem: %w", err)
+		return fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
-	err = o.store.DeleteUser(req.Name)
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventUserDeleted, User: req.Name}}, store.DeleteUser(req.Name, req.Cascade)
+	})
 	if err != nil {
 		return err
 	}
@@ -435,7 +684,9 @@ func (o *jwtOAuth) RecoverUser(ctx context.Context, req *RecoverUserRequest) err
 	if err != nil {
 		return fmt.Errorf("need admin prem: %w", err)
 	}
-	err = o.store.RecoverUser(req.Name)
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventUserRecovered, User: req.Name}}, store.RecoverUser(req.Name)
+	})
 	if err != nil {
 		return err
 	}
@@ -449,11 +700,17 @@ func (o *jwtOAuth) GetUserByMiner(ctx context.Context, req *GetUserByMinerReques
 		return nil, fmt.Errorf("need admin prem: %w", err)
 	}
 
-	user, err := o.store.GetUserByMiner(req.Miner)
+	miner, err := o.store.GetMiner(o.lookupMiner(ctx, req.Miner))
 	if err != nil {
 		return nil, err
 	}
-	return o.mp.ToOutPutUser(user), nil
+	user, err := o.store.GetUser(miner.User)
+	if err != nil {
+		return nil, err
+	}
+	out := o.mp.ToOutPutUser(user)
+	out.Miners = []*OutputMiner{o.mp.ToOutPutMiner(miner)}
+	return out, nil
 }
 
 func (o *jwtOAuth) GetUserBySigner(ctx context.Context, req *GetUserBySignerReq) ([]*OutputUser, error) {
@@ -462,7 +719,11 @@ func (o *jwtOAuth) GetUserBySigner(ctx context.Context, req *GetUserBySignerReq)
 		return nil, fmt.Errorf("need admin prem: %w", err)
 	}
 
-	users, err := o.store.GetUserBySigner(req.Signer)
+	signer, err := o.signerKeyAddress(ctx, req.Signer)
+	if err != nil {
+		return nil, err
+	}
+	users, err := o.store.GetUserBySigner(signer)
 	if err != nil {
 		return nil, err
 	}
@@ -476,7 +737,7 @@ func (o *jwtOAuth) GetUserBySigner(ctx context.Context, req *GetUserBySignerReq)
 }
 
 func (o *jwtOAuth) GetUser(ctx context.Context, req *GetUserRequest) (*OutputUser, error) {
-	err := userPermCheck(ctx, req.Name)
+	err := o.orgUserPermCheck(ctx, req.Name)
 	if err != nil {
 		return nil, fmt.Errorf("need admin prem or user %s does not match: %w", req.Name, err)
 	}
@@ -488,45 +749,179 @@ func (o *jwtOAuth) GetUser(ctx context.Context, req *GetUserRequest) (*OutputUse
 	return o.mp.ToOutPutUser(user), nil
 }
 
-func (o jwtOAuth) GetUserRateLimits(ctx context.Context, req *GetUserRateLimitsReq) (GetUserRateLimitResponse, error) {
-	err := permCheck(ctx, core.PermAdmin)
+func (o *jwtOAuth) GetUserRateLimits(ctx context.Context, req *GetUserRateLimitsReq) (GetUserRateLimitResponse, error) {
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return nil, fmt.Errorf("need admin prem: %w", err)
+		return nil, fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
 
-	return o.store.GetRateLimits(req.Name, req.Id)
+	limits, err := o.store.GetRateLimits(req.Name, req.Id)
+	if err != nil || len(req.Id) != 0 {
+		return limits, err
+	}
+	return o.rateLimit.fill(req.Name, limits), nil
 }
 
 func (o *jwtOAuth) UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateLimitReq) (string, error) {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return "nil", fmt.Errorf("need admin prem: %w", err)
+		return "nil", fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
 
-	return o.store.PutRateLimit((*storage.UserRateLimit)(req))
+	var id string
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		id, err = store.PutRateLimit((*storage.UserRateLimit)(req))
+		return []*Event{{Type: EventRateLimitChanged, User: req.Name}}, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
 }
 
-func (o jwtOAuth) DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error {
-	err := permCheck(ctx, core.PermAdmin)
+func (o *jwtOAuth) DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error {
+	err := o.orgAdminCheck(ctx, req.Name)
 	if err != nil {
-		return fmt.Errorf("need admin prem: %w", err)
+		return fmt.Errorf("need admin prem or org admin of user %s: %w", req.Name, err)
 	}
 
-	return o.store.DelRateLimit(req.Name, req.Id)
+	return o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventRateLimitChanged, User: req.Name}}, store.DelRateLimit(req.Name, req.Id)
+	})
 }
 
 func (o *jwtOAuth) UpsertMiner(ctx context.Context, req *UpsertMinerReq) (bool, error) {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.User)
 	if err != nil {
-		return false, fmt.Errorf("need admin prem: %w", err)
+		return false, fmt.Errorf("need admin prem or org admin of user %s: %w", req.User, err)
+	}
+
+	mAddr, err := o.resolveMiner(ctx, req.Miner)
+	if err != nil {
+		return false, err
+	}
+
+	// the miner may be taken from another user, who should be managed by the caller too
+	prevOwner := o.minerOwner(mAddr)
+	if len(prevOwner) != 0 && prevOwner != req.User {
+		if err := o.orgAdminCheck(ctx, prevOwner); err != nil {
+			return false, fmt.Errorf("miner %s belongs to user %s, need admin prem or org admin of it: %w", mAddr, prevOwner, err)
+		}
+	}
+	ev := &Event{Type: EventMinerUpserted, User: req.User, Miner: mAddr.String()}
+	if prevOwner != req.User {
+		ev.PrevUser = prevOwner
+	}
+	var isCreate bool
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		isCreate, err = store.UpsertMiner(mAddr, req.User, req.OpenMining)
+		return []*Event{ev}, err
+	})
+	if err != nil {
+		return false, err
+	}
+	return isCreate, nil
+}
+
+// minerOwner returns the name of the user miner belongs to, empty if it's not found
+func (o *jwtOAuth) minerOwner(mAddr address.Address) string {
+	user, err := o.store.GetUserByMiner(mAddr)
+	if err != nil {
+		return ""
+	}
+	return user.Name
+}
+
+// resolveMiner returns the ID address of miner, mappings resolved from chain are cached in store
+func (o *jwtOAuth) resolveMiner(ctx context.Context, mAddr address.Address) (address.Address, error) {
+	if mAddr.Protocol() == address.ID {
+		return mAddr, nil
+	}
+	if mAddr.Protocol() == address.Unknown {
+		return address.Undef, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", mAddr.Protocol())
+	}
+
+	mapping, err := o.store.GetAddressMapping(mAddr)
+	if err == nil {
+		return mapping.IDAddress.Address(), nil
+	}
+	if !errors.Is(err, storage.ErrAddressMappingNotFound) {
+		return address.Undef, err
+	}
+
+	if o.resolver == nil {
+		return address.Undef, errcode.Errorf(errcode.CodeInvalidArgument, "miner %s is not an ID address, configure the chain node in `[chain]` to resolve it", mAddr)
 	}
+	idAddr, err := o.resolver.LookupID(ctx, mAddr)
+	if err != nil {
+		return address.Undef, fmt.Errorf("resolve miner %s: %w", mAddr, err)
+	}
+	if err := o.store.PutAddressMapping(mAddr, idAddr); err != nil {
+		return address.Undef, fmt.Errorf("cache the ID address of miner %s: %w", mAddr, err)
+	}
+	log.Infof("miner %s is resolved to %s", mAddr, idAddr)
+	return idAddr, nil
+}
 
-	mAddr := req.Miner
-	if mAddr.Protocol() != address.ID {
-		return false, fmt.Errorf("invalid protocol type: %v", mAddr.Protocol())
+// lookupMiner returns the address miner is stored by, that's the ID address if it can be resolved,
+// otherwise the address itself, which may be stored before miners are resolved
+func (o *jwtOAuth) lookupMiner(ctx context.Context, mAddr address.Address) address.Address {
+	idAddr, err := o.resolveMiner(ctx, mAddr)
+	if err != nil {
+		log.Debugf("lookup ID address of miner %s: %v", mAddr, err)
+		return mAddr
 	}
+	return idAddr
+}
 
-	return o.store.UpsertMiner(mAddr, req.User, req.OpenMining)
+// aliasSigner caches the ID address of signer, so it can be found by the ID address as well.
+// A key without actor on chain can't be resolved yet, it's resolved by `signerKeyAddress` later.
+func (o *jwtOAuth) aliasSigner(ctx context.Context, signer address.Address) {
+	if o.resolver == nil {
+		return
+	}
+	if _, err := o.store.GetAddressMapping(signer); err == nil {
+		return
+	}
+	idAddr, err := o.resolver.LookupID(ctx, signer)
+	if err != nil {
+		log.Warnf("resolve ID address of signer %s: %v", signer, err)
+		return
+	}
+	if err := o.store.PutAddressMapping(signer, idAddr); err != nil {
+		log.Warnf("cache the ID address of signer %s: %v", signer, err)
+	}
+}
+
+// signerKeyAddress returns the key address of an ID address, or the ID address if it's unknown,
+// other addresses are returned as-is
+func (o *jwtOAuth) signerKeyAddress(ctx context.Context, addr address.Address) (address.Address, error) {
+	if addr.Protocol() != address.ID {
+		return addr, nil
+	}
+
+	mapping, err := o.store.GetAddressMapping(addr)
+	if err == nil {
+		return mapping.Address.Address(), nil
+	}
+	if !errors.Is(err, storage.ErrAddressMappingNotFound) {
+		return address.Undef, err
+	}
+
+	if o.resolver == nil {
+		return addr, nil
+	}
+	key, err := o.resolver.AccountKey(ctx, addr)
+	if err != nil {
+		log.Debugf("resolve key address of %s: %v", addr, err)
+		return addr, nil
+	}
+	if err := o.store.PutAddressMapping(key, addr); err != nil {
+		return address.Undef, fmt.Errorf("cache the key address of %s: %w", addr, err)
+	}
+	return key, nil
 }
 
 func (o *jwtOAuth) HasMiner(ctx context.Context, req *HasMinerRequest) (bool, error) {
@@ -535,7 +930,7 @@ func (o *jwtOAuth) HasMiner(ctx context.Context, req *HasMinerRequest) (bool, er
 		return false, fmt.Errorf("need admin prem: %w", err)
 	}
 
-	has, err := o.store.HasMiner(req.Miner)
+	has, err := o.store.HasMiner(o.lookupMiner(ctx, req.Miner))
 	if err != nil {
 		return false, err
 	}
@@ -543,12 +938,12 @@ func (o *jwtOAuth) HasMiner(ctx context.Context, req *HasMinerRequest) (bool, er
 }
 
 func (o *jwtOAuth) MinerExistInUser(ctx context.Context, req *MinerExistInUserRequest) (bool, error) {
-	err := userPermCheck(ctx, req.User)
+	err := o.orgUserPermCheck(ctx, req.User)
 	if err != nil {
 		return false, fmt.Errorf("need admin prem or user %s does not match: %w", req.User, err)
 	}
 
-	exist, err := o.store.MinerExistInUser(req.Miner, req.User)
+	exist, err := o.store.MinerExistInUser(o.lookupMiner(ctx, req.Miner), req.User)
 	if err != nil {
 		return false, err
 	}
@@ -556,7 +951,7 @@ func (o *jwtOAuth) MinerExistInUser(ctx context.Context, req *MinerExistInUserRe
 }
 
 func (o *jwtOAuth) ListMiners(ctx context.Context, req *ListMinerReq) (ListMinerResp, error) {
-	err := userPermCheck(ctx, req.User)
+	err := o.orgUserPermCheck(ctx, req.User)
 	if err != nil {
 		return nil, fmt.Errorf("need admin prem or user %s does not match: %w", req.User, err)
 	}
@@ -566,57 +961,153 @@ func (o *jwtOAuth) ListMiners(ctx context.Context, req *ListMinerReq) (ListMiner
 		return nil, xerrors.Errorf("list user:%s miners failed:%w", req.User, err)
 	}
 
-	outs := make([]*OutputMiner, len(miners))
-	for idx, m := range miners {
-		outs[idx] = &OutputMiner{
-			Miner:      m.Miner.Address(),
-			User:       m.User,
-			OpenMining: *m.OpenMining,
-			CreatedAt:  m.CreatedAt,
-			UpdatedAt:  m.UpdatedAt,
+	outs := make([]*OutputMiner, 0, len(miners))
+	for _, m := range miners {
+		if !m.Labels.Match(req.Labels) {
+			continue
 		}
+		outs = append(outs, o.mp.ToOutPutMiner(m))
 	}
 	return outs, nil
 }
 
-func (o jwtOAuth) DelMiner(ctx context.Context, req *DelMinerReq) (bool, error) {
+func (o *jwtOAuth) DelMiner(ctx context.Context, req *DelMinerReq) (bool, error) {
+	mAddr := o.lookupMiner(ctx, req.Miner)
 	if permCheck(ctx, core.PermAdmin) != nil {
-		if err := ownerOfMinerCheck(ctx, o.store, req.Miner); err != nil {
+		if err := ownerOfMinerCheck(ctx, o.store, mAddr); err != nil {
 			return false, fmt.Errorf("need admin prem or %s ownership check error: %w", req.Miner, err)
 		}
 	}
 
-	return o.store.DelMiner(req.Miner)
+	owner := o.minerOwner(mAddr)
+	var has bool
+	err := o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		if has, err = store.DelMiner(mAddr); err != nil || !has || len(owner) == 0 {
+			return nil, err
+		}
+		return []*Event{{Type: EventMinerDeleted, User: owner, Miner: mAddr.String()}}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+func (o *jwtOAuth) TransferMiner(ctx context.Context, req *TransferMinerReq) (*TransferMinerResp, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if req.From == req.To {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "can't transfer miner %s from user %s to itself", req.Miner, req.To)
+	}
+
+	// the transfer must be confirmed by the current owner if a confirm token provided
+	if len(req.ConfirmToken) != 0 {
+		payload, err := o.Verify(ctx, req.ConfirmToken)
+		if err != nil {
+			return nil, fmt.Errorf("verify confirm token: %w", err)
+		}
+		if payload.Name != req.From {
+			return nil, fmt.Errorf("confirm token not belongs to user %s: %w", req.From, ErrorPermissionDeny)
+		}
+	}
+
+	mAddr := o.lookupMiner(ctx, req.Miner)
+	var prev *storage.Miner
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		prev, err = store.TransferMiner(mAddr, req.From, req.To)
+		return []*Event{{Type: EventMinerUpserted, User: req.To, PrevUser: req.From, Miner: mAddr.String()}}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog(ctx, "transferMiner", log.Fields{
+		core.FieldMiner: mAddr.String(),
+		core.FieldFrom:  req.From,
+		core.FieldTo:    req.To,
+	})
+	return o.mp.ToOutPutMiner(prev), nil
 }
 
-func (o *jwtOAuth) RegisterSigners(ctx context.Context, req *RegisterSignersReq) error {
+func (o *jwtOAuth) UpdateMinerLabels(ctx context.Context, req *UpdateMinerLabelsReq) (*UpdateMinerLabelsResp, error) {
 	err := permCheck(ctx, core.PermAdmin)
 	if err != nil {
-		return fmt.Errorf("need admin prem: %w", err)
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if err := checkMinerLabels(req.Set); err != nil {
+		return nil, err
+	}
+	mAddr := o.lookupMiner(ctx, req.Miner)
+	var miner *storage.Miner
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		if miner, err = store.UpdateMinerLabels(mAddr, req.Set, req.Unset); err != nil {
+			return nil, err
+		}
+		return []*Event{{Type: EventMinerUpserted, User: miner.User, Miner: mAddr.String()}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.mp.ToOutPutMiner(miner), nil
+}
+
+func checkMinerLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if len(k) == 0 || strings.ContainsAny(k, "=,") {
+			return errcode.Errorf(errcode.CodeInvalidArgument, "invalid label key %q", k)
+		}
+		if core.IsMinerFlag(k) && v != "true" && v != "false" {
+			return errcode.Errorf(errcode.CodeInvalidArgument, "value of flag %s must be true or false, got %q", k, v)
+		}
+	}
+	return nil
+}
+
+func (o *jwtOAuth) RegisterSigners(ctx context.Context, req *RegisterSignersReq) error {
+	err := o.orgAdminCheck(ctx, req.User)
+	if err != nil {
+		return fmt.Errorf("need admin prem or org admin of user %s: %w", req.User, err)
 	}
 
 	for _, signer := range req.Signers {
 		if !IsSignerAddress(signer) {
-			return fmt.Errorf("invalid protocol type: %v", signer.Protocol())
+			return errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", signer.Protocol())
 		}
 
-		err := o.store.RegisterSigner(signer, req.User)
+		err := o.commit(func(store storage.Store) ([]*Event, error) {
+			return []*Event{{Type: EventSignerRegistered, User: req.User, Signer: signer.String()}}, store.RegisterSigner(signer, req.User)
+		})
 		if err != nil {
 			return fmt.Errorf("unregister signer:%s, error: %w", signer, err)
 		}
+		o.aliasSigner(ctx, signer)
 	}
 
 	return nil
 }
 
 func (o *jwtOAuth) SignerExistInUser(ctx context.Context, req *SignerExistInUserReq) (bool, error) {
-	if err := userPermCheck(ctx, req.User); err != nil {
+	if err := o.orgUserPermCheck(ctx, req.User); err != nil {
 		return false, fmt.Errorf("need admin prem or user %s does not match: %w", req.User, err)
 	}
 
-	addr := req.Signer
+	addr, err := o.signerKeyAddress(ctx, req.Signer)
+	if err != nil {
+		return false, err
+	}
+	// the key of an ID address is unknown
+	if addr.Protocol() == address.ID {
+		return false, nil
+	}
 	if !IsSignerAddress(addr) {
-		return false, fmt.Errorf("invalid protocol type: %v", addr.Protocol())
+		return false, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", addr.Protocol())
 	}
 
 	has, err := o.store.SignerExistInUser(addr, req.User)
@@ -627,7 +1118,7 @@ func (o *jwtOAuth) SignerExistInUser(ctx context.Context, req *SignerExistInUser
 }
 
 func (o *jwtOAuth) ListSigner(ctx context.Context, req *ListSignerReq) (ListSignerResp, error) {
-	if err := userPermCheck(ctx, req.User); err != nil {
+	if err := o.orgUserPermCheck(ctx, req.User); err != nil {
 		return nil, fmt.Errorf("need admin prem or user %s does not match: %w", req.User, err)
 	}
 
@@ -638,28 +1129,25 @@ func (o *jwtOAuth) ListSigner(ctx context.Context, req *ListSignerReq) (ListSign
 
 	outs := make([]*OutputSigner, len(signers))
 	for idx, m := range signers {
-		outs[idx] = &OutputSigner{
-			Signer:    m.Signer.Address(),
-			User:      m.User,
-			CreatedAt: m.CreatedAt,
-			UpdatedAt: m.UpdatedAt,
-		}
+		outs[idx] = o.mp.ToOutPutSigner(m)
 	}
 	return outs, nil
 }
 
 func (o *jwtOAuth) UnregisterSigners(ctx context.Context, req *UnregisterSignersReq) error {
-	err := permCheck(ctx, core.PermAdmin)
+	err := o.orgAdminCheck(ctx, req.User)
 	if err != nil {
-		return fmt.Errorf("need admin prem: %w", err)
+		return fmt.Errorf("need admin prem or org admin of user %s: %w", req.User, err)
 	}
 
 	for _, signer := range req.Signers {
 		if !IsSignerAddress(signer) {
-			return fmt.Errorf("invalid protocol type: %v", signer.Protocol())
+			return errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", signer.Protocol())
 		}
 
-		err := o.store.UnregisterSigner(signer, req.User)
+		err := o.commit(func(store storage.Store) ([]*Event, error) {
+			return []*Event{{Type: EventSignerUnregistered, User: req.User, Signer: signer.String()}}, store.UnregisterSigner(signer, req.User)
+		})
 		if err != nil {
 			return fmt.Errorf("unregister signer:%s, error: %w", signer, err)
 		}
@@ -668,7 +1156,7 @@ func (o *jwtOAuth) UnregisterSigners(ctx context.Context, req *UnregisterSigners
 	return nil
 }
 
-func (o jwtOAuth) HasSigner(ctx context.Context, req *HasSignerReq) (bool, error) {
+func (o *jwtOAuth) HasSigner(ctx context.Context, req *HasSignerReq) (bool, error) {
 	err := permCheck(ctx, core.PermAdmin)
 	if err != nil {
 		return false, fmt.Errorf("need admin prem: %w", err)
@@ -676,13 +1164,13 @@ func (o jwtOAuth) HasSigner(ctx context.Context, req *HasSignerReq) (bool, error
 
 	addr := req.Signer
 	if !IsSignerAddress(addr) {
-		return false, fmt.Errorf("invalid protocol type: %v", addr.Protocol())
+		return false, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", addr.Protocol())
 	}
 
 	return o.store.HasSigner(addr)
 }
 
-func (o jwtOAuth) DelSigner(ctx context.Context, req *DelSignerReq) (bool, error) {
+func (o *jwtOAuth) DelSigner(ctx context.Context, req *DelSignerReq) (bool, error) {
 	addr := req.Signer
 	err := permCheck(ctx, core.PermAdmin)
 	if err != nil {
@@ -691,7 +1179,110 @@ func (o jwtOAuth) DelSigner(ctx context.Context, req *DelSignerReq) (bool, error
 		}
 	}
 
-	return o.store.DelSigner(addr)
+	var owners []string
+	if users, err := o.store.GetUserBySigner(addr); err == nil {
+		for _, user := range users {
+			owners = append(owners, user.Name)
+		}
+	}
+	events := make([]*Event, 0, len(owners))
+	for _, owner := range owners {
+		events = append(events, &Event{Type: EventSignerUnregistered, User: owner, Signer: addr.String()})
+	}
+	var has bool
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		has, err = store.DelSigner(addr)
+		return events, err
+	})
+	if err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+func (o *jwtOAuth) UpdateSignerPolicy(ctx context.Context, req *UpdateSignerPolicyReq) (*UpdateSignerPolicyResp, error) {
+	err := o.orgAdminCheck(ctx, req.User)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem or org admin of user %s: %w", req.User, err)
+	}
+
+	if err := checkSignerPolicy(req.Policy); err != nil {
+		return nil, err
+	}
+	var signer *storage.Signer
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		var err error
+		signer, err = store.UpdateSignerOfUser(req.Signer, req.User, func(signer *storage.Signer) error {
+			signer.Policy = req.Policy
+			return nil
+		})
+		return []*Event{{Type: EventSignerUpdated, User: req.User, Signer: req.Signer.String()}}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog(ctx, "updateSignerPolicy", log.Fields{
+		core.FieldSigner: req.Signer.String(),
+		core.FieldName:   req.User,
+		"policy":         req.Policy,
+	})
+	return o.mp.ToOutPutSigner(signer), nil
+}
+
+// CheckSignerPolicy checks whether the user is allowed to sign the message by the signer,
+// the value of an allowed message is counted in the daily spending of the signer unless `req.DryRun`,
+// so it should be called once for a message to sign.
+func (o *jwtOAuth) CheckSignerPolicy(ctx context.Context, req *CheckSignerPolicyReq) (*CheckSignerPolicyResp, error) {
+	if err := o.orgUserPermCheck(ctx, req.User); err != nil {
+		return nil, fmt.Errorf("need admin prem or user %s does not match: %w", req.User, err)
+	}
+
+	addr, err := o.signerKeyAddress(ctx, req.Signer)
+	if err != nil {
+		return nil, err
+	}
+	// the key of an ID address is unknown, so is the signer
+	if addr.Protocol() != address.ID && !IsSignerAddress(addr) {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", addr.Protocol())
+	}
+	value, err := parseAttoFIL(req.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+
+	has := false
+	if addr.Protocol() != address.ID {
+		if has, err = o.store.SignerExistInUser(addr, req.User); err != nil {
+			return nil, err
+		}
+	}
+	if !has {
+		return &CheckSignerPolicyResp{Reason: fmt.Sprintf("signer %s not exist in user %s", req.Signer, req.User)}, nil
+	}
+
+	res := &CheckSignerPolicyResp{Allowed: true}
+	_, err = o.store.UpdateSignerOfUser(addr, req.User, func(signer *storage.Signer) error {
+		spent, reason := evalSignerPolicy(signer, req.Method, value, time.Now())
+		if len(reason) != 0 {
+			res.Allowed, res.Reason = false, reason
+			return errSkipUpdate
+		}
+		if spent == nil || req.DryRun {
+			return errSkipUpdate
+		}
+		signer.Spent = spent
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSkipUpdate) {
+		return nil, err
+	}
+	if err == nil {
+		// the spent of signer changed
+		o.changeLog.record(req.User)
+	}
+	return res, nil
 }
 
 func DecodeToBytes(enc []byte) ([]byte, error) {
@@ -706,7 +1297,7 @@ func DecodeToBytes(enc []byte) ([]byte, error) {
 func JwtUserFromToken(token string) (string, error) {
 	sks := strings.Split(token, ".")
 	if len(sks) < 2 {
-		return "", fmt.Errorf("can't parse user from input token")
+		return "", errcode.Errorf(errcode.CodeInvalidArgument, "can't parse user from input token")
 	}
 	dec, err := DecodeToBytes([]byte(sks[1]))
 	if err != nil {
@@ -721,7 +1312,7 @@ func JwtUserFromToken(token string) (string, error) {
 func DecodeToken(token string) (*JWTPayload, error) {
 	sks := strings.Split(token, ".")
 	if len(sks) < 2 {
-		return nil, fmt.Errorf("can't parse user from input token")
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "can't parse user from input token")
 	}
 	dec, err := DecodeToBytes([]byte(sks[1]))
 	if err != nil {
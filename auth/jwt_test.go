@@ -6,10 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,9 +22,12 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/golang/mock/gomock"
 
+	"github.com/ipfs-force-community/sophon-auth/chain/mocks"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
@@ -52,6 +60,7 @@ func TestJwt(t *testing.T) {
 	t.Run("generate token", testGenerateToken)
 	// stm: @VENUSAUTH_JWT_VERIFY_TOKEN_001, @VENUSAUTH_JWT_VERIFY_TOKEN_002
 	t.Run("verify token", testVerifyToken)
+	t.Run("verify tokens in batch", testVerifyBatch)
 	// stm: @VENUSAUTH_JWT_GET_TOKEN_001, @VENUSAUTH_JWT_GET_TOKEN_002
 	t.Run("get token", testGetToken)
 	// stm: @VENUSAUTH_JWT_GET_TOKEN_BY_NAME_001, @VENUSAUTH_JWT_GET_TOKEN_BY_NAME_002
@@ -60,6 +69,7 @@ func TestJwt(t *testing.T) {
 	t.Run("list all tokens", testTokenList)
 	// stm: @VENUSAUTH_JWT_REMOVE_TOKEN_001, @VENUSAUTH_JWT_RECOVER_TOKEN_001, @VENUSAUTH_JWT_RECOVER_TOKEN_003
 	t.Run("remove and recover tokens", testRemoveAndRecoverToken)
+	t.Run("token meta and usage", testTokenMetaAndUsage)
 	// Features about users
 	// stm: @VENUSAUTH_JWT_CREATE_USER_001, @VENUSAUTH_JWT_CREATE_USER_003
 	t.Run("test create user", func(t *testing.T) { testCreateUser(t, userMiners) })
@@ -84,6 +94,9 @@ func TestJwt(t *testing.T) {
 	t.Run("test get user by miner", func(t *testing.T) { testGetUserByMiner(t, userMiners) })
 	// stm: @VENUSAUTH_JWT_DELETE_MINER_001, @VENUSAUTH_JWT_DELETE_MINER_002
 	t.Run("test delete miner", func(t *testing.T) { testDeleteMiner(t, userMiners) })
+	t.Run("test transfer miner", func(t *testing.T) { testTransferMiner(t, userMiners) })
+	t.Run("test update miner labels", func(t *testing.T) { testUpdateMinerLabels(t, userMiners) })
+	t.Run("test upsert miner with resolver", testUpsertMinerResolve)
 
 	// Features about signers
 	userSigners := map[string][]string{
@@ -99,6 +112,8 @@ func TestJwt(t *testing.T) {
 	t.Run("test get user by signer", func(t *testing.T) { testGetUserBySigner(t, userSigners) })
 	t.Run("test unregister signer", func(t *testing.T) { testUnregisterSigner(t, userSigners) })
 	t.Run("test delete signer", func(t *testing.T) { testDeleteSigner(t, userSigners) })
+	t.Run("test signer policy", func(t *testing.T) { testSignerPolicy(t, userSigners) })
+	t.Run("test signer id alias", testSignerIDAlias)
 
 	// Features about rate limits
 	// stm: @VENUSAUTH_JWT_UPSERT_USER_RATE_LIMITS_001
@@ -106,6 +121,19 @@ func TestJwt(t *testing.T) {
 	t.Run("test get rate limit", func(t *testing.T) { testGetUserRateLimits(t, userMiners, originLimits) })
 	// stm: @VENUSAUTH_JWT_DELETE_USER_RATE_LIMITS_001
 	t.Run("test delete rate limit", func(t *testing.T) { testDeleteUserRateLimits(t, userMiners, originLimits) })
+
+	t.Run("test bulk apply", func(t *testing.T) { testBulkApply(t, userMiners, userSigners) })
+	t.Run("test bulk apply with prune", func(t *testing.T) { testBulkApplyPrune(t, userSigners) })
+	t.Run("test reconcile", testReconcile)
+	t.Run("test organization", testOrg)
+	t.Run("test self service", testSelfService)
+	t.Run("test reaper", testReaper)
+	t.Run("test purge", testPurge)
+	t.Run("test cascade delete user", testCascadeDeleteUser)
+	t.Run("test default rate limit", testDefaultRateLimit)
+	t.Run("test replica changes", testReplicaChanges)
+	t.Run("test events", testEvents)
+	t.Run("test webhooks", testWebhooks)
 }
 
 func testGenerateToken(t *testing.T) {
@@ -119,7 +147,7 @@ func testGenerateToken(t *testing.T) {
 		Extra: "",
 	}
 
-	_, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	_, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.NotNil(t, err)
 	require.Contains(t, err.Error(), "token must be based on an existing user")
 
@@ -130,11 +158,11 @@ func testGenerateToken(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(strings.Split(token, ".")))
 
-	_, err = jwtOAuthInstance.GenerateToken(signCtx, pl1)
+	_, err = jwtOAuthInstance.GenerateToken(signCtx, pl1, nil)
 	assert.True(t, errors.Is(err, ErrorPermissionDeny))
 }
 
@@ -157,7 +185,7 @@ func testVerifyToken(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 
 	// Verify a valid token
@@ -175,6 +203,44 @@ func testVerifyToken(t *testing.T) {
 	assert.Equal(t, ErrorPermissionNotFound, errors.Unwrap(err))
 }
 
+func testVerifyBatch(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-batch-01"})
+	assert.Nil(t, err)
+	payloads := []*JWTPayload{{Name: "test-batch-01", Perm: core.PermSign}, {Name: "test-batch-01", Perm: core.PermRead}}
+	tokens := make([]string, 0, len(payloads))
+	for _, pl := range payloads {
+		token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl, nil)
+		assert.Nil(t, err)
+		tokens = append(tokens, token)
+	}
+	removed := tokens[1]
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(adminCtx, removed))
+
+	// a token failed doesn't fail the others
+	res, err := jwtOAuthInstance.VerifyBatch(readCtx, []string{tokens[0], "I'm just an invalid token", removed, tokens[0]})
+	assert.Nil(t, err)
+	assert.Len(t, res, 4)
+	assert.Equal(t, payloads[0], res[0].Payload)
+	assert.Nil(t, res[0].Error)
+	assert.Nil(t, res[1].Payload)
+	assert.NotEmpty(t, res[1].Error.Error)
+	assert.Nil(t, res[2].Payload)
+	assert.Equal(t, errcode.CodeUnauthenticated, res[2].Error.Code)
+	assert.Equal(t, payloads[0], res[3].Payload)
+
+	res, err = jwtOAuthInstance.VerifyBatch(readCtx, nil)
+	assert.Nil(t, err)
+	assert.Len(t, res, 0)
+	_, err = jwtOAuthInstance.VerifyBatch(readCtx, make([]string, MaxVerifyBatch+1))
+	assert.True(t, errors.Is(err, errcode.ErrInvalidArgument))
+	_, err = jwtOAuthInstance.VerifyBatch(context.Background(), tokens)
+	assert.Equal(t, ErrorPermissionNotFound, errors.Unwrap(err))
+}
+
 func testGetToken(t *testing.T) {
 	cfg := config.DBConfig{Type: "badger"}
 	setup(&cfg, t)
@@ -194,7 +260,7 @@ func testGetToken(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 
 	// Get token
@@ -234,7 +300,7 @@ func testGetTokenByName(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 	userCtx := ctxWithUserNameAndAdminPerm(pl1.Name)
 
@@ -286,7 +352,7 @@ func testTokenList(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	_, err = jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	_, err = jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 	createUserReq = &CreateUserRequest{
 		Name:  "test-token-02",
@@ -295,7 +361,7 @@ func testTokenList(t *testing.T) {
 	resp, err = jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-02", resp.Name)
-	_, err = jwtOAuthInstance.GenerateToken(adminCtx, pl2)
+	_, err = jwtOAuthInstance.GenerateToken(adminCtx, pl2, nil)
 	assert.Nil(t, err)
 
 	allTokenInfos, err := jwtOAuthInstance.Tokens(adminCtx, 0, 2)
@@ -341,7 +407,7 @@ func testRemoveAndRecoverToken(t *testing.T) {
 	resp, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
 	assert.Nil(t, err)
 	assert.Equal(t, "test-token-01", resp.Name)
-	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl1, nil)
 	assert.Nil(t, err)
 
 	validPermTest := func(ctx context.Context) {
@@ -661,7 +727,7 @@ func testUpsertMiner(t *testing.T, userMiners map[string][]string) {
 		Miner: mAddr,
 	})
 	assert.NotNil(t, err)
-	require.Contains(t, err.Error(), "invalid protocol type")
+	require.Contains(t, err.Error(), "is not an ID address")
 
 	// with signCtx
 	_, err = jwtOAuthInstance.UpsertMiner(signCtx, &UpsertMinerReq{User: "user_01", Miner: mAddr})
@@ -832,6 +898,324 @@ func testDeleteMiner(t *testing.T, userMiners map[string][]string) {
 	assert.False(t, deleted)
 }
 
+func testTransferMiner(t *testing.T, userMiners map[string][]string) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+	addUsersAndMiners(t, userMiners)
+
+	from, to := "test_user_001", "test_user_002"
+	mAddr, err := address.NewFromString(userMiners[from][0])
+	assert.Nil(t, err)
+
+	// with ctx no perm
+	_, err = jwtOAuthInstance.TransferMiner(signCtx, &TransferMinerReq{Miner: mAddr, From: from, To: to})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// same user
+	_, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: mAddr, From: from, To: from})
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	// confirm token of another user
+	toToken, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: to, Perm: core.PermRead}, nil)
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: mAddr, From: from, To: to, ConfirmToken: toToken})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	fromToken, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: from, Perm: core.PermRead}, nil)
+	assert.Nil(t, err)
+	prev, err := jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: mAddr, From: from, To: to, ConfirmToken: fromToken})
+	assert.Nil(t, err)
+	assert.Equal(t, from, prev.User)
+	assert.Equal(t, mAddr, prev.Miner)
+	assert.True(t, prev.OpenMining)
+
+	user, err := jwtOAuthInstance.GetUserByMiner(adminCtx, &GetUserByMinerRequest{Miner: mAddr})
+	assert.Nil(t, err)
+	assert.Equal(t, to, user.Name)
+
+	// without confirm token
+	prev, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: mAddr, From: to, To: from})
+	assert.Nil(t, err)
+	assert.Equal(t, to, prev.User)
+
+	// miner not belongs to `from`
+	_, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: mAddr, From: to, To: from})
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+}
+
+func testUpsertMinerResolve(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	userName := "test_user_resolve"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: userName, State: core.UserStateEnabled})
+	assert.Nil(t, err)
+
+	robust, err := address.NewFromString("t3wylwd6pclppme4qmbgwled5xpsbgwgqbn2alxa7yahg2gnbfkipsdv6m764xm5coizujmwdmkxeugplmorha")
+	assert.Nil(t, err)
+	idAddr, err := address.NewFromString("t01888")
+	assert.Nil(t, err)
+	openMining := true
+
+	// no resolver
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: userName, Miner: robust, OpenMining: &openMining})
+	assert.Error(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	resolver := mocks.NewMockResolver(ctrl)
+	jwtOAuthInstance.resolver = resolver
+	defer func() { jwtOAuthInstance.resolver = nil }()
+
+	// resolver error is returned
+	unknown, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	resolver.EXPECT().LookupID(gomock.Any(), unknown).Return(address.Undef, errors.New("actor not found")).Times(1)
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: userName, Miner: unknown, OpenMining: &openMining})
+	assert.Error(t, err)
+
+	// resolved once, the mapping is cached afterward
+	resolver.EXPECT().LookupID(gomock.Any(), robust).Return(idAddr, nil).Times(1)
+	for i := 0; i < 2; i++ {
+		_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: userName, Miner: robust, OpenMining: &openMining})
+		assert.Nil(t, err)
+	}
+
+	exist, err := jwtOAuthInstance.MinerExistInUser(adminCtx, &MinerExistInUserRequest{User: userName, Miner: idAddr})
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	// the miner is found by both addresses through the cached mapping
+	exist, err = jwtOAuthInstance.MinerExistInUser(adminCtx, &MinerExistInUserRequest{User: userName, Miner: robust})
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	has, err := jwtOAuthInstance.HasMiner(adminCtx, &HasMinerRequest{Miner: robust})
+	assert.Nil(t, err)
+	assert.True(t, has)
+	user, err := jwtOAuthInstance.GetUserByMiner(adminCtx, &GetUserByMinerRequest{Miner: robust})
+	assert.Nil(t, err)
+	assert.Equal(t, userName, user.Name)
+	require.Len(t, user.Miners, 1)
+	assert.Equal(t, idAddr, user.Miners[0].Miner)
+
+	miner, err := jwtOAuthInstance.UpdateMinerLabels(adminCtx, &UpdateMinerLabelsReq{Miner: robust, Set: map[string]string{"region": "east"}})
+	assert.Nil(t, err)
+	assert.Equal(t, idAddr, miner.Miner)
+
+	otherName := "test_user_resolve_other"
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: otherName, State: core.UserStateEnabled})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: robust, From: userName, To: otherName})
+	assert.Nil(t, err)
+	exist, err = jwtOAuthInstance.MinerExistInUser(adminCtx, &MinerExistInUserRequest{User: otherName, Miner: idAddr})
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	// the manifest declares the miner by the robust address, it's resolved and nothing changes
+	res, err := jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: Manifest{Users: []*ManifestUser{
+		{Name: otherName, Miners: []*ManifestMiner{{Miner: robust.String(), Labels: map[string]string{"region": "east"}}}},
+	}}})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 0)
+	_, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: Manifest{Users: []*ManifestUser{
+		{Name: userName, Miners: []*ManifestMiner{{Miner: idAddr.String()}}},
+		{Name: otherName, Miners: []*ManifestMiner{{Miner: robust.String()}}},
+	}}, DryRun: true})
+	code, _ := errcode.CodeOf(err)
+	assert.Equal(t, errcode.CodeInvalidArgument, code)
+
+	deleted, err := jwtOAuthInstance.DelMiner(adminCtx, &DelMinerReq{Miner: robust})
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	has, err = jwtOAuthInstance.HasMiner(adminCtx, &HasMinerRequest{Miner: idAddr})
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	// an address can't be resolved is looked up as is
+	resolver.EXPECT().LookupID(gomock.Any(), unknown).Return(address.Undef, errors.New("actor not found")).Times(1)
+	has, err = jwtOAuthInstance.HasMiner(adminCtx, &HasMinerRequest{Miner: unknown})
+	assert.Nil(t, err)
+	assert.False(t, has)
+}
+
+func testSignerIDAlias(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	userName := "test_user_alias"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: userName, State: core.UserStateEnabled})
+	assert.Nil(t, err)
+
+	unfunded, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	funded, err := address.NewFromString("t15rynkupqyfx5ebvaishg7duutwb5ooq2qpaikua")
+	assert.Nil(t, err)
+	unfundedID, err := address.NewFromString("t01001")
+	assert.Nil(t, err)
+	fundedID, err := address.NewFromString("t01002")
+	assert.Nil(t, err)
+
+	// ID address is unknown without resolver
+	exist, err := jwtOAuthInstance.SignerExistInUser(adminCtx, &SignerExistInUserReq{User: userName, Signer: fundedID})
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	resolver := mocks.NewMockResolver(ctrl)
+	jwtOAuthInstance.resolver = resolver
+
+	// the unfunded key has no actor when it's registered
+	resolver.EXPECT().LookupID(gomock.Any(), unfunded).Return(address.Undef, errors.New("actor not found")).Times(1)
+	resolver.EXPECT().LookupID(gomock.Any(), funded).Return(fundedID, nil).Times(1)
+	err = jwtOAuthInstance.RegisterSigners(adminCtx, &RegisterSignersReq{User: userName, Signers: []address.Address{unfunded, funded}})
+	assert.Nil(t, err)
+
+	exist, err = jwtOAuthInstance.SignerExistInUser(adminCtx, &SignerExistInUserReq{User: userName, Signer: fundedID})
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	users, err := jwtOAuthInstance.GetUserBySigner(adminCtx, &GetUserBySignerReq{Signer: fundedID})
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+
+	// the policy of the key address applies to the ID address
+	_, err = jwtOAuthInstance.UpdateSignerPolicy(adminCtx, &UpdateSignerPolicyReq{User: userName, Signer: funded,
+		Policy: &storage.SignerPolicy{MaxValue: "100"}})
+	assert.Nil(t, err)
+	res, err := jwtOAuthInstance.CheckSignerPolicy(adminCtx, &CheckSignerPolicyReq{User: userName, Signer: fundedID, Value: "101"})
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Contains(t, res.Reason, "exceeds max value")
+	res, err = jwtOAuthInstance.CheckSignerPolicy(adminCtx, &CheckSignerPolicyReq{User: userName, Signer: fundedID, Value: "100"})
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+
+	// resolved from chain once, then cached
+	resolver.EXPECT().AccountKey(gomock.Any(), unfundedID).Return(unfunded, nil).Times(1)
+	for i := 0; i < 2; i++ {
+		exist, err = jwtOAuthInstance.SignerExistInUser(adminCtx, &SignerExistInUserReq{User: userName, Signer: unfundedID})
+		assert.Nil(t, err)
+		assert.True(t, exist)
+	}
+}
+
+func testOrg(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	orgA, orgB := "test_org_a", "test_org_b"
+	for _, org := range []string{orgA, orgB} {
+		_, err := jwtOAuthInstance.CreateOrg(adminCtx, &CreateOrgRequest{Name: org})
+		assert.Nil(t, err)
+	}
+	_, err := jwtOAuthInstance.CreateOrg(adminCtx, &CreateOrgRequest{Name: orgA})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.CreateOrg(signCtx, &CreateOrgRequest{Name: "test_org_c"})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	orgAdmin, member, outsider := "test_org_admin", "test_org_member", "test_outsider"
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: orgAdmin, Org: orgA})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: outsider, Org: orgB})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test_no_org", Org: "not_exist"})
+	assert.Error(t, err)
+
+	orgAdminCtx := core.CtxWithName(core.CtxWithPerm(context.Background(), core.PermSign), orgAdmin)
+	// not an org admin yet
+	_, err = jwtOAuthInstance.CreateUser(orgAdminCtx, &CreateUserRequest{Name: member, Org: orgA})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	assert.Error(t, jwtOAuthInstance.SetOrgMember(adminCtx, &SetOrgMemberRequest{User: orgAdmin, Admin: true}))
+	assert.Nil(t, jwtOAuthInstance.SetOrgMember(adminCtx, &SetOrgMemberRequest{Org: orgA, User: orgAdmin, Admin: true}))
+	user, err := jwtOAuthInstance.GetUser(adminCtx, &GetUserRequest{Name: orgAdmin})
+	assert.Nil(t, err)
+	assert.Equal(t, orgA, user.Org)
+	assert.True(t, user.OrgAdmin)
+
+	// the read tokens of the org admin manage nothing
+	orgAdminReadCtx := core.CtxWithName(core.CtxWithPerm(context.Background(), core.PermRead), orgAdmin)
+	_, err = jwtOAuthInstance.CreateUser(orgAdminReadCtx, &CreateUserRequest{Name: member, Org: orgA})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// users in the org are managed by the org admin
+	_, err = jwtOAuthInstance.CreateUser(orgAdminCtx, &CreateUserRequest{Name: member, Org: orgA})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.GenerateToken(orgAdminReadCtx, &JWTPayload{Name: member, Perm: core.PermSign}, nil)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.CreateUser(orgAdminCtx, &CreateUserRequest{Name: "test_user_of_b", Org: orgB})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.CreateUser(orgAdminCtx, &CreateUserRequest{Name: "test_user_no_org"})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	mAddr, err := address.NewFromString("t01234")
+	assert.Nil(t, err)
+	openMining := true
+	_, err = jwtOAuthInstance.UpsertMiner(orgAdminCtx, &UpsertMinerReq{User: member, Miner: mAddr, OpenMining: &openMining})
+	assert.Nil(t, err)
+	miners, err := jwtOAuthInstance.ListMiners(orgAdminCtx, &ListMinerReq{User: member})
+	assert.Nil(t, err)
+	assert.Len(t, miners, 1)
+	_, err = jwtOAuthInstance.UpsertMiner(orgAdminCtx, &UpsertMinerReq{User: outsider, Miner: mAddr, OpenMining: &openMining})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.ListMiners(orgAdminCtx, &ListMinerReq{User: outsider})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	// miners of the users outside the org can't be taken by the org admin
+	outsiderMiner, err := address.NewFromString("t01235")
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: outsider, Miner: outsiderMiner, OpenMining: &openMining})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.UpsertMiner(orgAdminCtx, &UpsertMinerReq{User: member, Miner: outsiderMiner, OpenMining: &openMining})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	owner, err := jwtOAuthInstance.GetUserByMiner(adminCtx, &GetUserByMinerRequest{Miner: outsiderMiner})
+	assert.Nil(t, err)
+	assert.Equal(t, outsider, owner.Name)
+
+	signer, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.RegisterSigners(orgAdminCtx, &RegisterSignersReq{User: member, Signers: []address.Address{signer}}))
+	err = jwtOAuthInstance.RegisterSigners(orgAdminCtx, &RegisterSignersReq{User: outsider, Signers: []address.Address{signer}})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	_, err = jwtOAuthInstance.GenerateToken(orgAdminCtx, &JWTPayload{Name: member, Perm: core.PermSign}, nil)
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.GenerateToken(orgAdminCtx, &JWTPayload{Name: member, Perm: core.PermAdmin}, nil)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.GenerateToken(orgAdminCtx, &JWTPayload{Name: outsider, Perm: core.PermSign}, nil)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	users, err := jwtOAuthInstance.ListOrgUsers(orgAdminCtx, &ListOrgUsersRequest{Name: orgA})
+	assert.Nil(t, err)
+	assert.Len(t, users, 2)
+	_, err = jwtOAuthInstance.ListOrgUsers(orgAdminCtx, &ListOrgUsersRequest{Name: orgB})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// members can get their organization only
+	memberCtx := core.CtxWithName(core.CtxWithPerm(context.Background(), core.PermSign), member)
+	org, err := jwtOAuthInstance.GetOrg(memberCtx, &GetOrgRequest{Name: orgA})
+	assert.Nil(t, err)
+	assert.Equal(t, orgA, org.Name)
+	_, err = jwtOAuthInstance.GetOrg(memberCtx, &GetOrgRequest{Name: orgB})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.ListOrgUsers(memberCtx, &ListOrgUsersRequest{Name: orgA})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(orgAdminCtx, &DeleteUserRequest{Name: member}))
+	assert.True(t, errors.Is(jwtOAuthInstance.DeleteUser(orgAdminCtx, &DeleteUserRequest{Name: outsider}), ErrorPermissionDeny))
+
+	// organization with users can't be deleted
+	assert.Error(t, jwtOAuthInstance.DeleteOrg(adminCtx, &DeleteOrgRequest{Name: orgA}))
+	assert.Nil(t, jwtOAuthInstance.SetOrgMember(adminCtx, &SetOrgMemberRequest{User: orgAdmin}))
+	assert.Nil(t, jwtOAuthInstance.DeleteOrg(adminCtx, &DeleteOrgRequest{Name: orgA}))
+	orgs, err := jwtOAuthInstance.ListOrgs(adminCtx)
+	assert.Nil(t, err)
+	assert.Len(t, orgs, 1)
+	assert.Equal(t, orgB, orgs[0].Name)
+}
+
 func addUsersAndSigners(t *testing.T, userSigners map[string][]string) {
 	for userName, signers := range userSigners {
 		createUserReq := &CreateUserRequest{
@@ -1198,6 +1582,250 @@ func testDeleteUserRateLimits(t *testing.T, userMiners map[string][]string, orig
 	assert.True(t, errors.Is(err, ErrorPermissionDeny))
 }
 
+func testSelfService(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test_self_service"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	assert.Nil(t, err)
+	userCtx := core.CtxWithName(core.CtxWithPerm(context.Background(), core.PermSign), name)
+
+	// tokens with lower or equal permission only
+	tk, err := jwtOAuthInstance.GenerateMyToken(userCtx, &GenerateMyTokenReq{Perm: core.PermRead})
+	assert.Nil(t, err)
+	payload, err := jwtOAuthInstance.Verify(readCtx, tk)
+	assert.Nil(t, err)
+	assert.Equal(t, name, payload.Name)
+	assert.Equal(t, core.PermRead, payload.Perm)
+	_, err = jwtOAuthInstance.GenerateMyToken(userCtx, &GenerateMyTokenReq{Perm: core.PermSign})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.GenerateMyToken(userCtx, &GenerateMyTokenReq{Perm: core.PermAdmin})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.GenerateMyToken(userCtx, &GenerateMyTokenReq{Perm: "invalid"})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.GenerateMyToken(core.CtxWithPerm(context.Background(), core.PermSign), &GenerateMyTokenReq{Perm: core.PermRead})
+	assert.True(t, errors.Is(err, ErrorUsernameNotFound))
+	tokens, err := jwtOAuthInstance.GetTokenByName(userCtx, name)
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 2)
+
+	comment := "updated by myself"
+	assert.Nil(t, jwtOAuthInstance.UpdateMe(userCtx, &UpdateMeReq{Comment: &comment}))
+	user, err := jwtOAuthInstance.GetUser(userCtx, &GetUserRequest{Name: name})
+	assert.Nil(t, err)
+	assert.Equal(t, comment, user.Comment)
+
+	signers := make([]address.Address, 3)
+	for idx := range signers {
+		signers[idx], err = address.NewSecp256k1Address([]byte(fmt.Sprintf("self service signer %d", idx)))
+		assert.Nil(t, err)
+	}
+	// disabled by default
+	err = jwtOAuthInstance.RegisterMySigners(userCtx, &RegisterMySignersReq{Signers: signers[:1]})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	jwtOAuthInstance.selfService = &config.SelfServiceConfig{RegisterSigner: true, MaxSigners: 2}
+	defer func() { jwtOAuthInstance.selfService = nil }()
+	assert.Nil(t, jwtOAuthInstance.RegisterMySigners(userCtx, &RegisterMySignersReq{Signers: signers[:2]}))
+	// registering again doesn't count
+	assert.Nil(t, jwtOAuthInstance.RegisterMySigners(userCtx, &RegisterMySignersReq{Signers: signers[:1]}))
+	err = jwtOAuthInstance.RegisterMySigners(userCtx, &RegisterMySignersReq{Signers: signers[2:]})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	mAddr, err := address.NewIDAddress(1000)
+	assert.Nil(t, err)
+	err = jwtOAuthInstance.RegisterMySigners(userCtx, &RegisterMySignersReq{Signers: []address.Address{mAddr}})
+	assert.Error(t, err)
+	list, err := jwtOAuthInstance.ListSigner(userCtx, &ListSignerReq{User: name})
+	assert.Nil(t, err)
+	assert.Len(t, list, 2)
+
+	limits, err := jwtOAuthInstance.GetMyRateLimits(userCtx)
+	assert.Nil(t, err)
+	assert.Len(t, limits, 0)
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Name: name, Id: "limit", ReqLimit: storage.ReqLimit{Cap: 10, ResetDur: time.Minute}})
+	assert.Nil(t, err)
+	limits, err = jwtOAuthInstance.GetMyRateLimits(userCtx)
+	assert.Nil(t, err)
+	assert.Len(t, limits, 1)
+}
+
+func testTokenMetaAndUsage(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test_token_meta"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+	meta := &TokenMeta{Description: "for the market of pool", Labels: map[string]string{"service": "market"}}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermSign, Extra: "custom"}, meta)
+	assert.Nil(t, err)
+
+	info, err := jwtOAuthInstance.GetToken(adminCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", info.Custom)
+	assert.Equal(t, meta.Description, info.Description)
+	assert.Equal(t, meta.Labels, info.Labels)
+	assert.Nil(t, info.LastUsedTime)
+
+	jwtOAuthInstance.usage = newTokenUsageRecorder(jwtOAuthInstance.store)
+	_, err = jwtOAuthInstance.Verify(core.CtxWithClientIP(readCtx, "10.0.0.1"), token)
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.Verify(core.CtxWithClientIP(readCtx, "10.0.0.2"), token)
+	assert.Nil(t, err)
+
+	// usages are written in batches
+	info, err = jwtOAuthInstance.GetToken(adminCtx, token)
+	assert.Nil(t, err)
+	assert.Nil(t, info.LastUsedTime)
+
+	assert.Nil(t, jwtOAuthInstance.usage.flush())
+	tokens, err := jwtOAuthInstance.GetTokenByName(adminCtx, name)
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedTime)
+	assert.Equal(t, "10.0.0.2", tokens[0].LastUsedIP)
+	assert.Equal(t, meta.Description, tokens[0].Description)
+}
+
+func testReaper(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	longAgo := time.Now().Add(-100 * 24 * time.Hour)
+	recently := time.Now().Add(-time.Hour)
+	// name of user -> last used time of its tokens, zero means never used
+	users := map[string][]time.Time{
+		// users without tokens are never reaped
+		"test_reaper_stale":     {{}},
+		"test_reaper_live":      {{}, recently},
+		"test_reaper_svc":       {longAgo},
+		DefaultAdminTokenName:   {{}},
+		"test_reaper_no_tokens": nil,
+	}
+	tokens := make(map[string][]string)
+	createUser := func(name string, usages []time.Time) {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+		user, err := jwtOAuthInstance.store.GetUser(name)
+		assert.Nil(t, err)
+		user.CreateTime = longAgo
+		assert.Nil(t, jwtOAuthInstance.store.UpdateUser(user))
+
+		for idx, usedTime := range usages {
+			token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead, Extra: fmt.Sprint(idx)}, nil)
+			assert.Nil(t, err)
+			kp, err := jwtOAuthInstance.store.Get(storage.Token(token))
+			assert.Nil(t, err)
+			kp.CreateTime = longAgo
+			assert.Nil(t, jwtOAuthInstance.store.UpdateToken(kp))
+			if !usedTime.IsZero() {
+				assert.Nil(t, jwtOAuthInstance.store.UpdateTokenUsages([]*storage.TokenUsage{{Token: kp.Token, Time: usedTime}}))
+			}
+			tokens[name] = append(tokens[name], token)
+		}
+	}
+	for name, usages := range users {
+		createUser(name, usages)
+	}
+	// users created recently are not stale
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test_reaper_new"})
+	assert.Nil(t, err)
+
+	reaperCnf := &config.ReaperConfig{StaleDays: 90, Policy: config.ReaperPolicyReport, Protected: []string{"test_reaper_svc"}}
+	_, err = jwtOAuthInstance.Reap(signCtx, reaperCnf)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.Reap(adminCtx, &config.ReaperConfig{StaleDays: 90, Policy: "unknown"})
+	assert.Error(t, err)
+
+	reapedTokens := func(report *ReaperReport) map[string]string {
+		res := make(map[string]string)
+		for _, token := range report.Tokens {
+			res[token.Token] = token.Action
+		}
+		return res
+	}
+	reapedUsers := func(report *ReaperReport) map[string]string {
+		res := make(map[string]string)
+		for _, user := range report.Users {
+			res[user.Name] = user.Action
+		}
+		return res
+	}
+
+	// tokens never used are aged from the time usages tracked since, not the time they were created
+	report, err := jwtOAuthInstance.Reap(adminCtx, reaperCnf)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Tokens)
+	assert.Empty(t, report.Users)
+	assert.Nil(t, jwtOAuthInstance.store.SetUsageTrackingSince(longAgo))
+
+	// nothing changes when reporting
+	report, err = jwtOAuthInstance.Reap(adminCtx, reaperCnf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		tokens["test_reaper_stale"][0]: ReapActionReported,
+		tokens["test_reaper_live"][0]:  ReapActionReported,
+	}, reapedTokens(report))
+	assert.Equal(t, map[string]string{"test_reaper_stale": ReapActionReported}, reapedUsers(report))
+	has, err := jwtOAuthInstance.store.Has(storage.Token(tokens["test_reaper_stale"][0]))
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	reaperCnf.Policy = config.ReaperPolicyDisable
+	report, err = jwtOAuthInstance.Reap(adminCtx, reaperCnf)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, map[string]string{
+		tokens["test_reaper_stale"][0]: ReapActionRemoved,
+		tokens["test_reaper_live"][0]:  ReapActionRemoved,
+	}, reapedTokens(report))
+	assert.Equal(t, map[string]string{"test_reaper_stale": ReapActionDisabled}, reapedUsers(report))
+	has, err = jwtOAuthInstance.store.Has(storage.Token(tokens["test_reaper_stale"][0]))
+	assert.Nil(t, err)
+	assert.False(t, has)
+	user, err := jwtOAuthInstance.GetUser(adminCtx, &GetUserRequest{Name: "test_reaper_stale"})
+	assert.Nil(t, err)
+	assert.Equal(t, core.UserStateDisabled, user.State)
+	user, err = jwtOAuthInstance.GetUser(adminCtx, &GetUserRequest{Name: "test_reaper_live"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, core.UserStateDisabled, user.State)
+
+	// users disabled before are not reported again
+	report, err = jwtOAuthInstance.Reap(adminCtx, reaperCnf)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Tokens)
+	assert.Empty(t, report.Users)
+
+	// users whose tokens were removed before are not reaped by a later run either
+	createUser("test_reaper_stale_del", []time.Time{{}})
+	reaperCnf.Policy = config.ReaperPolicyDelete
+	report, err = jwtOAuthInstance.Reap(adminCtx, reaperCnf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{tokens["test_reaper_stale_del"][0]: ReapActionRemoved}, reapedTokens(report))
+	assert.Equal(t, map[string]string{"test_reaper_stale_del": ReapActionRemoved}, reapedUsers(report))
+	has, err = jwtOAuthInstance.store.HasUser("test_reaper_stale_del")
+	assert.Nil(t, err)
+	assert.False(t, has)
+	for _, name := range []string{"test_reaper_svc", DefaultAdminTokenName, "test_reaper_new", "test_reaper_live",
+		"test_reaper_stale", "test_reaper_no_tokens"} {
+		has, err = jwtOAuthInstance.store.HasUser(name)
+		assert.Nil(t, err)
+		assert.True(t, has)
+	}
+
+	reports, err := jwtOAuthInstance.ListReaperReports(adminCtx)
+	assert.Nil(t, err)
+	assert.Len(t, reports, 5)
+	assert.Equal(t, config.ReaperPolicyDelete, reports[0].Policy)
+	assert.Equal(t, config.ReaperPolicyReport, reports[4].Policy)
+	_, err = jwtOAuthInstance.ListReaperReports(signCtx)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+}
+
 func TestTokenDecode(t *testing.T) {
 	payload := []byte("eyJzdWIiOiIxMjM0NTY3ODkwIiwibmFtZSI6IkpvaG4gRG9lIiwiaWF0IjoxNTE2MjM5MDIyfQ")
 	pb, err := DecodeToBytes(payload)
@@ -1224,8 +1852,13 @@ func setup(cfg *config.DBConfig, t *testing.T) {
 	}
 
 	jwtOAuthInstance = &jwtOAuth{
-		store: theStore,
-		mp:    newMapper(),
+		store:       theStore,
+		mp:          newMapper(),
+		reports:     &reaperReports{},
+		rateLimit:   &defaultRateLimit{},
+		changeLog:   newChangeLog(),
+		events:      newEventHub(),
+		webhookWake: make(chan struct{}, 1),
 	}
 }
 
@@ -1240,3 +1873,862 @@ func shutdown(cfg *config.DBConfig, t *testing.T) {
 func ctxWithUserNameAndAdminPerm(userName string) context.Context {
 	return core.CtxWithName(adminCtx, userName)
 }
+
+func testBulkApply(t *testing.T, userMiners, userSigners map[string][]string) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	comment := "from manifest"
+	closeMining := false
+	manifest := Manifest{}
+	for name, miners := range userMiners {
+		mu := &ManifestUser{
+			Name:       name,
+			Comment:    &comment,
+			State:      core.UserStateEnabled,
+			Signers:    userSigners[name],
+			RateLimits: []*ManifestRateLimit{{Cap: 10, ResetDur: time.Minute}},
+			Tokens:     []*ManifestToken{{Perm: core.PermSign}, {Perm: core.PermRead, Extra: "read only"}},
+		}
+		for _, miner := range miners {
+			mu.Miners = append(mu.Miners, &ManifestMiner{Miner: miner})
+		}
+		manifest.Users = append(manifest.Users, mu)
+	}
+
+	// with ctx no perm
+	_, err := jwtOAuthInstance.BulkApply(signCtx, &BulkApplyReq{Manifest: manifest})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// dry run writes nothing
+	res, err := jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest, DryRun: true})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.Changes)
+	assert.Empty(t, res.Tokens)
+	for name := range userMiners {
+		has, err := jwtOAuthInstance.HasUser(adminCtx, &HasUserRequest{Name: name})
+		assert.Nil(t, err)
+		assert.False(t, has)
+	}
+
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Len(t, res.Tokens, 2*len(userMiners))
+	for _, tk := range res.Tokens {
+		payload, err := jwtOAuthInstance.Verify(adminCtx, tk.Token)
+		assert.Nil(t, err)
+		assert.Equal(t, tk.User, payload.Name)
+		assert.Equal(t, tk.Perm, payload.Perm)
+	}
+	for name, miners := range userMiners {
+		user, err := jwtOAuthInstance.GetUser(adminCtx, &GetUserRequest{Name: name})
+		assert.Nil(t, err)
+		assert.Equal(t, comment, user.Comment)
+		assert.Equal(t, core.UserStateEnabled, user.State)
+
+		outMiners, err := jwtOAuthInstance.ListMiners(adminCtx, &ListMinerReq{User: name})
+		assert.Nil(t, err)
+		assert.Len(t, outMiners, len(miners))
+
+		signers, err := jwtOAuthInstance.ListSigner(adminCtx, &ListSignerReq{User: name})
+		assert.Nil(t, err)
+		assert.Len(t, signers, len(userSigners[name]))
+
+		limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+		assert.Nil(t, err)
+		assert.Len(t, limits, 1)
+	}
+
+	// apply again changes nothing
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Changes)
+	assert.Empty(t, res.Tokens)
+
+	// update open mining and rate limit
+	mu := manifest.Users[0]
+	mu.Miners[0].OpenMining = &closeMining
+	mu.RateLimits[0].Cap = 20
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 2)
+	for _, change := range res.Changes {
+		assert.Equal(t, ChangeActionUpdate, change.Action)
+	}
+	limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: mu.Name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 1)
+	assert.Equal(t, int64(20), limits[0].ReqLimit.Cap)
+
+	// labels of miner are replaced by manifest
+	mu.Miners[1].Labels = map[string]string{"region": "sh"}
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 1)
+	assert.Equal(t, ChangeKindMinerLabels, res.Changes[0].Kind)
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Changes)
+
+	// miner bound to another user
+	conflict := Manifest{Users: []*ManifestUser{{Name: "test_user_conflict", Miners: []*ManifestMiner{{Miner: mu.Miners[0].Miner}}}}}
+	_, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: conflict})
+	assert.Error(t, err)
+
+	// invalid manifest
+	invalid := Manifest{Users: []*ManifestUser{{Name: "test_user_invalid", Tokens: []*ManifestToken{{Perm: "invalid"}}}}}
+	_, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: invalid})
+	assert.Error(t, err)
+}
+
+func testBulkApplyPrune(t *testing.T, userSigners map[string][]string) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test_user_001"
+	manifest := Manifest{Users: []*ManifestUser{{
+		Name:    name,
+		Signers: userSigners[name],
+		RateLimits: []*ManifestRateLimit{
+			{Service: "sophon-messager", Cap: 10, ResetDur: time.Minute},
+			{Service: "sophon-miner", Cap: 10, ResetDur: time.Minute},
+		},
+	}}}
+	_, err := jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+
+	// without prune, nothing is removed
+	mu := manifest.Users[0]
+	mu.Signers = mu.Signers[:1]
+	mu.RateLimits = mu.RateLimits[:1]
+	res, err := jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Changes)
+
+	// protected user keeps its resources
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest, Prune: true, Protected: []string{name}})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Changes)
+
+	res, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: manifest, Prune: true})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 2)
+
+	signers, err := jwtOAuthInstance.ListSigner(adminCtx, &ListSignerReq{User: name})
+	assert.Nil(t, err)
+	assert.Len(t, signers, 1)
+	limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 1)
+	assert.Equal(t, "sophon-messager", limits[0].Service)
+}
+
+func testReconcile(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	path := t.TempDir() + "/manifest.yaml"
+	require.NoError(t, os.WriteFile(path, []byte("users:\n  - name: reconcile_user_01\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &oauthApp{srv: jwtOAuthInstance}
+	go app.Reconcile(ctx, &config.ReconcileConfig{ManifestPath: path, Interval: time.Hour, Prune: true})
+
+	hasUser := func(name string) func() bool {
+		return func() bool {
+			has, err := jwtOAuthInstance.HasUser(adminCtx, &HasUserRequest{Name: name})
+			return err == nil && has
+		}
+	}
+	// applied at start
+	assert.Eventually(t, hasUser("reconcile_user_01"), 5*time.Second, 50*time.Millisecond)
+
+	// applied after manifest changed
+	require.NoError(t, os.WriteFile(path, []byte("users:\n  - name: reconcile_user_02\n"), 0o644))
+	assert.Eventually(t, hasUser("reconcile_user_02"), 5*time.Second, 50*time.Millisecond)
+	assert.Eventually(t, func() bool { return !hasUser("reconcile_user_01")() }, 5*time.Second, 50*time.Millisecond)
+}
+
+func testUpdateMinerLabels(t *testing.T, userMiners map[string][]string) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+	addUsersAndMiners(t, userMiners)
+
+	name := "test_user_001"
+	mAddr, err := address.NewFromString(userMiners[name][0])
+	assert.Nil(t, err)
+	labels := map[string]string{core.MinerFlagAcceptDeals: "true", "region": "sh"}
+
+	// with ctx no perm
+	_, err = jwtOAuthInstance.UpdateMinerLabels(signCtx, &UpdateMinerLabelsReq{Miner: mAddr, Set: labels})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// invalid flag value
+	_, err = jwtOAuthInstance.UpdateMinerLabels(adminCtx, &UpdateMinerLabelsReq{Miner: mAddr, Set: map[string]string{core.MinerFlagWindowPoStOnly: "yes"}})
+	assert.Error(t, err)
+
+	miner, err := jwtOAuthInstance.UpdateMinerLabels(adminCtx, &UpdateMinerLabelsReq{Miner: mAddr, Set: labels})
+	assert.Nil(t, err)
+	assert.Equal(t, labels, miner.Labels)
+
+	miner, err = jwtOAuthInstance.UpdateMinerLabels(adminCtx, &UpdateMinerLabelsReq{Miner: mAddr, Unset: []string{"region"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{core.MinerFlagAcceptDeals: "true"}, miner.Labels)
+
+	miners, err := jwtOAuthInstance.ListMiners(adminCtx, &ListMinerReq{User: name, Labels: []string{core.MinerFlagAcceptDeals + "=true"}})
+	assert.Nil(t, err)
+	assert.Len(t, miners, 1)
+	assert.Equal(t, mAddr, miners[0].Miner)
+	miners, err = jwtOAuthInstance.ListMiners(adminCtx, &ListMinerReq{User: name, Labels: []string{"region"}})
+	assert.Nil(t, err)
+	assert.Len(t, miners, 0)
+	miners, err = jwtOAuthInstance.ListMiners(adminCtx, &ListMinerReq{User: name})
+	assert.Nil(t, err)
+	assert.Len(t, miners, len(userMiners[name]))
+
+	user, err := jwtOAuthInstance.GetUserByMiner(adminCtx, &GetUserByMinerRequest{Miner: mAddr})
+	assert.Nil(t, err)
+	assert.Len(t, user.Miners, 1)
+	assert.Equal(t, miner.Labels, user.Miners[0].Labels)
+}
+
+func testSignerPolicy(t *testing.T, userSigners map[string][]string) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+	addUsersAndSigners(t, userSigners)
+
+	name := "test_user_002"
+	sAddr, err := address.NewFromString(userSigners[name][1])
+	assert.Nil(t, err)
+	policy := &storage.SignerPolicy{AllowedMethods: []uint64{0, 2}, MaxValue: "100", DailyCap: "150"}
+
+	// with ctx no perm
+	_, err = jwtOAuthInstance.UpdateSignerPolicy(signCtx, &UpdateSignerPolicyReq{User: name, Signer: sAddr, Policy: policy})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	// invalid value
+	_, err = jwtOAuthInstance.UpdateSignerPolicy(adminCtx, &UpdateSignerPolicyReq{User: name, Signer: sAddr, Policy: &storage.SignerPolicy{MaxValue: "-1"}})
+	assert.Error(t, err)
+	// signer not bound to user
+	_, err = jwtOAuthInstance.UpdateSignerPolicy(adminCtx, &UpdateSignerPolicyReq{User: "test_user_001", Signer: sAddr, Policy: policy})
+	assert.Error(t, err)
+
+	signer, err := jwtOAuthInstance.UpdateSignerPolicy(adminCtx, &UpdateSignerPolicyReq{User: name, Signer: sAddr, Policy: policy})
+	assert.Nil(t, err)
+	assert.Equal(t, policy, signer.Policy)
+
+	// policy is only applied to the user
+	signers, err := jwtOAuthInstance.ListSigner(adminCtx, &ListSignerReq{User: "test_user_003"})
+	assert.Nil(t, err)
+	for _, s := range signers {
+		assert.Nil(t, s.Policy)
+	}
+
+	userCtx := core.CtxWithName(signCtx, name)
+	check := func(method uint64, value string) *CheckSignerPolicyResp {
+		res, err := jwtOAuthInstance.CheckSignerPolicy(userCtx, &CheckSignerPolicyReq{User: name, Signer: sAddr, Method: method, Value: value})
+		assert.Nil(t, err)
+		return res
+	}
+	// a dry run counts nothing
+	res, err := jwtOAuthInstance.CheckSignerPolicy(userCtx, &CheckSignerPolicyReq{User: name, Signer: sAddr, Value: "100", DryRun: true})
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	signers, err = jwtOAuthInstance.ListSigner(adminCtx, &ListSignerReq{User: name})
+	assert.Nil(t, err)
+	for _, s := range signers {
+		assert.Nil(t, s.Spent)
+	}
+	assert.True(t, check(0, "100").Allowed)
+	res = check(3, "")
+	assert.False(t, res.Allowed)
+	assert.Contains(t, res.Reason, "method 3 is not allowed")
+	res = check(2, "101")
+	assert.False(t, res.Allowed)
+	assert.Contains(t, res.Reason, "exceeds max value")
+	// 100 was spent today
+	res = check(2, "60")
+	assert.False(t, res.Allowed)
+	assert.Contains(t, res.Reason, "exceeds daily cap")
+	assert.True(t, check(2, "50").Allowed)
+
+	// the signer of other users are not limited
+	other := "test_user_003"
+	res, err = jwtOAuthInstance.CheckSignerPolicy(adminCtx, &CheckSignerPolicyReq{User: other, Signer: sAddr, Method: 3, Value: "1000"})
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	otherSigner, err := address.NewFromString(userSigners[other][0])
+	assert.Nil(t, err)
+	res, err = jwtOAuthInstance.CheckSignerPolicy(adminCtx, &CheckSignerPolicyReq{User: other, Signer: otherSigner, Method: 3, Value: "1000"})
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+
+	// user does not match
+	_, err = jwtOAuthInstance.CheckSignerPolicy(core.CtxWithName(signCtx, other), &CheckSignerPolicyReq{User: name, Signer: sAddr})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.CheckSignerPolicy(adminCtx, &CheckSignerPolicyReq{User: name, Signer: sAddr, Value: "abc"})
+	assert.Error(t, err)
+
+	// spending is reset in a new day
+	spent, reason := evalSignerPolicy(&storage.Signer{Policy: policy, Spent: &storage.SignerSpent{Day: "2023-01-02", Amount: "150"}},
+		0, big.NewInt(100), time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC))
+	assert.Empty(t, reason)
+	assert.Equal(t, &storage.SignerSpent{Day: "2023-01-03", Amount: "100"}, spent)
+
+	// remove policy
+	signer, err = jwtOAuthInstance.UpdateSignerPolicy(adminCtx, &UpdateSignerPolicyReq{User: name, Signer: sAddr})
+	assert.Nil(t, err)
+	assert.Nil(t, signer.Policy)
+	assert.True(t, check(3, "1000").Allowed)
+}
+
+func testPurge(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	deleted, live := "test_purge_deleted", "test_purge_live"
+	tokens := make(map[string]string)
+	for _, name := range []string{deleted, live} {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+		tokens[name], err = jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead}, nil)
+		assert.Nil(t, err)
+	}
+	miner, err := address.NewIDAddress(1200)
+	assert.Nil(t, err)
+	openMining := true
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: deleted, Miner: miner, OpenMining: &openMining})
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: deleted}))
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(adminCtx, tokens[live]))
+
+	_, err = jwtOAuthInstance.Purge(signCtx, &PurgeReq{})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.Purge(adminCtx, &PurgeReq{Kinds: []string{"unknown"}})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.Purge(adminCtx, &PurgeReq{OlderThan: -time.Hour})
+	assert.Error(t, err)
+
+	// deleted recently
+	res, err := jwtOAuthInstance.Purge(adminCtx, &PurgeReq{OlderThan: time.Hour, DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, storage.PurgeSummary{storage.PurgeKindToken: 0, storage.PurgeKindUser: 0,
+		storage.PurgeKindMiner: 0, storage.PurgeKindSigner: 0}, res.Summary)
+
+	res, err = jwtOAuthInstance.Purge(adminCtx, &PurgeReq{DryRun: true})
+	assert.Nil(t, err)
+	assert.True(t, res.DryRun)
+	assert.Equal(t, storage.PurgeSummary{storage.PurgeKindToken: 2, storage.PurgeKindUser: 1,
+		storage.PurgeKindMiner: 1, storage.PurgeKindSigner: 0}, res.Summary)
+
+	// the token of deleted user is purged along
+	res, err = jwtOAuthInstance.Purge(adminCtx, &PurgeReq{Kinds: []string{storage.PurgeKindUser}})
+	assert.Nil(t, err)
+	assert.Equal(t, storage.PurgeSummary{storage.PurgeKindToken: 1, storage.PurgeKindUser: 1,
+		storage.PurgeKindMiner: 1, storage.PurgeKindSigner: 0}, res.Summary)
+	assert.Error(t, jwtOAuthInstance.RecoverUser(adminCtx, &RecoverUserRequest{Name: deleted}))
+	has, err := jwtOAuthInstance.HasMiner(adminCtx, &HasMinerRequest{Miner: miner})
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	// the deleted token of live user is kept
+	assert.Nil(t, jwtOAuthInstance.RecoverToken(adminCtx, tokens[live]))
+}
+
+func testCascadeDeleteUser(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test_cascade"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermSign}, nil)
+	assert.Nil(t, err)
+	miner, err := address.NewIDAddress(1300)
+	assert.Nil(t, err)
+	openMining := true
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: name, Miner: miner, OpenMining: &openMining})
+	assert.Nil(t, err)
+	signer, err := address.NewFromString("t1mpvdqt2acgihevibd4greavlsfn3dfph5sckc2a")
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.RegisterSigners(adminCtx, &RegisterSignersReq{User: name, Signers: []address.Address{signer}}))
+
+	attached := func() (bool, bool) {
+		hasMiner, err := jwtOAuthInstance.HasMiner(adminCtx, &HasMinerRequest{Miner: miner})
+		assert.Nil(t, err)
+		hasSigner, err := jwtOAuthInstance.SignerExistInUser(adminCtx, &SignerExistInUserReq{Signer: signer, User: name})
+		assert.Nil(t, err)
+		return hasMiner, hasSigner
+	}
+
+	// tokens, miners and signers are restored with user
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: name, Cascade: true}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Error(t, err)
+	hasMiner, hasSigner := attached()
+	assert.False(t, hasMiner)
+	assert.False(t, hasSigner)
+
+	assert.Nil(t, jwtOAuthInstance.RecoverUser(adminCtx, &RecoverUserRequest{Name: name}))
+	payload, err := jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, name, payload.Name)
+	hasMiner, hasSigner = attached()
+	assert.True(t, hasMiner)
+	assert.True(t, hasSigner)
+	user, err := jwtOAuthInstance.store.GetUser(name)
+	assert.Nil(t, err)
+	assert.Nil(t, user.Cascaded)
+
+	// tokens are kept and miners and signers are not restored without cascade
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: name}))
+	assert.Nil(t, jwtOAuthInstance.RecoverUser(adminCtx, &RecoverUserRequest{Name: name}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+	hasMiner, hasSigner = attached()
+	assert.False(t, hasMiner)
+	assert.False(t, hasSigner)
+}
+
+func testDefaultRateLimit(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "default_limit_user"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+
+	limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 0)
+
+	jwtOAuthInstance.SetDefaultRateLimit(&config.RateLimitConfig{Cap: 10, ResetDur: time.Minute})
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 1)
+	assert.Equal(t, "", limits[0].Id)
+	assert.Equal(t, storage.ReqLimit{Cap: 10, ResetDur: time.Minute}, limits[0].ReqLimit)
+
+	myLimits, err := jwtOAuthInstance.GetMyRateLimits(core.CtxWithName(signCtx, name))
+	assert.Nil(t, err)
+	assert.Equal(t, limits, myLimits)
+
+	// a limit of some api doesn't replace the default one
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{
+		Id: "api_limit", Name: name, Service: "sophon-messager", API: "PushMessage",
+		ReqLimit: storage.ReqLimit{Cap: 5, ResetDur: time.Minute},
+	})
+	assert.Nil(t, err)
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 2)
+	assert.Equal(t, int64(10), limits.MatchedLimit("", "").ReqLimit.Cap)
+
+	// the limit of the user itself does
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{
+		Id: "own_limit", Name: name, ReqLimit: storage.ReqLimit{Cap: 20, ResetDur: time.Minute},
+	})
+	assert.Nil(t, err)
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 2)
+	assert.Equal(t, int64(20), limits.MatchedLimit("", "").ReqLimit.Cap)
+
+	// no default limit after the cap set to 0
+	jwtOAuthInstance.SetDefaultRateLimit(&config.RateLimitConfig{})
+	assert.Nil(t, jwtOAuthInstance.DelUserRateLimit(adminCtx, &DelUserRateLimitReq{Name: name, Id: "own_limit"}))
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: name})
+	assert.Nil(t, err)
+	assert.Len(t, limits, 1)
+	assert.Nil(t, limits.MatchedLimit("", ""))
+}
+
+func testReplicaChanges(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	for _, name := range []string{"replica_user_01", "replica_user_02"} {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+	}
+	miner, err := address.NewFromString("t01000")
+	assert.Nil(t, err)
+	openMining := true
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: "replica_user_01", Miner: miner, OpenMining: &openMining})
+	assert.Nil(t, err)
+
+	_, err = jwtOAuthInstance.ReplicaSnapshot(signCtx)
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	snapshot, err := jwtOAuthInstance.ReplicaSnapshot(adminCtx)
+	assert.Nil(t, err)
+	assert.Len(t, snapshot.Users, 2)
+	assert.Equal(t, "replica_user_01", snapshot.Users[0].User.Name)
+	assert.Len(t, snapshot.Users[0].Miners, 1)
+
+	changes, err := jwtOAuthInstance.ReplicaChanges(adminCtx, &ReplicaChangesReq{Epoch: snapshot.Epoch, Since: snapshot.Seq})
+	assert.Nil(t, err)
+	assert.False(t, changes.Reset)
+	assert.Len(t, changes.Users, 0)
+
+	// both users of a transferred miner changed, the deleted user is removed
+	_, err = jwtOAuthInstance.TransferMiner(adminCtx, &TransferMinerReq{Miner: miner, From: "replica_user_01", To: "replica_user_02"})
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: "replica_user_01"}))
+	changes, err = jwtOAuthInstance.ReplicaChanges(adminCtx, &ReplicaChangesReq{Epoch: snapshot.Epoch, Since: snapshot.Seq})
+	assert.Nil(t, err)
+	assert.False(t, changes.Reset)
+	assert.Equal(t, []string{"replica_user_01"}, changes.Removed)
+	assert.Len(t, changes.Users, 1)
+	assert.Equal(t, "replica_user_02", changes.Users[0].User.Name)
+	assert.Len(t, changes.Users[0].Miners, 1)
+
+	// the changes of an unknown epoch, or after a default rate limit changed, can't be told
+	changes, err = jwtOAuthInstance.ReplicaChanges(adminCtx, &ReplicaChangesReq{Epoch: "unknown"})
+	assert.Nil(t, err)
+	assert.True(t, changes.Reset)
+	jwtOAuthInstance.SetDefaultRateLimit(&config.RateLimitConfig{Cap: 10, ResetDur: time.Minute})
+	changes, err = jwtOAuthInstance.ReplicaChanges(adminCtx, &ReplicaChangesReq{Epoch: snapshot.Epoch, Since: snapshot.Seq})
+	assert.Nil(t, err)
+	assert.True(t, changes.Reset)
+
+	// the changes dropped from the log can't be told either
+	epoch, seq := jwtOAuthInstance.changeLog.current()
+	for i := 0; i <= changeLogSize; i++ {
+		jwtOAuthInstance.changeLog.record("replica_user_02")
+	}
+	changes, err = jwtOAuthInstance.ReplicaChanges(adminCtx, &ReplicaChangesReq{Epoch: epoch, Since: seq})
+	assert.Nil(t, err)
+	assert.True(t, changes.Reset)
+}
+
+func testEvents(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	next := func(events <-chan *Event) *Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(adminCtx)
+	defer cancel()
+	_, err := jwtOAuthInstance.SubscribeEvents(signCtx, &SubscribeEventsReq{})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	_, err = jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{Types: []EventType{EventReset}})
+	assert.True(t, errors.Is(err, errcode.ErrInvalidArgument))
+	all, err := jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{})
+	assert.Nil(t, err)
+	// the events of the miner moved from a user are delivered to the subscriber of it
+	ofUser1, err := jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{Types: []EventType{EventMinerUpserted}, User: "event_user_01"})
+	assert.Nil(t, err)
+
+	for _, name := range []string{"event_user_01", "event_user_02"} {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+	}
+	miner, err := address.NewFromString("t01000")
+	assert.Nil(t, err)
+	openMining := true
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: "event_user_01", Miner: miner, OpenMining: &openMining})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.UpsertMiner(adminCtx, &UpsertMinerReq{User: "event_user_02", Miner: miner, OpenMining: &openMining})
+	assert.Nil(t, err)
+
+	first := next(all)
+	assert.Equal(t, EventUserCreated, first.Type)
+	assert.Equal(t, "event_user_01", first.User)
+	assert.Equal(t, EventUserCreated, next(all).Type)
+	ev := next(all)
+	assert.Equal(t, EventMinerUpserted, ev.Type)
+	assert.Equal(t, "", ev.PrevUser)
+	moved := next(all)
+	assert.Equal(t, &Event{ID: moved.ID, Type: EventMinerUpserted, User: "event_user_02", PrevUser: "event_user_01",
+		Miner: "t01000", Time: moved.Time}, moved)
+	assert.Equal(t, ev.ID, next(ofUser1).ID)
+	assert.Equal(t, moved.ID, next(ofUser1).ID)
+
+	// the changes of bulk apply
+	_, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: Manifest{Users: []*ManifestUser{{
+		Name:   "event_user_03",
+		Miners: []*ManifestMiner{{Miner: "t01001"}},
+		Tokens: []*ManifestToken{{Perm: core.PermSign}},
+	}}}})
+	assert.Nil(t, err)
+	assert.Equal(t, EventUserCreated, next(all).Type)
+	assert.Equal(t, EventMinerUpserted, next(all).Type)
+	ev = next(all)
+	assert.Equal(t, EventTokenGenerated, ev.Type)
+	assert.Equal(t, core.PermSign, ev.Perm)
+
+	// disabling a user is told apart from other updates
+	disabled, err := jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{Types: []EventType{EventUserDisabled}})
+	assert.Nil(t, err)
+	comment := "disabled later"
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: "event_user_01", Comment: &comment}))
+	assert.Equal(t, EventUserUpdated, next(all).Type)
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: "event_user_01", State: core.UserStateDisabled}))
+	ev = next(all)
+	assert.Equal(t, EventUserDisabled, ev.Type)
+	assert.Equal(t, ev.ID, next(disabled).ID)
+	// already disabled
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: "event_user_01", State: core.UserStateDisabled}))
+	assert.Equal(t, EventUserUpdated, next(all).Type)
+	_, err = jwtOAuthInstance.BulkApply(adminCtx, &BulkApplyReq{Manifest: Manifest{Users: []*ManifestUser{{
+		Name: "event_user_03", State: core.UserStateDisabled,
+	}}}})
+	assert.Nil(t, err)
+	ev = next(all)
+	assert.Equal(t, EventUserDisabled, ev.Type)
+	assert.Equal(t, "event_user_03", ev.User)
+	assert.Equal(t, ev.ID, next(disabled).ID)
+
+	// resumed after an event, or reset if the events after it are dropped
+	resumed, err := jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{LastEventID: moved.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, EventUserCreated, next(resumed).Type)
+	for i := 0; i < eventBufferSize; i++ {
+		jwtOAuthInstance.events.publish(&Event{Type: EventUserUpdated, User: "event_user_01"})
+	}
+	dropped, err := jwtOAuthInstance.SubscribeEvents(ctx, &SubscribeEventsReq{LastEventID: first.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, EventReset, next(dropped).Type)
+
+	// the subscriptions end after the events closed
+	jwtOAuthInstance.CloseEvents()
+	_, ok := <-dropped
+	assert.False(t, ok)
+}
+
+func testWebhooks(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	const secret = "webhook-secret"
+	var lk sync.Mutex
+	received := make(map[string][]*Event)
+	flakyFailed, slowFailed := false, false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, SignWebhook(secret, r.Header.Get(WebhookTimestampHeader), body), r.Header.Get(WebhookSignatureHeader))
+		var payload WebhookPayload
+		assert.Nil(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, string(payload.Event.Type), r.Header.Get(WebhookEventHeader))
+		assert.NotEmpty(t, r.Header.Get(WebhookDeliveryHeader))
+		assert.True(t, strings.HasPrefix(payload.Text, "[sophon-auth] "+string(payload.Event.Type)))
+
+		lk.Lock()
+		defer lk.Unlock()
+		switch r.URL.Path {
+		case "/fail":
+			http.Error(w, "always fail", http.StatusInternalServerError)
+			return
+		case "/flaky":
+			if !flakyFailed {
+				flakyFailed = true
+				http.Error(w, "fail once", http.StatusServiceUnavailable)
+				return
+			}
+		case "/slow":
+			if !slowFailed {
+				slowFailed = true
+				http.Error(w, "fail once", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		received[r.URL.Path] = append(received[r.URL.Path], payload.Event)
+	}))
+	defer receiver.Close()
+	receivedOf := func(path string) []*Event {
+		lk.Lock()
+		defer lk.Unlock()
+		return received[path]
+	}
+
+	_, err := jwtOAuthInstance.CreateWebhook(signCtx, &CreateWebhookReq{Name: "all", URL: receiver.URL + "/all"})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+	for _, req := range []*CreateWebhookReq{
+		{Name: "invalid", URL: "ftp://127.0.0.1/all"},
+		{Name: "invalid", URL: "/all"},
+		{Name: "invalid", URL: receiver.URL, Events: []EventType{EventReset}},
+		{Name: "invalid", URL: receiver.URL, Perm: "root"},
+	} {
+		_, err = jwtOAuthInstance.CreateWebhook(adminCtx, req)
+		assert.True(t, errors.Is(err, errcode.ErrInvalidArgument), req)
+	}
+
+	for _, req := range []*CreateWebhookReq{
+		{Name: "all", URL: receiver.URL + "/all", Secret: secret},
+		{
+			Name: "user", URL: receiver.URL + "/user", Secret: secret, User: "webhook_user_01",
+			Events: []EventType{EventUserCreated, EventTokenGenerated}, Perm: core.PermSign,
+		},
+		{Name: "flaky", URL: receiver.URL + "/flaky", Secret: secret, Events: []EventType{EventUserCreated}},
+		{Name: "fail", URL: receiver.URL + "/fail", Secret: secret, Events: []EventType{EventUserCreated}},
+	} {
+		out, err := jwtOAuthInstance.CreateWebhook(adminCtx, req)
+		assert.Nil(t, err)
+		assert.Equal(t, secret, out.Secret)
+	}
+	_, err = jwtOAuthInstance.CreateWebhook(adminCtx, &CreateWebhookReq{Name: "all", URL: receiver.URL})
+	assert.True(t, errors.Is(err, errcode.ErrAlreadyExists))
+	// the secret generated is only returned when created or rotated
+	generated, err := jwtOAuthInstance.CreateWebhook(adminCtx, &CreateWebhookReq{Name: "generated", URL: receiver.URL, Events: []EventType{EventSignerRegistered}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, generated.Secret)
+	got, err := jwtOAuthInstance.GetWebhook(adminCtx, &GetWebhookReq{Name: "generated"})
+	assert.Nil(t, err)
+	assert.Empty(t, got.Secret)
+	rotated, err := jwtOAuthInstance.UpdateWebhook(adminCtx, &UpdateWebhookReq{Name: "generated", RotateSecret: true})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, rotated.Secret)
+	assert.NotEqual(t, generated.Secret, rotated.Secret)
+	assert.Nil(t, jwtOAuthInstance.DeleteWebhook(adminCtx, &DeleteWebhookReq{Name: "generated"}))
+	webhooks, err := jwtOAuthInstance.ListWebhooks(adminCtx)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 4)
+
+	for _, name := range []string{"webhook_user_01", "webhook_user_02"} {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+	}
+	for _, perm := range []string{core.PermSign, core.PermRead} {
+		_, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: "webhook_user_01", Perm: perm}, nil)
+		assert.Nil(t, err)
+	}
+
+	cnf := &config.WebhookConfig{Timeout: 5 * time.Second, MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	client := &http.Client{Timeout: cnf.Timeout}
+	jwtOAuthInstance.deliverWebhooks(context.Background(), client, cnf)
+	time.Sleep(10 * time.Millisecond)
+	jwtOAuthInstance.deliverWebhooks(context.Background(), client, cnf)
+
+	all := receivedOf("/all")
+	assert.Len(t, all, 4)
+	for idx, typ := range []EventType{EventUserCreated, EventUserCreated, EventTokenGenerated, EventTokenGenerated} {
+		assert.Equal(t, typ, all[idx].Type)
+	}
+	// the token of read permission is filtered out
+	ofUser := receivedOf("/user")
+	assert.Len(t, ofUser, 2)
+	assert.Equal(t, EventUserCreated, ofUser[0].Type)
+	assert.Equal(t, EventTokenGenerated, ofUser[1].Type)
+	assert.Equal(t, core.PermSign, ofUser[1].Perm)
+
+	// delivered in order after retried
+	flaky := receivedOf("/flaky")
+	assert.Len(t, flaky, 2)
+	assert.Equal(t, "webhook_user_01", flaky[0].User)
+	assert.Equal(t, "webhook_user_02", flaky[1].User)
+	deliveries, err := jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "flaky"})
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, storage.DeliveryDelivered, deliveries[1].State)
+	assert.Equal(t, 2, deliveries[1].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[1].StatusCode)
+	assert.Empty(t, deliveries[1].Error)
+
+	// the first one fails after the max attempts, the next one waits in the outbox
+	failed, err := jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "fail", State: storage.DeliveryFailed})
+	assert.Nil(t, err)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, cnf.MaxAttempts, failed[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, failed[0].StatusCode)
+	assert.Contains(t, failed[0].Error, "always fail")
+	var payload WebhookPayload
+	assert.Nil(t, json.Unmarshal(failed[0].Payload, &payload))
+	assert.Equal(t, "webhook_user_01", payload.Event.User)
+	pending, err := jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "fail", State: storage.DeliveryPending})
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+
+	// the pending ones fail without attempts once the webhook disabled
+	disabled := true
+	_, err = jwtOAuthInstance.UpdateWebhook(adminCtx, &UpdateWebhookReq{Name: "fail", Disabled: &disabled})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "webhook_user_03"})
+	assert.Nil(t, err)
+	jwtOAuthInstance.deliverWebhooks(context.Background(), client, cnf)
+	deliveries, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "fail", Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, storage.DeliveryFailed, deliveries[0].State)
+	assert.Equal(t, "webhook disabled", deliveries[0].Error)
+	assert.Len(t, receivedOf("/all"), 5)
+
+	// the later ones are not posted while the first one backs off, though they are due
+	_, err = jwtOAuthInstance.CreateWebhook(adminCtx, &CreateWebhookReq{Name: "slow", URL: receiver.URL + "/slow", Secret: secret,
+		Events: []EventType{EventUserCreated}})
+	assert.Nil(t, err)
+	for _, name := range []string{"webhook_user_04", "webhook_user_05"} {
+		_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+	}
+	slowCnf := *cnf
+	slowCnf.MinBackoff, slowCnf.MaxBackoff = time.Hour, time.Hour
+	jwtOAuthInstance.deliverWebhooks(context.Background(), client, &slowCnf)
+	jwtOAuthInstance.deliverWebhooks(context.Background(), client, &slowCnf)
+	assert.Empty(t, receivedOf("/slow"))
+	pending, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "slow", State: storage.DeliveryPending})
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+	assert.Equal(t, 0, pending[0].Attempts)
+	assert.Equal(t, 1, pending[1].Attempts)
+
+	_, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{State: "unknown"})
+	assert.True(t, errors.Is(err, errcode.ErrInvalidArgument))
+	_, err = jwtOAuthInstance.ListWebhookDeliveries(signCtx, &ListWebhookDeliveriesReq{})
+	assert.True(t, errors.Is(err, ErrorPermissionDeny))
+
+	// the deliveries are committed along with the change, with the ids of the events published
+	subCtx, cancel := context.WithCancel(context.Background())
+	events := jwtOAuthInstance.events.subscribe(subCtx, "", nil)
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "webhook_user_06"})
+	assert.Nil(t, err)
+	published := <-events
+	cancel()
+	deliveries, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "all", Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, published.ID, deliveries[0].EventID)
+	assert.Nil(t, json.Unmarshal(deliveries[0].Payload, &payload))
+	assert.Equal(t, published.ID, payload.Event.ID)
+	// and rolled back along with it
+	err = jwtOAuthInstance.commit(func(store storage.Store) ([]*Event, error) {
+		if err := store.PutUser(&storage.User{Id: "webhook_user_07_id", Name: "webhook_user_07", State: core.UserStateEnabled}); err != nil {
+			return nil, err
+		}
+		return []*Event{{Type: EventUserCreated, User: "webhook_user_07"}}, errors.New("broken change")
+	})
+	assert.EqualError(t, err, "broken change")
+	has, err := jwtOAuthInstance.store.HasUser("webhook_user_07")
+	assert.Nil(t, err)
+	assert.False(t, has)
+	deliveries, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "all", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, published.ID, deliveries[0].EventID)
+
+	// the deliveries are deleted along with the webhook
+	assert.Nil(t, jwtOAuthInstance.DeleteWebhook(adminCtx, &DeleteWebhookReq{Name: "all"}))
+	deliveries, err = jwtOAuthInstance.ListWebhookDeliveries(adminCtx, &ListWebhookDeliveriesReq{Webhook: "all"})
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 0)
+	_, err = jwtOAuthInstance.GetWebhook(adminCtx, &GetWebhookReq{Name: "all"})
+	assert.True(t, storage.IsNotFound(err))
+	assert.True(t, storage.IsNotFound(jwtOAuthInstance.DeleteWebhook(adminCtx, &DeleteWebhookReq{Name: "all"})))
+}
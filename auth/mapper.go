@@ -7,6 +7,9 @@ import (
 type Mapper interface {
 	ToOutPutUser(user *storage.User) *OutputUser
 	ToOutPutUsers(arr []*storage.User) []*OutputUser
+	ToOutPutMiner(m *storage.Miner) *OutputMiner
+	ToOutPutSigner(m *storage.Signer) *OutputSigner
+	ToOutPutOrg(org *storage.Organization) *OutputOrg
 }
 
 type mapper struct{}
@@ -26,6 +29,8 @@ func (o *mapper) ToOutPutUser(m *storage.User) *OutputUser {
 		State:      m.State,
 		CreateTime: m.CreateTime.Unix(),
 		UpdateTime: m.UpdateTime.Unix(),
+		Org:        m.Org,
+		OrgAdmin:   m.OrgAdmin,
 	}
 }
 
@@ -36,3 +41,47 @@ func (o *mapper) ToOutPutUsers(arr []*storage.User) []*OutputUser {
 	}
 	return list
 }
+
+func (o *mapper) ToOutPutMiner(m *storage.Miner) *OutputMiner {
+	if m == nil {
+		return nil
+	}
+	out := &OutputMiner{
+		Miner:     m.Miner.Address(),
+		User:      m.User,
+		Labels:    m.Labels,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+	if m.OpenMining != nil {
+		out.OpenMining = *m.OpenMining
+	}
+	return out
+}
+
+func (o *mapper) ToOutPutSigner(m *storage.Signer) *OutputSigner {
+	if m == nil {
+		return nil
+	}
+	return &OutputSigner{
+		Signer:    m.Signer.Address(),
+		User:      m.User,
+		Policy:    m.Policy,
+		Spent:     m.Spent,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+func (o *mapper) ToOutPutOrg(m *storage.Organization) *OutputOrg {
+	if m == nil {
+		return nil
+	}
+	return &OutputOrg{
+		Id:         m.Id,
+		Name:       m.Name,
+		Comment:    m.Comment,
+		CreateTime: m.CreateTime.Unix(),
+		UpdateTime: m.UpdateTime.Unix(),
+	}
+}
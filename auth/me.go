@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// callerName returns the name of the caller placed in context by `permMiddleWare`
+func callerName(ctx context.Context) (string, error) {
+	name, ok := core.CtxGetName(ctx)
+	if !ok || len(name) == 0 {
+		return "", ErrorUsernameNotFound
+	}
+	return name, nil
+}
+
+// GenerateMyToken generates a token for the caller, whose permission can't be higher than the caller's
+func (o *jwtOAuth) GenerateMyToken(ctx context.Context, req *GenerateMyTokenReq) (string, error) {
+	name, err := callerName(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !core.IsValid(req.Perm) {
+		return "", errcode.Errorf(errcode.CodeInvalidArgument, "invalid perm %s", req.Perm)
+	}
+	if err := permCheck(ctx, req.Perm); err != nil {
+		return "", fmt.Errorf("perm %s is higher than the caller's: %w", req.Perm, err)
+	}
+
+	tk, err := o.generateToken(ctx, &JWTPayload{Name: name, Perm: req.Perm, Extra: req.Extra}, &req.TokenMeta)
+	if err != nil {
+		return "", err
+	}
+	auditLog(ctx, "generateMyToken", log.Fields{core.FieldName: name, "perm": req.Perm})
+	return tk, nil
+}
+
+func (o *jwtOAuth) UpdateMe(ctx context.Context, req *UpdateMeReq) error {
+	name, err := callerName(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		return err
+	}
+	if req.Comment != nil {
+		user.Comment = *req.Comment
+	}
+	user.UpdateTime = time.Now().Local()
+	return o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventUserUpdated, User: name}}, store.UpdateUser(user)
+	})
+}
+
+// RegisterMySigners registers signers for the caller if it's allowed by the self-service policy
+func (o *jwtOAuth) RegisterMySigners(ctx context.Context, req *RegisterMySignersReq) error {
+	name, err := callerName(ctx)
+	if err != nil {
+		return err
+	}
+	if o.selfService == nil || !o.selfService.RegisterSigner {
+		return fmt.Errorf("registering signers by users themselves is disabled: %w", ErrorPermissionDeny)
+	}
+
+	newSigners := make(map[address.Address]struct{}, len(req.Signers))
+	for _, signer := range req.Signers {
+		if !IsSignerAddress(signer) {
+			return errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", signer.Protocol())
+		}
+		newSigners[signer] = struct{}{}
+	}
+	signers, err := o.store.ListSigner(name)
+	if err != nil {
+		return err
+	}
+	for _, signer := range signers {
+		delete(newSigners, signer.Signer.Address())
+	}
+	if maxSigners := o.selfService.MaxSigners; maxSigners > 0 && len(signers)+len(newSigners) > maxSigners {
+		return fmt.Errorf("user %s can have at most %d signers, already has %d: %w",
+			name, maxSigners, len(signers), ErrorPermissionDeny)
+	}
+
+	for signer := range newSigners {
+		err := o.commit(func(store storage.Store) ([]*Event, error) {
+			return []*Event{{Type: EventSignerRegistered, User: name, Signer: signer.String()}}, store.RegisterSigner(signer, name)
+		})
+		if err != nil {
+			return fmt.Errorf("register signer:%s, error: %w", signer, err)
+		}
+		o.aliasSigner(ctx, signer)
+		auditLog(ctx, "registerMySigner", log.Fields{core.FieldName: name, core.FieldSigner: signer.String()})
+	}
+	return nil
+}
+
+func (o *jwtOAuth) GetMyRateLimits(ctx context.Context) (GetUserRateLimitResponse, error) {
+	name, err := callerName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := o.store.GetRateLimits(name, "")
+	if err != nil {
+		return nil, err
+	}
+	return o.rateLimit.fill(name, limits), nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// the checks below fall back to the organization of the caller when the caller is not admin,
+// the error of the admin check is returned if the caller doesn't manage the target either.
+
+// callerOrg returns the organization of the caller and whether the caller is an org admin of it
+func (o *jwtOAuth) callerOrg(ctx context.Context) (string, bool) {
+	callerName, ok := core.CtxGetName(ctx)
+	if !ok {
+		return "", false
+	}
+	caller, err := o.store.GetUser(callerName)
+	if err != nil {
+		return "", false
+	}
+	return caller.Org, caller.OrgAdmin
+}
+
+// orgAdminOf returns nil if the caller is admin, or an org admin of the organization,
+// the org admin should call with a token of sign permission at least, the read ones manage nothing
+func (o *jwtOAuth) orgAdminOf(ctx context.Context, org string) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err == nil {
+		return nil
+	}
+	if permCheck(ctx, core.PermSign) != nil {
+		return err
+	}
+	if callerOrg, isAdmin := o.callerOrg(ctx); len(org) != 0 && isAdmin && callerOrg == org {
+		return nil
+	}
+	return err
+}
+
+// orgAdminCheck returns nil if the caller is admin, or an org admin of the organization the user belongs to
+func (o *jwtOAuth) orgAdminCheck(ctx context.Context, userName string) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err == nil {
+		return nil
+	}
+	// a user unknown is outside of any organization
+	if user, getErr := o.store.GetUser(userName); getErr == nil && o.orgAdminOf(ctx, user.Org) == nil {
+		return nil
+	}
+	return err
+}
+
+// orgUserPermCheck returns nil if the caller is admin, the user itself, or an org admin of the user
+func (o *jwtOAuth) orgUserPermCheck(ctx context.Context, userName string) error {
+	err := userPermCheck(ctx, userName)
+	if err == nil || o.orgAdminCheck(ctx, userName) == nil {
+		return nil
+	}
+	return err
+}
+
+// orgMemberCheck returns nil if the caller is admin or a user in the organization
+func (o *jwtOAuth) orgMemberCheck(ctx context.Context, org string) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err == nil {
+		return nil
+	}
+	if callerOrg, _ := o.callerOrg(ctx); len(org) != 0 && callerOrg == org {
+		return nil
+	}
+	return err
+}
+
+func (o *jwtOAuth) CreateOrg(ctx context.Context, req *CreateOrgRequest) (*OutputOrg, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	exist, err := o.store.HasOrg(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, errcode.Errorf(errcode.CodeAlreadyExists, "organization already exists")
+	}
+	org := &storage.Organization{
+		Id:         uuid.NewString(),
+		Name:       req.Name,
+		CreateTime: time.Now().Local(),
+		UpdateTime: time.Now().Local(),
+		IsDeleted:  core.NotDelete,
+	}
+	if req.Comment != nil {
+		org.Comment = *req.Comment
+	}
+	if err := o.store.PutOrg(org); err != nil {
+		return nil, err
+	}
+
+	auditLog(ctx, "createOrg", log.Fields{core.FieldOrg: org.Name})
+	return o.mp.ToOutPutOrg(org), nil
+}
+
+func (o *jwtOAuth) GetOrg(ctx context.Context, req *GetOrgRequest) (*OutputOrg, error) {
+	if err := o.orgMemberCheck(ctx, req.Name); err != nil {
+		return nil, fmt.Errorf("need admin prem or member of organization %s: %w", req.Name, err)
+	}
+
+	org, err := o.store.GetOrg(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return o.mp.ToOutPutOrg(org), nil
+}
+
+func (o *jwtOAuth) ListOrgs(ctx context.Context) (ListOrgsResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	orgs, err := o.store.ListOrgs()
+	if err != nil {
+		return nil, err
+	}
+	out := make(ListOrgsResponse, len(orgs))
+	for idx, org := range orgs {
+		out[idx] = o.mp.ToOutPutOrg(org)
+	}
+	return out, nil
+}
+
+// DeleteOrg only deletes an organization without users, users should be deleted or removed from it first
+func (o *jwtOAuth) DeleteOrg(ctx context.Context, req *DeleteOrgRequest) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	err = o.store.Transaction(func(store storage.Store) error {
+		users, err := store.ListOrgUsers(req.Name)
+		if err != nil {
+			return err
+		}
+		if len(users) != 0 {
+			return fmt.Errorf("organization %s still has %d users", req.Name, len(users))
+		}
+		return store.DeleteOrg(req.Name)
+	})
+	if err != nil {
+		return err
+	}
+
+	auditLog(ctx, "deleteOrg", log.Fields{core.FieldOrg: req.Name})
+	return nil
+}
+
+func (o *jwtOAuth) ListOrgUsers(ctx context.Context, req *ListOrgUsersRequest) (ListUsersResponse, error) {
+	if err := o.orgAdminOf(ctx, req.Name); err != nil {
+		return nil, fmt.Errorf("need admin prem or org admin of %s: %w", req.Name, err)
+	}
+
+	users, err := o.store.ListOrgUsers(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return o.mp.ToOutPutUsers(users), nil
+}
+
+// SetOrgMember moves the user into the organization, an empty organization removes the user from its organization
+func (o *jwtOAuth) SetOrgMember(ctx context.Context, req *SetOrgMemberRequest) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if len(req.Org) == 0 && req.Admin {
+		return errcode.Errorf(errcode.CodeInvalidArgument, "user without organization can't be org admin")
+	}
+	if len(req.Org) != 0 {
+		exist, err := o.store.HasOrg(req.Org)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errcode.Errorf(errcode.CodeNotFound, "organization %s not exists", req.Org)
+		}
+	}
+
+	user, err := o.store.GetUser(req.User)
+	if err != nil {
+		return err
+	}
+	user.Org, user.OrgAdmin = req.Org, req.Admin
+	user.UpdateTime = time.Now().Local()
+	err = o.commit(func(store storage.Store) ([]*Event, error) {
+		return []*Event{{Type: EventUserUpdated, User: user.Name}}, store.UpdateUser(user)
+	})
+	if err != nil {
+		return err
+	}
+
+	auditLog(ctx, "setOrgMember", log.Fields{core.FieldOrg: req.Org, core.FieldName: req.User, "admin": req.Admin})
+	return nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// returned by the update function of `CheckSignerPolicy` to leave the signer untouched
+var errSkipUpdate = errors.New("skip update")
+
+const spentDayLayout = "2006-01-02"
+
+// parseAttoFIL parses a non-negative decimal value in attoFIL, empty string is zero
+func parseAttoFIL(s string) (*big.Int, error) {
+	if len(s) == 0 {
+		return new(big.Int), nil
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal integer", s)
+	}
+	if v.Sign() < 0 {
+		return nil, fmt.Errorf("%q is negative", s)
+	}
+	return v, nil
+}
+
+func checkSignerPolicy(policy *storage.SignerPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if _, err := parseAttoFIL(policy.MaxValue); err != nil {
+		return fmt.Errorf("invalid max value: %w", err)
+	}
+	if _, err := parseAttoFIL(policy.DailyCap); err != nil {
+		return fmt.Errorf("invalid daily cap: %w", err)
+	}
+	return nil
+}
+
+// evalSignerPolicy returns the reason if the message is rejected by the policy of signer,
+// otherwise returns the spending of the day including the message, nil if there is no daily cap.
+func evalSignerPolicy(signer *storage.Signer, method uint64, value *big.Int, now time.Time) (*storage.SignerSpent, string) {
+	policy := signer.Policy
+	if policy == nil {
+		return nil, ""
+	}
+
+	if len(policy.AllowedMethods) != 0 {
+		allowed := false
+		for _, m := range policy.AllowedMethods {
+			if m == method {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Sprintf("method %d is not allowed", method)
+		}
+	}
+
+	if len(policy.MaxValue) != 0 {
+		maxValue, err := parseAttoFIL(policy.MaxValue)
+		if err != nil {
+			return nil, fmt.Sprintf("invalid max value of policy: %s", err)
+		}
+		if value.Cmp(maxValue) > 0 {
+			return nil, fmt.Sprintf("value %s exceeds max value %s", value, maxValue)
+		}
+	}
+
+	if len(policy.DailyCap) == 0 {
+		return nil, ""
+	}
+	dailyCap, err := parseAttoFIL(policy.DailyCap)
+	if err != nil {
+		return nil, fmt.Sprintf("invalid daily cap of policy: %s", err)
+	}
+	day := now.UTC().Format(spentDayLayout)
+	spent := new(big.Int)
+	// spending of previous days is dropped
+	if signer.Spent != nil && signer.Spent.Day == day {
+		if spent, err = parseAttoFIL(signer.Spent.Amount); err != nil {
+			return nil, fmt.Sprintf("invalid spent amount: %s", err)
+		}
+	}
+	spent.Add(spent, value)
+	if spent.Cmp(dailyCap) > 0 {
+		return nil, fmt.Sprintf("value %s exceeds daily cap %s, already spent %s today",
+			value, dailyCap, new(big.Int).Sub(spent, value))
+	}
+	return &storage.SignerSpent{Day: day, Amount: spent.String()}, ""
+}
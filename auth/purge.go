@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+const retentionName = "retention"
+
+type PurgeReq struct {
+	// records soft-deleted longer than it are purged
+	OlderThan time.Duration `json:"olderThan"`
+	// token, user, miner or signer, all kinds if empty
+	Kinds  []string `json:"kinds"`
+	DryRun bool     `json:"dryRun"`
+}
+
+type PurgeResp struct {
+	Before  time.Time            `json:"before"`
+	DryRun  bool                 `json:"dryRun"`
+	Summary storage.PurgeSummary `json:"summary"`
+}
+
+// Purge hard deletes the records soft-deleted longer than `req.OlderThan`, they can't be recovered any more.
+// Tokens, miners and signers of the purged users are purged along whatever `req.Kinds` is.
+func (o *jwtOAuth) Purge(ctx context.Context, req *PurgeReq) (*PurgeResp, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	if req.OlderThan < 0 {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "older than should not be negative, got %s", req.OlderThan)
+	}
+	kinds := req.Kinds
+	if len(kinds) == 0 {
+		kinds = storage.PurgeKinds
+	}
+	for _, kind := range kinds {
+		if !isPurgeKind(kind) {
+			return nil, errcode.Errorf(errcode.CodeInvalidArgument, "invalid purge kind %q, should be one of %v", kind, storage.PurgeKinds)
+		}
+	}
+
+	before := time.Now().Add(-req.OlderThan)
+	summary, err := o.store.Purge(kinds, before, req.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("purge: %w", err)
+	}
+	if !req.DryRun {
+		auditLog(ctx, "purge", log.Fields{"kinds": kinds, "before": before, "summary": summary})
+	}
+	return &PurgeResp{Before: before, DryRun: req.DryRun, Summary: summary}, nil
+}
+
+func isPurgeKind(kind string) bool {
+	for _, k := range storage.PurgeKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Retain purges the records soft-deleted longer than `cnf.OlderThan` every `cnf.Interval`, it returns when ctx is done.
+func (o *oauthApp) Retain(ctx context.Context, cnf *config.RetentionConfig) {
+	adminCtx := core.CtxWithName(core.CtxWithPerm(ctx, core.PermAdmin), retentionName)
+	ticker := time.NewTicker(cnf.Interval)
+	defer ticker.Stop()
+
+	log.Infof("purge records deleted for %s every %s, kinds: %v", cnf.OlderThan, cnf.Interval, cnf.Kinds)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// the leader purges for all the nodes
+			if !o.srv.IsLeader() {
+				continue
+			}
+			res, err := o.srv.Purge(adminCtx, &PurgeReq{OlderThan: cnf.OlderThan, Kinds: cnf.Kinds})
+			if err != nil {
+				log.Errorf("retention: %s", err)
+				continue
+			}
+			log.Infof("retention: purge records deleted before %s: %v", res.Before.Format(time.RFC3339), res.Summary)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// defaultRateLimit the rate limit of users without a limit of their own, it's replaced when the config reloaded
+type defaultRateLimit struct {
+	lk  sync.RWMutex
+	cnf *config.RateLimitConfig
+}
+
+func (d *defaultRateLimit) set(cnf *config.RateLimitConfig) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.cnf = cnf
+}
+
+// fill appends the default limit, which has an empty id, if none of limits applies to all services and apis
+func (d *defaultRateLimit) fill(name string, limits GetUserRateLimitResponse) GetUserRateLimitResponse {
+	d.lk.RLock()
+	cnf := d.cnf
+	d.lk.RUnlock()
+
+	if cnf == nil || cnf.Cap <= 0 || limits.MatchedLimit("", "") != nil {
+		return limits
+	}
+	return append(limits, &storage.UserRateLimit{
+		Name:     name,
+		ReqLimit: storage.ReqLimit{Cap: cnf.Cap, ResetDur: cnf.ResetDur},
+	})
+}
+
+// WithDefaultRateLimit sets the rate limit of users without a limit of their own
+func WithDefaultRateLimit(cnf *config.RateLimitConfig) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.rateLimit.set(cnf)
+	}
+}
+
+func (o *jwtOAuth) SetDefaultRateLimit(cnf *config.RateLimitConfig) {
+	o.rateLimit.set(cnf)
+	// the rate limits of all users may change
+	o.changeLog.reset()
+	ev := &Event{Type: EventRateLimitChanged}
+	// every node reloads the config, only the leader enqueues the deliveries
+	if !o.IsLeader() {
+		o.commitLk.Lock()
+		o.events.publish(ev)
+		o.commitLk.Unlock()
+		return
+	}
+	if err := o.commit(func(storage.Store) ([]*Event, error) {
+		return []*Event{ev}, nil
+	}); err != nil {
+		log.Errorf("enqueue deliveries of event %s: %s", ev.Type, err)
+	}
+}
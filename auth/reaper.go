@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+const reaperName = "reaper"
+
+// reports of the latest runs kept in memory, the oldest is dropped first
+const maxReaperReports = 30
+
+// actions taken on stale tokens and users
+const (
+	ReapActionReported = "reported"
+	ReapActionDisabled = "disabled"
+	ReapActionRemoved  = "removed"
+)
+
+type ReapedToken struct {
+	Token        string     `json:"token"`
+	Name         string     `json:"name"`
+	Perm         string     `json:"perm"`
+	CreateTime   time.Time  `json:"createTime"`
+	LastUsedTime *time.Time `json:"lastUsedTime"`
+	Action       string     `json:"action"`
+}
+
+type ReapedUser struct {
+	Name       string    `json:"name"`
+	CreateTime time.Time `json:"createTime"`
+	Action     string    `json:"action"`
+}
+
+// ReaperReport what a run of the reaper found and did
+type ReaperReport struct {
+	StartTime time.Time      `json:"startTime"`
+	EndTime   time.Time      `json:"endTime"`
+	Policy    string         `json:"policy"`
+	StaleDays int            `json:"staleDays"`
+	Tokens    []*ReapedToken `json:"tokens"`
+	Users     []*ReapedUser  `json:"users"`
+	// failures of disabling or removing, the run goes on with others
+	Errors []string `json:"errors"`
+}
+
+type reaperReports struct {
+	lk      sync.Mutex
+	reports []*ReaperReport
+}
+
+func (r *reaperReports) add(report *ReaperReport) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.reports = append(r.reports, report)
+	if len(r.reports) > maxReaperReports {
+		r.reports = r.reports[len(r.reports)-maxReaperReports:]
+	}
+}
+
+// list returns reports from the newest
+func (r *reaperReports) list() []*ReaperReport {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	res := make([]*ReaperReport, len(r.reports))
+	for idx, report := range r.reports {
+		res[len(res)-1-idx] = report
+	}
+	return res
+}
+
+// Reap finds tokens not verified for `cnf.StaleDays` days and the users whose tokens are all of them,
+// then reports, disables or removes them by `cnf.Policy`. Users in `cnf.Protected` and their tokens are skipped.
+func (o *jwtOAuth) Reap(ctx context.Context, cnf *config.ReaperConfig) (*ReaperReport, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	switch cnf.Policy {
+	case config.ReaperPolicyReport, config.ReaperPolicyDisable, config.ReaperPolicyDelete:
+	default:
+		return nil, fmt.Errorf("invalid reaper policy %q", cnf.Policy)
+	}
+	if cnf.StaleDays <= 0 {
+		return nil, fmt.Errorf("stale days should be positive, got %d", cnf.StaleDays)
+	}
+
+	protected := map[string]struct{}{DefaultAdminTokenName: {}}
+	for _, name := range cnf.Protected {
+		protected[name] = struct{}{}
+	}
+	report := &ReaperReport{
+		StartTime: time.Now(),
+		Policy:    cnf.Policy,
+		StaleDays: cnf.StaleDays,
+	}
+	deadline := report.StartTime.Add(-time.Duration(cnf.StaleDays) * 24 * time.Hour)
+
+	// usages not flushed yet may make stale tokens live
+	if o.usage != nil {
+		if err := o.usage.flush(); err != nil {
+			return nil, fmt.Errorf("flush usages of tokens: %w", err)
+		}
+	}
+	// tokens created before usages are tracked may have been used without a record of it,
+	// they are aged from the time the tracking started
+	trackingSince, err := o.store.UsageTrackingSince()
+	if err != nil {
+		return nil, fmt.Errorf("get the time usages of tokens tracked since: %w", err)
+	}
+	kps, err := o.store.List(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	// users without any token, such as owners of miners, are never reaped
+	liveTokens, staleTokens := make(map[string]int), make(map[string]int)
+	for _, kp := range kps {
+		if _, ok := protected[kp.Name]; ok {
+			continue
+		}
+		lastUsed := kp.CreateTime
+		if kp.LastUsedTime != nil {
+			lastUsed = *kp.LastUsedTime
+		} else if lastUsed.Before(trackingSince) {
+			lastUsed = trackingSince
+		}
+		if !lastUsed.Before(deadline) {
+			liveTokens[kp.Name]++
+			continue
+		}
+
+		staleTokens[kp.Name]++
+		reaped := &ReapedToken{
+			Token:        kp.Token.String(),
+			Name:         kp.Name,
+			Perm:         kp.Perm,
+			CreateTime:   kp.CreateTime,
+			LastUsedTime: kp.LastUsedTime,
+			Action:       ReapActionReported,
+		}
+		if cnf.Policy != config.ReaperPolicyReport {
+			if err := o.RemoveToken(ctx, reaped.Token); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else {
+				reaped.Action = ReapActionRemoved
+				auditLog(ctx, "reapToken", log.Fields{core.FieldName: kp.Name, "token": reaped.Token})
+			}
+		}
+		report.Tokens = append(report.Tokens, reaped)
+	}
+
+	users, err := o.store.ListUsers(0, 0, core.UserStateUndefined)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	for _, user := range users {
+		if _, ok := protected[user.Name]; ok || staleTokens[user.Name] == 0 || liveTokens[user.Name] != 0 || !user.CreateTime.Before(deadline) {
+			continue
+		}
+		// don't report the users disabled before again and again
+		if cnf.Policy == config.ReaperPolicyDisable && user.State == core.UserStateDisabled {
+			continue
+		}
+
+		reaped := &ReapedUser{Name: user.Name, CreateTime: user.CreateTime, Action: ReapActionReported}
+		var err error
+		switch cnf.Policy {
+		case config.ReaperPolicyDisable:
+			err = o.UpdateUser(ctx, &UpdateUserRequest{Name: user.Name, State: core.UserStateDisabled})
+			if err == nil {
+				reaped.Action = ReapActionDisabled
+				auditLog(ctx, "reapUser", log.Fields{core.FieldName: user.Name, "action": reaped.Action})
+			}
+		case config.ReaperPolicyDelete:
+			err = o.DeleteUser(ctx, &DeleteUserRequest{Name: user.Name})
+			if err == nil {
+				reaped.Action = ReapActionRemoved
+				auditLog(ctx, "reapUser", log.Fields{core.FieldName: user.Name, "action": reaped.Action})
+			}
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("reap user %s: %s", user.Name, err))
+		}
+		report.Users = append(report.Users, reaped)
+	}
+
+	report.EndTime = time.Now()
+	o.reports.add(report)
+	return report, nil
+}
+
+func (o *jwtOAuth) ListReaperReports(ctx context.Context) ([]*ReaperReport, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	return o.reports.list(), nil
+}
+
+// Reap runs the reaper every `cnf.Interval`, it returns when ctx is done.
+func (o *oauthApp) Reap(ctx context.Context, cnf *config.ReaperConfig) {
+	adminCtx := core.CtxWithName(core.CtxWithPerm(ctx, core.PermAdmin), reaperName)
+	ticker := time.NewTicker(cnf.Interval)
+	defer ticker.Stop()
+
+	log.Infof("reap tokens not used for %d days every %s, policy: %s", cnf.StaleDays, cnf.Interval, cnf.Policy)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// the leader reaps for all the nodes
+			if !o.srv.IsLeader() {
+				continue
+			}
+			report, err := o.srv.Reap(adminCtx, cnf)
+			if err != nil {
+				log.Errorf("reap: %s", err)
+				continue
+			}
+			log.Infof("reap: %d stale tokens and %d stale users found, policy: %s, %d errors, see `maintenance reports`",
+				len(report.Tokens), len(report.Users), cnf.Policy, len(report.Errors))
+		}
+	}
+}
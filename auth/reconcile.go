@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+const reconcilerName = "reconciler"
+
+// wait for editors to finish writing the manifest before applying it
+var reconcileDebounce = time.Second
+
+// Reconcile applies the manifest every `cnf.Interval` and whenever the manifest file changed,
+// it returns when ctx is done.
+func (o *oauthApp) Reconcile(ctx context.Context, cnf *config.ReconcileConfig) {
+	path := filepath.Clean(cnf.ManifestPath)
+	adminCtx := core.CtxWithName(core.CtxWithPerm(ctx, core.PermAdmin), reconcilerName)
+	apply := func() {
+		// the leader reconciles for all the nodes
+		if !o.srv.IsLeader() {
+			return
+		}
+		manifest, err := LoadManifest(path)
+		if err != nil {
+			log.Errorf("reconcile: %s", err)
+			return
+		}
+		res, err := o.srv.BulkApply(adminCtx, &BulkApplyReq{Manifest: *manifest, Prune: cnf.Prune, Protected: cnf.Protected})
+		if err != nil {
+			log.Errorf("reconcile %s: %s", path, err)
+			return
+		}
+		for _, change := range res.Changes {
+			log.Infof("reconcile: %s %s %s of user %s %s", change.Action, change.Kind, change.Target, change.User, change.Detail)
+		}
+		// tokens are not logged, get them by `token list`
+		if len(res.Changes) != 0 {
+			log.Infof("reconcile %s: %d changes applied, %d tokens minted", path, len(res.Changes), len(res.Tokens))
+		}
+	}
+
+	// watch the directory, since editors usually replace the file instead of writing it
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warnf("reconcile: create watcher failed, only apply periodically: %s", err)
+	} else {
+		defer watcher.Close() //nolint
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			log.Warnf("reconcile: watch %s failed, only apply periodically: %s", path, err)
+		}
+	}
+	var events <-chan fsnotify.Event
+	if watcher != nil {
+		events = watcher.Events
+	}
+
+	var tick <-chan time.Time
+	if cnf.Interval > 0 {
+		ticker := time.NewTicker(cnf.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// apply once at start
+	debounce := time.NewTimer(0)
+	defer debounce.Stop()
+	log.Infof("reconcile %s every %s, prune: %v", path, cnf.Interval, cnf.Prune)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			apply()
+		case <-debounce.C:
+			apply()
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(ev.Name) != path || ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if !debounce.Stop() {
+				select {
+				case <-debounce.C:
+				default:
+				}
+			}
+			debounce.Reset(reconcileDebounce)
+		}
+	}
+}
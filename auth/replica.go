@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+// changeLogSize how many changes are kept for replica clients to catch up, those fall behind further sync a snapshot
+const changeLogSize = 4096
+
+type changeEntry struct {
+	seq  uint64
+	user string
+}
+
+// changeLog records the users whose user, miners, signers or rate limits changed, so replica clients
+// only fetch them, see `jwtclient.ReplicaClient`. It's kept in memory, a new epoch starts when the service
+// started or the changes are unknown, and replica clients sync a snapshot in a new epoch.
+type changeLog struct {
+	lk    sync.Mutex
+	epoch string
+	seq   uint64
+	// the seq of the latest change dropped from entries
+	dropped uint64
+	entries []changeEntry
+}
+
+func newChangeLog() *changeLog {
+	return &changeLog{epoch: uuid.NewString()}
+}
+
+// record should be called after the changes written, empty names are skipped and a nil log records nothing
+func (l *changeLog) record(users ...string) {
+	if l == nil || len(users) == 0 {
+		return
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	for _, user := range users {
+		if len(user) == 0 {
+			continue
+		}
+		l.seq++
+		l.entries = append(l.entries, changeEntry{seq: l.seq, user: user})
+	}
+	if over := len(l.entries) - changeLogSize; over > 0 {
+		l.dropped = l.entries[over-1].seq
+		l.entries = append(l.entries[:0], l.entries[over:]...)
+	}
+}
+
+// reset starts a new epoch, it's called when what changed is unknown, such as the default rate limit
+func (l *changeLog) reset() {
+	if l == nil {
+		return
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	l.epoch, l.seq, l.dropped, l.entries = uuid.NewString(), 0, 0, nil
+}
+
+func (l *changeLog) current() (string, uint64) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return l.epoch, l.seq
+}
+
+// since returns the users changed after seq of epoch and the current seq, false if they can't be told
+func (l *changeLog) since(epoch string, seq uint64) ([]string, uint64, bool) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if epoch != l.epoch || seq > l.seq || seq < l.dropped {
+		return nil, l.seq, false
+	}
+	seen := make(map[string]struct{})
+	var users []string
+	for _, e := range l.entries {
+		if e.seq <= seq {
+			continue
+		}
+		if _, ok := seen[e.user]; !ok {
+			seen[e.user] = struct{}{}
+			users = append(users, e.user)
+		}
+	}
+	return users, l.seq, true
+}
+
+// ReplicaSnapshot returns all the users with their miners, signers and rate limits, the changes after it
+// are got by `ReplicaChanges` with the epoch and seq of the snapshot
+func (o *jwtOAuth) ReplicaSnapshot(ctx context.Context) (*ReplicaSnapshot, error) {
+	if err := permCheck(ctx, core.PermAdmin); err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	// read the position before the store, the changes written meanwhile are fetched again
+	epoch, seq := o.changeLog.current()
+	users, err := o.store.ListUsers(0, 0, core.UserStateUndefined)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &ReplicaSnapshot{Epoch: epoch, Seq: seq, Users: make([]*ReplicaUser, 0, len(users))}
+	for _, user := range users {
+		ru, err := o.replicaUser(user.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ru != nil {
+			snapshot.Users = append(snapshot.Users, ru)
+		}
+	}
+	return snapshot, nil
+}
+
+// ReplicaChanges returns the users changed after the position of req, `Reset` is set if they can't be told
+func (o *jwtOAuth) ReplicaChanges(ctx context.Context, req *ReplicaChangesReq) (*ReplicaChanges, error) {
+	if err := permCheck(ctx, core.PermAdmin); err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	names, seq, ok := o.changeLog.since(req.Epoch, req.Since)
+	if !ok {
+		return &ReplicaChanges{Reset: true}, nil
+	}
+	changes := &ReplicaChanges{Epoch: req.Epoch, Seq: seq}
+	for _, name := range names {
+		ru, err := o.replicaUser(name)
+		if err != nil {
+			return nil, err
+		}
+		if ru == nil {
+			changes.Removed = append(changes.Removed, name)
+			continue
+		}
+		changes.Users = append(changes.Users, ru)
+	}
+	return changes, nil
+}
+
+// replicaUser returns nil if the user doesn't exist or has been deleted
+func (o *jwtOAuth) replicaUser(name string) (*ReplicaUser, error) {
+	has, err := o.store.HasUser(name)
+	if err != nil || !has {
+		return nil, err
+	}
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		return nil, fmt.Errorf("get user %s: %w", name, err)
+	}
+	ru := &ReplicaUser{User: o.mp.ToOutPutUser(user)}
+
+	miners, err := o.store.ListMiners(name)
+	if err != nil {
+		return nil, fmt.Errorf("list miners of %s: %w", name, err)
+	}
+	for _, m := range miners {
+		ru.Miners = append(ru.Miners, o.mp.ToOutPutMiner(m))
+	}
+	signers, err := o.store.ListSigner(name)
+	if err != nil {
+		return nil, fmt.Errorf("list signers of %s: %w", name, err)
+	}
+	for _, s := range signers {
+		ru.Signers = append(ru.Signers, o.mp.ToOutPutSigner(s))
+	}
+	limits, err := o.store.GetRateLimits(name, "")
+	if err != nil {
+		return nil, fmt.Errorf("get rate limits of %s: %w", name, err)
+	}
+	ru.RateLimits = o.rateLimit.fill(name, limits)
+	return ru, nil
+}
@@ -6,22 +6,44 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/etherlabsio/healthcheck/v2"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/gin-gonic/gin"
+	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
+// RouterOption sets optional parts of the router
+type RouterOption func(*routerOptions)
+
+type routerOptions struct {
+	cors *Cors
+}
+
+// WithCors applies the CORS settings of cors, they can be updated while serving
+func WithCors(cors *Cors) RouterOption {
+	return func(o *routerOptions) {
+		o.cors = cors
+	}
+}
+
 // todo: rm checkPermission after v1.13.0
-func InitRouter(app OAuthApp) http.Handler {
+func InitRouter(app OAuthApp, opts ...RouterOption) http.Handler {
 	gin.SetMode(gin.ReleaseMode)
 
+	options := &routerOptions{cors: NewCors(nil)}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	router := gin.New()
 	router.ContextWithFallback = true
-	router.Use(CorsMiddleWare())
+	router.Use(options.cors.Middleware())
 	router.Use(RewriteAddressInUrl())
 	router.Use(permMiddleWare(app))
 
@@ -31,13 +53,11 @@ func InitRouter(app OAuthApp) http.Handler {
 	})
 
 	router.GET("/version", func(c *gin.Context) {
-		type version struct {
-			Version string
-		}
-		c.JSON(http.StatusOK, version{Version: core.Version})
+		c.JSON(http.StatusOK, VersionResponse{Version: core.Version, Network: core.CurrentNetwork})
 	})
 
 	router.POST("/verify", verifyInterceptor(), app.Verify)
+	router.POST("/verify/batch", verifyInterceptor(), app.VerifyBatch)
 	router.POST("/genToken", app.GenerateToken)
 	router.GET("/token", app.GetToken)
 	router.GET("/tokens", app.Tokens)
@@ -54,6 +74,14 @@ func InitRouter(app OAuthApp) http.Handler {
 	userGroup.POST("/del", app.DeleteUser)
 	userGroup.POST("/recover", app.RecoverUser)
 
+	orgGroup := router.Group("/org")
+	orgGroup.PUT("/new", app.CreateOrg)
+	orgGroup.GET("", app.GetOrg)
+	orgGroup.GET("/list", app.ListOrgs)
+	orgGroup.POST("/del", app.DeleteOrg)
+	orgGroup.GET("/users", app.ListOrgUsers)
+	orgGroup.POST("/member", app.SetOrgMember)
+
 	rateLimitGroup := userGroup.Group("/ratelimit")
 	rateLimitGroup.POST("/upsert", app.UpsertUserRateLimit)
 	rateLimitGroup.POST("/del", app.DelUserRateLimit)
@@ -75,6 +103,8 @@ func InitRouter(app OAuthApp) http.Handler {
 	userMinerGroup.GET("/exist", app.MinerExistInUser)
 	userMinerGroup.GET("/list", app.ListMiners)
 	userMinerGroup.POST("/del", app.DeleteMiner)
+	userMinerGroup.POST("/transfer", app.TransferMiner)
+	userMinerGroup.POST("/labels", app.UpdateMinerLabels)
 
 	userSignerGroup := userGroup.Group("/signer")
 	userSignerGroup.GET("", app.GetUserBySigner)
@@ -82,11 +112,47 @@ func InitRouter(app OAuthApp) http.Handler {
 	userSignerGroup.GET("/exist", app.SignerExistInUser)
 	userSignerGroup.GET("/list", app.ListSigner)
 	userSignerGroup.POST("/unregister", app.UnregisterSigners)
+	userSignerGroup.POST("/policy", app.UpdateSignerPolicy)
+	// counts the value of an allowed message in the daily spending of the signer, unless it's a dry run
+	userSignerGroup.POST("/policy/check", app.CheckSignerPolicy)
 
 	signerGroup := router.Group("/signer")
 	signerGroup.GET("/has", app.HasSigner)
 	signerGroup.POST("/del", app.DelSigner)
 
+	// apis of the caller itself, which is the user of the token
+	meGroup := router.Group("/me")
+	meGroup.GET("", app.GetMe)
+	meGroup.POST("/update", app.UpdateMe)
+	meGroup.GET("/tokens", app.GetMyTokens)
+	meGroup.POST("/token", app.GenerateMyToken)
+	meGroup.GET("/miners", app.ListMyMiners)
+	meGroup.GET("/signers", app.ListMySigners)
+	meGroup.POST("/signer/register", app.RegisterMySigners)
+	meGroup.GET("/ratelimit", app.GetMyRateLimits)
+
+	maintenanceGroup := router.Group("/maintenance")
+	maintenanceGroup.GET("/reports", app.ListReaperReports)
+	maintenanceGroup.POST("/purge", app.Purge)
+
+	bulkGroup := router.Group("/bulk")
+	bulkGroup.POST("/apply", app.BulkApply)
+
+	// users with their miners, signers and rate limits for replica clients
+	replicaGroup := router.Group("/replica")
+	replicaGroup.GET("/snapshot", app.ReplicaSnapshot)
+	replicaGroup.GET("/changes", app.ReplicaChanges)
+
+	router.GET("/events", app.SubscribeEvents)
+
+	webhookGroup := router.Group("/webhook")
+	webhookGroup.PUT("/new", app.CreateWebhook)
+	webhookGroup.POST("/update", app.UpdateWebhook)
+	webhookGroup.GET("", app.GetWebhook)
+	webhookGroup.GET("/list", app.ListWebhooks)
+	webhookGroup.POST("/del", app.DeleteWebhook)
+	webhookGroup.GET("/deliveries", app.ListWebhookDeliveries)
+
 	return router
 }
 
@@ -130,22 +196,73 @@ func (w bodyLogWriter) Write(b []byte) (int, error) {
 	return w.ResponseWriter.Write(b)
 }
 
-func CorsMiddleWare() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers",
-			"DNT,X-Mx-ReqToken,Keep-Alive,User-Agent,X-Requested-With,"+
-				"If-Modified-Since,Cache-Control,Content-Type,Authorization,X-Forwarded-For,Origin,"+
-				"X-Real-Ip,spanId,preHost,svcName")
-		c.Header("Content-Type", "application/json")
-		if c.Request.Method == "OPTIONS" {
-			c.JSON(http.StatusOK, "ok!")
+const corsAllowHeaders = "DNT,X-Mx-ReqToken,Keep-Alive,User-Agent,X-Requested-With," +
+	"If-Modified-Since,Cache-Control,Content-Type,Authorization,X-Forwarded-For,Origin," +
+	"X-Real-Ip,spanId,preHost,svcName"
+
+// Cors the CORS settings of the router, any origin is allowed if the config is nil
+type Cors struct {
+	lk  sync.RWMutex
+	cnf *config.CorsConfig
+}
+
+func NewCors(cnf *config.CorsConfig) *Cors {
+	return &Cors{cnf: cnf}
+}
+
+// Update replaces the settings, the requests after it are checked with cnf
+func (c *Cors) Update(cnf *config.CorsConfig) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.cnf = cnf
+}
+
+// headers returns the allowed origin for origin, empty if it's not allowed, and the allowed headers
+func (c *Cors) headers(origin string) (string, string) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	if c.cnf == nil {
+		return "*", corsAllowHeaders
+	}
+	headers := corsAllowHeaders
+	if len(c.cnf.AllowHeaders) != 0 {
+		headers += "," + strings.Join(c.cnf.AllowHeaders, ",")
+	}
+	for _, allowed := range c.cnf.AllowOrigins {
+		if allowed == "*" {
+			return "*", headers
 		}
-		c.Next()
+		if len(origin) != 0 && allowed == origin {
+			return origin, headers
+		}
+	}
+	return "", headers
+}
+
+func (c *Cors) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		allowOrigin, allowHeaders := c.headers(ctx.GetHeader("Origin"))
+		if allowOrigin != "*" {
+			ctx.Header("Vary", "Origin")
+		}
+		if len(allowOrigin) != 0 {
+			ctx.Header("Access-Control-Allow-Origin", allowOrigin)
+		}
+		ctx.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		ctx.Header("Access-Control-Allow-Headers", allowHeaders)
+		ctx.Header("Content-Type", "application/json")
+		if ctx.Request.Method == "OPTIONS" {
+			ctx.JSON(http.StatusOK, "ok!")
+		}
+		ctx.Next()
 	}
 }
 
+func CorsMiddleWare() gin.HandlerFunc {
+	return NewCors(nil).Middleware()
+}
+
 func RewriteAddressInUrl() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Request.URL.Query()) > 0 {
@@ -153,6 +270,10 @@ func RewriteAddressInUrl() gin.HandlerFunc {
 			for key, params := range queryParams {
 				if key == "miner" || key == "signer" {
 					for index, v := range params {
+						// both 'f' and 't' prefixes are accepted, and normalized to the current network
+						if addr, err := address.NewFromString(v); err == nil {
+							v = addr.String()
+						}
 						params[index] = "\"" + v + "\""
 					}
 				}
@@ -181,19 +302,32 @@ func permMiddleWare(app OAuthApp) gin.HandlerFunc {
 			}
 		}
 
-		if !strings.HasPrefix(token, "Bearer ") {
-			log.Warnf("missing Bearer prefix in sophon-auth header")
-			c.Writer.WriteHeader(401)
-			return
-		}
+		var jwtPayload *JWTPayload
+		var err error
+		if len(token) == 0 && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) != 0 {
+			// a verified client certificate authenticates the request when no token is given
+			cert := c.Request.TLS.VerifiedChains[0][0]
+			jwtPayload, err = app.verifyClientCert(c.ClientIP(), cert)
+			if err != nil {
+				log.Warnf("verify client certificate %s failed: %s", cert.Subject, err)
+				c.Writer.WriteHeader(401)
+				return
+			}
+		} else {
+			if !strings.HasPrefix(token, "Bearer ") {
+				log.Warnf("missing Bearer prefix in sophon-auth header")
+				c.Writer.WriteHeader(401)
+				return
+			}
 
-		token = strings.TrimPrefix(token, "Bearer ")
+			token = strings.TrimPrefix(token, "Bearer ")
 
-		jwtPayload, err := app.verify(token)
-		if err != nil {
-			log.Warnf("verify token %s failed: %s", token, err)
-			c.Writer.WriteHeader(401)
-			return
+			jwtPayload, err = app.verify(c.ClientIP(), token)
+			if err != nil {
+				log.Warnf("verify token %s failed: %s", token, err)
+				c.Writer.WriteHeader(401)
+				return
+			}
 		}
 
 		reqCtx := core.CtxWithPerm(c.Request.Context(), jwtPayload.Perm)
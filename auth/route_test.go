@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	cors := NewCors(nil)
+	router := gin.New()
+	router.Use(cors.Middleware())
+	router.GET("/version", func(c *gin.Context) { c.JSON(http.StatusOK, "") })
+
+	request := func(origin string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/version", nil)
+		if len(origin) != 0 {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	assert.Equal(t, "*", request("http://a.com").Get("Access-Control-Allow-Origin"))
+
+	cors.Update(&config.CorsConfig{AllowOrigins: []string{"http://a.com"}, AllowHeaders: []string{"X-Custom"}})
+	header := request("http://a.com")
+	assert.Equal(t, "http://a.com", header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", header.Get("Vary"))
+	assert.Contains(t, header.Get("Access-Control-Allow-Headers"), "X-Custom")
+	assert.Equal(t, "", request("http://b.com").Get("Access-Control-Allow-Origin"))
+
+	cors.Update(&config.CorsConfig{AllowOrigins: []string{"*"}})
+	assert.Equal(t, "*", request("http://b.com").Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+// WithClientCertPerm accepts verified client certificates as the credentials of the users named by
+// their common names, the requests authenticated by them are granted perm
+func WithClientCertPerm(perm core.Permission) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.clientCertPerm = perm
+	}
+}
+
+// VerifyClientCert authenticates the user named by the common name of a verified client certificate,
+// the user should be enabled.
+func (o *jwtOAuth) VerifyClientCert(ctx context.Context, cert *x509.Certificate) (*JWTPayload, error) {
+	if len(o.clientCertPerm) == 0 {
+		return nil, errcode.Errorf(errcode.CodeUnauthenticated, "client certificates are not accepted")
+	}
+	name := cert.Subject.CommonName
+	if len(name) == 0 {
+		return nil, errcode.Errorf(errcode.CodeUnauthenticated, "no common name in client certificate")
+	}
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		return nil, errcode.Errorf(errcode.CodeUnauthenticated, "get user %s of client certificate: %v", name, err)
+	}
+	if user.State != core.UserStateEnabled {
+		return nil, errcode.Errorf(errcode.CodeUnauthenticated, "user %s of client certificate is disabled", name)
+	}
+	return &JWTPayload{Name: name, Perm: o.clientCertPerm}, nil
+}
+
+// NewTLSConfig returns the TLS config of the server, the certificate and the client CA bundle
+// are reloaded whenever their files changed until ctx done.
+func NewTLSConfig(ctx context.Context, cnf *config.TLSConfig) (*tls.Config, error) {
+	minVersion, err := tlsVersion(cnf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth := tls.NoClientCert
+	if len(cnf.ClientCAFile) != 0 {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if cnf.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if cnf.RequireClientCert {
+		return nil, fmt.Errorf("client CA file is required to verify client certificates")
+	}
+
+	r := &certReloader{cnf: cnf}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if err := r.watch(ctx); err != nil {
+		log.Warnf("watch tls files: %s, they are not reloaded when changed", err)
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: minVersion,
+		ClientAuth: clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.get()
+			return cert, nil
+		},
+	}
+	if clientAuth != tls.NoClientCert {
+		tlsCfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, clientCAs := r.get()
+			cfg := tlsCfg.Clone()
+			cfg.GetConfigForClient = nil
+			cfg.ClientCAs = clientCAs
+			return cfg, nil
+		}
+	}
+	return tlsCfg, nil
+}
+
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "", config.TLSVersion12:
+		return tls.VersionTLS12, nil
+	case config.TLSVersion13:
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls version %s, %s or %s expected", version, config.TLSVersion12, config.TLSVersion13)
+	}
+}
+
+// LoadCertPool reads the PEM encoded certificates in path
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// certReloader keeps the certificate and client CAs of the latest valid files
+type certReloader struct {
+	cnf *config.TLSConfig
+
+	lk        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func (r *certReloader) get() (*tls.Certificate, *x509.CertPool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.cert, r.clientCAs
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.cnf.CertFile, r.cnf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if len(r.cnf.ClientCAFile) != 0 {
+		if clientCAs, err = LoadCertPool(r.cnf.ClientCAFile); err != nil {
+			return fmt.Errorf("load client CA: %w", err)
+		}
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.cert, r.clientCAs = &cert, clientCAs
+	return nil
+}
+
+// watch reloads the files when any of them changed, the directories are watched
+// as the files are usually replaced by renaming or switching symlinks.
+func (r *certReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	files := map[string]struct{}{}
+	for _, file := range []string{r.cnf.CertFile, r.cnf.KeyFile, r.cnf.ClientCAFile} {
+		if len(file) == 0 {
+			continue
+		}
+		file = filepath.Clean(file)
+		files[file] = struct{}{}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close() // nolint
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if _, ok := files[name]; !ok && !strings.HasPrefix(filepath.Base(name), "..") {
+					continue
+				}
+				if err := r.load(); err != nil {
+					log.Warnf("reload tls files after %s changed: %s, keep the loaded ones", name, err)
+					continue
+				}
+				log.Infof("tls files reloaded after %s changed", name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("watch tls files: %s", err)
+			}
+		}
+	}()
+	return nil
+}
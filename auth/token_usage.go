@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// tokenUsageFlushInterval how often the usages of tokens are written to store
+var tokenUsageFlushInterval = time.Minute
+
+// tokenUsageRecorder keeps the latest usage of tokens in memory and writes them to store in batches,
+// so verifying a token doesn't write the store every time.
+type tokenUsageRecorder struct {
+	writer usageWriter
+
+	lk     sync.Mutex
+	usages map[storage.Token]*storage.TokenUsage
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// usageWriter writes the usages of tokens, which is the store, or the leader with replication
+type usageWriter interface {
+	UpdateTokenUsages(usages []*storage.TokenUsage) error
+}
+
+func newTokenUsageRecorder(writer usageWriter) *tokenUsageRecorder {
+	return &tokenUsageRecorder{
+		writer: writer,
+		usages: make(map[storage.Token]*storage.TokenUsage),
+	}
+}
+
+// record overwrites the usage of token not flushed yet
+func (r *tokenUsageRecorder) record(token storage.Token, ip string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.usages[token] = &storage.TokenUsage{Token: token, Time: time.Now(), IP: ip}
+}
+
+// flush writes the recorded usages to store, they are dropped if writing fails
+func (r *tokenUsageRecorder) flush() error {
+	r.lk.Lock()
+	if len(r.usages) == 0 {
+		r.lk.Unlock()
+		return nil
+	}
+	usages := make([]*storage.TokenUsage, 0, len(r.usages))
+	for _, usage := range r.usages {
+		usages = append(usages, usage)
+	}
+	r.usages = make(map[storage.Token]*storage.TokenUsage)
+	r.lk.Unlock()
+
+	return r.writer.UpdateTokenUsages(usages)
+}
+
+// start flushes the usages periodically until closed
+func (r *tokenUsageRecorder) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel, r.done = cancel, make(chan struct{})
+	go func() {
+		defer close(r.done)
+		r.run(ctx)
+	}()
+}
+
+// close stops flushing periodically and flushes the usages recorded so far
+func (r *tokenUsageRecorder) close() error {
+	if r.cancel != nil {
+		r.cancel()
+		<-r.done
+	}
+	return r.flush()
+}
+
+func (r *tokenUsageRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(tokenUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flush(); err != nil {
+				log.Warnf("flush usages of tokens failed: %v", err)
+			}
+		}
+	}
+}
@@ -5,18 +5,54 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
+type VersionResponse struct {
+	Version string
+	// name of network set in config
+	Network string `json:",omitempty"`
+}
+
 type VerifyRequest struct {
 	Token string `form:"token" binding:"required"`
 }
 type VerifyResponse = JWTPayload
 
+type VerifyBatchRequest struct {
+	// at most `MaxVerifyBatch` tokens
+	Tokens []string `json:"tokens" binding:"required"`
+}
+
+// VerifyResult either the payload of a token verified, or the reason it failed
+type VerifyResult struct {
+	Payload *JWTPayload     `json:"payload,omitempty"`
+	Error   *errcode.ErrMsg `json:"error,omitempty"`
+}
+
+// VerifyBatchResponse the results in the order of tokens requested
+type VerifyBatchResponse = []*VerifyResult
+
 type GenTokenRequest struct {
 	Name  string `form:"name" json:"name" binding:"required"`
 	Perm  string `form:"perm" json:"perm"`
 	Extra string `form:"extra" json:"extra"`
+	TokenMeta
+}
+
+type GenerateMyTokenReq struct {
+	Perm  string `form:"perm" json:"perm" binding:"required"`
+	Extra string `form:"extra" json:"extra"`
+	TokenMeta
+}
+
+type UpdateMeReq struct {
+	Comment *string `form:"comment"`
+}
+
+type RegisterMySignersReq struct {
+	Signers []address.Address `binding:"required"`
 }
 
 type GenTokenResponse struct {
@@ -78,6 +114,8 @@ type CreateUserRequest struct {
 	Name    string         `form:"name" binding:"required"`
 	Comment *string        `form:"comment"`
 	State   core.UserState `form:"state"` // 0: disable, 1: enable
+	// required when an org admin creates a user in its organization
+	Org string `form:"org"`
 }
 type CreateUserResponse = OutputUser
 
@@ -94,9 +132,46 @@ type OutputUser struct {
 	State      core.UserState `json:"state"`
 	CreateTime int64          `json:"createTime"`
 	UpdateTime int64          `json:"updateTime"`
+	Org        string         `json:"org,omitempty"`
+	OrgAdmin   bool           `json:"orgAdmin,omitempty"`
 	// the field `Miners` is used for compound api `ListUserWithMiners`
-	// which calls 'listuser' and for each 'user' calls 'listminers'
-	Miners []*OutputMiner `json:"-"`
+	// which calls 'listuser' and for each 'user' calls 'listminers',
+	// `GetUserByMiner` also fills it with the specified miner
+	Miners []*OutputMiner `json:"miners,omitempty"`
+}
+
+type CreateOrgRequest struct {
+	Name    string  `form:"name" binding:"required"`
+	Comment *string `form:"comment"`
+}
+
+type OutputOrg struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Comment    string `json:"comment"`
+	CreateTime int64  `json:"createTime"`
+	UpdateTime int64  `json:"updateTime"`
+}
+
+type ListOrgsResponse = []*OutputOrg
+
+type GetOrgRequest struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type DeleteOrgRequest struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type ListOrgUsersRequest struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type SetOrgMemberRequest struct {
+	// empty organization removes the user from its organization
+	Org   string `form:"org"`
+	User  string `form:"user" binding:"required"`
+	Admin bool   `form:"admin"`
 }
 
 type VerifyUsersReq struct {
@@ -113,6 +188,8 @@ type HasUserRequest struct {
 
 type DeleteUserRequest struct {
 	Name string `form:"name" binding:"required"`
+	// revoke tokens of user too, they are recovered with user
+	Cascade bool `form:"cascade" json:"cascade"`
 }
 
 type RecoverUserRequest struct {
@@ -151,16 +228,38 @@ type MinerExistInUserRequest struct {
 
 type ListMinerReq struct {
 	User string `form:"user" binding:"required"`
+	// selectors of miner labels, `key=value` or `key`, miners matching all of them are returned
+	Labels []string `form:"label"`
 }
 
 type OutputMiner struct {
 	Miner                address.Address
 	User                 string
 	OpenMining           bool
+	Labels               map[string]string `json:",omitempty"`
 	CreatedAt, UpdatedAt time.Time
 }
+
+type UpdateMinerLabelsReq struct {
+	Miner address.Address `binding:"required"`
+	Set   map[string]string
+	Unset []string
+}
+
+type UpdateMinerLabelsResp = OutputMiner
 type ListMinerResp []*OutputMiner
 
+type TransferMinerReq struct {
+	Miner address.Address `binding:"required"`
+	From  string          `binding:"required"`
+	To    string          `binding:"required"`
+	// token of the current owner, if set, the transfer is rejected unless it's a valid token of `From`
+	ConfirmToken string
+}
+
+// TransferMinerResp is the binding of miner before transfer
+type TransferMinerResp = OutputMiner
+
 type DelMinerReq struct {
 	Miner address.Address `json:"miner"`
 }
@@ -200,6 +299,88 @@ type DelSignerReq struct {
 type OutputSigner struct {
 	Signer               address.Address
 	User                 string
+	Policy               *storage.SignerPolicy `json:",omitempty"`
+	Spent                *storage.SignerSpent  `json:",omitempty"`
 	CreatedAt, UpdatedAt time.Time
 }
 type ListSignerResp []*OutputSigner
+
+type UpdateSignerPolicyReq struct {
+	User   string          `binding:"required"`
+	Signer address.Address `binding:"required"`
+	// nil removes the policy
+	Policy *storage.SignerPolicy
+}
+
+type UpdateSignerPolicyResp = OutputSigner
+
+type CheckSignerPolicyReq struct {
+	User   string          `binding:"required"`
+	Signer address.Address `binding:"required"`
+	Method uint64
+	// value of the message in attoFIL, empty means zero
+	Value string
+	// only evaluates the policy, the value of an allowed message isn't counted in the daily spending
+	DryRun bool
+}
+
+type CheckSignerPolicyResp struct {
+	Allowed bool
+	// why the message is rejected
+	Reason string `json:",omitempty"`
+}
+
+type BulkApplyReq struct {
+	Manifest Manifest
+	DryRun   bool
+	// remove users, miners, signers and rate limits absent from the manifest
+	Prune bool
+	// users never removed by prune, `DefaultAdminTokenName` is always protected
+	Protected []string
+}
+
+type BulkApplyResp struct {
+	Changes []*ApplyChange `json:"changes"`
+	// tokens minted by this apply, only returned once
+	Tokens []*GeneratedToken `json:"tokens"`
+}
+
+// ReplicaUser a user with its miners, signers and rate limits, which are kept by replica clients,
+// the rate limits are filled with the default one as `GetUserRateLimits`
+type ReplicaUser struct {
+	User       *OutputUser
+	Miners     []*OutputMiner           `json:",omitempty"`
+	Signers    []*OutputSigner          `json:",omitempty"`
+	RateLimits GetUserRateLimitResponse `json:",omitempty"`
+}
+
+type ReplicaSnapshot struct {
+	// the position of the change log when the snapshot taken
+	Epoch string
+	Seq   uint64
+	Users []*ReplicaUser
+}
+
+type ReplicaChangesReq struct {
+	Epoch string `form:"epoch" binding:"required"`
+	Since uint64 `form:"since"`
+}
+
+type ReplicaChanges struct {
+	// the changes after the position are unknown, a snapshot should be synced
+	Reset bool
+	Epoch string
+	Seq   uint64
+	// users changed, with all of their miners, signers and rate limits
+	Users []*ReplicaUser `json:",omitempty"`
+	// users deleted
+	Removed []string `json:",omitempty"`
+}
+
+// SubscribeEventsReq the events of all types and users are streamed if `Types` and `User` are empty
+type SubscribeEventsReq struct {
+	Types []EventType `form:"types"`
+	User  string      `form:"user"`
+	// taken from the header `Last-Event-ID` if empty
+	LastEventID string `form:"lastEventId"`
+}
@@ -0,0 +1,617 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// headers of the requests posted to webhooks
+const (
+	WebhookEventHeader     = "X-Sophon-Event"
+	WebhookDeliveryHeader  = "X-Sophon-Delivery"
+	WebhookTimestampHeader = "X-Sophon-Timestamp"
+	// `sha256=<hex>`, see `SignWebhook`
+	WebhookSignatureHeader = "X-Sophon-Signature"
+)
+
+const (
+	// how often the outbox is checked for the deliveries to retry, new events are delivered at once
+	webhookPollInterval = time.Second
+	// how often the deliveries finished are pruned from the log
+	webhookPruneInterval = time.Hour
+	// how many deliveries of a webhook are taken from the outbox at a time
+	webhookBatchSize = 100
+	// the errors and responses longer than it are cut in the log
+	maxDeliveryError = 1024
+)
+
+// SignWebhook the signature of a delivery, which is the hex of HMAC-SHA256 of `<timestamp>.<body>` by the secret,
+// receivers should compare it with `WebhookSignatureHeader` and reject the timestamps too old against replays.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookPayload the body posted to webhooks, `Text` is a summary of the event for chat tools such as Slack
+type WebhookPayload struct {
+	Text  string `json:"text"`
+	Event *Event `json:"event"`
+}
+
+type CreateWebhookReq struct {
+	Name string `json:"name" binding:"required"`
+	// http or https
+	URL string `json:"url" binding:"required"`
+	// types of the events delivered, all types if empty
+	Events []EventType `json:"events"`
+	// only the events of the user if set, including the miners moved from it
+	User string `json:"user"`
+	// only the tokens of the permission if set, the other events are not affected
+	Perm string `json:"perm"`
+	// signs the deliveries, generated if empty
+	Secret  string `json:"secret"`
+	Comment string `json:"comment"`
+}
+
+// UpdateWebhookReq the fields nil are not changed
+type UpdateWebhookReq struct {
+	Name     string       `json:"name" binding:"required"`
+	URL      *string      `json:"url"`
+	Events   *[]EventType `json:"events"`
+	User     *string      `json:"user"`
+	Perm     *string      `json:"perm"`
+	Disabled *bool        `json:"disabled"`
+	Comment  *string      `json:"comment"`
+	// generates a new secret, which is returned only this time
+	RotateSecret bool `json:"rotateSecret"`
+}
+
+type GetWebhookReq struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type DeleteWebhookReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type ListWebhookDeliveriesReq struct {
+	// all webhooks if empty
+	Webhook string `form:"webhook"`
+	// pending, delivered or failed, all states if empty
+	State string `form:"state"`
+	// all if 0
+	Limit int `form:"limit"`
+}
+
+type OutputWebhook struct {
+	Name     string      `json:"name"`
+	URL      string      `json:"url"`
+	Events   []EventType `json:"events,omitempty"`
+	User     string      `json:"user,omitempty"`
+	Perm     string      `json:"perm,omitempty"`
+	Disabled bool        `json:"disabled"`
+	Comment  string      `json:"comment,omitempty"`
+	// only returned when it's created or rotated
+	Secret     string `json:"secret,omitempty"`
+	CreateTime int64  `json:"createTime"`
+	UpdateTime int64  `json:"updateTime"`
+}
+
+type ListWebhooksResp = []*OutputWebhook
+
+type OutputWebhookDelivery struct {
+	ID          string          `json:"id"`
+	Webhook     string          `json:"webhook"`
+	EventID     string          `json:"eventId"`
+	EventType   EventType       `json:"eventType"`
+	Payload     json.RawMessage `json:"payload"`
+	State       string          `json:"state"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	StatusCode  int             `json:"statusCode,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreateTime  time.Time       `json:"createTime"`
+	UpdateTime  time.Time       `json:"updateTime"`
+}
+
+type ListWebhookDeliveriesResp = []*OutputWebhookDelivery
+
+func toOutputWebhook(w *storage.Webhook) *OutputWebhook {
+	return &OutputWebhook{
+		Name:       w.Name,
+		URL:        w.URL,
+		User:       w.User,
+		Perm:       w.Perm,
+		Disabled:   w.Disabled,
+		Comment:    w.Comment,
+		Events:     toEventTypes(w.Events),
+		CreateTime: w.CreateTime.Unix(),
+		UpdateTime: w.UpdateTime.Unix(),
+	}
+}
+
+func toEventTypes(events storage.WebhookEvents) []EventType {
+	var types []EventType
+	for _, t := range events {
+		types = append(types, EventType(t))
+	}
+	return types
+}
+
+func toOutputWebhookDelivery(d *storage.WebhookDelivery) *OutputWebhookDelivery {
+	return &OutputWebhookDelivery{
+		ID:          d.Id,
+		Webhook:     d.Webhook,
+		EventID:     d.EventID,
+		EventType:   EventType(d.EventType),
+		Payload:     json.RawMessage(d.Payload),
+		State:       d.State,
+		Attempts:    d.Attempts,
+		NextAttempt: d.NextAttempt,
+		StatusCode:  d.StatusCode,
+		Error:       d.Error,
+		CreateTime:  d.CreateTime,
+		UpdateTime:  d.UpdateTime,
+	}
+}
+
+func checkWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errcode.Errorf(errcode.CodeInvalidArgument, "invalid url of webhook: %s", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errcode.Errorf(errcode.CodeInvalidArgument, "url of webhook should be http or https, got %s", rawURL)
+	}
+	return nil
+}
+
+func checkWebhookFilter(events []EventType, perm string) (storage.WebhookEvents, error) {
+	var types storage.WebhookEvents
+	for _, t := range events {
+		if !isEventType(t) {
+			return nil, errcode.Errorf(errcode.CodeInvalidArgument, "unknown event type %s", t)
+		}
+		types = append(types, string(t))
+	}
+	if len(perm) != 0 && !core.IsValid(perm) {
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "invalid permission %s", perm)
+	}
+	return types, nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret, err := config.RandSecret()
+	if err != nil {
+		return "", fmt.Errorf("rand secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// CreateWebhook registers a webhook, the secret is only returned this time
+func (o *jwtOAuth) CreateWebhook(ctx context.Context, req *CreateWebhookReq) (*OutputWebhook, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	if err := checkWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	events, err := checkWebhookFilter(req.Events, req.Perm)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = o.store.GetWebhook(req.Name)
+	if err == nil {
+		return nil, errcode.Errorf(errcode.CodeAlreadyExists, "webhook %s already exists", req.Name)
+	}
+	if !storage.IsNotFound(err) {
+		return nil, err
+	}
+	secret := req.Secret
+	if len(secret) == 0 {
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now().Local()
+	webhook := &storage.Webhook{
+		Name:       req.Name,
+		URL:        req.URL,
+		Events:     events,
+		User:       req.User,
+		Perm:       req.Perm,
+		Secret:     secret,
+		Comment:    req.Comment,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := o.store.PutWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	auditLog(ctx, "createWebhook", log.Fields{"webhook": req.Name, "url": req.URL})
+	out := toOutputWebhook(webhook)
+	out.Secret = secret
+	return out, nil
+}
+
+func (o *jwtOAuth) UpdateWebhook(ctx context.Context, req *UpdateWebhookReq) (*OutputWebhook, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	webhook, err := o.store.GetWebhook(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL != nil {
+		if err := checkWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		webhook.URL = *req.URL
+	}
+	types, perm := toEventTypes(webhook.Events), webhook.Perm
+	if req.Events != nil {
+		types = *req.Events
+	}
+	if req.Perm != nil {
+		perm = *req.Perm
+	}
+	if webhook.Events, err = checkWebhookFilter(types, perm); err != nil {
+		return nil, err
+	}
+	webhook.Perm = perm
+	if req.User != nil {
+		webhook.User = *req.User
+	}
+	if req.Disabled != nil {
+		webhook.Disabled = *req.Disabled
+	}
+	if req.Comment != nil {
+		webhook.Comment = *req.Comment
+	}
+	if req.RotateSecret {
+		if webhook.Secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	webhook.UpdateTime = time.Now().Local()
+	if err := o.store.PutWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	auditLog(ctx, "updateWebhook", log.Fields{"webhook": req.Name, "rotateSecret": req.RotateSecret})
+	out := toOutputWebhook(webhook)
+	if req.RotateSecret {
+		out.Secret = webhook.Secret
+	}
+	return out, nil
+}
+
+func (o *jwtOAuth) GetWebhook(ctx context.Context, req *GetWebhookReq) (*OutputWebhook, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	webhook, err := o.store.GetWebhook(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return toOutputWebhook(webhook), nil
+}
+
+func (o *jwtOAuth) ListWebhooks(ctx context.Context) (ListWebhooksResp, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	webhooks, err := o.store.ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	out := make(ListWebhooksResp, len(webhooks))
+	for idx, webhook := range webhooks {
+		out[idx] = toOutputWebhook(webhook)
+	}
+	return out, nil
+}
+
+// DeleteWebhook deletes the webhook along with its deliveries, including the pending ones
+func (o *jwtOAuth) DeleteWebhook(ctx context.Context, req *DeleteWebhookReq) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if err := o.store.DeleteWebhook(req.Name); err != nil {
+		return err
+	}
+	auditLog(ctx, "deleteWebhook", log.Fields{"webhook": req.Name})
+	return nil
+}
+
+// ListWebhookDeliveries the deliveries from the newest, the finished ones are kept for `WebhookConfig.LogRetention`
+func (o *jwtOAuth) ListWebhookDeliveries(ctx context.Context, req *ListWebhookDeliveriesReq) (ListWebhookDeliveriesResp, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	switch req.State {
+	case "", storage.DeliveryPending, storage.DeliveryDelivered, storage.DeliveryFailed:
+	default:
+		return nil, errcode.Errorf(errcode.CodeInvalidArgument, "invalid state of delivery %s", req.State)
+	}
+
+	deliveries, err := o.store.ListWebhookDeliveries(req.Webhook, req.State, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make(ListWebhookDeliveriesResp, len(deliveries))
+	for idx, d := range deliveries {
+		out[idx] = toOutputWebhookDelivery(d)
+	}
+	return out, nil
+}
+
+// matchWebhook whether the event is delivered to the webhook
+func matchWebhook(webhook *storage.Webhook, ev *Event) bool {
+	if webhook.Disabled || ev.Type == EventReset {
+		return false
+	}
+	if len(webhook.Events) != 0 {
+		matched := false
+		for _, t := range webhook.Events {
+			if EventType(t) == ev.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(webhook.User) != 0 && ev.User != webhook.User && ev.PrevUser != webhook.User {
+		return false
+	}
+	switch ev.Type {
+	case EventTokenGenerated, EventTokenRemoved, EventTokenRecovered:
+		return len(webhook.Perm) == 0 || ev.Perm == webhook.Perm
+	}
+	return true
+}
+
+// eventText a summary of the event, such as `[sophon-auth] miner_upserted, user: bob, prevUser: alice, miner: f01000`
+func eventText(ev *Event) string {
+	text := "[sophon-auth] " + string(ev.Type)
+	for _, field := range []struct{ name, value string }{
+		{"user", ev.User}, {"prevUser", ev.PrevUser}, {"miner", ev.Miner}, {"signer", ev.Signer}, {"perm", ev.Perm},
+	} {
+		if len(field.value) != 0 {
+			text += fmt.Sprintf(", %s: %s", field.name, field.value)
+		}
+	}
+	return text
+}
+
+// enqueueWebhooks writes the deliveries of events into the outbox by store, which is the transaction of the changes,
+// so the deliveries are committed or lost along with the changes. Events are then retried until delivered,
+// a post whose result isn't recorded may be repeated with the same delivery id.
+func (o *jwtOAuth) enqueueWebhooks(store storage.Store, events []*Event) (bool, error) {
+	if len(events) == 0 {
+		return false, nil
+	}
+	webhooks, err := store.ListWebhooks()
+	if err != nil {
+		return false, fmt.Errorf("list webhooks: %w", err)
+	}
+	now := time.Now()
+	var deliveries []*storage.WebhookDelivery
+	for _, ev := range events {
+		var payload []byte
+		for _, webhook := range webhooks {
+			if !matchWebhook(webhook, ev) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(&WebhookPayload{Text: eventText(ev), Event: ev}); err != nil {
+					return false, fmt.Errorf("marshal event %s: %w", ev.Type, err)
+				}
+			}
+			// the ids keep the order of deliveries
+			id, err := uuid.NewV7()
+			if err != nil {
+				return false, fmt.Errorf("new id of delivery: %w", err)
+			}
+			deliveries = append(deliveries, &storage.WebhookDelivery{
+				Id:          id.String(),
+				Webhook:     webhook.Name,
+				EventID:     ev.ID,
+				EventType:   string(ev.Type),
+				Payload:     string(payload),
+				State:       storage.DeliveryPending,
+				NextAttempt: now,
+				CreateTime:  now,
+				UpdateTime:  now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return false, nil
+	}
+	if err := store.PutWebhookDeliveries(deliveries); err != nil {
+		return false, fmt.Errorf("enqueue %d deliveries of webhooks: %w", len(deliveries), err)
+	}
+	return true, nil
+}
+
+// DeliverWebhooks posts the deliveries in the outbox until ctx done, while this node is the leader.
+// The deliveries of a webhook are posted in order, the later ones wait until the earlier one is delivered or failed at last.
+func (o *jwtOAuth) DeliverWebhooks(ctx context.Context, cnf *config.WebhookConfig) {
+	client := &http.Client{Timeout: cnf.Timeout}
+	poll := time.NewTicker(webhookPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(webhookPruneInterval)
+	defer prune.Stop()
+
+	for {
+		if o.IsLeader() {
+			o.deliverWebhooks(ctx, client, cnf)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-o.webhookWake:
+		case <-prune.C:
+			if !o.IsLeader() || cnf.LogRetention <= 0 {
+				continue
+			}
+			pruned, err := o.store.PruneWebhookDeliveries(time.Now().Add(-cnf.LogRetention))
+			if err != nil {
+				log.Errorf("prune deliveries of webhooks: %s", err)
+			} else if pruned != 0 {
+				log.Infof("prune %d deliveries of webhooks finished before %s", pruned, cnf.LogRetention)
+			}
+		}
+	}
+}
+
+// deliverWebhooks delivers the pending ones of each webhook from the oldest, until one of them isn't due yet or fails
+func (o *jwtOAuth) deliverWebhooks(ctx context.Context, client *http.Client, cnf *config.WebhookConfig) {
+	webhooks, err := o.store.ListWebhooks()
+	if err != nil {
+		log.Errorf("list webhooks: %s", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range webhooks {
+		wg.Add(1)
+		go func(webhook *storage.Webhook) {
+			defer wg.Done()
+			deliveries, err := o.store.ListPendingWebhookDeliveries(webhook.Name, webhookBatchSize)
+			if err != nil {
+				log.Errorf("list pending deliveries of webhook %s: %s", webhook.Name, err)
+				return
+			}
+			now := time.Now()
+			for _, d := range deliveries {
+				// the one backing off holds the later ones, so they never overtake it
+				if d.NextAttempt.After(now) || !o.deliverWebhook(ctx, client, cnf, webhook, d) {
+					return
+				}
+			}
+		}(webhook)
+	}
+	wg.Wait()
+}
+
+// deliverWebhook attempts to post d to webhook, and records the result, returns whether it's delivered
+func (o *jwtOAuth) deliverWebhook(ctx context.Context, client *http.Client, cnf *config.WebhookConfig,
+	webhook *storage.Webhook, d *storage.WebhookDelivery,
+) bool {
+	var err error
+	if webhook.Disabled {
+		// nothing is attempted, they are never delivered after the webhook disabled
+		d.Attempts = cnf.MaxAttempts
+		err = fmt.Errorf("webhook disabled")
+	} else {
+		d.Attempts++
+		d.StatusCode, err = postWebhook(ctx, client, webhook, d)
+		// the attempt broke by shutting down is not counted
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+
+	now := time.Now()
+	d.UpdateTime = now
+	switch {
+	case err == nil:
+		d.State, d.Error = storage.DeliveryDelivered, ""
+	case d.Attempts >= cnf.MaxAttempts:
+		d.State, d.Error = storage.DeliveryFailed, cutDeliveryError(err.Error())
+		log.Warnf("deliver %s of event %s to webhook %s failed after %d attempts: %s",
+			d.Id, d.EventID, d.Webhook, d.Attempts, err)
+	default:
+		d.Error = cutDeliveryError(err.Error())
+		d.NextAttempt = now.Add(webhookBackoff(cnf, d.Attempts))
+	}
+	if err := o.store.PutWebhookDeliveries([]*storage.WebhookDelivery{d}); err != nil {
+		log.Errorf("update delivery %s of webhook %s: %s", d.Id, d.Webhook, err)
+		return false
+	}
+	return d.State == storage.DeliveryDelivered
+}
+
+// postWebhook returns the status code of response, which is 0 if no response got
+func postWebhook(ctx context.Context, client *http.Client, webhook *storage.Webhook, d *storage.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sophon-auth/"+core.Version)
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.Id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, []byte(d.Payload)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() // nolint
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeliveryError))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff the wait after the attempt-th attempt failed
+func webhookBackoff(cnf *config.WebhookConfig, attempt int) time.Duration {
+	backoff := cnf.MinBackoff
+	for i := 1; i < attempt && backoff < cnf.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > cnf.MaxBackoff {
+		backoff = cnf.MaxBackoff
+	}
+	return backoff
+}
+
+func cutDeliveryError(msg string) string {
+	if len(msg) > maxDeliveryError {
+		return msg[:maxDeliveryError]
+	}
+	return msg
+}
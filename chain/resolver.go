@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+//go:generate mockgen -destination=mocks/mock_resolver.go -package=mocks github.com/ipfs-force-community/sophon-auth/chain Resolver
+
+// Resolver resolves addresses of actors on chain
+type Resolver interface {
+	// LookupID returns the ID address of the actor
+	LookupID(ctx context.Context, addr address.Address) (address.Address, error)
+	// AccountKey returns the key address of the account actor
+	AccountKey(ctx context.Context, addr address.Address) (address.Address, error)
+}
+
+var _ Resolver = (*rpcResolver)(nil)
+
+// rpcResolver resolves addresses by the api of a Lotus/Venus compatible node
+type rpcResolver struct {
+	cli *resty.Client
+}
+
+// NewResolver returns nil if the node is not configured
+func NewResolver(cnf *config.ChainConfig) Resolver {
+	if cnf == nil || len(cnf.URL) == 0 {
+		return nil
+	}
+	cli := resty.New().
+		SetHostURL(cnf.URL).
+		SetHeader("Accept", "application/json").
+		SetTimeout(cnf.Timeout)
+	if len(cnf.Token) != 0 {
+		cli.SetAuthToken(cnf.Token)
+	}
+	return &rpcResolver{cli: cli}
+}
+
+type rpcRequest struct {
+	Jsonrpc string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type addressResponse struct {
+	Result *address.Address `json:"result"`
+	Error  *rpcError        `json:"error"`
+}
+
+// callAddressMethod calls a state method which takes an address at the head and returns an address
+func (r *rpcResolver) callAddressMethod(ctx context.Context, method string, addr address.Address) (address.Address, error) {
+	// look up at the head, which is the empty tipset key
+	req := &rpcRequest{Jsonrpc: "2.0", ID: 1, Method: method, Params: []interface{}{addr, []interface{}{}}}
+	resp, err := r.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&addressResponse{}).ForceContentType("application/json").Post("")
+	if err != nil {
+		return address.Undef, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return address.Undef, fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	res := resp.Result().(*addressResponse)
+	if res.Error != nil {
+		return address.Undef, errors.New(res.Error.Message)
+	}
+	if res.Result == nil {
+		return address.Undef, errors.New("empty result")
+	}
+	return *res.Result, nil
+}
+
+func (r *rpcResolver) LookupID(ctx context.Context, addr address.Address) (address.Address, error) {
+	if addr.Protocol() == address.ID {
+		return addr, nil
+	}
+
+	idAddr, err := r.callAddressMethod(ctx, "Filecoin.StateLookupID", addr)
+	if err != nil {
+		return address.Undef, fmt.Errorf("look up id of %s: %w", addr, err)
+	}
+	if idAddr.Protocol() != address.ID {
+		return address.Undef, fmt.Errorf("look up id of %s: unexpected result %s", addr, idAddr)
+	}
+	return idAddr, nil
+}
+
+func (r *rpcResolver) AccountKey(ctx context.Context, addr address.Address) (address.Address, error) {
+	if addr.Protocol() != address.ID {
+		return addr, nil
+	}
+
+	key, err := r.callAddressMethod(ctx, "Filecoin.StateAccountKey", addr)
+	if err != nil {
+		return address.Undef, fmt.Errorf("look up key of %s: %w", addr, err)
+	}
+	if key.Protocol() == address.ID {
+		return address.Undef, fmt.Errorf("look up key of %s: unexpected result %s", addr, key)
+	}
+	return key, nil
+}
@@ -0,0 +1,79 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+func TestRPCResolver(t *testing.T) {
+	robust, err := address.NewFromString("t3wylwd6pclppme4qmbgwled5xpsbgwgqbn2alxa7yahg2gnbfkipsdv6m764xm5coizujmwdmkxeugplmorha")
+	assert.Nil(t, err)
+	unknown, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	idAddr, err := address.NewIDAddress(1000)
+	assert.Nil(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var req struct {
+			Method string
+			Params []json.RawMessage
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Len(t, req.Params, 2)
+
+		var addr address.Address
+		assert.Nil(t, json.Unmarshal(req.Params[0], &addr))
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": 1}
+		switch {
+		case req.Method == "Filecoin.StateLookupID" && addr == robust:
+			res["result"] = idAddr
+		case req.Method == "Filecoin.StateAccountKey" && addr == idAddr:
+			res["result"] = robust
+		default:
+			res["error"] = map[string]interface{}{"code": 1, "message": "actor not found"}
+		}
+		assert.Nil(t, json.NewEncoder(w).Encode(res))
+	}))
+	defer srv.Close()
+
+	assert.Nil(t, NewResolver(&config.ChainConfig{}))
+	resolver := NewResolver(&config.ChainConfig{URL: srv.URL, Token: "token", Timeout: time.Second})
+	assert.NotNil(t, resolver)
+
+	ctx := context.Background()
+	res, err := resolver.LookupID(ctx, robust)
+	assert.Nil(t, err)
+	assert.Equal(t, idAddr, res)
+
+	_, err = resolver.LookupID(ctx, unknown)
+	assert.ErrorContains(t, err, "actor not found")
+
+	// ID address is returned directly
+	res, err = resolver.LookupID(ctx, idAddr)
+	assert.Nil(t, err)
+	assert.Equal(t, idAddr, res)
+
+	res, err = resolver.AccountKey(ctx, idAddr)
+	assert.Nil(t, err)
+	assert.Equal(t, robust, res)
+
+	unknownID, err := address.NewIDAddress(1001)
+	assert.Nil(t, err)
+	_, err = resolver.AccountKey(ctx, unknownID)
+	assert.ErrorContains(t, err, "actor not found")
+
+	// key address is returned directly
+	res, err = resolver.AccountKey(ctx, robust)
+	assert.Nil(t, err)
+	assert.Equal(t, robust, res)
+}
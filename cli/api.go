@@ -3,10 +3,12 @@ package cli
 import (
 	"fmt"
 
+	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/jwtclient"
 	"github.com/ipfs-force-community/sophon-auth/log"
 	"github.com/ipfs-force-community/sophon-auth/util"
 	"github.com/mitchellh/go-homedir"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,18 +28,46 @@ func GetCli(ctx *cli.Context) (*jwtclient.AuthClient, error) {
 		return nil, fmt.Errorf("get token: %w", err)
 	}
 
-	var listen string
-	if ctx.IsSet("listen") {
-		listen = ctx.String("listen")
-	} else {
-		cnf, err := repo.GetConfig()
-		if err != nil {
+	listen, network := ctx.String("listen"), ctx.String("network")
+	cnf, err := repo.GetConfig()
+	if err != nil {
+		if !ctx.IsSet("listen") || !ctx.IsSet("network") {
 			return nil, fmt.Errorf("get config: %w", err)
 		}
-		listen = cnf.Listen
+		cnf = nil
+	}
+	if cnf != nil {
+		if !ctx.IsSet("listen") {
+			listen = cnf.Listen
+		}
+		if !ctx.IsSet("network") {
+			network = cnf.Network
+		}
+	}
+	// addresses are printed with the prefix of network
+	if err := core.SetupNetwork(network); err != nil {
+		return nil, err
 	}
 
-	return jwtclient.NewAuthClient("http://"+listen, token)
+	// the daemon serves over tls, trust its certificate which may be self-signed
+	if cnf != nil && cnf.TLS.Enabled() {
+		return jwtclient.NewAuthClient(apiAddr(listen, true), token, jwtclient.WithCAFile(cnf.TLS.CertFile))
+	}
+	return jwtclient.NewAuthClient(apiAddr(listen, false), token)
+}
+
+// apiAddr the address to request the daemon listening on listen, unix sockets are never over tls
+func apiAddr(listen string, tls bool) string {
+	if _, err := multiaddr.NewMultiaddr(listen); err == nil {
+		if _, isUnix := util.UnixSocketPath(listen); tls && !isUnix {
+			return listen + "/https"
+		}
+		return listen
+	}
+	if tls {
+		return "https://" + listen
+	}
+	return "http://" + listen
 }
 
 func GetRepoPath(ctx *cli.Context) (string, error) {
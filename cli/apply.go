@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+)
+
+var applyCommand = &cli.Command{
+	Name:  "apply",
+	Usage: "Create or update users, miners, signers, rate limits and tokens declared in a manifest file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "path of the manifest file in yaml format",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only print the changes, nothing will be written",
+		},
+		&cli.BoolFlag{
+			Name:  "prune",
+			Usage: "remove users, miners, signers and rate limits absent from the manifest",
+		},
+		&cli.StringSliceFlag{
+			Name:  "protected",
+			Usage: "users never removed by prune, " + auth.DefaultAdminTokenName + " is always protected",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format, table or json",
+			Value: "table",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		manifest, err := auth.LoadManifest(ctx.String("file"))
+		if err != nil {
+			return err
+		}
+
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		dryRun := ctx.Bool("dry-run")
+		res, err := client.BulkApply(ctx.Context, &auth.BulkApplyReq{
+			Manifest:  *manifest,
+			DryRun:    dryRun,
+			Prune:     ctx.Bool("prune"),
+			Protected: ctx.StringSlice("protected"),
+		})
+		if err != nil {
+			return xerrors.Errorf("apply manifest failed: %w", err)
+		}
+
+		if ctx.String("output") == "json" {
+			if res.Changes == nil {
+				res.Changes = []*auth.ApplyChange{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(res)
+		}
+
+		if len(res.Changes) == 0 {
+			fmt.Println("nothing to change.")
+			return nil
+		}
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "action\tkind\tuser\ttarget\tdetail\t")
+		for _, change := range res.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", change.Action, change.Kind, change.User, change.Target, change.Detail)
+		}
+		_ = w.Flush()
+		if dryRun {
+			fmt.Printf("dry run, %d changes not applied.\n", len(res.Changes))
+			return nil
+		}
+
+		if len(res.Tokens) != 0 {
+			fmt.Println()
+			fmt.Println("generated tokens, keep them safe:")
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+			fmt.Fprintln(w, "user\tperm\textra\ttoken\t")
+			for _, tk := range res.Tokens {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", tk.User, tk.Perm, tk.Extra, tk.Token)
+			}
+			_ = w.Flush()
+		}
+		fmt.Printf("apply %d changes success.\n", len(res.Changes))
+		return nil
+	},
+}
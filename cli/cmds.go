@@ -10,4 +10,9 @@ var Commands = []*cli.Command{
 	userSubCommand,
 	minerSubCommand,
 	signerSubCommand,
+	orgSubCommand,
+	webhookSubCommand,
+	maintenanceSubCommand,
+	dbSubCommand,
+	applyCommand,
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var dbSubCommand = &cli.Command{
+	Name:  "db",
+	Usage: "db command",
+	Subcommands: []*cli.Command{
+		dbPurgeCmd,
+	},
+}
+
+var dbPurgeCmd = &cli.Command{
+	Name:  "purge",
+	Usage: "Hard delete the records soft-deleted long ago, they can't be recovered any more",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "older-than",
+			Usage:    "purge the records deleted longer than it, eg. 90d, 36h",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "kind",
+			Usage: fmt.Sprintf("kinds of records to purge, all kinds if not set, %s", strings.Join(storage.PurgeKinds, "|")),
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only show how many records would be purged",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		olderThan, err := parseDays(ctx.String("older-than"))
+		if err != nil {
+			return fmt.Errorf("invalid older-than: %w", err)
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := client.Purge(ctx.Context, &auth.PurgeReq{
+			OlderThan: olderThan,
+			Kinds:     ctx.StringSlice("kind"),
+			DryRun:    ctx.Bool("dry-run"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if res.DryRun {
+			fmt.Printf("records deleted before %s to purge:\n", res.Before.Format(time.RFC1123))
+		} else {
+			fmt.Printf("purged records deleted before %s:\n", res.Before.Format(time.RFC1123))
+		}
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "kind\tcount\t")
+		for _, kind := range storage.PurgeKinds {
+			fmt.Fprintf(w, "%s\t%d\t\n", kind, res.Summary[kind])
+		}
+		return w.Flush()
+	},
+}
+
+// parseDays parses a duration with a suffix of days like `90d`, or a go duration like `36h`
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
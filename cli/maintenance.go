@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var maintenanceSubCommand = &cli.Command{
+	Name:  "maintenance",
+	Usage: "maintenance command",
+	Subcommands: []*cli.Command{
+		maintenanceReportsCmd,
+	},
+}
+
+var maintenanceReportsCmd = &cli.Command{
+	Name:  "reports",
+	Usage: "List reports of the latest runs of the reaper of stale tokens and users, from the newest",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "show at most limit reports",
+			Value: 1,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		reports, err := client.ListReaperReports(ctx.Context)
+		if err != nil {
+			return err
+		}
+		if len(reports) == 0 {
+			fmt.Println("no reports, the reaper is disabled or has not run yet")
+			return nil
+		}
+		if limit := ctx.Int("limit"); limit > 0 && len(reports) > limit {
+			reports = reports[:limit]
+		}
+
+		const padding = 2
+		for _, report := range reports {
+			fmt.Printf("start: %s, end: %s, policy: %s, stale days: %d\n", report.StartTime.Format(time.RFC1123),
+				report.EndTime.Format(time.RFC1123), report.Policy, report.StaleDays)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+			fmt.Fprintf(w, "stale tokens: %d\n", len(report.Tokens))
+			if len(report.Tokens) != 0 {
+				fmt.Fprintln(w, "name\tperm\tcreate-time\tlast-used\taction\ttoken\t")
+				for _, token := range report.Tokens {
+					lastUsed := "never"
+					if token.LastUsedTime != nil {
+						lastUsed = token.LastUsedTime.Format(time.RFC1123)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", token.Name, token.Perm,
+						token.CreateTime.Format(time.RFC1123), lastUsed, token.Action, token.Token)
+				}
+			}
+			fmt.Fprintf(w, "stale users: %d\n", len(report.Users))
+			if len(report.Users) != 0 {
+				fmt.Fprintln(w, "name\tcreate-time\taction\t")
+				for _, user := range report.Users {
+					fmt.Fprintf(w, "%s\t%s\t%s\t\n", user.Name, user.CreateTime.Format(time.RFC1123), user.Action)
+				}
+			}
+			_ = w.Flush()
+			for _, e := range report.Errors {
+				fmt.Println("error:", e)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
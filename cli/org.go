@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+)
+
+var orgSubCommand = &cli.Command{
+	Name:  "org",
+	Usage: "organization command, an organization owns its users and their miners and signers",
+	Subcommands: []*cli.Command{
+		orgAddCmd,
+		orgGetCmd,
+		orgListCmd,
+		orgDeleteCmd,
+		orgUsersCmd,
+		orgMemberCmd,
+	},
+}
+
+var orgAddCmd = &cli.Command{
+	Name:      "add",
+	Usage:     "Add organization",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "comment",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		req := &auth.CreateOrgRequest{Name: ctx.Args().First()}
+		if ctx.IsSet("comment") {
+			comment := ctx.String("comment")
+			req.Comment = &comment
+		}
+		res, err := client.CreateOrg(ctx.Context, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Add organization success: %s, next can add users to it by `org member`\n", res.Id)
+		return nil
+	},
+}
+
+func printOrg(org *auth.OutputOrg) {
+	fmt.Println("name:", org.Name)
+	if len(org.Comment) != 0 {
+		fmt.Println("comment:", org.Comment)
+	}
+	fmt.Println("createTime:", time.Unix(org.CreateTime, 0).Format(time.RFC1123))
+	fmt.Println("updateTime:", time.Unix(org.UpdateTime, 0).Format(time.RFC1123))
+	fmt.Println()
+}
+
+var orgGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Get organization by name",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		org, err := client.GetOrg(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		printOrg(org)
+		return nil
+	},
+}
+
+var orgListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List organizations",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		orgs, err := client.ListOrgs(ctx.Context)
+		if err != nil {
+			return err
+		}
+		for _, org := range orgs {
+			printOrg(org)
+		}
+		return nil
+	},
+}
+
+var orgDeleteCmd = &cli.Command{
+	Name:      "delete",
+	Usage:     "Delete organization, users in it should be deleted or removed first",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeleteOrg(ctx.Context, ctx.Args().First()); err != nil {
+			return err
+		}
+		fmt.Println("remove organization success")
+		return nil
+	},
+}
+
+var orgUsersCmd = &cli.Command{
+	Name:      "users",
+	Usage:     "List users of organization",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		users, err := client.ListOrgUsers(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			fmt.Println("name:", user.Name)
+			fmt.Println("state:", user.State.String())
+			fmt.Println("orgAdmin:", user.OrgAdmin)
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var orgMemberCmd = &cli.Command{
+	Name:      "member",
+	Usage:     "Move user into organization, or remove user from its organization with --remove",
+	ArgsUsage: "<org> <user> | --remove <user>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "admin",
+			Usage: "user manages the users in the organization, their miners, signers and tokens",
+		},
+		&cli.BoolFlag{
+			Name:  "remove",
+			Usage: "remove user from its organization",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		var org, user string
+		switch {
+		case ctx.Bool("remove") && ctx.NArg() == 1:
+			user = ctx.Args().First()
+		case !ctx.Bool("remove") && ctx.NArg() == 2:
+			org, user = ctx.Args().Get(0), ctx.Args().Get(1)
+		default:
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := client.SetOrgMember(ctx.Context, org, user, ctx.Bool("admin")); err != nil {
+			return err
+		}
+		fmt.Println("set organization of user success")
+		return nil
+	},
+}
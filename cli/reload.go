@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ipfs-force-community/metrics"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+// sections of config applied while running, named as in the config file,
+// the others take effect after restart.
+var reloadableSections = map[string]struct{}{
+	"Log":       {},
+	"Metrics":   {},
+	"RateLimit": {},
+	"Cors":      {},
+}
+
+// configReloader reloads the config when the file changed or SIGHUP received,
+// a config failed to decode or validate is rejected and the running one is kept.
+type configReloader struct {
+	lk     sync.Mutex
+	path   string
+	cliCtx *cli.Context
+	cur    *config.Config
+
+	app  auth.OAuthApp
+	cors *auth.Cors
+
+	ctx           context.Context
+	cancelMetrics context.CancelFunc
+}
+
+func newConfigReloader(ctx context.Context, path string, cliCtx *cli.Context, cnf *config.Config, app auth.OAuthApp, cors *auth.Cors) *configReloader {
+	return &configReloader{
+		path:   path,
+		cliCtx: cliCtx,
+		cur:    cnf,
+		app:    app,
+		cors:   cors,
+		ctx:    ctx,
+	}
+}
+
+// setupMetrics restarts the metrics exporter with cnf, the exporter started before is stopped
+func (r *configReloader) setupMetrics(cnf *metrics.MetricsConfig) {
+	if r.cancelMetrics != nil {
+		r.cancelMetrics()
+		r.cancelMetrics = nil
+	}
+	if cnf == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	if err := metrics.SetupMetrics(ctx, cnf); err != nil {
+		log.Warnf("setup metrics: %s", err)
+	}
+	r.cancelMetrics = cancel
+}
+
+func (r *configReloader) run() {
+	changed := make(chan struct{}, 1)
+	err := config.Watch(r.path, func(in fsnotify.Event) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		log.Warnf("watch config %s: %s, reload it by SIGHUP", r.path, err)
+	}
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-changed:
+			r.reload("config file changed")
+		case <-sighup:
+			r.reload("SIGHUP received")
+		}
+	}
+}
+
+func (r *configReloader) reload(reason string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	cnf, err := config.DecodeConfig(r.path)
+	if err != nil {
+		log.Errorf("%s, but failed to decode config %s, keep the running one: %s", reason, r.path, err)
+		return
+	}
+	cnf = fillConfigByFlag(cnf, r.cliCtx)
+	if err := cnf.ValidateReloadable(); err != nil {
+		log.Errorf("%s, but config %s is invalid, keep the running one: %s", reason, r.path, err)
+		return
+	}
+
+	sections := changedSections(r.cur, cnf)
+	if len(sections) == 0 {
+		log.Debugf("%s, nothing changed", reason)
+		return
+	}
+	for _, section := range sections {
+		if _, ok := reloadableSections[section]; !ok {
+			log.Warnf("%s, section %s changed, it takes effect after restart", reason, section)
+			continue
+		}
+		if err := r.apply(section, cnf); err != nil {
+			log.Errorf("%s, failed to reload section %s, keep the running one: %s", reason, section, err)
+			continue
+		}
+		log.Infof("%s, section %s reloaded", reason, section)
+	}
+}
+
+// apply applies the section of cnf, then the section of the running config is replaced
+func (r *configReloader) apply(section string, cnf *config.Config) error {
+	switch section {
+	case "Log":
+		if err := log.ReloadLog(cnf.Log); err != nil {
+			return err
+		}
+		r.cur.Log = cnf.Log
+	case "Metrics":
+		r.setupMetrics(cnf.Metrics)
+		r.cur.Metrics = cnf.Metrics
+	case "RateLimit":
+		r.app.SetDefaultRateLimit(cnf.RateLimit)
+		r.cur.RateLimit = cnf.RateLimit
+	case "Cors":
+		r.cors.Update(cnf.Cors)
+		r.cur.Cors = cnf.Cors
+	}
+	return nil
+}
+
+// changedSections returns the names of sections differ between the two configs
+func changedSections(old, new *config.Config) []string {
+	var sections []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			sections = append(sections, ov.Type().Field(i).Name)
+		}
+	}
+	return sections
+}
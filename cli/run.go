@@ -2,15 +2,23 @@ package cli
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/ipfs-force-community/metrics"
 	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/chain"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/replication"
 	"github.com/ipfs-force-community/sophon-auth/util"
 	"github.com/urfave/cli/v2"
 	"go.opencensus.io/plugin/ochttp"
@@ -74,12 +82,46 @@ func fillConfigByFlag(cnf *config.Config, cliCtx *cli.Context) *config.Config {
 	if cliCtx.IsSet("listen") {
 		cnf.Listen = cliCtx.String("listen")
 	}
+	if cliCtx.IsSet("network") {
+		cnf.Network = cliCtx.String("network")
+	}
 
 	return cnf
 }
 
+// newReplicationNode requests the peers over https if the apis are served over tls,
+// their certificates are verified by the CA of `TLS.ClientCAFile`, or the certificate of this node
+func newReplicationNode(cnf *config.Config) (*replication.Node, error) {
+	if !strings.EqualFold(cnf.DB.Type, config.Badger) {
+		return nil, fmt.Errorf("only badger store can be replicated, got %s", cnf.DB.Type)
+	}
+	var opts []replication.Option
+	if cnf.TLS.Enabled() {
+		caFile := cnf.TLS.ClientCAFile
+		if len(caFile) == 0 {
+			caFile = cnf.TLS.CertFile
+		}
+		pool, err := auth.LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		if len(cnf.TLS.ClientCAFile) != 0 {
+			cert, err := tls.LoadX509KeyPair(cnf.TLS.CertFile, cnf.TLS.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, replication.WithTLSConfig(tlsCfg))
+	}
+	return replication.NewNode(cnf.Replication, opts...)
+}
+
 func run(cliCtx *cli.Context) error {
-	ctx := cliCtx.Context
+	// the server is shut down gracefully when the signals received
+	ctx, stop := signal.NotifyContext(cliCtx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	repoPath, err := GetRepoPath(cliCtx)
 	if err != nil {
 		return err
@@ -98,26 +140,94 @@ func run(cliCtx *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if err := cnf.TLS.Validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
 
 	log.InitLog(cnf.Log)
+	defer log.Close()
+	if err := core.SetupNetwork(cnf.Network); err != nil {
+		return err
+	}
+	log.Infof("network: %s", core.CurrentNetwork)
 
 	dataPath := repo.GetDataDir()
-	app, err := auth.NewOAuthApp(dataPath, cnf.DB)
+	var opts []auth.ServiceOption
+	if resolver := chain.NewResolver(cnf.Chain); resolver != nil {
+		log.Infof("resolve miner addresses through %s", cnf.Chain.URL)
+		opts = append(opts, auth.WithResolver(resolver))
+	}
+	if cnf.SelfService != nil {
+		opts = append(opts, auth.WithSelfService(cnf.SelfService))
+	}
+	if cnf.RateLimit != nil {
+		opts = append(opts, auth.WithDefaultRateLimit(cnf.RateLimit))
+	}
+	if cnf.TLS.Enabled() && len(cnf.TLS.ClientCAFile) != 0 {
+		perm := core.Permission(cnf.TLS.ClientCertPerm)
+		log.Infof("accept client certificates verified by %s with permission %s", cnf.TLS.ClientCAFile, perm)
+		opts = append(opts, auth.WithClientCertPerm(perm))
+	}
+	var node *replication.Node
+	if cnf.Replication != nil && cnf.Replication.Enable {
+		if node, err = newReplicationNode(cnf); err != nil {
+			return fmt.Errorf("init replication: %w", err)
+		}
+		opts = append(opts, auth.WithReplication(node))
+	}
+	app, err := auth.NewOAuthApp(dataPath, cnf.DB, opts...)
 	if err != nil {
 		return fmt.Errorf("init oauth app: %s", err)
 	}
-
-	token, err := app.GetDefaultAdminToken()
-	if err != nil {
-		return fmt.Errorf("get default admin token: %s", err)
+	defer func() {
+		if err := app.Close(); err != nil {
+			log.Warnf("close oauth app: %s", err)
+		}
+	}()
+	// the background loops are stopped before the app closed
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	goLoop := func(loop func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop()
+		}()
 	}
 
-	err = repo.SaveToken(token)
-	if err != nil {
-		return fmt.Errorf("save token: %s", err)
+	if cnf.Reconcile != nil && len(cnf.Reconcile.ManifestPath) != 0 {
+		goLoop(func() { app.Reconcile(ctx, cnf.Reconcile) })
+	}
+	if cnf.Reaper != nil && cnf.Reaper.Enable {
+		if cnf.Reaper.Interval <= 0 {
+			return fmt.Errorf("interval of reaper should be positive, got %s", cnf.Reaper.Interval)
+		}
+		goLoop(func() { app.Reap(ctx, cnf.Reaper) })
+	}
+	if cnf.Retention != nil && cnf.Retention.Enable {
+		if cnf.Retention.Interval <= 0 {
+			return fmt.Errorf("interval of retention should be positive, got %s", cnf.Retention.Interval)
+		}
+		goLoop(func() { app.Retain(ctx, cnf.Retention) })
+	}
+	// nothing is delivered until webhooks registered
+	webhookCnf := cnf.Webhook
+	if webhookCnf == nil {
+		webhookCnf = config.DefaultConfig().Webhook
 	}
+	if webhookCnf.Timeout <= 0 || webhookCnf.MaxAttempts <= 0 || webhookCnf.MinBackoff <= 0 || webhookCnf.MaxBackoff < webhookCnf.MinBackoff {
+		return fmt.Errorf("invalid webhook config, timeout and attempts should be positive, and backoff from %s to %s should be increasing",
+			webhookCnf.MinBackoff, webhookCnf.MaxBackoff)
+	}
+	goLoop(func() { app.DeliverWebhooks(ctx, webhookCnf) })
 
-	router := auth.InitRouter(app)
+	cors := auth.NewCors(cnf.Cors)
+	router := auth.InitRouter(app, auth.WithCors(cors))
+	if node != nil {
+		router = node.Handler(router)
+	}
 
 	if cnf.Trace != nil && cnf.Trace.JaegerTracingEnabled {
 		log.Infof("setup jaeger-tracing exporter to %s, with node-name:%s",
@@ -138,24 +248,86 @@ func run(cliCtx *cli.Context) error {
 		}
 	}
 
-	// set up metrics
-	if cnf.Metrics != nil {
-		err := metrics.SetupMetrics(ctx, cnf.Metrics)
-		if err != nil {
-			log.Warnf("setup metrics: %s", err)
-		}
-	}
+	// set up metrics, they are restarted when the config reloaded
+	reloader := newConfigReloader(ctx, cnfPath, cliCtx, cnf, app, cors)
+	reloader.setupMetrics(cnf.Metrics)
+	goLoop(reloader.run)
 
 	server := &http.Server{
-		Addr:         cnf.Listen,
 		Handler:      router,
 		ReadTimeout:  cnf.ReadTimeout,
 		WriteTimeout: cnf.WriteTimeout,
 		IdleTimeout:  cnf.IdleTimeout,
 	}
-	log.Infof("server start and listen on %s", cnf.Listen)
+	// the event streams never idle, they are ended for shutdown not waiting them
+	server.RegisterOnShutdown(app.CloseEvents)
+	if cnf.TLS.Enabled() {
+		server.TLSConfig, err = auth.NewTLSConfig(ctx, cnf.TLS)
+		if err != nil {
+			return fmt.Errorf("init tls: %w", err)
+		}
+	}
+
+	addrs := append([]string{cnf.Listen}, cnf.ExtraListen...)
+	listeners := make([]net.Listener, 0, len(addrs))
+	defer func() {
+		for _, lst := range listeners {
+			_ = lst.Close()
+		}
+	}()
+	for _, addr := range addrs {
+		lst, err := util.Listen(addr)
+		if err != nil {
+			return fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, lst)
+	}
 
 	core.ApiState.Set(ctx, 1)
-	defer core.ApiState.Set(ctx, 0)
-	return server.ListenAndServe()
+	errCh := make(chan error, len(listeners)+1)
+	for i, lst := range listeners {
+		go func(addr string, lst net.Listener) {
+			// unix sockets are guarded by filesystem permissions, tls is only for tcp
+			if _, isUnix := util.UnixSocketPath(addr); cnf.TLS.Enabled() && !isUnix {
+				log.Infof("server start and listen on %s over tls", addr)
+				errCh <- server.ServeTLS(lst, "", "")
+				return
+			}
+			log.Infof("server start and listen on %s", addr)
+			errCh <- server.Serve(lst)
+		}(addrs[i], lst)
+	}
+	// the default admin token is got after serving, since it's created by the leader with replication,
+	// which is elected through the apis
+	go func() {
+		token, err := app.GetDefaultAdminToken(ctx)
+		if err != nil {
+			errCh <- fmt.Errorf("get default admin token: %s", err)
+			return
+		}
+		if err := repo.SaveToken(token); err != nil {
+			errCh <- fmt.Errorf("save token: %s", err)
+		}
+	}()
+
+	select {
+	case err = <-errCh:
+		// failed to serve on one of the addresses or to save the token, the others are shut down
+		log.Errorf("%s", err)
+	case <-ctx.Done():
+		err = nil
+	}
+	timeout := cnf.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultShutdownTimeout
+	}
+	log.Infof("shutting down, wait %s for the requests in flight", timeout)
+	core.ApiState.Set(ctx, 0)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warnf("drain requests: %s, close the connections left", err)
+		_ = server.Close()
+	}
+	return err
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
 )
 
@@ -35,6 +36,14 @@ var genTokenCmd = &cli.Command{
 			Usage: "custom string in JWT payload",
 			Value: "",
 		},
+		&cli.StringFlag{
+			Name:  "description",
+			Usage: "what the token is for",
+		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "label of token, format: key=value, can be specified multiple times",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		client, err := GetCli(ctx)
@@ -55,8 +64,16 @@ var genTokenCmd = &cli.Command{
 			return fmt.Errorf("`perm` flag invalid")
 		}
 
+		labels, err := parseLabels(ctx.StringSlice("label"))
+		if err != nil {
+			return err
+		}
+
 		extra := ctx.String("extra")
-		tk, err := client.GenerateToken(ctx.Context, name, perm, extra)
+		tk, err := client.GenerateTokenWithMeta(ctx.Context, name, perm, extra, auth.TokenMeta{
+			Description: ctx.String("description"),
+			Labels:      labels,
+		})
 		if err != nil {
 			return err
 		}
@@ -92,6 +109,10 @@ var getTokenCmd = &cli.Command{
 			fmt.Println("name:       ", token.Name)
 			fmt.Println("perm:       ", token.Perm)
 			fmt.Println("create time:", token.CreateTime)
+			fmt.Println("custom:     ", token.Custom)
+			fmt.Println("description:", token.Description)
+			fmt.Println("labels:     ", formatLabels(token.Labels))
+			fmt.Println("last used:  ", formatLastUsed(token))
 			fmt.Println("token:      ", token.Token)
 			fmt.Println()
 		}
@@ -128,13 +149,14 @@ var listTokensCmd = &cli.Command{
 		//	Token     string    `json:"token"`
 		//	Name      string    `json:"name"`
 		//	CreatTime time.Time `json:"createTime"`
-		fmt.Println("num\tname\t\tperm\t\tcreateTime\t\ttoken")
+		fmt.Println("num\tname\t\tperm\t\tcreateTime\t\tlastUsed\t\t\tdescription\tlabels\ttoken")
 		for k, v := range tks {
 			name := v.Name
 			if len(name) < 8 {
 				name = name + "\t"
 			}
-			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", k+1, name, v.Perm, v.CreateTime.Format("2006-01-02 15:04:05"), v.Token)
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k+1, name, v.Perm, v.CreateTime.Format("2006-01-02 15:04:05"),
+				formatLastUsed(v), v.Description, formatLabels(v.Labels), v.Token)
 		}
 		return nil
 	},
@@ -183,3 +205,11 @@ var recoverTokenCmd = &cli.Command{
 		return nil
 	},
 }
+
+// formatLastUsed formats the last used time and client ip of token
+func formatLastUsed(token *auth.TokenInfo) string {
+	if token.LastUsedTime == nil {
+		return "never"
+	}
+	return fmt.Sprintf("%s(%s)", token.LastUsedTime.Format("2006-01-02 15:04:05"), token.LastUsedIP)
+}
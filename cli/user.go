@@ -44,6 +44,10 @@ var userAddCmd = &cli.Command{
 			Usage: "1-enabled,2-disabled. if set to 2, the user cannot access the chain service normally",
 			Value: 1,
 		},
+		&cli.StringFlag{
+			Name:  "org",
+			Usage: "organization of the user, required when called by an org admin",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		if ctx.NArg() != 1 {
@@ -61,6 +65,7 @@ var userAddCmd = &cli.Command{
 		user := &auth.CreateUserRequest{
 			Name:  name,
 			State: core.UserState(state),
+			Org:   ctx.String("org"),
 		}
 		if ctx.IsSet("comment") {
 			comment := ctx.String("comment")
@@ -98,6 +103,9 @@ var userGetCmd = &cli.Command{
 		fmt.Println("name:", user.Name)
 		fmt.Println("state", user.State, "\t// 2: disable, 1: enable")
 		fmt.Println("comment:", user.Comment)
+		if len(user.Org) != 0 {
+			fmt.Println("org:", user.Org, "\torgAdmin:", user.OrgAdmin)
+		}
 		fmt.Println("createTime:", time.Unix(user.CreateTime, 0).Format(time.RFC1123))
 		fmt.Println("updateTime:", time.Unix(user.CreateTime, 0).Format(time.RFC1123))
 		fmt.Println()
@@ -239,8 +247,14 @@ var userListCmd = &cli.Command{
 
 var userDeleteCmd = &cli.Command{
 	Name:      "delete",
-	Usage:     "Delete user",
+	Usage:     "Delete user, miners and signers of user are detached",
 	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "cascade",
+			Usage: "revoke tokens of user too, `user recover` restores the user with its tokens, miners and signers",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		client, err := GetCli(ctx)
 		if err != nil {
@@ -260,7 +274,8 @@ var userDeleteCmd = &cli.Command{
 		}
 
 		req := &auth.DeleteUserRequest{
-			Name: ctx.Args().First(),
+			Name:    ctx.Args().First(),
+			Cascade: ctx.Bool("cascade"),
 		}
 
 		err = client.DeleteUser(ctx.Context, req)
@@ -3,6 +3,8 @@ package cli
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
 )
 
 var minerSubCmds = &cli.Command{
@@ -20,6 +24,8 @@ var minerSubCmds = &cli.Command{
 		minerExistCmd,
 		minerListCmd,
 		minerDeleteCmd,
+		minerTransferCmd,
+		minerLabelCmd,
 	},
 }
 
@@ -32,6 +38,10 @@ var minerAddCmd = &cli.Command{
 			Usage: "false/true",
 			Value: true,
 		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "label of miner in the form of key=value, can be specified multiple times",
+		},
 	},
 	ArgsUsage: "<user> <miner>",
 	Action: func(ctx *cli.Context) error {
@@ -45,11 +55,24 @@ var minerAddCmd = &cli.Command{
 		}
 		user, miner := ctx.Args().Get(0), ctx.Args().Get(1)
 		openMining := ctx.Bool("openMining")
+		labels, err := parseLabels(ctx.StringSlice("label"))
+		if err != nil {
+			return err
+		}
 
 		var isCreate bool
 		if isCreate, err = client.UpsertMiner(ctx.Context, user, miner, openMining); err != nil {
 			return err
 		}
+		if len(labels) != 0 {
+			mAddr, err := address.NewFromString(miner)
+			if err != nil {
+				return err
+			}
+			if _, err := client.UpdateMinerLabels(ctx.Context, mAddr, labels, nil); err != nil {
+				return xerrors.Errorf("set labels of miner:%s failed: %w", miner, err)
+			}
+		}
 		var opStr string
 		if isCreate {
 			opStr = "create"
@@ -103,6 +126,12 @@ var minerListCmd = &cli.Command{
 	Name:      "list",
 	Usage:     "List of miners for the specified user",
 	ArgsUsage: "<user>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "only list miners with the label, in the form of key=value or key, can be specified multiple times",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		args := ctx.Args()
 		if args.Len() != 1 {
@@ -120,7 +149,7 @@ var minerListCmd = &cli.Command{
 			return xerrors.Errorf("list user:%s miner failed: %w", user, err)
 		}
 
-		miners, err := client.ListMiners(ctx.Context, user)
+		miners, err := client.ListMinersByLabels(ctx.Context, user, ctx.StringSlice("label"))
 		if err != nil {
 			return err
 		}
@@ -132,9 +161,9 @@ var minerListCmd = &cli.Command{
 
 		const padding = 2
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "idx\tminer\topenMining\tcreate-time\t")
+		fmt.Fprintln(w, "idx\tminer\topenMining\tlabels\tcreate-time\t")
 		for idx, miner := range miners {
-			fmt.Fprintf(w, "%d\t%s\t%v\t%s\t\n", idx, miner.Miner, miner.OpenMining, miner.CreatedAt.Format(time.RFC1123))
+			fmt.Fprintf(w, "%d\t%s\t%v\t%s\t%s\t\n", idx, miner.Miner, miner.OpenMining, formatLabels(miner.Labels), miner.CreatedAt.Format(time.RFC1123))
 		}
 		_ = w.Flush()
 		return nil
@@ -171,3 +200,119 @@ var minerDeleteCmd = &cli.Command{
 		return nil
 	},
 }
+
+var minerTransferCmd = &cli.Command{
+	Name:      "transfer",
+	Usage:     "Transfer miner from one user to another",
+	ArgsUsage: "<miner>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Usage:    "current owner of the miner",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "new owner of the miner",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "confirm-token",
+			Usage: "token of the current owner, the transfer is rejected if it does not belong to the current owner",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		args := ctx.Args()
+		if args.Len() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		miner := args.First()
+		mAddr, err := address.NewFromString(miner)
+		if err != nil {
+			return err
+		}
+		from, to := ctx.String("from"), ctx.String("to")
+		prev, err := client.TransferMiner(ctx.Context, mAddr, from, to, ctx.String("confirm-token"))
+		if err != nil {
+			return xerrors.Errorf("transfer miner:%s failed: %w", miner, err)
+		}
+
+		fmt.Printf("transfer miner:%s from user:%s to user:%s success, previous binding updated at %s.\n",
+			miner, prev.User, to, prev.UpdatedAt.Format(time.RFC1123))
+		return nil
+	},
+}
+
+var minerLabelCmd = &cli.Command{
+	Name:  "label",
+	Usage: "Set or remove labels of miner",
+	Description: "well known flags, whose value must be true or false: " +
+		strings.Join(core.MinerFlags, ", "),
+	ArgsUsage: "<miner>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "label to set in the form of key=value, can be specified multiple times",
+		},
+		&cli.StringSliceFlag{
+			Name:  "unset",
+			Usage: "key of label to remove, can be specified multiple times",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		miner := ctx.Args().First()
+		mAddr, err := address.NewFromString(miner)
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(ctx.StringSlice("set"))
+		if err != nil {
+			return err
+		}
+		res, err := client.UpdateMinerLabels(ctx.Context, mAddr, labels, ctx.StringSlice("unset"))
+		if err != nil {
+			return xerrors.Errorf("update labels of miner:%s failed: %w", miner, err)
+		}
+
+		fmt.Printf("update labels of miner:%s success, labels: %s\n", miner, formatLabels(res.Labels))
+		return nil
+	},
+}
+
+func parseLabels(labels []string) (map[string]string, error) {
+	res := make(map[string]string, len(labels))
+	for _, label := range labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, xerrors.Errorf("invalid label %s, should be key=value", label)
+		}
+		res[key] = value
+	}
+	return res, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
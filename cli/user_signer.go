@@ -3,6 +3,8 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
 var signerSubCmds = &cli.Command{
@@ -20,6 +24,7 @@ var signerSubCmds = &cli.Command{
 		signerExistCmd,
 		signerListCmd,
 		signerUnregisterCmd,
+		signerPolicyCmd,
 	},
 }
 
@@ -121,9 +126,9 @@ var signerListCmd = &cli.Command{
 
 		const padding = 2
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "idx\tsigner\tcreate-time\t")
+		fmt.Fprintln(w, "idx\tsigner\tpolicy\tcreate-time\t")
 		for idx, signer := range signers {
-			fmt.Fprintf(w, "%d\t%s\t%s\t\n", idx, signer.Signer, signer.CreatedAt.Format(time.RFC1123))
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t\n", idx, signer.Signer, formatSignerPolicy(signer.Policy), signer.CreatedAt.Format(time.RFC1123))
 		}
 		_ = w.Flush()
 		return nil
@@ -167,3 +172,84 @@ var signerUnregisterCmd = &cli.Command{
 		return nil
 	},
 }
+
+var signerPolicyCmd = &cli.Command{
+	Name:      "policy",
+	Usage:     "Set usage policy of signer for the specified user, values are in attoFIL",
+	ArgsUsage: "<user> <signer address>",
+	Flags: []cli.Flag{
+		&cli.Uint64SliceFlag{
+			Name:  "method",
+			Usage: "method number of message allowed to sign, can be specified multiple times, all methods are allowed if not set",
+		},
+		&cli.StringFlag{
+			Name:  "max-value",
+			Usage: "max value per message",
+		},
+		&cli.StringFlag{
+			Name:  "daily-cap",
+			Usage: "max total value of messages per day(UTC)",
+		},
+		&cli.BoolFlag{
+			Name:  "clear",
+			Usage: "remove the policy",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		user, signer := ctx.Args().Get(0), ctx.Args().Get(1)
+		sAddr, err := address.NewFromString(signer)
+		if err != nil {
+			return err
+		}
+
+		var policy *storage.SignerPolicy
+		if !ctx.Bool("clear") {
+			policy = &storage.SignerPolicy{
+				AllowedMethods: ctx.Uint64Slice("method"),
+				MaxValue:       ctx.String("max-value"),
+				DailyCap:       ctx.String("daily-cap"),
+			}
+		}
+		res, err := client.UpdateSignerPolicy(ctx.Context, user, sAddr, policy)
+		if err != nil {
+			return xerrors.Errorf("update policy of signer:%s failed: %w", signer, err)
+		}
+
+		fmt.Printf("update policy of signer:%s for %s success, policy: %s\n", signer, user, formatSignerPolicy(res.Policy))
+		return nil
+	},
+}
+
+func formatSignerPolicy(policy *storage.SignerPolicy) string {
+	if policy == nil {
+		return "-"
+	}
+	var parts []string
+	if len(policy.AllowedMethods) != 0 {
+		methods := make([]string, len(policy.AllowedMethods))
+		for idx, m := range policy.AllowedMethods {
+			methods[idx] = strconv.FormatUint(m, 10)
+		}
+		parts = append(parts, "methods="+strings.Join(methods, "|"))
+	}
+	if len(policy.MaxValue) != 0 {
+		parts = append(parts, "max-value="+policy.MaxValue)
+	}
+	if len(policy.DailyCap) != 0 {
+		parts = append(parts, "daily-cap="+policy.DailyCap)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
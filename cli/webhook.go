@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var webhookSubCommand = &cli.Command{
+	Name:  "webhook",
+	Usage: "webhook command, the events of users, tokens, miners and signers are posted to webhooks",
+	Subcommands: []*cli.Command{
+		webhookAddCmd,
+		webhookUpdateCmd,
+		webhookGetCmd,
+		webhookListCmd,
+		webhookDeleteCmd,
+		webhookDeliveriesCmd,
+	},
+}
+
+var webhookFilterFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "events",
+		Usage: fmt.Sprintf("types of the events delivered, all types if not set, types: %v", auth.EventTypes),
+	},
+	&cli.StringFlag{
+		Name:  "user",
+		Usage: "only the events of the user",
+	},
+	&cli.StringFlag{
+		Name:  "perm",
+		Usage: "only the tokens of the permission, the other events are not affected",
+	},
+	&cli.StringFlag{
+		Name: "comment",
+	},
+}
+
+func eventTypes(ctx *cli.Context) []auth.EventType {
+	types := make([]auth.EventType, 0)
+	for _, t := range ctx.StringSlice("events") {
+		types = append(types, auth.EventType(t))
+	}
+	return types
+}
+
+// optionalString nil if the flag is not set
+func optionalString(ctx *cli.Context, name string) *string {
+	if !ctx.IsSet(name) {
+		return nil
+	}
+	value := ctx.String(name)
+	return &value
+}
+
+var webhookAddCmd = &cli.Command{
+	Name:      "add",
+	Usage:     "Add webhook, the requests posted are signed by the secret, see `X-Sophon-Signature`",
+	ArgsUsage: "<name> <url>",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "secret",
+			Usage: "signs the requests posted, generated if not set",
+		},
+	}, webhookFilterFlags...),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := client.CreateWebhook(ctx.Context, &auth.CreateWebhookReq{
+			Name:    ctx.Args().Get(0),
+			URL:     ctx.Args().Get(1),
+			Events:  eventTypes(ctx),
+			User:    ctx.String("user"),
+			Perm:    ctx.String("perm"),
+			Secret:  ctx.String("secret"),
+			Comment: ctx.String("comment"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("Add webhook success, keep the secret, it's only shown this time")
+		printWebhook(res)
+		return nil
+	},
+}
+
+var webhookUpdateCmd = &cli.Command{
+	Name:      "update",
+	Usage:     "Update webhook, only the flags set are changed",
+	ArgsUsage: "<name>",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name: "url",
+		},
+		&cli.BoolFlag{
+			Name:  "disabled",
+			Usage: "stop delivering, the pending deliveries fail",
+		},
+		&cli.BoolFlag{
+			Name:  "rotate-secret",
+			Usage: "generate a new secret, it's only shown this time",
+		},
+	}, webhookFilterFlags...),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		req := &auth.UpdateWebhookReq{Name: ctx.Args().First(), RotateSecret: ctx.Bool("rotate-secret")}
+		req.URL = optionalString(ctx, "url")
+		req.User = optionalString(ctx, "user")
+		req.Perm = optionalString(ctx, "perm")
+		req.Comment = optionalString(ctx, "comment")
+		if ctx.IsSet("events") {
+			types := eventTypes(ctx)
+			req.Events = &types
+		}
+		if ctx.IsSet("disabled") {
+			disabled := ctx.Bool("disabled")
+			req.Disabled = &disabled
+		}
+		res, err := client.UpdateWebhook(ctx.Context, req)
+		if err != nil {
+			return err
+		}
+		fmt.Println("update webhook success")
+		printWebhook(res)
+		return nil
+	},
+}
+
+func printWebhook(webhook *auth.OutputWebhook) {
+	fmt.Println("name:", webhook.Name)
+	fmt.Println("url:", webhook.URL)
+	if len(webhook.Events) != 0 {
+		fmt.Println("events:", webhook.Events)
+	}
+	if len(webhook.User) != 0 {
+		fmt.Println("user:", webhook.User)
+	}
+	if len(webhook.Perm) != 0 {
+		fmt.Println("perm:", webhook.Perm)
+	}
+	fmt.Println("disabled:", webhook.Disabled)
+	if len(webhook.Comment) != 0 {
+		fmt.Println("comment:", webhook.Comment)
+	}
+	if len(webhook.Secret) != 0 {
+		fmt.Println("secret:", webhook.Secret)
+	}
+	fmt.Println("createTime:", time.Unix(webhook.CreateTime, 0).Format(time.RFC1123))
+	fmt.Println("updateTime:", time.Unix(webhook.UpdateTime, 0).Format(time.RFC1123))
+	fmt.Println()
+}
+
+var webhookGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Get webhook by name",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		webhook, err := client.GetWebhook(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		printWebhook(webhook)
+		return nil
+	},
+}
+
+var webhookListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List webhooks",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		webhooks, err := client.ListWebhooks(ctx.Context)
+		if err != nil {
+			return err
+		}
+		for _, webhook := range webhooks {
+			printWebhook(webhook)
+		}
+		return nil
+	},
+}
+
+var webhookDeleteCmd = &cli.Command{
+	Name:      "delete",
+	Usage:     "Delete webhook along with its deliveries",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeleteWebhook(ctx.Context, ctx.Args().First()); err != nil {
+			return err
+		}
+		fmt.Println("remove webhook success")
+		return nil
+	},
+}
+
+var webhookDeliveriesCmd = &cli.Command{
+	Name:      "deliveries",
+	Usage:     "List deliveries of webhooks from the newest, including the pending ones",
+	ArgsUsage: "[name]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "state",
+			Usage: "pending, delivered or failed, all states if not set",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "show at most limit deliveries, all if 0",
+			Value: 20,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() > 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := client.ListWebhookDeliveries(ctx.Context, &auth.ListWebhookDeliveriesReq{
+			Webhook: ctx.Args().First(),
+			State:   ctx.String("state"),
+			Limit:   ctx.Int("limit"),
+		})
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "id\twebhook\tevent\tstate\tattempts\tstatus\tcreate-time\tnext-attempt\terror\t")
+		for _, d := range deliveries {
+			next := "-"
+			if d.State == storage.DeliveryPending {
+				next = d.NextAttempt.Format(time.RFC1123)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t\n", d.ID, d.Webhook, d.EventType, d.State, d.Attempts,
+				d.StatusCode, d.CreateTime.Format(time.RFC1123), next, d.Error)
+		}
+		return w.Flush()
+	},
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/log"
 	"github.com/mitchellh/go-homedir"
 )
@@ -30,6 +31,9 @@ func main() {
 		return
 	}
 	log.InitLog(cnf.Log)
+	if err := core.SetupNetwork(cnf.Network); err != nil {
+		log.Fatalf("Failed to setup network: %s", err)
+	}
 	app, err := auth.NewOAuthApp(dataPath, cnf.DB)
 	if err != nil {
 		log.Fatalf("Failed to init sophon-auth: %s", err)
@@ -3,15 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/filecoin-project/go-address"
 	locli "github.com/ipfs-force-community/sophon-auth/cli"
 	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
-	address.CurrentNetwork = address.Mainnet
 	app := newApp()
 	err := app.Run(os.Args)
 	if err != nil {
@@ -39,6 +38,11 @@ func newApp() (app *cli.App) {
 				Name:  "listen",
 				Value: "127.0.0.1:8989",
 			},
+			&cli.StringFlag{
+				Name:    "network",
+				EnvVars: []string{"SOPHON_AUTH_NETWORK"},
+				Usage:   "network of addresses, overrides the network in config, one of " + strings.Join(core.NetworkNames, ", "),
+			},
 		},
 	}
 	return app
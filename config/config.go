@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"crypto/rand"
+	"fmt"
 	"io"
 	"os"
 	"time"
@@ -10,18 +11,42 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/ipfs-force-community/metrics"
 	"golang.org/x/xerrors"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
 )
 
 type Config struct {
-	Listen       string        `json:"listen"`
+	// `host:port` or a multiaddr, such as /ip4/127.0.0.1/tcp/8989 and /unix/run/sophon-auth.sock
+	Listen string `json:"listen"`
+	// more addresses served besides `Listen`, in the same forms
+	ExtraListen []string `json:"extraListen"`
+	// decides the prefix of addresses, mainnet, calibnet, butterfly, interop, force or 2k
+	Network      string        `json:"network"`
 	ReadTimeout  time.Duration `json:"readTimeout"`
 	WriteTimeout time.Duration `json:"writeTimeout"`
 	IdleTimeout  time.Duration `json:"idleTimeout"`
-	Log          *LogConfig    `json:"log"`
-	DB           *DBConfig     `json:"db"`
+	// how long to wait for the requests in flight after SIGINT or SIGTERM received, `DefaultShutdownTimeout` if not positive
+	ShutdownTimeout time.Duration `json:"shutdownTimeout"`
+	Log             *LogConfig    `json:"log"`
+	DB              *DBConfig     `json:"db"`
 
 	Trace   *metrics.TraceConfig   `json:"traceConfig"`
 	Metrics *metrics.MetricsConfig `json:"metricsExporter"`
+
+	Reconcile *ReconcileConfig `json:"reconcile"`
+	Chain     *ChainConfig     `json:"chain"`
+
+	SelfService *SelfServiceConfig `json:"selfService"`
+	Reaper      *ReaperConfig      `json:"reaper"`
+	Retention   *RetentionConfig   `json:"retention"`
+	Webhook     *WebhookConfig     `json:"webhook"`
+
+	RateLimit *RateLimitConfig `json:"rateLimit"`
+	Cors      *CorsConfig      `json:"cors"`
+
+	TLS *TLSConfig `json:"tls"`
+
+	Replication *ReplicationConfig `json:"replication"`
 }
 
 type DBType = string
@@ -41,6 +66,9 @@ type DBConfig struct {
 	Debug        bool          `json:"debug"`
 }
 
+// DefaultShutdownTimeout the time to drain requests when the daemon is shutting down
+const DefaultShutdownTimeout = 30 * time.Second
+
 // RandSecret If the daemon does not have a secret key configured, it is automatically generated
 func RandSecret() ([]byte, error) {
 	sk, err := io.ReadAll(io.LimitReader(rand.Reader, 32))
@@ -57,9 +85,12 @@ func DefaultConfig() *Config {
 
 	return &Config{
 		Listen:       "127.0.0.1:8989",
+		Network:      "mainnet",
 		ReadTimeout:  time.Minute,
 		WriteTimeout: time.Minute,
 		IdleTimeout:  time.Minute,
+
+		ShutdownTimeout: DefaultShutdownTimeout,
 		Trace: &metrics.TraceConfig{
 			JaegerTracingEnabled: false,
 			ProbabilitySampler:   1.0,
@@ -78,7 +109,197 @@ func DefaultConfig() *Config {
 			MaxLifeTime:  120 * time.Second,
 			MaxIdleTime:  60 * time.Second,
 		},
+		Reconcile: &ReconcileConfig{
+			Interval: 10 * time.Minute,
+		},
+		Chain: &ChainConfig{
+			Timeout: 10 * time.Second,
+		},
+		SelfService: &SelfServiceConfig{
+			RegisterSigner: false,
+			MaxSigners:     10,
+		},
+		Reaper: &ReaperConfig{
+			Enable:    false,
+			Interval:  24 * time.Hour,
+			StaleDays: 90,
+			Policy:    ReaperPolicyReport,
+		},
+		Retention: &RetentionConfig{
+			Enable:    false,
+			Interval:  24 * time.Hour,
+			OlderThan: 90 * 24 * time.Hour,
+		},
+		Webhook: &WebhookConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			MinBackoff:   10 * time.Second,
+			MaxBackoff:   time.Hour,
+			LogRetention: 7 * 24 * time.Hour,
+		},
+		RateLimit: &RateLimitConfig{
+			Cap:      0,
+			ResetDur: time.Minute,
+		},
+		Cors: &CorsConfig{
+			AllowOrigins: []string{"*"},
+		},
+		TLS: &TLSConfig{
+			MinVersion:     TLSVersion12,
+			ClientCertPerm: "read",
+		},
+		Replication: &ReplicationConfig{
+			ElectionTimeout:   3 * time.Second,
+			HeartbeatInterval: time.Second,
+		},
+	}
+}
+
+// policies of the reaper on stale tokens and users
+const (
+	// only report them
+	ReaperPolicyReport = "report"
+	// disable stale users and remove stale tokens, tokens have no disabled state and can be recovered
+	ReaperPolicyDisable = "disable"
+	// remove both stale tokens and users, they can be recovered
+	ReaperPolicyDelete = "delete"
+)
+
+// ReaperConfig the daemon finds stale tokens and users periodically,
+// tokens not verified for `StaleDays` days are stale, so are the users whose tokens are all stale,
+// users without any token are never stale.
+type ReaperConfig struct {
+	Enable   bool          `json:"enable"`
+	Interval time.Duration `json:"interval"`
+	// tokens never verified are aged from their creation, or from when usages started to be tracked if it's later
+	StaleDays int `json:"staleDays"`
+	// report, disable or delete
+	Policy string `json:"policy"`
+	// users whose tokens are never touched, the user of the default admin token is always protected
+	Protected []string `json:"protected"`
+}
+
+// RetentionConfig the daemon purges the records soft-deleted longer than `OlderThan` periodically,
+// the purged can't be recovered any more.
+type RetentionConfig struct {
+	Enable    bool          `json:"enable"`
+	Interval  time.Duration `json:"interval"`
+	OlderThan time.Duration `json:"olderThan"`
+	// token, user, miner or signer, all kinds if empty
+	Kinds []string `json:"kinds"`
+}
+
+// WebhookConfig the leader posts the events to the webhooks registered, a delivery failed is retried
+// after a backoff doubling from `MinBackoff` up to `MaxBackoff`, until `MaxAttempts` attempts made.
+type WebhookConfig struct {
+	// of each attempt
+	Timeout     time.Duration `json:"timeout"`
+	MaxAttempts int           `json:"maxAttempts"`
+	MinBackoff  time.Duration `json:"minBackoff"`
+	MaxBackoff  time.Duration `json:"maxBackoff"`
+	// the deliveries finished longer than it are removed from the log
+	LogRetention time.Duration `json:"logRetention"`
+}
+
+// versions of TLS accepted as the minimum one
+const (
+	TLSVersion12 = "tls1.2"
+	TLSVersion13 = "tls1.3"
+)
+
+// TLSConfig the http apis are served over TLS if both `CertFile` and `KeyFile` are set,
+// the certificate and the CA bundle are reloaded whenever their files changed.
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// tls1.2 or tls1.3, tls1.2 if empty
+	MinVersion string `json:"minVersion"`
+	// CA bundle to verify client certificates, a verified client certificate authenticates
+	// the user named by its common name, as an alternative of tokens
+	ClientCAFile string `json:"clientCAFile"`
+	// reject the connections without a verified client certificate
+	RequireClientCert bool `json:"requireClientCert"`
+	// permission of the requests authenticated by client certificates, read, write or sign,
+	// admin is refused since it's granted to every user with a certificate
+	ClientCertPerm string `json:"clientCertPerm"`
+}
+
+// Enabled returns true if the http apis are served over TLS
+func (c *TLSConfig) Enabled() bool {
+	return c != nil && len(c.CertFile) != 0 && len(c.KeyFile) != 0
+}
+
+// Validate checks the permission of client certificates if they are accepted
+func (c *TLSConfig) Validate() error {
+	if !c.Enabled() || len(c.ClientCAFile) == 0 {
+		return nil
+	}
+	perm := core.Permission(c.ClientCertPerm)
+	if !core.IsValid(perm) {
+		return fmt.Errorf("invalid permission of client certificates: %q", c.ClientCertPerm)
+	}
+	if perm == core.PermAdmin {
+		return fmt.Errorf("permission of client certificates can't be %s", core.PermAdmin)
 	}
+	return nil
+}
+
+// ReplicationConfig replicates the badger store from the leader to the followers, the followers serve reads
+// and `/verify`, and proxy writes to the leader, which is elected among the nodes.
+type ReplicationConfig struct {
+	Enable bool `json:"enable"`
+	// the url the other nodes reach this node at, such as http://10.0.0.1:8989, it identifies the node
+	Advertise string `json:"advertise"`
+	// urls of the other nodes
+	Peers []string `json:"peers"`
+	// authenticates the requests among the nodes, it should be the same on all of them
+	Secret string `json:"secret"`
+	// a follower campaigns if it hears nothing from the leader in the timeout,
+	// and the leader steps down if it can't reach the majority in the timeout
+	ElectionTimeout   time.Duration `json:"electionTimeout"`
+	HeartbeatInterval time.Duration `json:"heartbeatInterval"`
+}
+
+// RateLimitConfig the default rate limit of users without a limit of their own
+type RateLimitConfig struct {
+	// max requests in `ResetDur`, 0 means no limit
+	Cap      int64         `json:"cap"`
+	ResetDur time.Duration `json:"resetDur"`
+}
+
+// CorsConfig cross-origin requests accepted by the http apis
+type CorsConfig struct {
+	// origins allowed, "*" allows any origin
+	AllowOrigins []string `json:"allowOrigins"`
+	// headers allowed besides the builtin ones
+	AllowHeaders []string `json:"allowHeaders"`
+}
+
+// SelfServiceConfig the policy of what users can do for themselves through `/me`
+type SelfServiceConfig struct {
+	// users can register signers for themselves
+	RegisterSigner bool `json:"registerSigner"`
+	// max signers of a user after registering by itself, 0 means no limit
+	MaxSigners int `json:"maxSigners"`
+}
+
+// ChainConfig a Lotus/Venus compatible node, used to resolve miner addresses to ID addresses
+type ChainConfig struct {
+	// url of the node api, eg. http://127.0.0.1:1234/rpc/v1, only ID addresses are accepted if empty
+	URL     string        `json:"url"`
+	Token   string        `json:"token"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// ReconcileConfig the daemon applies the manifest periodically and whenever it changed
+type ReconcileConfig struct {
+	// path of the manifest file, reconcile is disabled if empty
+	ManifestPath string        `json:"manifestPath"`
+	Interval     time.Duration `json:"interval"`
+	// remove users, miners, signers and rate limits absent from the manifest
+	Prune bool `json:"prune"`
+	// users never removed by prune
+	Protected []string `json:"protected"`
 }
 
 type LogHookType = int
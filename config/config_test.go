@@ -28,3 +28,63 @@ func TestSafeWriteConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestValidateReloadable(t *testing.T) {
+	cnf := DefaultConfig()
+	if err := cnf.ValidateReloadable(); err != nil {
+		t.Fatal(err)
+	}
+
+	cnf.Log.LogLevel = "verbose"
+	if err := cnf.ValidateReloadable(); err == nil {
+		t.Fatal("expect error of invalid log level")
+	}
+
+	cnf = DefaultConfig()
+	cnf.Log.HookSwitch = true
+	cnf.Log.Type = LHTInfluxDB
+	if err := cnf.ValidateReloadable(); err == nil {
+		t.Fatal("expect error of missing influxdb section")
+	}
+
+	cnf = DefaultConfig()
+	cnf.Metrics.Enabled = true
+	cnf.Metrics.Exporter.Type = "unknown"
+	if err := cnf.ValidateReloadable(); err == nil {
+		t.Fatal("expect error of invalid exporter type")
+	}
+
+	cnf = DefaultConfig()
+	cnf.RateLimit.Cap = 10
+	cnf.RateLimit.ResetDur = 0
+	if err := cnf.ValidateReloadable(); err == nil {
+		t.Fatal("expect error of invalid reset duration")
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	cnf := DefaultConfig()
+	if err := cnf.TLS.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cnf.TLS.CertFile, cnf.TLS.KeyFile, cnf.TLS.ClientCAFile = "server.crt", "server.key", "ca.crt"
+	for _, perm := range []string{"read", "write", "sign"} {
+		cnf.TLS.ClientCertPerm = perm
+		if err := cnf.TLS.Validate(); err != nil {
+			t.Fatalf("perm %s: %v", perm, err)
+		}
+	}
+	for _, perm := range []string{"", "root", "admin"} {
+		cnf.TLS.ClientCertPerm = perm
+		if err := cnf.TLS.Validate(); err == nil {
+			t.Fatalf("expect error of perm %q", perm)
+		}
+	}
+
+	// the perm is not used without the CA of client certificates
+	cnf.TLS.ClientCAFile = ""
+	if err := cnf.TLS.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
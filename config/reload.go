@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ipfs-force-community/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Watch calls onChange whenever the config file is written, renamed or recreated,
+// the file is watched until the process exits.
+func Watch(path string, onChange func(in fsnotify.Event)) error {
+	provider, err := FromConfigString(path, "toml")
+	if err != nil {
+		return err
+	}
+	provider.OnConfigChange(onChange)
+	provider.WatchConfig()
+	return nil
+}
+
+// ValidateReloadable checks the sections which can be reloaded while the daemon is running,
+// a config failed the check should not be applied at all.
+func (c *Config) ValidateReloadable() error {
+	if c.Log == nil {
+		return fmt.Errorf("log section is required")
+	}
+	if _, err := logrus.ParseLevel(c.Log.LogLevel); err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	if c.Log.HookSwitch {
+		if c.Log.Type != LHTInfluxDB {
+			return fmt.Errorf("unsupported log hook type %d", c.Log.Type)
+		}
+		if c.Log.InfluxDB == nil {
+			return fmt.Errorf("influxdb section is required when the log hook is on")
+		}
+	}
+
+	if c.Metrics != nil && c.Metrics.Enabled {
+		exporter := c.Metrics.Exporter
+		if exporter == nil {
+			return fmt.Errorf("metrics exporter section is required when metrics is enabled")
+		}
+		var period string
+		switch exporter.Type {
+		case metrics.ETPrometheus:
+			if exporter.Prometheus == nil {
+				return fmt.Errorf("prometheus section is required by the prometheus exporter")
+			}
+			period = exporter.Prometheus.ReportingPeriod
+		case metrics.ETGraphite:
+			if exporter.Graphite == nil {
+				return fmt.Errorf("graphite section is required by the graphite exporter")
+			}
+			period = exporter.Graphite.ReportingPeriod
+		default:
+			return fmt.Errorf("invalid metrics exporter type: %s", exporter.Type)
+		}
+		if _, err := time.ParseDuration(period); err != nil {
+			return fmt.Errorf("metrics reporting period: %w", err)
+		}
+	}
+
+	if c.RateLimit != nil {
+		if c.RateLimit.Cap < 0 {
+			return fmt.Errorf("cap of default rate limit should not be negative, got %d", c.RateLimit.Cap)
+		}
+		if c.RateLimit.Cap > 0 && c.RateLimit.ResetDur <= 0 {
+			return fmt.Errorf("reset duration of default rate limit should be positive, got %s", c.RateLimit.ResetDur)
+		}
+	}
+	return nil
+}
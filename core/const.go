@@ -72,6 +72,13 @@ const (
 	FieldPreHost LogField = "preHost"
 	FieldElapsed LogField = "elapsed"
 	FieldToken   LogField = "token"
+
+	FieldOperator LogField = "operator"
+	FieldMiner    LogField = "miner"
+	FieldSigner   LogField = "signer"
+	FieldFrom     LogField = "from"
+	FieldTo       LogField = "to"
+	FieldOrg      LogField = "org"
 )
 
 var TagFields = []LogField{
@@ -126,3 +133,22 @@ const (
 	NotDelete = 0
 	Deleted   = 1
 )
+
+// well known miner labels, the value of a flag label is "true" or "false"
+const (
+	MinerFlagAcceptDeals          = "accept-deals"
+	MinerFlagPreCommitViaMessager = "precommit-via-messager"
+	MinerFlagWindowPoStOnly       = "window-post-only"
+)
+
+// MinerFlags labels whose value must be a boolean
+var MinerFlags = []string{MinerFlagAcceptDeals, MinerFlagPreCommitViaMessager, MinerFlagWindowPoStOnly}
+
+func IsMinerFlag(key string) bool {
+	for _, flag := range MinerFlags {
+		if flag == key {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,7 @@ const (
 	accountKey CtxKey = iota
 	tokenLocationKey
 	permKey
+	clientIPKey
 )
 
 func HasPerm(ctx context.Context, defaultPerms []Permission, perm Permission) bool {
@@ -61,6 +62,14 @@ func CtxGetTokenLocation(ctx context.Context) (location string, exists bool) {
 	return ctxGetString(ctx, tokenLocationKey)
 }
 
+func CtxWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+func CtxGetClientIP(ctx context.Context) (ip string, exists bool) {
+	return ctxGetString(ctx, clientIPKey)
+}
+
 type ValueFromCtx struct{}
 
 func (vfc *ValueFromCtx) AccFromCtx(ctx context.Context) (string, bool) {
@@ -23,4 +23,7 @@ var (
 	UserGauge          = metrics.NewInt64WithCategory("user/amount", "amount of user", emptyUnit)
 	TokenVerifyCounter = metrics.NewCounter("token/verify", "amount of token verify", TagPerm, TagVerifyState)
 	ApiState           = metrics.NewInt64("api/state", "api service state. 0: down, 1: up", emptyUnit)
+
+	// ticked by `AuthMux` of jwtclient for the verifications sharing the one of the same token in flight
+	TokenVerifyCoalescedCounter = metrics.NewCounter("token/verify_coalesced", "amount of token verify coalesced")
 )
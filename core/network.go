@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+)
+
+type NetworkName = string
+
+const (
+	NetworkMainnet   NetworkName = "mainnet"
+	NetworkCalibnet  NetworkName = "calibnet"
+	NetworkButterfly NetworkName = "butterfly"
+	NetworkInterop   NetworkName = "interop"
+	NetworkForce     NetworkName = "force"
+	Network2k        NetworkName = "2k"
+)
+
+var NetworkNames = []NetworkName{
+	NetworkMainnet, NetworkCalibnet, NetworkButterfly, NetworkInterop, NetworkForce, Network2k,
+}
+
+// CurrentNetwork is the name of network set by `SetupNetwork`, empty if it's not called
+var CurrentNetwork NetworkName
+
+// ParseNetwork returns the address network of the named network,
+// addresses are prefixed with 'f' in mainnet and 't' in the others
+func ParseNetwork(name NetworkName) (address.Network, error) {
+	switch strings.ToLower(name) {
+	case "", NetworkMainnet:
+		return address.Mainnet, nil
+	case NetworkCalibnet, NetworkButterfly, NetworkInterop, NetworkForce, Network2k:
+		return address.Testnet, nil
+	default:
+		return 0, fmt.Errorf("unknown network %q, should be one of %s", name, strings.Join(NetworkNames, ", "))
+	}
+}
+
+// SetupNetwork sets `address.CurrentNetwork`, which decides the prefix of encoded addresses
+func SetupNetwork(name NetworkName) error {
+	network, err := ParseNetwork(name)
+	if err != nil {
+		return err
+	}
+	if len(name) == 0 {
+		name = NetworkMainnet
+	}
+	address.CurrentNetwork = network
+	CurrentNetwork = strings.ToLower(name)
+	return nil
+}
+
+// NetworkPrefix returns the prefix of addresses encoded in the current network
+func NetworkPrefix() string {
+	if address.CurrentNetwork == address.Mainnet {
+		return address.MainnetPrefix
+	}
+	return address.TestnetPrefix
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupNetwork(t *testing.T) {
+	origin, originName := address.CurrentNetwork, CurrentNetwork
+	defer func() {
+		address.CurrentNetwork, CurrentNetwork = origin, originName
+	}()
+
+	addr, err := address.NewFromString("t01000")
+	assert.Nil(t, err)
+
+	assert.Nil(t, SetupNetwork(NetworkMainnet))
+	assert.Equal(t, address.Mainnet, address.CurrentNetwork)
+	assert.Equal(t, "f01000", addr.String())
+	assert.Equal(t, address.MainnetPrefix, NetworkPrefix())
+
+	assert.Nil(t, SetupNetwork("Calibnet"))
+	assert.Equal(t, NetworkCalibnet, CurrentNetwork)
+	assert.Equal(t, "t01000", addr.String())
+	assert.Equal(t, address.TestnetPrefix, NetworkPrefix())
+
+	// mainnet is the default
+	assert.Nil(t, SetupNetwork(""))
+	assert.Equal(t, NetworkMainnet, CurrentNetwork)
+	assert.Equal(t, address.Mainnet, address.CurrentNetwork)
+
+	assert.Error(t, SetupNetwork("devnet"))
+	assert.Equal(t, NetworkMainnet, CurrentNetwork)
+}
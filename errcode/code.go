@@ -0,0 +1,122 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code machine-readable kind of error, clients tell errors apart by it rather than the message
+type Code string
+
+const (
+	CodeNotFound         Code = "not_found"
+	CodeAlreadyExists    Code = "already_exists"
+	CodePermissionDenied Code = "permission_denied"
+	CodeInvalidArgument  Code = "invalid_argument"
+	CodeUnavailable      Code = "unavailable"
+	// the token is missing or can't be verified
+	CodeUnauthenticated Code = "unauthenticated"
+	// errors not classified, they are bad requests as before codes are introduced
+	CodeUnknown Code = "unknown"
+)
+
+// sentinel errors of codes, match them with `errors.Is`
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrUnavailable      = errors.New("unavailable")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+)
+
+var sentinels = map[Code]error{
+	CodeNotFound:         ErrNotFound,
+	CodeAlreadyExists:    ErrAlreadyExists,
+	CodePermissionDenied: ErrPermissionDenied,
+	CodeInvalidArgument:  ErrInvalidArgument,
+	CodeUnavailable:      ErrUnavailable,
+	CodeUnauthenticated:  ErrUnauthenticated,
+}
+
+// HTTPStatus the status of responses carrying errors of code
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAlreadyExists:
+		return http.StatusConflict
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// CodeOfStatus the code of a response of status without one in its body, such as the bare 401 of
+// the requests not authenticated, returns false if the status doesn't tell the kind of error
+func CodeOfStatus(status int) (Code, bool) {
+	switch status {
+	case http.StatusNotFound:
+		return CodeNotFound, true
+	case http.StatusConflict:
+		return CodeAlreadyExists, true
+	case http.StatusForbidden:
+		return CodePermissionDenied, true
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable, true
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated, true
+	}
+	return "", false
+}
+
+type codedError struct {
+	code Code
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func (e *codedError) Is(target error) bool {
+	sentinel, ok := sentinels[e.code]
+	return ok && sentinel == target
+}
+
+// WithCode marks err with code, the message is kept
+func WithCode(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// Errorf formats an error marked with code, `%w` wraps errors as `fmt.Errorf`
+func Errorf(code Code, format string, a ...interface{}) error {
+	return WithCode(code, fmt.Errorf(format, a...))
+}
+
+// CodeOf returns the code err is marked with, or the code of the sentinel err wraps
+func CodeOf(err error) (Code, bool) {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code, true
+	}
+	for code, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			return code, true
+		}
+	}
+	return "", false
+}
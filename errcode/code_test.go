@@ -0,0 +1,47 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	err := Errorf(CodeNotFound, "user %s not found", "tom")
+	assert.Equal(t, "user tom not found", err.Error())
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrAlreadyExists))
+
+	wrapped := fmt.Errorf("get user: %w", err)
+	code, ok := CodeOf(wrapped)
+	assert.True(t, ok)
+	assert.Equal(t, CodeNotFound, code)
+	assert.Equal(t, http.StatusNotFound, code.HTTPStatus())
+
+	code, ok = CodeOf(fmt.Errorf("check: %w", ErrPermissionDenied))
+	assert.True(t, ok)
+	assert.Equal(t, CodePermissionDenied, code)
+
+	_, ok = CodeOf(errors.New("plain"))
+	assert.False(t, ok)
+	assert.Nil(t, WithCode(CodeUnavailable, nil))
+	assert.Equal(t, http.StatusBadRequest, CodeUnknown.HTTPStatus())
+
+	msg := ErrMsg{Error: "org x not exists", Code: CodeNotFound}
+	assert.True(t, errors.Is(msg.Err(), ErrNotFound))
+	assert.Equal(t, "org x not exists", msg.Err().Error())
+
+	// the code and message in the body are kept
+	msg.FillStatus(http.StatusBadRequest)
+	assert.True(t, errors.Is(msg.Err(), ErrNotFound))
+	assert.Equal(t, "org x not exists", msg.Err().Error())
+	bare := ErrMsg{}
+	bare.FillStatus(http.StatusUnauthorized)
+	assert.True(t, errors.Is(bare.Err(), ErrUnauthenticated))
+	assert.Equal(t, "401 Unauthorized", bare.Err().Error())
+	_, ok = CodeOfStatus(http.StatusBadRequest)
+	assert.False(t, ok)
+}
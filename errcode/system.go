@@ -1,13 +1,34 @@
 package errcode
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 type ErrMsg struct {
 	Error string `json:"error"`
+	// machine-readable kind of error, empty if the server doesn't classify errors
+	Code Code `json:"code,omitempty"`
 }
 
+// Err returns an error of the message, it matches the sentinel of its code by `errors.Is`
 func (err *ErrMsg) Err() error {
-	return errors.New(err.Error)
+	if len(err.Code) == 0 {
+		return errors.New(err.Error)
+	}
+	return WithCode(err.Code, errors.New(err.Error))
+}
+
+// FillStatus takes the code and message from the status of response if the body carries none,
+// so `Err` of the bare 401 matches `ErrUnauthenticated`
+func (err *ErrMsg) FillStatus(status int) {
+	if len(err.Code) == 0 {
+		err.Code, _ = CodeOfStatus(status)
+	}
+	if len(err.Error) == 0 {
+		err.Error = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
 }
 
 var (
@@ -0,0 +1,115 @@
+// stm: #integration
+package integrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestBulkApis(t *testing.T) {
+	t.Run("bulk apply", testBulkApply)
+	t.Run("bulk apply with prune", testBulkApplyPrune)
+}
+
+func testBulkApply(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	comment := "bulk"
+	manifest := &auth.Manifest{Users: []*auth.ManifestUser{{
+		Name:       "bulk_user",
+		Comment:    &comment,
+		State:      core.UserStateEnabled,
+		Miners:     []*auth.ManifestMiner{{Miner: "t01000"}},
+		Signers:    []string{"t15rynkupqyfx5ebvaishg7duutwb5ooq2qpaikua"},
+		RateLimits: []*auth.ManifestRateLimit{{Service: "sophon-messager", Cap: 10, ResetDur: time.Minute}},
+		Tokens:     []*auth.ManifestToken{{Perm: core.PermSign}},
+	}}}
+
+	res, err := client.BulkApply(ctx, &auth.BulkApplyReq{Manifest: *manifest, DryRun: true})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 5)
+	has, err := client.HasUser(ctx, "bulk_user")
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	res, err = client.BulkApply(ctx, &auth.BulkApplyReq{Manifest: *manifest})
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 5)
+	assert.Len(t, res.Tokens, 1)
+
+	payload, err := client.Verify(ctx, res.Tokens[0].Token)
+	assert.Nil(t, err)
+	assert.Equal(t, "bulk_user", payload.Name)
+	mAddr, err := address.NewFromString(manifest.Users[0].Miners[0].Miner)
+	assert.Nil(t, err)
+	user, err := client.GetUserByMiner(ctx, mAddr)
+	assert.Nil(t, err)
+	assert.Equal(t, "bulk_user", user.Name)
+
+	res, err = client.BulkApply(ctx, &auth.BulkApplyReq{Manifest: *manifest})
+	assert.Nil(t, err)
+	assert.Empty(t, res.Changes)
+}
+
+func testBulkApplyPrune(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	for _, name := range []string{"prune_user", "protected_user"} {
+		_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+		assert.Nil(t, err)
+	}
+	manifest := &auth.Manifest{Users: []*auth.ManifestUser{{
+		Name:   "keep_user",
+		Miners: []*auth.ManifestMiner{{Miner: "t01000"}, {Miner: "t01001"}},
+	}}}
+	_, err = client.BulkApply(ctx, &auth.BulkApplyReq{Manifest: *manifest})
+	assert.Nil(t, err)
+
+	manifest.Users[0].Miners = manifest.Users[0].Miners[:1]
+	req := &auth.BulkApplyReq{Manifest: *manifest, DryRun: true, Prune: true, Protected: []string{"protected_user"}}
+	res, err := client.BulkApply(ctx, req)
+	assert.Nil(t, err)
+	assert.Len(t, res.Changes, 2)
+	for _, change := range res.Changes {
+		assert.Equal(t, auth.ChangeActionDelete, change.Action)
+		assert.NotEqual(t, "protected_user", change.User)
+		// the default admin user is always protected
+		assert.NotEqual(t, auth.DefaultAdminTokenName, change.User)
+	}
+
+	req.DryRun = false
+	_, err = client.BulkApply(ctx, req)
+	assert.Nil(t, err)
+
+	has, err := client.HasUser(ctx, "prune_user")
+	assert.Nil(t, err)
+	assert.False(t, has)
+	has, err = client.HasUser(ctx, "protected_user")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	miners, err := client.ListMiners(ctx, "keep_user")
+	assert.Nil(t, err)
+	assert.Len(t, miners, 1)
+
+	// admin token still works
+	_, err = client.Verify(ctx, token)
+	assert.Nil(t, err)
+}
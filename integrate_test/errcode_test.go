@@ -0,0 +1,68 @@
+package integrate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestErrorCodes(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = client.GetUser(ctx, "not_exist")
+	assert.True(t, errors.Is(err, errcode.ErrNotFound), err)
+
+	name := "test_errcode"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	require.NoError(t, err)
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	assert.True(t, errors.Is(err, errcode.ErrAlreadyExists), err)
+
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{})
+	assert.True(t, errors.Is(err, errcode.ErrInvalidArgument), err)
+
+	miner, err := address.NewIDAddress(1999)
+	require.NoError(t, err)
+	_, err = client.UpdateMinerLabels(ctx, miner, map[string]string{"zone": "a"}, nil)
+	assert.True(t, errors.Is(err, errcode.ErrNotFound), err)
+
+	userToken, err := client.GenerateToken(ctx, name, core.PermSign, "")
+	require.NoError(t, err)
+	userClient, err := jwtclient.NewAuthClient(server.URL, userToken)
+	require.NoError(t, err)
+	_, err = userClient.ListUsers(ctx, 0, 10, 0)
+	assert.True(t, errors.Is(err, errcode.ErrPermissionDenied), err)
+
+	_, err = client.Verify(ctx, "invalid token")
+	assert.True(t, errors.Is(err, errcode.ErrInvalidArgument), err)
+	require.NoError(t, client.RemoveToken(ctx, userToken))
+	_, err = client.Verify(ctx, userToken)
+	assert.True(t, errors.Is(err, errcode.ErrUnauthenticated), err)
+
+	// a response without body gets the code of its status
+	bare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer bare.Close()
+	bareClient, err := jwtclient.NewAuthClient(bare.URL, token)
+	require.NoError(t, err)
+	_, err = bareClient.ListUsers(ctx, 0, 10, 0)
+	assert.True(t, errors.Is(err, errcode.ErrUnauthenticated), err)
+	assert.Equal(t, "401 Unauthorized", err.Error())
+}
@@ -0,0 +1,37 @@
+package integrate
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+	"github.com/ipfs-force-community/sophon-auth/util"
+)
+
+func TestUnixSocket(t *testing.T) {
+	router, tmpDir, token := newRouter(t)
+	defer shutdown(t, tmpDir)
+
+	addr := "/unix" + filepath.Join(t.TempDir(), "sophon-auth.sock")
+	lst, err := util.Listen(addr)
+	require.NoError(t, err)
+	server := &http.Server{Handler: router}
+	go server.Serve(lst) // nolint
+	defer server.Close() // nolint
+
+	client, err := jwtclient.NewAuthClient(addr, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+	name := "test_unix_socket"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	require.NoError(t, err)
+	user, err := client.GetUser(ctx, name)
+	require.NoError(t, err)
+	assert.Equal(t, name, user.Name)
+}
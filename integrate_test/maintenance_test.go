@@ -0,0 +1,69 @@
+package integrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+func TestMaintenanceReports(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	reports, err := client.ListReaperReports(ctx)
+	require.NoError(t, err)
+	assert.Len(t, reports, 0)
+
+	name := "test_maintenance"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	require.NoError(t, err)
+	userToken, err := client.GenerateToken(ctx, name, core.PermSign, "")
+	require.NoError(t, err)
+	userClient, err := jwtclient.NewAuthClient(server.URL, userToken)
+	require.NoError(t, err)
+	_, err = userClient.ListReaperReports(ctx)
+	assert.Error(t, err)
+}
+
+func TestMaintenancePurge(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	name := "test_purge"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	require.NoError(t, err)
+	userToken, err := client.GenerateToken(ctx, name, core.PermSign, "")
+	require.NoError(t, err)
+	userClient, err := jwtclient.NewAuthClient(server.URL, userToken)
+	require.NoError(t, err)
+	_, err = userClient.Purge(ctx, &auth.PurgeReq{DryRun: true})
+	assert.Error(t, err)
+
+	require.NoError(t, client.DeleteUser(ctx, &auth.DeleteUserRequest{Name: name}))
+	res, err := client.Purge(ctx, &auth.PurgeReq{DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, res.DryRun)
+	assert.Equal(t, 1, res.Summary[storage.PurgeKindUser])
+	assert.Equal(t, 1, res.Summary[storage.PurgeKindToken])
+
+	res, err = client.Purge(ctx, &auth.PurgeReq{Kinds: []string{storage.PurgeKindUser}})
+	require.NoError(t, err)
+	assert.False(t, res.DryRun)
+	assert.Equal(t, 1, res.Summary[storage.PurgeKindUser])
+	assert.Error(t, client.RecoverUser(ctx, &auth.RecoverUserRequest{Name: name}))
+}
@@ -0,0 +1,75 @@
+package integrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestMeAPI(t *testing.T) {
+	server, tmpDir, token := setup(t, auth.WithSelfService(&config.SelfServiceConfig{RegisterSigner: true, MaxSigners: 1}))
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	name := "test_me"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	require.NoError(t, err)
+	mAddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	_, err = client.UpsertMiner(ctx, name, mAddr.String(), true)
+	require.NoError(t, err)
+
+	userToken, err := client.GenerateToken(ctx, name, core.PermSign, "")
+	require.NoError(t, err)
+	userClient, err := jwtclient.NewAuthClient(server.URL, userToken)
+	require.NoError(t, err)
+
+	me, err := userClient.Me(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, name, me.Name)
+
+	require.NoError(t, userClient.UpdateMe(ctx, "my comment"))
+	me, err = userClient.Me(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my comment", me.Comment)
+
+	_, err = userClient.GenerateMyToken(ctx, core.PermRead, "")
+	require.NoError(t, err)
+	_, err = userClient.GenerateMyToken(ctx, core.PermAdmin, "")
+	assert.Error(t, err)
+	tokens, err := userClient.GetMyTokens(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 2)
+
+	miners, err := userClient.ListMyMiners(ctx)
+	require.NoError(t, err)
+	require.Len(t, miners, 1)
+	assert.Equal(t, mAddr, miners[0].Miner)
+
+	signers := make([]address.Address, 2)
+	for idx := range signers {
+		signers[idx], err = address.NewSecp256k1Address([]byte{byte(idx)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, userClient.RegisterMySigners(ctx, signers[:1]))
+	assert.Error(t, userClient.RegisterMySigners(ctx, signers[1:]))
+	res, err := userClient.ListMySigners(ctx)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, signers[0], res[0].Signer)
+
+	limits, err := userClient.GetMyRateLimits(ctx)
+	require.NoError(t, err)
+	assert.Len(t, limits, 0)
+}
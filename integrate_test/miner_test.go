@@ -9,6 +9,7 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/jwtclient"
 )
 
@@ -24,6 +25,8 @@ func TestMinerApis(t *testing.T) {
 	t.Run("get user by miner", testGetUserByMiner)
 	// stm: @VENUSAUTH_APP_DEL_MINER_001, @VENUSAUTH_APP_DEL_MINER_003
 	t.Run("delete miner", testDeleteMiner)
+	t.Run("transfer miner", testTransferMiner)
+	t.Run("update miner labels", testUpdateMinerLabels)
 }
 
 func setupAndAddMiners(t *testing.T) (*jwtclient.AuthClient, *auth.OutputUser, string) {
@@ -173,3 +176,57 @@ func testDeleteMiner(t *testing.T) {
 	_, err = client.DelMiner(context.TODO(), "abcdfghijk")
 	assert.Error(t, err)
 }
+
+func testTransferMiner(t *testing.T) {
+	client, user, tmpDir := setupAndAddMiners(t)
+	defer shutdown(t, tmpDir)
+
+	newUser := "Rennbon2"
+	_, err := client.CreateUser(context.TODO(), &auth.CreateUserRequest{Name: newUser})
+	assert.Nil(t, err)
+
+	prev, err := client.TransferMiner(context.TODO(), user.Miners[0].Miner, user.Name, newUser, "")
+	assert.Nil(t, err)
+	assert.Equal(t, user.Name, prev.User)
+
+	getUserInfo, err := client.GetUserByMiner(context.Background(), user.Miners[0].Miner)
+	assert.Nil(t, err)
+	assert.Equal(t, newUser, getUserInfo.Name)
+
+	// miner not belongs to the user any more
+	_, err = client.TransferMiner(context.TODO(), user.Miners[0].Miner, user.Name, newUser, "")
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+	_, err = client.TransferMiner(context.TODO(), user.Miners[1].Miner, user.Name, user.Name, "")
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	// target user not exists
+	_, err = client.TransferMiner(context.TODO(), user.Miners[1].Miner, user.Name, "not-exist-user", "")
+	assert.Error(t, err)
+}
+
+func testUpdateMinerLabels(t *testing.T) {
+	client, user, tmpDir := setupAndAddMiners(t)
+	defer shutdown(t, tmpDir)
+
+	mAddr := user.Miners[0].Miner
+	res, err := client.UpdateMinerLabels(context.TODO(), mAddr, map[string]string{"accept-deals": "true", "region": "sh"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "sh", res.Labels["region"])
+
+	miners, err := client.ListMinersByLabels(context.TODO(), user.Name, []string{"accept-deals=true", "region"})
+	assert.Nil(t, err)
+	assert.Len(t, miners, 1)
+	assert.Equal(t, mAddr, miners[0].Miner)
+	assert.Equal(t, res.Labels, miners[0].Labels)
+
+	getUserInfo, err := client.GetUserByMiner(context.Background(), mAddr)
+	assert.Nil(t, err)
+	assert.Len(t, getUserInfo.Miners, 1)
+	assert.Equal(t, res.Labels, getUserInfo.Miners[0].Labels)
+
+	// miner not exists
+	notExist, err := address.NewFromString("f0999999")
+	assert.Nil(t, err)
+	_, err = client.UpdateMinerLabels(context.TODO(), notExist, map[string]string{"region": "sh"}, nil)
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package integrate
 
 import (
+	"context"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
@@ -13,7 +15,13 @@ import (
 	"github.com/mitchellh/go-homedir"
 )
 
-func setup(t *testing.T) (server *httptest.Server, dir string, token string) {
+func setup(t *testing.T, opts ...auth.ServiceOption) (server *httptest.Server, dir string, token string) {
+	router, tempDir, token := newRouter(t, opts...)
+	srv := httptest.NewServer(router)
+	return srv, tempDir, token
+}
+
+func newRouter(t *testing.T, opts ...auth.ServiceOption) (router http.Handler, dir string, token string) {
 	tempDir := t.TempDir()
 	log.Infof("create storage temp dir: %s", tempDir)
 
@@ -27,18 +35,16 @@ func setup(t *testing.T) (server *httptest.Server, dir string, token string) {
 	gin.SetMode(gin.DebugMode)
 	dataPath := path.Join(dir, "data")
 
-	app, err := auth.NewOAuthApp(dataPath, cnf.DB)
+	app, err := auth.NewOAuthApp(dataPath, cnf.DB, opts...)
 	if err != nil {
 		t.Fatalf("Failed to init sophon-auth: %s", err)
 	}
-	token, err = app.GetDefaultAdminToken()
+	token, err = app.GetDefaultAdminToken(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to get default admin token: %s", err)
 	}
 
-	router := auth.InitRouter(app)
-	srv := httptest.NewServer(router)
-	return srv, tempDir, token
+	return auth.InitRouter(app), tempDir, token
 }
 
 func shutdown(t *testing.T, tempDir string) {
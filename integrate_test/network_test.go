@@ -0,0 +1,59 @@
+// stm: #integration
+package integrate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestNetwork(t *testing.T) {
+	originName := core.CurrentNetwork
+	origin := address.CurrentNetwork
+	defer func() {
+		core.CurrentNetwork, address.CurrentNetwork = originName, origin
+	}()
+	assert.Nil(t, core.SetupNetwork(core.NetworkCalibnet))
+
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	userName := "test_user_network"
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: userName})
+	assert.Nil(t, err)
+	_, err = client.UpsertMiner(ctx, userName, "t01000", true)
+	assert.Nil(t, err)
+
+	// addresses with prefix of other networks are accepted
+	for _, miner := range []string{"t01000", "f01000"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/user/miner/exist?user="+userName+"&miner="+miner, nil)
+		assert.Nil(t, err)
+		req.Header.Set(core.AuthorizationHeader, "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var exist bool
+		assert.Nil(t, json.Unmarshal(body, &exist))
+		assert.True(t, exist, miner)
+	}
+
+	assert.Nil(t, client.CheckNetwork(ctx))
+	// the local network doesn't match the server
+	address.CurrentNetwork = address.Mainnet
+	assert.Error(t, client.CheckNetwork(ctx))
+}
@@ -0,0 +1,60 @@
+package integrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestOrgAPI(t *testing.T) {
+	server, tmpDir, token := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	org, orgAdmin, member := "test_org", "test_org_admin", "test_org_member"
+	_, err = client.CreateOrg(ctx, &auth.CreateOrgRequest{Name: org})
+	require.NoError(t, err)
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: orgAdmin, State: core.UserStateEnabled})
+	require.NoError(t, err)
+	require.NoError(t, client.SetOrgMember(ctx, org, orgAdmin, true))
+
+	orgs, err := client.ListOrgs(ctx)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+
+	// client with the token of the org admin
+	orgAdminToken, err := client.GenerateToken(ctx, orgAdmin, core.PermSign, "")
+	require.NoError(t, err)
+	orgAdminClient, err := jwtclient.NewAuthClient(server.URL, orgAdminToken)
+	require.NoError(t, err)
+
+	res, err := orgAdminClient.GetOrg(ctx, org)
+	require.NoError(t, err)
+	assert.Equal(t, org, res.Name)
+	_, err = orgAdminClient.CreateUser(ctx, &auth.CreateUserRequest{Name: member, Org: org, State: core.UserStateEnabled})
+	require.NoError(t, err)
+	_, err = orgAdminClient.ListOrgs(ctx)
+	assert.Error(t, err)
+
+	users, err := orgAdminClient.ListOrgUsers(ctx, org)
+	require.NoError(t, err)
+	names := make([]string, len(users))
+	for idx, user := range users {
+		names[idx] = user.Name
+	}
+	assert.ElementsMatch(t, []string{orgAdmin, member}, names)
+
+	assert.Error(t, client.DeleteOrg(ctx, org))
+	require.NoError(t, orgAdminClient.DeleteUser(ctx, &auth.DeleteUserRequest{Name: member}))
+	require.NoError(t, client.SetOrgMember(ctx, "", orgAdmin, false))
+	require.NoError(t, client.DeleteOrg(ctx, org))
+}
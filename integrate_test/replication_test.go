@@ -0,0 +1,206 @@
+package integrate
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+	"github.com/ipfs-force-community/sophon-auth/replication"
+)
+
+// replicaNode a node serving on loopback
+type replicaNode struct {
+	addr     string
+	dataPath string
+	node     *replication.Node
+	app      auth.OAuthApp
+	server   *http.Server
+}
+
+func startReplicaNode(t *testing.T, cnf config.ReplicationConfig, lst net.Listener, dataPath string) *replicaNode {
+	cnf.Advertise = "http://" + lst.Addr().String()
+	node, err := replication.NewNode(&cnf)
+	require.NoError(t, err)
+	app, err := auth.NewOAuthApp(dataPath, config.DefaultConfig().DB, auth.WithReplication(node))
+	require.NoError(t, err)
+	server := &http.Server{Handler: node.Handler(auth.InitRouter(app))}
+	go server.Serve(lst) // nolint
+	return &replicaNode{addr: cnf.Advertise, dataPath: dataPath, node: node, app: app, server: server}
+}
+
+func (n *replicaNode) stop(t *testing.T) {
+	require.NoError(t, n.server.Close())
+	require.NoError(t, n.app.Close())
+}
+
+// waitLeader returns the index of the leader all the nodes agree on
+func waitLeader(t *testing.T, nodes []*replicaNode) int {
+	leader := -1
+	require.Eventually(t, func() bool {
+		leader = -1
+		var addr string
+		for i, n := range nodes {
+			l := n.node.Leader()
+			if len(l.Addr) == 0 || (len(addr) != 0 && l.Addr != addr) {
+				return false
+			}
+			addr = l.Addr
+			if l.Self {
+				leader = i
+			}
+		}
+		return leader >= 0
+	}, 10*time.Second, 50*time.Millisecond)
+	return leader
+}
+
+func TestReplication(t *testing.T) {
+	ctx := context.Background()
+	cnf := config.ReplicationConfig{
+		Enable:            true,
+		Secret:            "test-replication-secret",
+		ElectionTimeout:   500 * time.Millisecond,
+		HeartbeatInterval: 100 * time.Millisecond,
+	}
+	lsts := make([]net.Listener, 3)
+	for i := range lsts {
+		lst, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		lsts[i] = lst
+		cnf.Peers = append(cnf.Peers, "http://"+lst.Addr().String())
+	}
+	nodes := make([]*replicaNode, len(lsts))
+	for i, lst := range lsts {
+		nodes[i] = startReplicaNode(t, cnf, lst, path.Join(t.TempDir(), "data"))
+	}
+	defer func() {
+		for _, n := range nodes {
+			if n != nil {
+				n.stop(t)
+			}
+		}
+	}()
+
+	leader := waitLeader(t, nodes)
+	token, err := nodes[leader].app.GetDefaultAdminToken(ctx)
+	require.NoError(t, err)
+	// the followers get the token created by the leader
+	for _, n := range nodes {
+		followerToken, err := n.app.GetDefaultAdminToken(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, token, followerToken)
+	}
+
+	clients := make([]*jwtclient.AuthClient, len(nodes))
+	for i, n := range nodes {
+		clients[i], err = jwtclient.NewAuthClient(n.addr, token)
+		require.NoError(t, err)
+	}
+	follower := (leader + 1) % len(nodes)
+	// the reaper runs on the leader, followers proxy the reports to it
+	reapCtx, cancelReap := context.WithCancel(ctx)
+	defer cancelReap()
+	go nodes[leader].app.Reap(reapCtx, &config.ReaperConfig{Interval: 50 * time.Millisecond, StaleDays: 30, Policy: config.ReaperPolicyReport})
+	assert.Eventually(t, func() bool {
+		reports, err := clients[follower].ListReaperReports(ctx)
+		return err == nil && len(reports) != 0
+	}, 5*time.Second, 50*time.Millisecond)
+	cancelReap()
+
+	// the events are published by the leader, followers proxy the subscriptions to it
+	subCtx, cancelSub := context.WithCancel(ctx)
+	defer cancelSub()
+	events, err := clients[follower].Subscribe(subCtx, jwtclient.WithEventTypes(auth.EventUserCreated))
+	require.NoError(t, err)
+
+	// writes to followers are proxied to the leader, and replicated to all
+	_, err = clients[follower].CreateUser(ctx, &auth.CreateUserRequest{Name: "test_replica_user", State: core.UserStateEnabled})
+	require.NoError(t, err)
+	select {
+	case ev := <-events:
+		assert.Equal(t, "test_replica_user", ev.User)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received from the follower")
+	}
+	cancelSub()
+	userToken, err := clients[follower].GenerateToken(ctx, "test_replica_user", core.PermRead, "")
+	require.NoError(t, err)
+	for _, cli := range clients {
+		assert.Eventually(t, func() bool {
+			res, err := cli.Verify(ctx, userToken)
+			return err == nil && res.Name == "test_replica_user"
+		}, 5*time.Second, 50*time.Millisecond)
+	}
+	// the usage of token verified by a follower is written by the leader
+	require.NoError(t, nodes[follower].app.Close())
+	tokens, err := clients[leader].GetToken(ctx, "", userToken)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedTime)
+	require.NoError(t, nodes[follower].server.Close())
+
+	// the follower restarts and catches up what it missed, including deletion
+	require.NoError(t, clients[leader].RemoveToken(ctx, userToken))
+	_, err = clients[leader].CreateUser(ctx, &auth.CreateUserRequest{Name: "test_replica_user2"})
+	require.NoError(t, err)
+	lst, err := net.Listen("tcp", nodes[follower].addr[len("http://"):])
+	require.NoError(t, err)
+	nodes[follower] = startReplicaNode(t, cnf, lst, nodes[follower].dataPath)
+	assert.Eventually(t, func() bool {
+		_, err := clients[follower].GetUser(ctx, "test_replica_user2")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = clients[follower].Verify(ctx, userToken)
+	assert.Error(t, err)
+
+	// another leader is elected after the leader stopped, and it has what the former leader wrote
+	nodes[leader].stop(t)
+	nodes[leader] = nil
+	rest := make([]*replicaNode, 0, len(nodes)-1)
+	restClients := make([]*jwtclient.AuthClient, 0, len(nodes)-1)
+	for i, n := range nodes {
+		if n != nil {
+			rest = append(rest, n)
+			restClients = append(restClients, clients[i])
+		}
+	}
+	newLeader := waitLeader(t, rest)
+	_, err = restClients[newLeader].GetUser(ctx, "test_replica_user2")
+	require.NoError(t, err)
+	_, err = restClients[(newLeader+1)%len(rest)].CreateUser(ctx, &auth.CreateUserRequest{Name: "test_replica_user3"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := restClients[newLeader].GetUser(ctx, "test_replica_user3")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestDefaultAdminTokenWithoutLeader(t *testing.T) {
+	cnf := config.ReplicationConfig{
+		Enable:            true,
+		Secret:            "test-replication-secret",
+		ElectionTimeout:   500 * time.Millisecond,
+		HeartbeatInterval: 100 * time.Millisecond,
+	}
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// the other peers are down, no leader can be elected
+	cnf.Peers = []string{"http://" + lst.Addr().String(), "http://127.0.0.1:1", "http://127.0.0.1:2"}
+	n := startReplicaNode(t, cnf, lst, path.Join(t.TempDir(), "data"))
+	defer n.stop(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = n.app.GetDefaultAdminToken(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
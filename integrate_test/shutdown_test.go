@@ -0,0 +1,106 @@
+package integrate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+	dataPath := path.Join(t.TempDir(), "data")
+	cnf := config.DefaultConfig()
+
+	// the store is reopened in each cycle, which fails if it wasn't closed
+	for i := 0; i < 5; i++ {
+		app, err := auth.NewOAuthApp(dataPath, cnf.DB)
+		require.NoError(t, err)
+		token, err := app.GetDefaultAdminToken(ctx)
+		require.NoError(t, err)
+
+		// requests to `/slow` are blocked until released
+		arrived, release := make(chan struct{}), make(chan struct{})
+		router := auth.InitRouter(app)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				close(arrived)
+				<-release
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			router.ServeHTTP(w, r)
+		})
+		lst, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := &http.Server{Handler: handler}
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.Serve(lst)
+		}()
+		url := "http://" + lst.Addr().String()
+
+		client, err := jwtclient.NewAuthClient(url, token)
+		require.NoError(t, err)
+		// what the former cycles wrote is persisted, including the usage of token
+		for j := 0; j < i; j++ {
+			_, err := client.GetUser(ctx, fmt.Sprintf("test_shutdown_user_%d", j))
+			require.NoError(t, err)
+		}
+		if i > 0 {
+			tokens, err := client.GetToken(ctx, "", token)
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			assert.NotNil(t, tokens[0].LastUsedTime)
+		}
+		_, err = client.CreateUser(ctx, &auth.CreateUserRequest{
+			Name:  fmt.Sprintf("test_shutdown_user_%d", i),
+			State: core.UserStateEnabled,
+		})
+		require.NoError(t, err)
+		_, err = client.Verify(ctx, token)
+		require.NoError(t, err)
+
+		// the request in flight is drained
+		respCh := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get(url + "/slow") // nolint
+			assert.NoError(t, err)
+			respCh <- resp
+		}()
+		<-arrived
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- server.Shutdown(ctx)
+		}()
+		select {
+		case err := <-shutdownErr:
+			t.Fatalf("shutdown returned before the request finished: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		// no more requests are accepted
+		_, err = client.Verify(ctx, token)
+		assert.Error(t, err)
+
+		close(release)
+		resp := <-respCh
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+		require.NoError(t, <-shutdownErr)
+		require.ErrorIs(t, <-serveErr, http.ErrServerClosed)
+
+		require.NoError(t, app.Close())
+	}
+}
@@ -2,14 +2,19 @@ package integrate
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/chain/mocks"
+	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
 var userSignerAddrs = getUserSignerAddrs()
@@ -44,6 +49,8 @@ func TestSignerAPI(t *testing.T) {
 	t.Run("get user by signer", testGetUserBySigner)
 	t.Run("unregister signer", testUnregisterSigner)
 	t.Run("delete signer", testDeleteSigner)
+	t.Run("signer policy", testSignerPolicy)
+	t.Run("signer id alias", testSignerIDAlias)
 }
 
 func setupAndAddSigners(t *testing.T) (*jwtclient.AuthClient, string) {
@@ -163,3 +170,90 @@ func testDeleteSigner(t *testing.T) {
 	assert.Nil(t, err)
 	assert.False(t, bDel)
 }
+
+func testSignerPolicy(t *testing.T) {
+	client, tmpDir := setupAndAddSigners(t)
+	defer shutdown(t, tmpDir)
+
+	ctx := context.Background()
+	userName := "test_user01"
+	signer, err := address.NewFromString("t15rynkupqyfx5ebvaishg7duutwb5ooq2qpaikua")
+	assert.Nil(t, err)
+
+	policy := &storage.SignerPolicy{AllowedMethods: []uint64{0}, MaxValue: "10", DailyCap: "15"}
+	res, err := client.UpdateSignerPolicy(ctx, userName, signer, policy)
+	assert.Nil(t, err)
+	assert.Equal(t, policy, res.Policy)
+
+	signers, err := client.ListSigners(ctx, userName)
+	assert.Nil(t, err)
+	for _, s := range signers {
+		if s.Signer == signer {
+			assert.Equal(t, policy, s.Policy)
+		}
+	}
+
+	// evaluating doesn't count the value
+	check, err := client.EvalSignerPolicy(ctx, userName, signer, 0, big.NewInt(10))
+	assert.Nil(t, err)
+	assert.True(t, check.Allowed)
+	check, err = client.CheckSignerPolicy(ctx, userName, signer, 0, big.NewInt(10))
+	assert.Nil(t, err)
+	assert.True(t, check.Allowed)
+	check, err = client.EvalSignerPolicy(ctx, userName, signer, 0, big.NewInt(10))
+	assert.Nil(t, err)
+	assert.False(t, check.Allowed)
+	check, err = client.CheckSignerPolicy(ctx, userName, signer, 0, big.NewInt(10))
+	assert.Nil(t, err)
+	assert.False(t, check.Allowed)
+	check, err = client.CheckSignerPolicy(ctx, userName, signer, 2, nil)
+	assert.Nil(t, err)
+	assert.False(t, check.Allowed)
+
+	// the binding of other user is not limited
+	check, err = client.CheckSignerPolicy(ctx, "test_user02", signer, 2, big.NewInt(100))
+	assert.Nil(t, err)
+	assert.True(t, check.Allowed)
+
+	_, err = client.UpdateSignerPolicy(ctx, userName, signer, &storage.SignerPolicy{DailyCap: "1.5"})
+	assert.Error(t, err)
+}
+
+func testSignerIDAlias(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	resolver := mocks.NewMockResolver(ctrl)
+
+	user := "test_user01"
+	signer, err := address.NewFromString("t15rynkupqyfx5ebvaishg7duutwb5ooq2qpaikua")
+	assert.Nil(t, err)
+	idAddr, err := address.NewFromString("t01234")
+	assert.Nil(t, err)
+	resolver.EXPECT().LookupID(gomock.Any(), signer).Return(idAddr, nil).Times(1)
+
+	server, tmpDir, token := setup(t, auth.WithResolver(resolver))
+	defer shutdown(t, tmpDir)
+	client, err := jwtclient.NewAuthClient(server.URL, token)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: user})
+	assert.Nil(t, err)
+	assert.Nil(t, client.RegisterSigners(ctx, user, []address.Address{signer}))
+
+	for _, addr := range []address.Address{signer, idAddr} {
+		exist, err := client.SignerExistInUser(ctx, user, addr)
+		assert.Nil(t, err)
+		assert.True(t, exist)
+
+		users, err := client.GetUserBySigner(ctx, addr)
+		assert.Nil(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, user, users[0].Name)
+
+		userCtx := core.CtxWithName(core.CtxWithPerm(ctx, core.PermSign), user)
+		assert.Nil(t, jwtclient.CheckPermissionBySigner(userCtx, client, addr))
+		otherCtx := core.CtxWithName(core.CtxWithPerm(ctx, core.PermSign), "test_user02")
+		assert.ErrorIs(t, jwtclient.CheckPermissionBySigner(otherCtx, client, addr), jwtclient.ErrorPermissionDeny)
+	}
+}
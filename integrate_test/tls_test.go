@@ -0,0 +1,142 @@
+package integrate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+)
+
+func TestTLS(t *testing.T) {
+	router, tmpDir, token := newRouter(t, auth.WithClientCertPerm(core.PermRead))
+	defer shutdown(t, tmpDir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	certDir := t.TempDir()
+	caCert, caKey := newCert(t, "test-ca", nil, nil)
+	writeCert(t, certDir, "ca", caCert, nil)
+	serverCert, serverKey := newCert(t, "127.0.0.1", caCert, caKey)
+	writeCert(t, certDir, "server", serverCert, serverKey)
+	userCert, userKey := newCert(t, "test_tls_user", caCert, caKey)
+	writeCert(t, certDir, "user", userCert, userKey)
+	unknownCert, unknownKey := newCert(t, "unknown_user", caCert, caKey)
+	writeCert(t, certDir, "unknown", unknownCert, unknownKey)
+
+	tlsCfg, err := auth.NewTLSConfig(ctx, &config.TLSConfig{
+		CertFile:     filepath.Join(certDir, "server.crt"),
+		KeyFile:      filepath.Join(certDir, "server.key"),
+		ClientCAFile: filepath.Join(certDir, "ca.crt"),
+	})
+	require.NoError(t, err)
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{Handler: router, TLSConfig: tlsCfg}
+	go server.ServeTLS(lst, "", "") // nolint
+	defer server.Close()            // nolint
+	url := "https://" + lst.Addr().String()
+	caFile := filepath.Join(certDir, "ca.crt")
+
+	// the certificate of server is not trusted without the CA
+	client, err := jwtclient.NewAuthClient(url, token)
+	require.NoError(t, err)
+	_, err = client.ListUsers(ctx, 0, 10, core.UserStateUndefined)
+	assert.Error(t, err)
+
+	client, err = jwtclient.NewAuthClient(url, token, jwtclient.WithCAFile(caFile))
+	require.NoError(t, err)
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: "test_tls_user", State: core.UserStateEnabled})
+	require.NoError(t, err)
+
+	// the client certificate authenticates its user
+	_, err = jwtclient.NewAuthClient(url, "", jwtclient.WithCAFile(caFile))
+	assert.Error(t, err)
+	userClient, err := jwtclient.NewAuthClient(url, "", jwtclient.WithCAFile(caFile),
+		jwtclient.WithClientCert(filepath.Join(certDir, "user.crt"), filepath.Join(certDir, "user.key")))
+	require.NoError(t, err)
+	_, err = userClient.GetMyRateLimits(ctx)
+	assert.NoError(t, err)
+	// with read permission only
+	_, err = userClient.ListUsers(ctx, 0, 10, core.UserStateUndefined)
+	assert.Error(t, err)
+
+	unknownClient, err := jwtclient.NewAuthClient(url, "", jwtclient.WithCAFile(caFile),
+		jwtclient.WithClientCert(filepath.Join(certDir, "unknown.crt"), filepath.Join(certDir, "unknown.key")))
+	require.NoError(t, err)
+	_, err = unknownClient.GetMyRateLimits(ctx)
+	assert.Error(t, err)
+
+	// the certificate of server is reloaded after its files changed
+	newServerCert, newServerKey := newCert(t, "127.0.0.1", caCert, caKey)
+	writeCert(t, certDir, "server", newServerCert, newServerKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	assert.Eventually(t, func() bool {
+		conn, err := tls.Dial("tcp", lst.Addr().String(), &tls.Config{RootCAs: pool})
+		if err != nil {
+			return false
+		}
+		defer conn.Close() // nolint
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Cmp(newServerCert.SerialNumber) == 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+// newCert issues a certificate of cn by the parent, it's self-signed CA if parent is nil
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(cn); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writeCert(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	if key != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0o600))
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPem, 0o644))
+}
@@ -15,6 +15,7 @@ func TestTokenApis(t *testing.T) {
 	t.Run("verify token", testVerifyToken)
 	t.Run("list token", testListToken)
 	t.Run("remove and recover token", testRemoveAndRecoverToken)
+	t.Run("token meta", testTokenMeta)
 }
 
 func setupAndGenerateToken(t *testing.T, name string, perm string) (*jwtclient.AuthClient, string, string) {
@@ -88,3 +89,25 @@ func testRemoveAndRecoverToken(t *testing.T) {
 	assert.Equal(t, name, verifyResp.Name)
 	assert.Equal(t, perm, verifyResp.Perm)
 }
+
+func testTokenMeta(t *testing.T) {
+	server, tmpDir, adminToken := setup(t)
+	defer shutdown(t, tmpDir)
+
+	client, err := jwtclient.NewAuthClient(server.URL, adminToken)
+	assert.Nil(t, err)
+
+	name := "Rennbon"
+	_, err = client.CreateUser(context.TODO(), &auth.CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+	meta := auth.TokenMeta{Description: "token of gateway", Labels: map[string]string{"service": "gateway"}}
+	token, err := client.GenerateTokenWithMeta(context.TODO(), name, "sign", "custom", meta)
+	assert.Nil(t, err)
+
+	tokens, err := client.GetToken(context.TODO(), "", token)
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, "custom", tokens[0].Custom)
+	assert.Equal(t, meta.Description, tokens[0].Description)
+	assert.Equal(t, meta.Labels, tokens[0].Labels)
+}
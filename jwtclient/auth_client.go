@@ -3,6 +3,8 @@ package jwtclient
 import (
 	"context"
 	"fmt"
+	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -18,6 +20,8 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+	"github.com/ipfs-force-community/sophon-auth/util"
 
 	maNet "github.com/multiformats/go-multiaddr/net"
 )
@@ -26,6 +30,7 @@ import (
 
 type IAuthClient interface {
 	Verify(ctx context.Context, token string) (*auth.VerifyResponse, error)
+	VerifyBatch(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error)
 	VerifyUsers(ctx context.Context, names []string) error
 	HasUser(ctx context.Context, name string) (bool, error)
 	GetUser(ctx context.Context, name string) (*auth.OutputUser, error)
@@ -37,6 +42,7 @@ type IAuthClient interface {
 
 	MinerExistInUser(ctx context.Context, user string, miner address.Address) (bool, error)
 	SignerExistInUser(ctx context.Context, user string, signer address.Address) (bool, error)
+	CheckSignerPolicy(ctx context.Context, user string, signer address.Address, method uint64, value *big.Int) (*auth.CheckSignerPolicyResp, error)
 
 	HasMiner(ctx context.Context, miner address.Address) (bool, error)
 	ListMiners(ctx context.Context, user string) (auth.ListMinerResp, error)
@@ -54,19 +60,50 @@ type AuthClient struct {
 	cli *resty.Client
 }
 
-func NewAuthClient(addr string, token string) (*AuthClient, error) {
-	if len(token) == 0 {
+// NewAuthClient the token can be empty if a client certificate is given, see `WithClientCert`
+func NewAuthClient(addr string, token string, opts ...ClientOption) (*AuthClient, error) {
+	o := &clientOpt{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(token) == 0 && !o.hasClientCert() {
 		return nil, xerrors.Errorf("token is empty")
 	}
-	url, err := ParseAddr(addr)
+	tlsCfg, err := o.tlsConfig()
 	if err != nil {
-		return nil, fmt.Errorf("parse addr %s: %w", addr, err)
+		return nil, err
 	}
 	client := resty.New().
-		SetHostURL(url).
 		SetHeader("Accept", "application/json").
-		SetHeader(core.AuthorizationHeader, "Bearer "+token).
 		SetHeader(core.VenusAPINamespaceHeader, core.APINamespace)
+	if path, ok := util.UnixSocketPath(addr); ok {
+		// the host is a placeholder, all requests are sent through the socket
+		client.SetHostURL("http://unix").SetTransport(&http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		})
+	} else {
+		url, err := ParseAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("parse addr %s: %w", addr, err)
+		}
+		client.SetHostURL(url)
+	}
+	if len(token) != 0 {
+		client.SetHeader(core.AuthorizationHeader, "Bearer "+token)
+	}
+	if tlsCfg != nil {
+		client.SetTLSClientConfig(tlsCfg)
+	}
+	// the errors without a body, such as the bare 401 of requests not authenticated, get a code by the status
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if msg, ok := resp.Error().(*errcode.ErrMsg); ok && resp.IsError() {
+			msg.FillStatus(resp.StatusCode())
+		}
+		return nil
+	})
 	return &AuthClient{cli: client}, nil
 }
 
@@ -77,7 +114,7 @@ func (lc *AuthClient) Verify(ctx context.Context, token string) (*auth.VerifyRes
 
 	resp, err := lc.cli.R().SetContext(ctx).
 		SetBody(auth.VerifyRequest{Token: token}).
-		SetResult(&auth.VerifyResponse{}).Post("/verify")
+		SetResult(&auth.VerifyResponse{}).SetError(&errcode.ErrMsg{}).Post("/verify")
 	if err != nil {
 		return nil, err
 	}
@@ -93,14 +130,53 @@ func (lc *AuthClient) Verify(ctx context.Context, token string) (*auth.VerifyRes
 		Message: string(resp.Body()),
 	})
 
-	return nil, fmt.Errorf("response code is : %d, msg:%s", resp.StatusCode(), resp.Body())
+	err = fmt.Errorf("response code is : %d, msg:%s", resp.StatusCode(), resp.Body())
+	if msg, ok := resp.Error().(*errcode.ErrMsg); ok && len(msg.Code) != 0 {
+		err = errcode.WithCode(msg.Code, err)
+	}
+	return nil, err
+}
+
+// VerifyBatch verifies the tokens in a request, the results are in the order of tokens,
+// and the error of a token failed is in its result, see `VerifyResult`
+func (lc *AuthClient) VerifyBatch(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+	ctx, span := trace.StartSpan(ctx, "AuthClient.verifyBatch",
+		func(so *trace.StartOptions) { so.Sampler = trace.AlwaysSample() })
+	defer span.End()
+	span.AddAttributes(trace.Int64Attribute("Tokens", int64(len(tokens))))
+
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(auth.VerifyBatchRequest{Tokens: tokens}).
+		SetResult(&auth.VerifyBatchResponse{}).SetError(&errcode.ErrMsg{}).Post("/verify/batch")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		res := *(resp.Result().(*auth.VerifyBatchResponse))
+		if len(res) != len(tokens) {
+			return nil, fmt.Errorf("verify %d tokens, got %d results", len(tokens), len(res))
+		}
+		return res, nil
+	}
+
+	span.SetStatus(trace.Status{
+		Code:    trace.StatusCodeUnauthenticated,
+		Message: string(resp.Body()),
+	})
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
 }
 
 func (lc *AuthClient) GenerateToken(ctx context.Context, name, perm, extra string) (string, error) {
+	return lc.GenerateTokenWithMeta(ctx, name, perm, extra, auth.TokenMeta{})
+}
+
+// GenerateTokenWithMeta generates token with the description and labels stored along with it
+func (lc *AuthClient) GenerateTokenWithMeta(ctx context.Context, name, perm, extra string, meta auth.TokenMeta) (string, error) {
 	resp, err := lc.cli.R().SetContext(ctx).SetBody(auth.GenTokenRequest{
-		Name:  name,
-		Perm:  perm,
-		Extra: extra,
+		Name:      name,
+		Perm:      perm,
+		Extra:     extra,
+		TokenMeta: meta,
 	}).SetResult(&auth.GenTokenResponse{}).SetError(&errcode.ErrMsg{}).Post("/genToken")
 	if err != nil {
 		return core.EmptyString, err
@@ -230,6 +306,7 @@ func (lc *AuthClient) ListUsersWithMiners(ctx context.Context, skip, limit int64
 				Miner:      val.Miner,
 				User:       user.Name,
 				OpenMining: val.OpenMining,
+				Labels:     val.Labels,
 				CreatedAt:  time.Time{},
 				UpdatedAt:  time.Time{},
 			})
@@ -299,6 +376,186 @@ func (lc *AuthClient) RecoverUser(ctx context.Context, req *auth.RecoverUserRequ
 	return resp.Error().(*errcode.ErrMsg).Err()
 }
 
+func (lc *AuthClient) CreateOrg(ctx context.Context, req *auth.CreateOrgRequest) (*auth.OutputOrg, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req).
+		SetResult(&auth.OutputOrg{}).
+		SetError(&errcode.ErrMsg{}).
+		Put("/org/new")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputOrg), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetOrg(ctx context.Context, name string) (*auth.OutputOrg, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"name": name,
+	}).SetResult(&auth.OutputOrg{}).SetError(&errcode.ErrMsg{}).Get("/org")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputOrg), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListOrgs(ctx context.Context) (auth.ListOrgsResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListOrgsResponse{}).SetError(&errcode.ErrMsg{}).Get("/org/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListOrgsResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// DeleteOrg deletes an organization without users
+func (lc *AuthClient) DeleteOrg(ctx context.Context, name string) error {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.DeleteOrgRequest{Name: name}).
+		SetError(&errcode.ErrMsg{}).Post("/org/del")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListOrgUsers(ctx context.Context, name string) (auth.ListUsersResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"name": name,
+	}).SetResult(&auth.ListUsersResponse{}).SetError(&errcode.ErrMsg{}).Get("/org/users")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListUsersResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// SetOrgMember moves user into the organization as a member or an org admin,
+// empty organization removes user from its organization
+func (lc *AuthClient) SetOrgMember(ctx context.Context, org, user string, admin bool) error {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.SetOrgMemberRequest{Org: org, User: user, Admin: admin}).
+		SetError(&errcode.ErrMsg{}).Post("/org/member")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// Me returns the user of the token
+func (lc *AuthClient) Me(ctx context.Context) (*auth.OutputUser, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.OutputUser{}).SetError(&errcode.ErrMsg{}).Get("/me")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputUser), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) UpdateMe(ctx context.Context, comment string) error {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.UpdateMeReq{Comment: &comment}).
+		SetError(&errcode.ErrMsg{}).Post("/me/update")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetMyTokens(ctx context.Context) ([]*auth.TokenInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&[]*auth.TokenInfo{}).SetError(&errcode.ErrMsg{}).Get("/me/tokens")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*[]*auth.TokenInfo)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// GenerateMyToken generates a token for the user of the token, perm can't be higher than the token's
+func (lc *AuthClient) GenerateMyToken(ctx context.Context, perm, extra string) (string, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.GenerateMyTokenReq{Perm: perm, Extra: extra}).
+		SetResult(&auth.GenTokenResponse{}).SetError(&errcode.ErrMsg{}).Post("/me/token")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.GenTokenResponse).Token, nil
+	}
+	return "", resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListMyMiners(ctx context.Context) (auth.ListMinerResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListMinerResp{}).SetError(&errcode.ErrMsg{}).Get("/me/miners")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListMinerResp)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListMySigners(ctx context.Context) (auth.ListSignerResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListSignerResp{}).SetError(&errcode.ErrMsg{}).Get("/me/signers")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListSignerResp)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// RegisterMySigners registers signers for the user of the token if it's allowed by the server
+func (lc *AuthClient) RegisterMySigners(ctx context.Context, addrs []address.Address) error {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.RegisterMySignersReq{Signers: addrs}).
+		SetError(&errcode.ErrMsg{}).Post("/me/signer/register")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetMyRateLimits(ctx context.Context) (auth.GetUserRateLimitResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.GetUserRateLimitResponse{}).SetError(&errcode.ErrMsg{}).Get("/me/ratelimit")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.GetUserRateLimitResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) GetUserRateLimit(ctx context.Context, name, id string) (auth.GetUserRateLimitResponse, error) {
 	param := make(map[string]string)
 	if len(name) != 0 {
@@ -410,6 +667,34 @@ func (lc *AuthClient) ListMiners(ctx context.Context, user string) (auth.ListMin
 	return nil, resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// ListMinersByLabels returns miners of user matching all the label selectors, a selector is `key=value` or `key`
+func (lc *AuthClient) ListMinersByLabels(ctx context.Context, user string, selectors []string) (auth.ListMinerResp, error) {
+	var res auth.ListMinerResp
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParamsFromValues(url.Values{"user": {user}, "label": selectors}).
+		SetResult(&res).SetError(&errcode.ErrMsg{}).Get("/user/miner/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return res, nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// UpdateMinerLabels sets labels in `set` and removes labels in `unset`, returns the miner after update
+func (lc *AuthClient) UpdateMinerLabels(ctx context.Context, miner address.Address, set map[string]string, unset []string) (*auth.UpdateMinerLabelsResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.UpdateMinerLabelsReq{Miner: miner, Set: set, Unset: unset}).
+		SetResult(&auth.UpdateMinerLabelsResp{}).SetError(&errcode.ErrMsg{}).Post("/user/miner/labels")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.UpdateMinerLabelsResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) DelMiner(ctx context.Context, miner string) (bool, error) {
 	if _, err := address.NewFromString(miner); err != nil {
 		return false, xerrors.Errorf("invalid miner address:%s", miner)
@@ -444,6 +729,21 @@ func (lc *AuthClient) GetUserByMiner(ctx context.Context, miner address.Address)
 	return nil, resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// TransferMiner rebinds miner from user `from` to user `to`, returns the binding before transfer.
+// `confirmToken` is optional, if set it must be a token of user `from`.
+func (lc *AuthClient) TransferMiner(ctx context.Context, miner address.Address, from, to, confirmToken string) (*auth.TransferMinerResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.TransferMinerReq{Miner: miner, From: from, To: to, ConfirmToken: confirmToken}).
+		SetResult(&auth.TransferMinerResp{}).SetError(&errcode.ErrMsg{}).Post("/user/miner/transfer")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.TransferMinerResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) RegisterSigners(ctx context.Context, user string, addrs []address.Address) error {
 	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.RegisterSignersReq{Signers: addrs, User: user}).
 		SetError(&errcode.ErrMsg{}).Post("/user/signer/register")
@@ -542,6 +842,73 @@ func (lc *AuthClient) GetUserBySigner(ctx context.Context, signer address.Addres
 	return nil, resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// UpdateSignerPolicy replaces the policy of signer for the user, nil policy removes it
+func (lc *AuthClient) UpdateSignerPolicy(ctx context.Context, user string, signer address.Address, policy *storage.SignerPolicy) (*auth.UpdateSignerPolicyResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.UpdateSignerPolicyReq{User: user, Signer: signer, Policy: policy}).
+		SetResult(&auth.UpdateSignerPolicyResp{}).SetError(&errcode.ErrMsg{}).Post("/user/signer/policy")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.UpdateSignerPolicyResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// CheckSignerPolicy should be called once before signing a message by the signer for the user,
+// value is in attoFIL. It consumes: the value of an allowed message is counted in the daily spending,
+// even if the message is not signed at last, use `EvalSignerPolicy` to only check.
+func (lc *AuthClient) CheckSignerPolicy(ctx context.Context, user string, signer address.Address, method uint64, value *big.Int) (*auth.CheckSignerPolicyResp, error) {
+	return lc.checkSignerPolicy(ctx, &auth.CheckSignerPolicyReq{User: user, Signer: signer, Method: method}, value)
+}
+
+// EvalSignerPolicy whether the message is allowed by the policy now, nothing is counted in the daily spending
+func (lc *AuthClient) EvalSignerPolicy(ctx context.Context, user string, signer address.Address, method uint64, value *big.Int) (*auth.CheckSignerPolicyResp, error) {
+	return lc.checkSignerPolicy(ctx, &auth.CheckSignerPolicyReq{User: user, Signer: signer, Method: method, DryRun: true}, value)
+}
+
+func (lc *AuthClient) checkSignerPolicy(ctx context.Context, req *auth.CheckSignerPolicyReq, value *big.Int) (*auth.CheckSignerPolicyResp, error) {
+	if value != nil {
+		req.Value = value.String()
+	}
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&auth.CheckSignerPolicyResp{}).SetError(&errcode.ErrMsg{}).Post("/user/signer/policy/check")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.CheckSignerPolicyResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// CheckNetwork returns an error if the network of server doesn't match `address.CurrentNetwork`,
+// in which case addresses are returned with a prefix different from the local one
+func (lc *AuthClient) CheckNetwork(ctx context.Context) error {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.VersionResponse{}).SetError(&errcode.ErrMsg{}).Get("/version")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return resp.Error().(*errcode.ErrMsg).Err()
+	}
+	// server before the network is configurable
+	name := resp.Result().(*auth.VersionResponse).Network
+	if len(name) == 0 {
+		return nil
+	}
+	network, err := core.ParseNetwork(name)
+	if err != nil {
+		return err
+	}
+	if network != address.CurrentNetwork {
+		return fmt.Errorf("network of sophon-auth is %s, which doesn't match the local address network", name)
+	}
+	return nil
+}
+
 // ParseAddr parse a multi addr to a traditional url ( with http scheme as default)
 func ParseAddr(addr string) (string, error) {
 	ret := addr
@@ -601,3 +968,150 @@ func ParseAddr(addr string) (string, error) {
 
 	return u.String(), nil
 }
+
+// BulkApply makes users and resources bound to them satisfy the manifest, only the changes are returned if `DryRun` is true.
+func (lc *AuthClient) BulkApply(ctx context.Context, req *auth.BulkApplyReq) (*auth.BulkApplyResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&auth.BulkApplyResp{}).SetError(&errcode.ErrMsg{}).Post("/bulk/apply")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.BulkApplyResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// ListReaperReports returns reports of the latest runs of the reaper, from the newest
+func (lc *AuthClient) ListReaperReports(ctx context.Context) ([]*auth.ReaperReport, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&[]*auth.ReaperReport{}).SetError(&errcode.ErrMsg{}).Get("/maintenance/reports")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*[]*auth.ReaperReport)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// Purge hard deletes the records soft-deleted longer than `req.OlderThan`, only counts them if `req.DryRun`
+func (lc *AuthClient) Purge(ctx context.Context, req *auth.PurgeReq) (*auth.PurgeResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&auth.PurgeResp{}).SetError(&errcode.ErrMsg{}).Post("/maintenance/purge")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.PurgeResp), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// ReplicaSnapshot returns all the users with their miners, signers and rate limits, see `ReplicaClient`
+func (lc *AuthClient) ReplicaSnapshot(ctx context.Context) (*auth.ReplicaSnapshot, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ReplicaSnapshot{}).SetError(&errcode.ErrMsg{}).Get("/replica/snapshot")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.ReplicaSnapshot), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// ReplicaChanges returns the users changed after `since` of `epoch`, a snapshot should be synced if `Reset` is set
+func (lc *AuthClient) ReplicaChanges(ctx context.Context, epoch string, since uint64) (*auth.ReplicaChanges, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"epoch": epoch,
+		"since": strconv.FormatUint(since, 10),
+	}).SetResult(&auth.ReplicaChanges{}).SetError(&errcode.ErrMsg{}).Get("/replica/changes")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.ReplicaChanges), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// CreateWebhook registers a webhook which the events are posted to, the secret is only returned this time
+func (lc *AuthClient) CreateWebhook(ctx context.Context, req *auth.CreateWebhookReq) (*auth.OutputWebhook, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&auth.OutputWebhook{}).SetError(&errcode.ErrMsg{}).Put("/webhook/new")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputWebhook), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// UpdateWebhook changes the fields set, the new secret is returned if `RotateSecret`
+func (lc *AuthClient) UpdateWebhook(ctx context.Context, req *auth.UpdateWebhookReq) (*auth.OutputWebhook, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).
+		SetResult(&auth.OutputWebhook{}).SetError(&errcode.ErrMsg{}).Post("/webhook/update")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputWebhook), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetWebhook(ctx context.Context, name string) (*auth.OutputWebhook, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"name": name,
+	}).SetResult(&auth.OutputWebhook{}).SetError(&errcode.ErrMsg{}).Get("/webhook")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.OutputWebhook), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListWebhooks(ctx context.Context) (auth.ListWebhooksResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListWebhooksResp{}).SetError(&errcode.ErrMsg{}).Get("/webhook/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListWebhooksResp)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// DeleteWebhook deletes the webhook along with its deliveries
+func (lc *AuthClient) DeleteWebhook(ctx context.Context, name string) error {
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(&auth.DeleteWebhookReq{Name: name}).
+		SetError(&errcode.ErrMsg{}).Post("/webhook/del")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// ListWebhookDeliveries returns the deliveries from the newest, including those pending in the outbox
+func (lc *AuthClient) ListWebhookDeliveries(ctx context.Context, req *auth.ListWebhookDeliveriesReq) (auth.ListWebhookDeliveriesResp, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"webhook": req.Webhook,
+		"state":   req.State,
+		"limit":   strconv.Itoa(req.Limit),
+	}).SetResult(&auth.ListWebhookDeliveriesResp{}).SetError(&errcode.ErrMsg{}).Get("/webhook/deliveries")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListWebhookDeliveriesResp)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
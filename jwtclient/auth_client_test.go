@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/gin-gonic/gin"
@@ -17,6 +18,8 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 	"github.com/ipfs-force-community/sophon-auth/util"
 )
 
@@ -35,7 +38,7 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("failed to get available port err:%s", err)
 	}
-	cnf.Listen = fmt.Sprintf("127.0.0.1:%d", port)
+	cnf.Listen = fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
 
 	var tmpPath string
 	if cnf.DB.Type == "badger" {
@@ -49,28 +52,32 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("Failed to init oauthApp : %s", err)
 	}
-	token, err := app.GetDefaultAdminToken()
+	token, err := app.GetDefaultAdminToken(context.Background())
 	if err != nil {
 		log.Fatalf("Failed to get default admin token : %s", err)
 	}
 
 	router := auth.InitRouter(app)
 	server := &http.Server{
-		Addr:         cnf.Listen,
 		Handler:      router,
 		ReadTimeout:  cnf.ReadTimeout,
 		WriteTimeout: cnf.WriteTimeout,
 		IdleTimeout:  cnf.IdleTimeout,
 	}
 
+	// listen before serving, or the requests of tests may come first
+	lst, err := util.Listen(cnf.Listen)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %s", cnf.Listen, err)
+	}
 	go func() {
 		log.Infof("server start and listen on %s", cnf.Listen)
-		if err = server.ListenAndServe(); err != nil {
+		if err := server.Serve(lst); err != nil && err != http.ErrServerClosed {
 			log.Errorf("start serve failed: %v", err)
 		}
 	}() //nolint
 
-	if cli, err = NewAuthClient("http://"+cnf.Listen, token); err != nil {
+	if cli, err = NewAuthClient(cnf.Listen, token); err != nil {
 		log.Fatalf("create auth client failed:%s\n", err.Error())
 		return
 	}
@@ -282,6 +289,26 @@ func TestClient_Verify(t *testing.T) {
 	}
 }
 
+func TestClient_VerifyBatch(t *testing.T) {
+	ctx := context.Background()
+	name := fmt.Sprintf("batch_%d", time.Now().UnixNano())
+	_, err := cli.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	assert.NoError(t, err)
+	token, err := cli.GenerateToken(ctx, name, core.PermSign, "")
+	assert.NoError(t, err)
+
+	res, err := cli.VerifyBatch(ctx, []string{token, "invalid token"})
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, name, res[0].Payload.Name)
+	assert.Equal(t, core.PermSign, res[0].Payload.Perm)
+	assert.Nil(t, res[1].Payload)
+	assert.NotNil(t, res[1].Error)
+
+	_, err = cli.VerifyBatch(ctx, make([]string, auth.MaxVerifyBatch+1))
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+}
+
 func TestJWTClient_ListUsers(t *testing.T) {
 	if os.Getenv("CI") == "test" {
 		t.Skip()
@@ -295,6 +322,51 @@ func TestJWTClient_ListUsers(t *testing.T) {
 	}
 }
 
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	name := fmt.Sprintf("webhook_%d", time.Now().UnixNano())
+	_, err := cli.CreateWebhook(ctx, &auth.CreateWebhookReq{Name: name, URL: "ftp://127.0.0.1/events"})
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	created, err := cli.CreateWebhook(ctx, &auth.CreateWebhookReq{
+		Name:   name,
+		URL:    "http://127.0.0.1/events",
+		Events: []auth.EventType{auth.EventUserCreated},
+		User:   name,
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.Secret)
+	_, err = cli.CreateWebhook(ctx, &auth.CreateWebhookReq{Name: name, URL: "http://127.0.0.1/events"})
+	assert.ErrorIs(t, err, errcode.ErrAlreadyExists)
+
+	comment := "updated"
+	updated, err := cli.UpdateWebhook(ctx, &auth.UpdateWebhookReq{Name: name, Comment: &comment})
+	assert.NoError(t, err)
+	assert.Equal(t, comment, updated.Comment)
+	assert.Empty(t, updated.Secret)
+	webhook, err := cli.GetWebhook(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, []auth.EventType{auth.EventUserCreated}, webhook.Events)
+	webhooks, err := cli.ListWebhooks(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, webhooks, webhook)
+
+	// nothing is delivered by the server of test, the delivery waits in the outbox
+	_, err = cli.CreateUser(ctx, &auth.CreateUserRequest{Name: name})
+	assert.NoError(t, err)
+	deliveries, err := cli.ListWebhookDeliveries(ctx, &auth.ListWebhookDeliveriesReq{Webhook: name, State: storage.DeliveryPending, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, auth.EventUserCreated, deliveries[0].EventType)
+	_, err = cli.ListWebhookDeliveries(ctx, &auth.ListWebhookDeliveriesReq{State: "unknown"})
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	assert.NoError(t, cli.DeleteWebhook(ctx, name))
+	deliveries, err = cli.ListWebhookDeliveries(ctx, &auth.ListWebhookDeliveriesReq{Webhook: name})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 0)
+}
+
 func TestParseAddr(t *testing.T) {
 	testCase := []struct {
 		Input    string
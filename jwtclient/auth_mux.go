@@ -1,10 +1,12 @@
 package jwtclient
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
@@ -35,17 +37,43 @@ type trustHandle struct {
 type AuthMux struct {
 	handler       http.Handler
 	local, remote IJwtAuthClient
+	// verifies the tokens by remote in batches if set
+	batcher *verifyBatcher
+	// the concurrent verifications of a token by remote share one
+	flights *verifyGroup
 
 	trustHandle map[string]trustHandle
 }
 
-func NewAuthMux(local, remote IJwtAuthClient, handler http.Handler) *AuthMux {
-	return &AuthMux{
+type MuxOption func(*AuthMux)
+
+// WithVerifyBatch coalesces the verifications of remote within the window into a request of `/verify/batch`,
+// at most maxSize tokens in a request, the defaults are used if they are zero.
+// The remote should implement `IJwtBatchAuthClient`, such as the one of `WarpIJwtAuthClient`,
+// and the sophon-auth it requests should serve `/verify/batch`.
+func WithVerifyBatch(window time.Duration, maxSize int) MuxOption {
+	return func(authMux *AuthMux) {
+		client, ok := authMux.remote.(IJwtBatchAuthClient)
+		if !ok || isNil(authMux.remote) {
+			log.Warnf("remote %T can't verify tokens in batches, verify them one by one", authMux.remote)
+			return
+		}
+		authMux.batcher = newVerifyBatcher(client, window, maxSize)
+	}
+}
+
+func NewAuthMux(local, remote IJwtAuthClient, handler http.Handler, opts ...MuxOption) *AuthMux {
+	authMux := &AuthMux{
 		handler:     handler,
 		local:       local,
 		remote:      remote,
+		flights:     newVerifyGroup(),
 		trustHandle: make(map[string]trustHandle),
 	}
+	for _, opt := range opts {
+		opt(authMux)
+	}
+	return authMux
 }
 
 // TrustHandle for requests that can be accessed directly
@@ -117,7 +145,7 @@ func (authMux *AuthMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !isNil(authMux.local) {
 		if perm, err = authMux.local.Verify(ctx, token); err != nil {
 			if !isNil(authMux.remote) {
-				if perm, err = authMux.remote.Verify(ctx, token); err != nil {
+				if perm, err = authMux.verifyRemote(ctx, token); err != nil {
 					log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
 					w.WriteHeader(401)
 					return
@@ -130,7 +158,7 @@ func (authMux *AuthMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		if !isNil(authMux.remote) {
-			if perm, err = authMux.remote.Verify(ctx, token); err != nil {
+			if perm, err = authMux.verifyRemote(ctx, token); err != nil {
 				log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
 				w.WriteHeader(401)
 				return
@@ -149,6 +177,16 @@ func (authMux *AuthMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	authMux.handler.ServeHTTP(w, r)
 }
 
+// verifyRemote the requests of a token reconnecting at once share a verification in flight
+func (authMux *AuthMux) verifyRemote(ctx context.Context, token string) (core.Permission, error) {
+	return authMux.flights.Verify(ctx, token, func(ctx context.Context, token string) (core.Permission, error) {
+		if authMux.batcher != nil {
+			return authMux.batcher.Verify(ctx, token)
+		}
+		return authMux.remote.Verify(ctx, token)
+	})
+}
+
 func isNil(ac IJwtAuthClient) bool {
 	if ac != nil && !reflect.ValueOf(ac).IsNil() {
 		return false
@@ -3,12 +3,20 @@ package jwtclient
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient/mocks"
 )
 
 type mockImp struct{}
@@ -43,3 +51,226 @@ func TestTruthHandle(t *testing.T) {
 	path := "/piece/xfdfs1fs"
 	assert.NotNil(t, mux.trustedHandler(path))
 }
+
+// permHandler responds the highest permission of request
+var permHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	perms, _ := core.CtxGetPerm(r.Context())
+	if len(perms) != 0 {
+		_, _ = w.Write([]byte(perms[len(perms)-1]))
+	}
+})
+
+func serveToken(mux http.Handler, ctx context.Context, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil).WithContext(ctx)
+	req.Header.Set(core.AuthorizationHeader, "Bearer "+token)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestVerifyBatch(t *testing.T) {
+	perms := map[string]core.Permission{"token-read": core.PermRead, "token-sign": core.PermSign}
+	verifyBatch := func(_ context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+		res := make(auth.VerifyBatchResponse, len(tokens))
+		for idx, token := range tokens {
+			if perm, ok := perms[token]; ok {
+				res[idx] = &auth.VerifyResult{Payload: &auth.JWTPayload{Perm: perm}}
+				continue
+			}
+			res[idx] = &auth.VerifyResult{Error: &errcode.ErrMsg{Error: "token not found", Code: errcode.CodeUnauthenticated}}
+		}
+		return res, nil
+	}
+
+	t.Run("coalesce within window", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		client.EXPECT().VerifyBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+				// the same token is sent once
+				assert.ElementsMatch(t, []string{"token-read", "token-sign", "token-unknown"}, tokens)
+				return verifyBatch(ctx, tokens)
+			}).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler, WithVerifyBatch(100*time.Millisecond, 0))
+
+		expects := map[string]string{"token-read": core.PermRead, "token-sign": core.PermSign, "token-unknown": ""}
+		var wg sync.WaitGroup
+		for _, token := range []string{"token-read", "token-sign", "token-unknown", "token-read"} {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				w := serveToken(mux, context.Background(), token)
+				if len(expects[token]) == 0 {
+					assert.Equal(t, http.StatusUnauthorized, w.Code)
+					return
+				}
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, expects[token], w.Body.String())
+			}(token)
+		}
+		wg.Wait()
+	})
+
+	t.Run("send once full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		client.EXPECT().VerifyBatch(gomock.Any(), gomock.Len(2)).DoAndReturn(verifyBatch).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler, WithVerifyBatch(time.Hour, 2))
+
+		var wg sync.WaitGroup
+		for _, token := range []string{"token-read", "token-sign"} {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				assert.Equal(t, http.StatusOK, serveToken(mux, context.Background(), token).Code)
+			}(token)
+		}
+		wg.Wait()
+	})
+
+	t.Run("cancel once all gone", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		canceled := make(chan struct{})
+		client.EXPECT().VerifyBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			}).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler, WithVerifyBatch(time.Millisecond, 0))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, http.StatusUnauthorized, serveToken(mux, ctx, "token-read").Code)
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("batch not canceled")
+		}
+	})
+
+	t.Run("remote not batching", func(t *testing.T) {
+		mux := NewAuthMux(nil, &mockImp{}, permHandler, WithVerifyBatch(0, 0))
+		assert.Nil(t, mux.batcher)
+	})
+}
+
+func coalescedCount(t *testing.T) int64 {
+	rows, err := view.RetrieveData("token/verify_coalesced")
+	assert.NoError(t, err)
+	var count int64
+	for _, row := range rows {
+		count += row.Data.(*view.CountData).Value
+	}
+	return count
+}
+
+func TestVerifyCoalesce(t *testing.T) {
+	const token = "token-sign"
+	// waitFlight waits until n requests wait for the verification of token in flight
+	waitFlight := func(t *testing.T, mux *AuthMux, n int) {
+		assert.Eventually(t, func() bool {
+			mux.flights.lk.Lock()
+			defer mux.flights.lk.Unlock()
+			f := mux.flights.flights[token]
+			return f != nil && f.waiters == n
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	t.Run("share in flight", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		release := make(chan struct{})
+		client.EXPECT().Verify(gomock.Any(), token).DoAndReturn(func(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+			<-release
+			return &auth.VerifyResponse{Name: "test-user01", Perm: core.PermSign}, nil
+		}).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler)
+
+		const requests = 20
+		before := coalescedCount(t)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := serveToken(mux, context.Background(), token)
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, core.PermSign, w.Body.String())
+			}()
+		}
+		waitFlight(t, mux, requests)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int64(requests-1), coalescedCount(t)-before)
+
+		// the result isn't cached
+		client.EXPECT().Verify(gomock.Any(), token).Return(nil, errcode.ErrUnauthenticated).Times(1)
+		assert.Equal(t, http.StatusUnauthorized, serveToken(mux, context.Background(), token).Code)
+	})
+
+	t.Run("originating request gone", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		started, release := make(chan struct{}), make(chan struct{})
+		client.EXPECT().Verify(gomock.Any(), token).DoAndReturn(func(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+			close(started)
+			<-release
+			// not canceled by the request gone, since the other one still waits
+			assert.NoError(t, ctx.Err())
+			return &auth.VerifyResponse{Perm: core.PermSign}, nil
+		}).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan int)
+		go func() {
+			first <- serveToken(mux, ctx, token).Code
+		}()
+		<-started
+		second := make(chan int)
+		go func() {
+			second <- serveToken(mux, context.Background(), token).Code
+		}()
+		waitFlight(t, mux, 2)
+		cancel()
+		assert.Equal(t, http.StatusUnauthorized, <-first)
+		close(release)
+		assert.Equal(t, http.StatusOK, <-second)
+	})
+
+	t.Run("cancel once all gone", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := mocks.NewMockIAuthClient(ctrl)
+		canceled := make(chan struct{})
+		client.EXPECT().Verify(gomock.Any(), token).DoAndReturn(func(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}).Times(1)
+		mux := NewAuthMux(nil, WarpIJwtAuthClient(client), permHandler)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Equal(t, http.StatusUnauthorized, serveToken(mux, ctx, token).Code)
+			}()
+		}
+		waitFlight(t, mux, 2)
+		cancel()
+		wg.Wait()
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("verification not canceled")
+		}
+
+		// the requests later verify again rather than get the error of canceled
+		client.EXPECT().Verify(gomock.Any(), token).Return(&auth.VerifyResponse{Perm: core.PermSign}, nil).Times(1)
+		assert.Equal(t, http.StatusOK, serveToken(mux, context.Background(), token).Code)
+	})
+}
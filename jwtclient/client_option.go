@@ -0,0 +1,70 @@
+package jwtclient
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+)
+
+// ClientOption sets optional settings of AuthClient
+type ClientOption func(*clientOpt)
+
+type clientOpt struct {
+	caFile   string
+	certFile string
+	keyFile  string
+	tlsCfg   *tls.Config
+}
+
+// WithCAFile verifies the certificate of sophon-auth with the CA bundle in path instead of the system roots
+func WithCAFile(path string) ClientOption {
+	return func(o *clientOpt) {
+		o.caFile = path
+	}
+}
+
+// WithClientCert presents the client certificate to sophon-auth, it authenticates the user named
+// by its common name if no token is given
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return func(o *clientOpt) {
+		o.certFile, o.keyFile = certFile, keyFile
+	}
+}
+
+// WithTLSConfig uses cfg as the base of the TLS config, the CA bundle and the client certificate are added to it
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(o *clientOpt) {
+		o.tlsCfg = cfg
+	}
+}
+
+// tlsConfig returns nil if no TLS setting is given
+func (o *clientOpt) tlsConfig() (*tls.Config, error) {
+	if o.tlsCfg == nil && len(o.caFile) == 0 && len(o.certFile) == 0 {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.tlsCfg != nil {
+		cfg = o.tlsCfg.Clone()
+	}
+	if len(o.caFile) != 0 {
+		pool, err := auth.LoadCertPool(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+	if len(o.certFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+	return cfg, nil
+}
+
+func (o *clientOpt) hasClientCert() bool {
+	return len(o.certFile) != 0 || (o.tlsCfg != nil && (len(o.tlsCfg.Certificates) != 0 || o.tlsCfg.GetClientCertificate != nil))
+}
@@ -3,6 +3,7 @@ package jwtclient
 import (
 	"context"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
 )
 
@@ -10,11 +11,17 @@ type IJwtAuthClient interface {
 	Verify(ctx context.Context, token string) (core.Permission, error)
 }
 
+// IJwtBatchAuthClient verifies many tokens in a request, see `WithVerifyBatch`
+type IJwtBatchAuthClient interface {
+	IJwtAuthClient
+	VerifyBatch(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error)
+}
+
 type jwtAuthClient struct {
 	IAuthClient
 }
 
-var _ IJwtAuthClient = &jwtAuthClient{}
+var _ IJwtBatchAuthClient = &jwtAuthClient{}
 
 func (c *jwtAuthClient) Verify(ctx context.Context, token string) (core.Permission, error) {
 	res, err := c.IAuthClient.Verify(ctx, token)
@@ -25,6 +32,10 @@ func (c *jwtAuthClient) Verify(ctx context.Context, token string) (core.Permissi
 	return res.Perm, nil
 }
 
+func (c *jwtAuthClient) VerifyBatch(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+	return c.IAuthClient.VerifyBatch(ctx, tokens)
+}
+
 func WarpIJwtAuthClient(cli IAuthClient) IJwtAuthClient {
 	return &jwtAuthClient{IAuthClient: cli}
 }
@@ -6,6 +6,7 @@ package mocks
 
 import (
 	context "context"
+	big "math/big"
 	reflect "reflect"
 
 	address "github.com/filecoin-project/go-address"
@@ -37,6 +38,21 @@ func (m *MockIAuthClient) EXPECT() *MockIAuthClientMockRecorder {
 	return m.recorder
 }
 
+// CheckSignerPolicy mocks base method.
+func (m *MockIAuthClient) CheckSignerPolicy(arg0 context.Context, arg1 string, arg2 address.Address, arg3 uint64, arg4 *big.Int) (*auth.CheckSignerPolicyResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckSignerPolicy", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*auth.CheckSignerPolicyResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckSignerPolicy indicates an expected call of CheckSignerPolicy.
+func (mr *MockIAuthClientMockRecorder) CheckSignerPolicy(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckSignerPolicy", reflect.TypeOf((*MockIAuthClient)(nil).CheckSignerPolicy), arg0, arg1, arg2, arg3, arg4)
+}
+
 // GetUser mocks base method.
 func (m *MockIAuthClient) GetUser(arg0 context.Context, arg1 string) (*auth.OutputUser, error) {
 	m.ctrl.T.Helper()
@@ -290,6 +306,21 @@ func (mr *MockIAuthClientMockRecorder) Verify(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockIAuthClient)(nil).Verify), arg0, arg1)
 }
 
+// VerifyBatch mocks base method.
+func (m *MockIAuthClient) VerifyBatch(arg0 context.Context, arg1 []string) ([]*auth.VerifyResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyBatch", arg0, arg1)
+	ret0, _ := ret[0].([]*auth.VerifyResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyBatch indicates an expected call of VerifyBatch.
+func (mr *MockIAuthClientMockRecorder) VerifyBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyBatch", reflect.TypeOf((*MockIAuthClient)(nil).VerifyBatch), arg0, arg1)
+}
+
 // VerifyUsers mocks base method.
 func (m *MockIAuthClient) VerifyUsers(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,578 @@
+package jwtclient
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+// DefaultReplicaSyncInterval how often the replica syncs the changes from sophon-auth by default
+const DefaultReplicaSyncInterval = 5 * time.Second
+
+// the first retry after a failed sync, it doubles until the sync interval
+const replicaMinBackoff = 200 * time.Millisecond
+
+// ReplicaOption sets optional settings of ReplicaClient
+type ReplicaOption func(*replicaOpt)
+
+type replicaOpt struct {
+	interval     time.Duration
+	maxStaleness time.Duration
+}
+
+// WithSyncInterval sets how often the changes are synced, `DefaultReplicaSyncInterval` if it's not positive
+func WithSyncInterval(interval time.Duration) ReplicaOption {
+	return func(o *replicaOpt) {
+		o.interval = interval
+	}
+}
+
+// WithMaxStaleness fails the queries with `errcode.ErrUnavailable` if the replica hasn't been synced for d,
+// the last synced replica is used however stale it is by default
+func WithMaxStaleness(d time.Duration) ReplicaOption {
+	return func(o *replicaOpt) {
+		o.maxStaleness = d
+	}
+}
+
+// ReplicaClient answers the queries of `IAuthClient` from a replica of users, miners, signers and rate limits
+// in memory, it syncs a snapshot from sophon-auth and then the changes after it periodically.
+// `Verify`, `CheckSignerPolicy`, writes and queries by ID addresses of signers are sent to sophon-auth.
+// The replica is only replaced by a complete snapshot or batch of changes, while sophon-auth is unreachable,
+// the queries are answered by the last synced one, see `Staleness` and `WithMaxStaleness`.
+// The token of remote should have the admin permission.
+type ReplicaClient struct {
+	remote *AuthClient
+	opts   replicaOpt
+
+	lk    sync.RWMutex
+	epoch string
+	seq   uint64
+	users map[string]*auth.ReplicaUser
+	// indexes of the miners and signers of users
+	miners  map[address.Address]*auth.OutputMiner
+	signers map[address.Address]map[string]*auth.OutputSigner
+	// zero if never synced
+	lastSynced time.Time
+	created    time.Time
+
+	synced     chan struct{}
+	syncedOnce sync.Once
+	trigger    chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+var _ IAuthClient = (*ReplicaClient)(nil)
+
+// NewReplicaClient starts syncing from remote in background, queries wait until the first sync done
+func NewReplicaClient(remote *AuthClient, opts ...ReplicaOption) *ReplicaClient {
+	o := replicaOpt{interval: DefaultReplicaSyncInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.interval <= 0 {
+		o.interval = DefaultReplicaSyncInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &ReplicaClient{
+		remote:  remote,
+		opts:    o,
+		users:   make(map[string]*auth.ReplicaUser),
+		miners:  make(map[address.Address]*auth.OutputMiner),
+		signers: make(map[address.Address]map[string]*auth.OutputSigner),
+		created: time.Now(),
+		synced:  make(chan struct{}),
+		trigger: make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Close stops syncing, the replica shouldn't be queried after closed
+func (r *ReplicaClient) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// WaitSynced waits until the first sync done
+func (r *ReplicaClient) WaitSynced(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.synced:
+		return nil
+	}
+}
+
+// LastSynced returns when the replica was synced last time, zero if never
+func (r *ReplicaClient) LastSynced() time.Time {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.lastSynced
+}
+
+// Staleness how long the replica hasn't been synced, since the client created if it has never been synced
+func (r *ReplicaClient) Staleness() time.Duration {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.staleness()
+}
+
+func (r *ReplicaClient) staleness() time.Duration {
+	if r.lastSynced.IsZero() {
+		return time.Since(r.created)
+	}
+	return time.Since(r.lastSynced)
+}
+
+func (r *ReplicaClient) run(ctx context.Context) {
+	defer close(r.done)
+	backoff := time.Duration(0)
+	for {
+		wait := r.opts.interval
+		if err := r.sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			backoff *= 2
+			if backoff < replicaMinBackoff {
+				backoff = replicaMinBackoff
+			}
+			if backoff < wait {
+				wait = backoff
+			}
+			log.Warnf("replica: sync from sophon-auth failed, stale for %s: %s", r.Staleness().Truncate(time.Second), err)
+		} else {
+			backoff = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.trigger:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// syncNow syncs without waiting for the interval, it's called after writes so they are seen soon
+func (r *ReplicaClient) syncNow() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// sync fetches the changes after the last sync, or a snapshot if they are unknown
+func (r *ReplicaClient) sync(ctx context.Context) error {
+	r.lk.RLock()
+	epoch, seq := r.epoch, r.seq
+	r.lk.RUnlock()
+
+	if len(epoch) != 0 {
+		changes, err := r.remote.ReplicaChanges(ctx, epoch, seq)
+		if err != nil {
+			return err
+		}
+		if !changes.Reset {
+			r.applyChanges(changes)
+			return nil
+		}
+		log.Infof("replica: changes after %d of epoch %s are unknown, sync a snapshot", seq, epoch)
+	}
+
+	snapshot, err := r.remote.ReplicaSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	r.applySnapshot(snapshot)
+	log.Infof("replica: synced a snapshot of %d users at %d of epoch %s", len(snapshot.Users), snapshot.Seq, snapshot.Epoch)
+	return nil
+}
+
+func (r *ReplicaClient) applySnapshot(snapshot *auth.ReplicaSnapshot) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.users = make(map[string]*auth.ReplicaUser, len(snapshot.Users))
+	r.miners = make(map[address.Address]*auth.OutputMiner)
+	r.signers = make(map[address.Address]map[string]*auth.OutputSigner)
+	for _, ru := range snapshot.Users {
+		r.putUser(ru)
+	}
+	r.epoch, r.seq = snapshot.Epoch, snapshot.Seq
+	r.markSynced()
+}
+
+func (r *ReplicaClient) applyChanges(changes *auth.ReplicaChanges) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for _, name := range changes.Removed {
+		r.removeUser(name)
+	}
+	for _, ru := range changes.Users {
+		r.removeUser(ru.User.Name)
+		r.putUser(ru)
+	}
+	r.seq = changes.Seq
+	r.markSynced()
+}
+
+// markSynced should be called with lk held
+func (r *ReplicaClient) markSynced() {
+	r.lastSynced = time.Now()
+	r.syncedOnce.Do(func() {
+		close(r.synced)
+	})
+}
+
+// putUser should be called with lk held
+func (r *ReplicaClient) putUser(ru *auth.ReplicaUser) {
+	name := ru.User.Name
+	r.users[name] = ru
+	for _, m := range ru.Miners {
+		r.miners[m.Miner] = m
+	}
+	for _, s := range ru.Signers {
+		users, ok := r.signers[s.Signer]
+		if !ok {
+			users = make(map[string]*auth.OutputSigner)
+			r.signers[s.Signer] = users
+		}
+		users[name] = s
+	}
+}
+
+// removeUser should be called with lk held
+func (r *ReplicaClient) removeUser(name string) {
+	ru, ok := r.users[name]
+	if !ok {
+		return
+	}
+	delete(r.users, name)
+	for _, m := range ru.Miners {
+		// the miner may have been taken by another user
+		if cur, ok := r.miners[m.Miner]; ok && cur.User == name {
+			delete(r.miners, m.Miner)
+		}
+	}
+	for _, s := range ru.Signers {
+		users := r.signers[s.Signer]
+		delete(users, name)
+		if len(users) == 0 {
+			delete(r.signers, s.Signer)
+		}
+	}
+}
+
+// view calls fn with the replica read locked, after the first sync done, it fails if the replica is too stale
+func (r *ReplicaClient) view(ctx context.Context, fn func()) error {
+	if err := r.WaitSynced(ctx); err != nil {
+		return err
+	}
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	if r.opts.maxStaleness > 0 {
+		if stale := r.staleness(); stale > r.opts.maxStaleness {
+			return errcode.Errorf(errcode.CodeUnavailable, "the replica hasn't been synced for %s", stale.Truncate(time.Second))
+		}
+	}
+	fn()
+	return nil
+}
+
+func copyUser(u *auth.OutputUser) *auth.OutputUser {
+	out := *u
+	out.Miners = nil
+	return &out
+}
+
+func copyMiners(miners []*auth.OutputMiner) auth.ListMinerResp {
+	out := make(auth.ListMinerResp, 0, len(miners))
+	for _, m := range miners {
+		cp := *m
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Miner.String() < out[j].Miner.String()
+	})
+	return out
+}
+
+func (r *ReplicaClient) Verify(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+	return r.remote.Verify(ctx, token)
+}
+
+func (r *ReplicaClient) VerifyBatch(ctx context.Context, tokens []string) (auth.VerifyBatchResponse, error) {
+	return r.remote.VerifyBatch(ctx, tokens)
+}
+
+func (r *ReplicaClient) VerifyUsers(ctx context.Context, names []string) error {
+	var err error
+	if viewErr := r.view(ctx, func() {
+		for _, name := range names {
+			if _, ok := r.users[name]; !ok {
+				err = errcode.Errorf(errcode.CodeNotFound, "verify %s: user not found", name)
+				return
+			}
+		}
+	}); viewErr != nil {
+		return viewErr
+	}
+	return err
+}
+
+func (r *ReplicaClient) HasUser(ctx context.Context, name string) (bool, error) {
+	var has bool
+	err := r.view(ctx, func() {
+		_, has = r.users[name]
+	})
+	return has, err
+}
+
+func (r *ReplicaClient) GetUser(ctx context.Context, name string) (*auth.OutputUser, error) {
+	var user *auth.OutputUser
+	if err := r.view(ctx, func() {
+		if ru, ok := r.users[name]; ok {
+			user = copyUser(ru.User)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errcode.Errorf(errcode.CodeNotFound, "user %s not found", name)
+	}
+	return user, nil
+}
+
+func (r *ReplicaClient) GetUserByMiner(ctx context.Context, miner address.Address) (*auth.OutputUser, error) {
+	var user *auth.OutputUser
+	if err := r.view(ctx, func() {
+		m, ok := r.miners[miner]
+		if !ok {
+			return
+		}
+		if ru, ok := r.users[m.User]; ok {
+			user = copyUser(ru.User)
+			user.Miners = copyMiners([]*auth.OutputMiner{m})
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errcode.Errorf(errcode.CodeNotFound, "user of miner %s not found", miner)
+	}
+	return user, nil
+}
+
+// GetUserBySigner the ID address of signer is resolved by sophon-auth
+func (r *ReplicaClient) GetUserBySigner(ctx context.Context, signer address.Address) (auth.ListUsersResponse, error) {
+	if signer.Protocol() == address.ID {
+		return r.remote.GetUserBySigner(ctx, signer)
+	}
+	users := make(auth.ListUsersResponse, 0)
+	if err := r.view(ctx, func() {
+		for name := range r.signers[signer] {
+			if ru, ok := r.users[name]; ok {
+				users = append(users, copyUser(ru.User))
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	return users, nil
+}
+
+func (r *ReplicaClient) ListUsers(ctx context.Context, skip, limit int64, state core.UserState) (auth.ListUsersResponse, error) {
+	return r.listUsers(ctx, skip, limit, state, false)
+}
+
+func (r *ReplicaClient) ListUsersWithMiners(ctx context.Context, skip, limit int64, state core.UserState) (auth.ListUsersResponse, error) {
+	return r.listUsers(ctx, skip, limit, state, true)
+}
+
+// listUsers pages the users in the order of names
+func (r *ReplicaClient) listUsers(ctx context.Context, skip, limit int64, state core.UserState, withMiners bool) (auth.ListUsersResponse, error) {
+	req := auth.NewListUsersRequest(skip, limit, int(state))
+	skip, limit = req.GetSkip(), req.GetLimit()
+
+	var users auth.ListUsersResponse
+	err := r.view(ctx, func() {
+		names := make([]string, 0, len(r.users))
+		for name, ru := range r.users {
+			if state == core.UserStateUndefined || ru.User.State == state {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if skip >= int64(len(names)) {
+			return
+		}
+		names = names[skip:]
+		if limit > 0 && limit < int64(len(names)) {
+			names = names[:limit]
+		}
+		users = make(auth.ListUsersResponse, 0, len(names))
+		for _, name := range names {
+			ru := r.users[name]
+			user := copyUser(ru.User)
+			if withMiners {
+				user.Miners = copyMiners(ru.Miners)
+			}
+			users = append(users, user)
+		}
+	})
+	return users, err
+}
+
+// GetUserRateLimit the limits of users absent from the replica are got from sophon-auth, which fills the default one
+func (r *ReplicaClient) GetUserRateLimit(ctx context.Context, name, id string) (auth.GetUserRateLimitResponse, error) {
+	var limits auth.GetUserRateLimitResponse
+	found := false
+	if err := r.view(ctx, func() {
+		ru, ok := r.users[name]
+		if !ok {
+			return
+		}
+		found = true
+		for _, limit := range ru.RateLimits {
+			// the default limit has no id
+			if len(id) != 0 && limit.Id != id {
+				continue
+			}
+			cp := *limit
+			limits = append(limits, &cp)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if !found {
+		return r.remote.GetUserRateLimit(ctx, name, id)
+	}
+	return limits, nil
+}
+
+func (r *ReplicaClient) MinerExistInUser(ctx context.Context, user string, miner address.Address) (bool, error) {
+	var exist bool
+	err := r.view(ctx, func() {
+		m, ok := r.miners[miner]
+		exist = ok && m.User == user
+	})
+	return exist, err
+}
+
+// SignerExistInUser the ID address of signer is resolved by sophon-auth
+func (r *ReplicaClient) SignerExistInUser(ctx context.Context, user string, signer address.Address) (bool, error) {
+	if signer.Protocol() == address.ID {
+		return r.remote.SignerExistInUser(ctx, user, signer)
+	}
+	if !auth.IsSignerAddress(signer) {
+		return false, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", signer.Protocol())
+	}
+	var exist bool
+	err := r.view(ctx, func() {
+		_, exist = r.signers[signer][user]
+	})
+	return exist, err
+}
+
+func (r *ReplicaClient) CheckSignerPolicy(ctx context.Context, user string, signer address.Address, method uint64, value *big.Int) (*auth.CheckSignerPolicyResp, error) {
+	res, err := r.remote.CheckSignerPolicy(ctx, user, signer, method, value)
+	if err == nil && res.Allowed {
+		// the spent of signer may change
+		r.syncNow()
+	}
+	return res, err
+}
+
+func (r *ReplicaClient) HasMiner(ctx context.Context, miner address.Address) (bool, error) {
+	var has bool
+	err := r.view(ctx, func() {
+		_, has = r.miners[miner]
+	})
+	return has, err
+}
+
+func (r *ReplicaClient) ListMiners(ctx context.Context, user string) (auth.ListMinerResp, error) {
+	miners := auth.ListMinerResp{}
+	if err := r.view(ctx, func() {
+		if ru, ok := r.users[user]; ok {
+			miners = copyMiners(ru.Miners)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return miners, nil
+}
+
+func (r *ReplicaClient) UpsertMiner(ctx context.Context, user, miner string, openMining bool) (bool, error) {
+	isCreate, err := r.remote.UpsertMiner(ctx, user, miner, openMining)
+	if err == nil {
+		r.syncNow()
+	}
+	return isCreate, err
+}
+
+func (r *ReplicaClient) HasSigner(ctx context.Context, signer address.Address) (bool, error) {
+	if !auth.IsSignerAddress(signer) {
+		return false, errcode.Errorf(errcode.CodeInvalidArgument, "invalid protocol type: %v", signer.Protocol())
+	}
+	var has bool
+	err := r.view(ctx, func() {
+		has = len(r.signers[signer]) != 0
+	})
+	return has, err
+}
+
+func (r *ReplicaClient) ListSigners(ctx context.Context, user string) (auth.ListSignerResp, error) {
+	signers := auth.ListSignerResp{}
+	if err := r.view(ctx, func() {
+		ru, ok := r.users[user]
+		if !ok {
+			return
+		}
+		for _, s := range ru.Signers {
+			cp := *s
+			signers = append(signers, &cp)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return signers[i].Signer.String() < signers[j].Signer.String()
+	})
+	return signers, nil
+}
+
+func (r *ReplicaClient) RegisterSigners(ctx context.Context, user string, addrs []address.Address) error {
+	err := r.remote.RegisterSigners(ctx, user, addrs)
+	if err == nil {
+		r.syncNow()
+	}
+	return err
+}
+
+func (r *ReplicaClient) UnregisterSigners(ctx context.Context, user string, addrs []address.Address) error {
+	err := r.remote.UnregisterSigners(ctx, user, addrs)
+	if err == nil {
+		r.syncNow()
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package jwtclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// switchableProxy proxies to the server of `cli`, answers 503 while down
+func switchableProxy(t *testing.T) (*AuthClient, *atomic.Bool, *httptest.Server) {
+	target, err := url.Parse(cli.cli.HostURL)
+	require.NoError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	down := new(atomic.Bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	token := strings.TrimPrefix(cli.cli.Header.Get(core.AuthorizationHeader), "Bearer ")
+	proxied, err := NewAuthClient(server.URL, token)
+	require.NoError(t, err)
+	return proxied, down, server
+}
+
+// replicaMatches whether the replica answers the same as the server about users
+func replicaMatches(ctx context.Context, r *ReplicaClient, users []string, miners, signers []address.Address) bool {
+	same := func(a, b interface{}, errA, errB error) bool {
+		return (errA == nil) == (errB == nil) && assert.ObjectsAreEqual(a, b)
+	}
+	for _, user := range users {
+		a, errA := r.HasUser(ctx, user)
+		b, errB := cli.HasUser(ctx, user)
+		if !same(a, b, errA, errB) {
+			return false
+		}
+		u1, errA := r.GetUser(ctx, user)
+		u2, errB := cli.GetUser(ctx, user)
+		if !same(u1, u2, errA, errB) {
+			return false
+		}
+		m1, errA := r.ListMiners(ctx, user)
+		m2, errB := cli.ListMiners(ctx, user)
+		if !same(m1, m2, errA, errB) {
+			return false
+		}
+		s1, errA := r.ListSigners(ctx, user)
+		s2, errB := cli.ListSigners(ctx, user)
+		if !same(s1, s2, errA, errB) {
+			return false
+		}
+		l1, errA := r.GetUserRateLimit(ctx, user, "")
+		l2, errB := cli.GetUserRateLimit(ctx, user, "")
+		if !same(l1, l2, errA, errB) {
+			return false
+		}
+		for _, miner := range miners {
+			a, errA := r.MinerExistInUser(ctx, user, miner)
+			b, errB := cli.MinerExistInUser(ctx, user, miner)
+			if !same(a, b, errA, errB) {
+				return false
+			}
+		}
+		for _, signer := range signers {
+			a, errA := r.SignerExistInUser(ctx, user, signer)
+			b, errB := cli.SignerExistInUser(ctx, user, signer)
+			if !same(a, b, errA, errB) {
+				return false
+			}
+		}
+	}
+	for _, miner := range miners {
+		u1, errA := r.GetUserByMiner(ctx, miner)
+		u2, errB := cli.GetUserByMiner(ctx, miner)
+		if !same(u1, u2, errA, errB) {
+			return false
+		}
+	}
+	for _, signer := range signers {
+		a, errA := r.HasSigner(ctx, signer)
+		b, errB := cli.HasSigner(ctx, signer)
+		if !same(a, b, errA, errB) {
+			return false
+		}
+		u1, errA := r.GetUserBySigner(ctx, signer)
+		u2, errB := cli.GetUserBySigner(ctx, signer)
+		if !same(u1, u2, errA, errB) {
+			return false
+		}
+	}
+	l1, errA := r.ListUsers(ctx, 0, 0, core.UserStateUndefined)
+	l2, errB := cli.ListUsers(ctx, 0, 0, core.UserStateUndefined)
+	return same(l1, l2, errA, errB)
+}
+
+func TestReplicaClient(t *testing.T) {
+	ctx := context.Background()
+	// the server is shared by runs with -count
+	suffix := time.Now().UnixNano()
+	users := make([]string, 3)
+	for i := range users {
+		users[i] = fmt.Sprintf("replica_user_%d_%d", i+1, suffix)
+	}
+	miner, err := address.NewIDAddress(460001)
+	require.NoError(t, err)
+	signer, err := address.NewFromString("f1mpvdqt2acgihevibd4greavlsfn3dfph5sckc2a")
+	require.NoError(t, err)
+	miners, signers := []address.Address{miner}, []address.Address{signer}
+
+	for _, user := range users[:2] {
+		_, err := cli.CreateUser(ctx, &auth.CreateUserRequest{Name: user, State: core.UserStateEnabled})
+		require.NoError(t, err)
+		require.NoError(t, cli.RegisterSigners(ctx, user, signers))
+	}
+	_, err = cli.UpsertMiner(ctx, users[0], miner.String(), true)
+	require.NoError(t, err)
+	_, err = cli.UpsertUserRateLimit(ctx, &auth.UpsertUserRateLimitReq{
+		Name:     users[0],
+		ReqLimit: storage.ReqLimit{Cap: 10, ResetDur: time.Minute},
+	})
+	require.NoError(t, err)
+
+	proxied, down, _ := switchableProxy(t)
+	replica := NewReplicaClient(proxied, WithSyncInterval(50*time.Millisecond))
+	defer replica.Close()
+	strict := NewReplicaClient(proxied, WithSyncInterval(50*time.Millisecond), WithMaxStaleness(300*time.Millisecond))
+	defer strict.Close()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, replica.WaitSynced(waitCtx))
+	require.NoError(t, strict.WaitSynced(waitCtx))
+	assert.True(t, replicaMatches(ctx, replica, users, miners, signers))
+
+	// the changes are synced
+	_, err = cli.TransferMiner(ctx, miner, users[0], users[1], "")
+	require.NoError(t, err)
+	require.NoError(t, cli.UpdateUser(ctx, &auth.UpdateUserRequest{Name: users[0], State: core.UserStateDisabled}))
+	require.NoError(t, cli.UnregisterSigners(ctx, users[1], signers))
+	assert.Eventually(t, func() bool {
+		return replicaMatches(ctx, replica, users, miners, signers)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the replica keeps answering while the server is unreachable, unless it's too stale
+	down.Store(true)
+	_, err = cli.CreateUser(ctx, &auth.CreateUserRequest{Name: users[2], State: core.UserStateEnabled})
+	require.NoError(t, err)
+	require.NoError(t, cli.DeleteUser(ctx, &auth.DeleteUserRequest{Name: users[1]}))
+	time.Sleep(500 * time.Millisecond)
+
+	has, err := replica.HasUser(ctx, users[1])
+	require.NoError(t, err)
+	assert.True(t, has)
+	has, err = replica.HasUser(ctx, users[2])
+	require.NoError(t, err)
+	assert.False(t, has)
+	assert.Greater(t, replica.Staleness(), 300*time.Millisecond)
+	_, err = strict.HasUser(ctx, users[1])
+	assert.ErrorIs(t, err, errcode.ErrUnavailable)
+
+	// and catches up once the server is back
+	down.Store(false)
+	assert.Eventually(t, func() bool {
+		return replicaMatches(ctx, replica, users, miners, signers)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		has, err := strict.HasUser(ctx, users[2])
+		return err == nil && has
+	}, 5*time.Second, 50*time.Millisecond)
+	has, err = replica.HasUser(ctx, users[1])
+	require.NoError(t, err)
+	assert.False(t, has)
+}
@@ -0,0 +1,157 @@
+package jwtclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+// the first reconnection after the event stream broke, it doubles until subscribeMaxBackoff
+const (
+	subscribeMinBackoff = 200 * time.Millisecond
+	subscribeMaxBackoff = 10 * time.Second
+)
+
+// SubscribeOption sets optional settings of `AuthClient.Subscribe`
+type SubscribeOption func(*auth.SubscribeEventsReq)
+
+// WithEventTypes only delivers the events of types, `auth.EventReset` is always delivered
+func WithEventTypes(types ...auth.EventType) SubscribeOption {
+	return func(req *auth.SubscribeEventsReq) {
+		req.Types = append(req.Types, types...)
+	}
+}
+
+// WithEventUser only delivers the events of user, including the miners moved from it
+func WithEventUser(user string) SubscribeOption {
+	return func(req *auth.SubscribeEventsReq) {
+		req.User = user
+	}
+}
+
+// WithLastEventID resumes from the event after id, which is received by a former subscription
+func WithLastEventID(id string) SubscribeOption {
+	return func(req *auth.SubscribeEventsReq) {
+		req.LastEventID = id
+	}
+}
+
+// Subscribe streams the events of sophon-auth through the channel returned, which is closed when ctx done.
+// It reconnects if the stream broke, and resumes from the last event received, an `auth.EventReset`
+// is delivered if the events missed can't be replayed. Only the error of the first connection is returned.
+func (lc *AuthClient) Subscribe(ctx context.Context, opts ...SubscribeOption) (<-chan *auth.Event, error) {
+	req := &auth.SubscribeEventsReq{}
+	for _, opt := range opts {
+		opt(req)
+	}
+	body, err := lc.connectEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *auth.Event, 64)
+	go func() {
+		defer close(ch)
+		for {
+			err := readEvents(ctx, body, req, ch)
+			_ = body.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warnf("event stream broke after %s, reconnect: %v", req.LastEventID, err)
+
+			backoff := subscribeMinBackoff
+			for {
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				if body, err = lc.connectEvents(ctx, req); err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warnf("reconnect event stream: %s", err)
+				if backoff *= 2; backoff > subscribeMaxBackoff {
+					backoff = subscribeMaxBackoff
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (lc *AuthClient) connectEvents(ctx context.Context, req *auth.SubscribeEventsReq) (io.ReadCloser, error) {
+	r := lc.cli.R().SetContext(ctx).SetDoNotParseResponse(true).SetHeader("Accept", "text/event-stream")
+	for _, t := range req.Types {
+		r.QueryParam.Add("types", string(t))
+	}
+	if len(req.User) != 0 {
+		r.SetQueryParam("user", req.User)
+	}
+	if len(req.LastEventID) != 0 {
+		r.SetHeader("Last-Event-ID", req.LastEventID)
+	}
+	resp, err := r.Get("/events")
+	if err != nil {
+		return nil, err
+	}
+	body := resp.RawBody()
+	if resp.StatusCode() == http.StatusOK {
+		return body, nil
+	}
+	defer body.Close() // nolint
+
+	msg := &errcode.ErrMsg{}
+	if err := json.NewDecoder(body).Decode(msg); err != nil || len(msg.Error) == 0 {
+		return nil, fmt.Errorf("response code is : %d", resp.StatusCode())
+	}
+	return nil, msg.Err()
+}
+
+// readEvents delivers the server-sent events of body until it broke, the id of the last one is kept in req.
+// The ids and types of events are carried by data too, so only data is parsed.
+func readEvents(ctx context.Context, body io.Reader, req *auth.SubscribeEventsReq, ch chan<- *auth.Event) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) != 0 {
+			if value, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, strings.TrimPrefix(value, " "))
+			}
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+		ev := new(auth.Event)
+		if err := json.Unmarshal([]byte(strings.Join(data, "\n")), ev); err != nil {
+			return fmt.Errorf("decode event: %w", err)
+		}
+		data = data[:0]
+		select {
+		case ch <- ev:
+			req.LastEventID = ev.ID
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,105 @@
+package jwtclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+func nextEvent(t *testing.T, events <-chan *auth.Event) *auth.Event {
+	select {
+	case ev, ok := <-events:
+		require.True(t, ok, "events closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the server is shared by runs with -count
+	user := fmt.Sprintf("event_user_%d", time.Now().UnixNano())
+	miner, err := address.NewIDAddress(470001)
+	require.NoError(t, err)
+	signer, err := address.NewFromString("f15rynkupqyfx5ebvaishg7duutwb5ooq2qpaikua")
+	require.NoError(t, err)
+
+	_, err = cli.Subscribe(ctx, WithEventTypes("unknown"))
+	assert.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	proxied, down, server := switchableProxy(t)
+	events, err := proxied.Subscribe(ctx, WithEventUser(user))
+	require.NoError(t, err)
+	// only miner events of the user
+	minerEvents, err := cli.Subscribe(ctx, WithEventUser(user), WithEventTypes(auth.EventMinerUpserted, auth.EventMinerDeleted))
+	require.NoError(t, err)
+
+	_, err = cli.CreateUser(ctx, &auth.CreateUserRequest{Name: user, State: core.UserStateEnabled})
+	require.NoError(t, err)
+	_, err = cli.UpsertMiner(ctx, user, miner.String(), true)
+	require.NoError(t, err)
+	require.NoError(t, cli.RegisterSigners(ctx, user, []address.Address{signer}))
+	token, err := cli.GenerateToken(ctx, user, core.PermSign, "")
+	require.NoError(t, err)
+
+	ev := nextEvent(t, events)
+	assert.Equal(t, auth.EventUserCreated, ev.Type)
+	assert.Equal(t, user, ev.User)
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventMinerUpserted, ev.Type)
+	assert.Equal(t, miner.String(), ev.Miner)
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventSignerRegistered, ev.Type)
+	assert.Equal(t, signer.String(), ev.Signer)
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventTokenGenerated, ev.Type)
+	assert.Equal(t, core.PermSign, ev.Perm)
+
+	// the events while the stream broke are replayed after reconnected
+	down.Store(true)
+	server.CloseClientConnections()
+	require.NoError(t, cli.RemoveToken(ctx, token))
+	require.NoError(t, cli.UnregisterSigners(ctx, user, []address.Address{signer}))
+	_, err = cli.DelMiner(ctx, miner.String())
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	down.Store(false)
+
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventTokenRemoved, ev.Type)
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventSignerUnregistered, ev.Type)
+	ev = nextEvent(t, events)
+	assert.Equal(t, auth.EventMinerDeleted, ev.Type)
+	lastID := ev.ID
+
+	assert.Equal(t, auth.EventMinerUpserted, nextEvent(t, minerEvents).Type)
+	assert.Equal(t, auth.EventMinerDeleted, nextEvent(t, minerEvents).Type)
+
+	// resumed by the id of a former subscription, or reset if it's unknown
+	require.NoError(t, cli.DeleteUser(ctx, &auth.DeleteUserRequest{Name: user}))
+	resumed, err := cli.Subscribe(ctx, WithEventUser(user), WithLastEventID(lastID))
+	require.NoError(t, err)
+	assert.Equal(t, auth.EventUserDeleted, nextEvent(t, resumed).Type)
+	reset, err := cli.Subscribe(ctx, WithLastEventID("unknown-1"))
+	require.NoError(t, err)
+	assert.Equal(t, auth.EventReset, nextEvent(t, reset).Type)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,129 @@
+package jwtclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+// defaults of `WithVerifyBatch`
+const (
+	DefaultVerifyBatchWindow = 5 * time.Millisecond
+	DefaultVerifyBatchSize   = 100
+)
+
+// verifyBatcher coalesces the verifications within a window into a request of `VerifyBatch`,
+// the batch is sent earlier once it's full
+type verifyBatcher struct {
+	client  IJwtBatchAuthClient
+	window  time.Duration
+	maxSize int
+
+	lk      sync.Mutex
+	pending *verifyBatch
+}
+
+// verifyBatch the tokens verified in a request, a token verified concurrently is sent once
+type verifyBatch struct {
+	tokens  []string
+	indexes map[string]int
+	// the verifications waiting for the batch, the request is canceled once all of them gone
+	waiters int
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	done    chan struct{}
+	results auth.VerifyBatchResponse
+	err     error
+}
+
+func newVerifyBatcher(client IJwtBatchAuthClient, window time.Duration, maxSize int) *verifyBatcher {
+	if window <= 0 {
+		window = DefaultVerifyBatchWindow
+	}
+	if maxSize <= 0 || maxSize > auth.MaxVerifyBatch {
+		maxSize = DefaultVerifyBatchSize
+	}
+	return &verifyBatcher{client: client, window: window, maxSize: maxSize}
+}
+
+func (b *verifyBatcher) Verify(ctx context.Context, token string) (core.Permission, error) {
+	b.lk.Lock()
+	batch := b.pending
+	if batch == nil {
+		batchCtx, cancel := context.WithCancel(context.Background())
+		batch = &verifyBatch{
+			indexes: make(map[string]int),
+			ctx:     batchCtx,
+			cancel:  cancel,
+			done:    make(chan struct{}),
+		}
+		b.pending = batch
+		time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	idx, ok := batch.indexes[token]
+	if !ok {
+		idx = len(batch.tokens)
+		batch.indexes[token] = idx
+		batch.tokens = append(batch.tokens, token)
+	}
+	batch.waiters++
+	full := len(batch.tokens) >= b.maxSize
+	b.lk.Unlock()
+	if full {
+		b.flush(batch)
+	}
+
+	select {
+	case <-batch.done:
+		if batch.err != nil {
+			return "", batch.err
+		}
+		res := batch.results[idx]
+		if res.Error != nil {
+			return "", res.Error.Err()
+		}
+		if res.Payload == nil {
+			return "", fmt.Errorf("no payload of token in the result")
+		}
+		return res.Payload.Perm, nil
+	case <-ctx.Done():
+		b.lk.Lock()
+		batch.waiters--
+		// the batch pending is canceled when flushed, others may join it before
+		if batch.waiters == 0 && b.pending != batch {
+			batch.cancel()
+		}
+		b.lk.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+// flush sends the batch if it's still pending, nothing is sent if no one waits for it
+func (b *verifyBatcher) flush(batch *verifyBatch) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.pending != batch {
+		return
+	}
+	b.pending = nil
+	if batch.waiters == 0 {
+		batch.cancel()
+		return
+	}
+	go batch.send(b.client)
+}
+
+func (batch *verifyBatch) send(client IJwtBatchAuthClient) {
+	defer batch.cancel()
+	results, err := client.VerifyBatch(batch.ctx, batch.tokens)
+	if err == nil && len(results) != len(batch.tokens) {
+		err = fmt.Errorf("verify %d tokens, got %d results", len(batch.tokens), len(results))
+	}
+	batch.results, batch.err = results, err
+	close(batch.done)
+}
@@ -0,0 +1,84 @@
+package jwtclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+// verifyFlight a verification in flight, shared by the requests of the same token
+type verifyFlight struct {
+	// the requests waiting for it, the verification is canceled once all of them gone
+	waiters int
+	cancel  context.CancelFunc
+
+	done chan struct{}
+	perm core.Permission
+	err  error
+}
+
+// verifyGroup de-duplicates the concurrent verifications of a token, only the first one of them
+// requests the remote, the others wait for its result
+type verifyGroup struct {
+	lk      sync.Mutex
+	flights map[string]*verifyFlight
+}
+
+func newVerifyGroup() *verifyGroup {
+	return &verifyGroup{flights: make(map[string]*verifyFlight)}
+}
+
+// Verify the verification is run with the values of ctx of the first request, but not canceled
+// by it while the others still wait, a request gone returns at once with the error of its ctx
+func (g *verifyGroup) Verify(ctx context.Context, token string,
+	verify func(ctx context.Context, token string) (core.Permission, error),
+) (core.Permission, error) {
+	g.lk.Lock()
+	f, ok := g.flights[token]
+	if ok {
+		core.TokenVerifyCoalescedCounter.Tick(ctx)
+	} else {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &verifyFlight{cancel: cancel, done: make(chan struct{})}
+		g.flights[token] = f
+		go g.run(flightCtx, f, token, verify)
+	}
+	f.waiters++
+	g.lk.Unlock()
+
+	select {
+	case <-f.done:
+		return f.perm, f.err
+	case <-ctx.Done():
+		g.lk.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// the requests coming later verify again rather than get the error of canceled
+			f.cancel()
+			g.forget(token, f)
+		}
+		g.lk.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+func (g *verifyGroup) run(ctx context.Context, f *verifyFlight, token string,
+	verify func(ctx context.Context, token string) (core.Permission, error),
+) {
+	defer f.cancel()
+	perm, err := verify(ctx, token)
+	// the result isn't cached, the requests after it finished verify again
+	g.lk.Lock()
+	g.forget(token, f)
+	g.lk.Unlock()
+	f.perm, f.err = perm, err
+	close(f.done)
+}
+
+// forget removes f if it's still the flight of token, the caller should hold the lock
+func (g *verifyGroup) forget(token string, f *verifyFlight) {
+	if g.flights[token] == f {
+		delete(g.flights, token)
+	}
+}
@@ -3,6 +3,7 @@ package log
 import (
 	"fmt"
 	"strconv"
+	"sync"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
@@ -20,6 +21,8 @@ type InfluxHook struct {
 	client   influxdb2.Client
 	writeAPI api.WriteAPI
 	tags     []string
+
+	closeOnce sync.Once
 }
 
 func NewInfluxHook(c *config.InfluxDBConfig) *InfluxHook {
@@ -38,6 +41,15 @@ func NewInfluxHook(c *config.InfluxDBConfig) *InfluxHook {
 	}
 }
 
+// Close flushes the points not written yet and closes the client, which stops its background goroutines,
+// it's safe to call more than once
+func (h *InfluxHook) Close() {
+	h.closeOnce.Do(func() {
+		h.writeAPI.Flush()
+		h.client.Close()
+	})
+}
+
 func (h *InfluxHook) Levels() []logrus.Level {
 	return logrus.AllLevels
 }
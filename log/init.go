@@ -1,6 +1,7 @@
 package log
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/ipfs-force-community/sophon-auth/config"
@@ -36,3 +37,42 @@ func WithInflux(c *config.InfluxDBConfig) error {
 	localLog.AddHook(hook)
 	return nil
 }
+
+// ReloadLog applies c to the running logger, the level and hooks are replaced and the old hooks are closed
+func ReloadLog(c *config.LogConfig) error {
+	lvl, err := logrus.ParseLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+	hooks := make(logrus.LevelHooks)
+	if c.HookSwitch {
+		if c.InfluxDB == nil {
+			return fmt.Errorf("influxdb config is required by the log hook")
+		}
+		hooks.Add(NewInfluxHook(c.InfluxDB))
+	}
+	old := localLog.ReplaceHooks(hooks)
+	localLog.SetLevel(lvl)
+	closeHooks(old)
+	return nil
+}
+
+// Close removes the hooks and flushes the entries they haven't sent, called before the daemon exits
+func Close() {
+	closeHooks(localLog.ReplaceHooks(make(logrus.LevelHooks)))
+}
+
+func closeHooks(hooks logrus.LevelHooks) {
+	// a hook is registered for each of its levels
+	closed := make(map[*InfluxHook]struct{})
+	for _, levelHooks := range hooks {
+		for _, hook := range levelHooks {
+			if h, ok := hook.(*InfluxHook); ok {
+				if _, ok := closed[h]; !ok {
+					h.Close()
+					closed[h] = struct{}{}
+				}
+			}
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package log
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,3 +50,58 @@ func TestLog(t *testing.T) {
 	}).Error("This is an error")
 	time.Sleep(time.Second * 2)
 }
+
+func TestReloadLog(t *testing.T) {
+	InitLog(&config.LogConfig{LogLevel: "info"})
+	if GetLevel() != logrus.InfoLevel {
+		t.Fatalf("expect level info, got %s", GetLevel())
+	}
+
+	if err := ReloadLog(&config.LogConfig{LogLevel: "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != logrus.WarnLevel {
+		t.Fatalf("expect level warning, got %s", GetLevel())
+	}
+
+	if err := ReloadLog(&config.LogConfig{LogLevel: "verbose"}); err == nil {
+		t.Fatal("expect error of invalid level")
+	}
+	if GetLevel() != logrus.WarnLevel {
+		t.Fatalf("level should be kept, got %s", GetLevel())
+	}
+}
+
+func TestCloseLog(t *testing.T) {
+	var lk sync.Mutex
+	var written []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lk.Lock()
+		written = append(written, string(body))
+		lk.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	for i := 0; i < 3; i++ {
+		// points are only written by flushing within an hour
+		InitLog(&config.LogConfig{LogLevel: "info", HookSwitch: true, InfluxDB: &config.InfluxDBConfig{
+			ServerURL:     srv.URL,
+			Org:           "venus-oauth",
+			Bucket:        "bkt",
+			FlushInterval: time.Hour,
+			BatchSize:     100,
+		}})
+		WithFields(logrus.Fields{"method": "verify", "name": fmt.Sprintf("user_%d", i)}).Info("verify token")
+		Close()
+		// hooks are removed after closed
+		Info("not written")
+
+		lk.Lock()
+		if len(written) != i+1 || !strings.Contains(written[i], fmt.Sprintf("user_%d", i)) {
+			t.Fatalf("expect the point of user_%d flushed, got %v", i, written)
+		}
+		lk.Unlock()
+	}
+}
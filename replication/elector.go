@@ -0,0 +1,366 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// Leadership who is the leader of a term
+type Leadership struct {
+	// address of the leader, empty if no leader is known
+	Addr string `json:"addr"`
+	Term uint64 `json:"term"`
+	// whether this node is the leader
+	Self bool `json:"self"`
+}
+
+// Elector decides which node is the leader, the built-in one elects as Raft does among the nodes,
+// others, such as a lock of etcd, can be plugged by `WithElector`.
+type Elector interface {
+	// Run takes part in the elections until ctx done
+	Run(ctx context.Context)
+	// Leader returns the current leadership
+	Leader() Leadership
+}
+
+// Position how up to date the store of a node is, compared by the term of the leader written it and then the version
+type Position struct {
+	Term    uint64 `json:"term"`
+	Version uint64 `json:"version"`
+}
+
+func (p Position) Less(o Position) bool {
+	return p.Term < o.Term || (p.Term == o.Term && p.Version < o.Version)
+}
+
+const (
+	votePath      = "/replication/vote"
+	heartbeatPath = "/replication/heartbeat"
+	// the term and vote of the elector are persisted, so it never votes twice in a term
+	electorStateKey = "replication-elector"
+)
+
+type voteRequest struct {
+	Term      uint64   `json:"term"`
+	Candidate string   `json:"candidate"`
+	Position  Position `json:"position"`
+}
+
+type voteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type heartbeatRequest struct {
+	Term   uint64 `json:"term"`
+	Leader string `json:"leader"`
+}
+
+type heartbeatResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+}
+
+type electorState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"votedFor"`
+}
+
+var _ Elector = (*raftElector)(nil)
+
+// raftElector elects the leader as Raft does, a follower campaigns if it hears nothing from the leader
+// in the election timeout, and the candidate with the votes of majority becomes the leader of its term.
+// The votes are only granted to the candidates whose stores are at least as up to date as the voter.
+type raftElector struct {
+	self  string
+	peers []string
+	cli   *resty.Client
+
+	electionTimeout   time.Duration
+	heartbeatInterval time.Duration
+	// position of the store of this node
+	position func() Position
+	store    storage.Replicable
+
+	lk       sync.Mutex
+	term     uint64
+	votedFor string
+	leader   string
+	// when the leader was heard or a vote was granted last time
+	lastContact time.Time
+	// when the leader heard from the majority last time
+	lastMajority time.Time
+}
+
+func newRaftElector(n *Node, store storage.Replicable) (*raftElector, error) {
+	e := &raftElector{
+		self:              n.self,
+		peers:             n.peers,
+		cli:               n.cli,
+		electionTimeout:   n.cnf.ElectionTimeout,
+		heartbeatInterval: n.cnf.HeartbeatInterval,
+		position:          n.Position,
+		store:             store,
+		lastContact:       time.Now(),
+	}
+	data, err := store.GetLocal(electorStateKey)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		var state electorState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, err
+		}
+		e.term, e.votedFor = state.Term, state.VotedFor
+	}
+	return e, nil
+}
+
+func (e *raftElector) Leader() Leadership {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	return Leadership{Addr: e.leader, Term: e.term, Self: len(e.leader) != 0 && e.leader == e.self}
+}
+
+func (e *raftElector) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if e.Leader().Self {
+			e.lead(ctx)
+		} else {
+			e.follow(ctx)
+		}
+	}
+}
+
+// persist should be called with lk held
+func (e *raftElector) persist() {
+	data, _ := json.Marshal(&electorState{Term: e.term, VotedFor: e.votedFor})
+	if err := e.store.PutLocal(electorStateKey, data); err != nil {
+		log.Warnf("replication: persist term %d: %s", e.term, err)
+	}
+}
+
+func (e *raftElector) majority() int {
+	return (len(e.peers)+1)/2 + 1
+}
+
+func (e *raftElector) tick() time.Duration {
+	if tick := e.heartbeatInterval / 5; tick > 10*time.Millisecond {
+		return tick
+	}
+	return 10 * time.Millisecond
+}
+
+// follow returns after this node is elected
+func (e *raftElector) follow(ctx context.Context) {
+	timeout := e.electionTimeout + time.Duration(rand.Int63n(int64(e.electionTimeout)))
+	ticker := time.NewTicker(e.tick())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		e.lk.Lock()
+		expired := time.Since(e.lastContact) > timeout
+		e.lk.Unlock()
+		if !expired {
+			continue
+		}
+		if e.campaign(ctx) {
+			return
+		}
+		timeout = e.electionTimeout + time.Duration(rand.Int63n(int64(e.electionTimeout)))
+	}
+}
+
+func (e *raftElector) campaign(ctx context.Context) bool {
+	pos := e.position()
+	e.lk.Lock()
+	e.term++
+	e.votedFor, e.leader, e.lastContact = e.self, "", time.Now()
+	e.persist()
+	term := e.term
+	e.lk.Unlock()
+	log.Infof("replication: campaign for term %d", term)
+
+	req := &voteRequest{Term: term, Candidate: e.self, Position: pos}
+	votes := 1
+	for _, resp := range e.broadcast(ctx, votePath, req, func() interface{} { return &voteResponse{} }) {
+		res := resp.(*voteResponse)
+		if res.Term > term {
+			e.stepDown(res.Term)
+			return false
+		}
+		if res.Granted {
+			votes++
+		}
+	}
+
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	if e.term != term || votes < e.majority() {
+		return false
+	}
+	e.leader, e.lastMajority = e.self, time.Now()
+	log.Infof("replication: elected as the leader of term %d with %d votes", term, votes)
+	return true
+}
+
+// lead sends heartbeats until this node steps down
+func (e *raftElector) lead(ctx context.Context) {
+	ticker := time.NewTicker(e.heartbeatInterval)
+	defer ticker.Stop()
+	term := e.Leader().Term
+	for {
+		acks := 1
+		req := &heartbeatRequest{Term: term, Leader: e.self}
+		for _, resp := range e.broadcast(ctx, heartbeatPath, req, func() interface{} { return &heartbeatResponse{} }) {
+			res := resp.(*heartbeatResponse)
+			if res.Term > term {
+				e.stepDown(res.Term)
+				return
+			}
+			if res.Success {
+				acks++
+			}
+		}
+
+		e.lk.Lock()
+		if e.leader != e.self || e.term != term {
+			e.lk.Unlock()
+			return
+		}
+		if acks >= e.majority() {
+			e.lastMajority = time.Now()
+		} else if time.Since(e.lastMajority) > e.electionTimeout {
+			// the others may have elected another leader
+			log.Warnf("replication: step down from the leader of term %d, the majority is unreachable", term)
+			e.leader, e.lastContact = "", time.Now()
+			e.lk.Unlock()
+			return
+		}
+		e.lk.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *raftElector) stepDown(term uint64) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	if term > e.term {
+		e.term, e.votedFor = term, ""
+		e.persist()
+	}
+	if e.leader == e.self {
+		log.Warnf("replication: step down from the leader, a newer term %d found", term)
+		e.leader = ""
+	}
+	e.lastContact = time.Now()
+}
+
+// broadcast posts req to the peers, returns the responses of those reachable
+func (e *raftElector) broadcast(ctx context.Context, path string, req interface{}, newResp func() interface{}) []interface{} {
+	ctx, cancel := context.WithTimeout(ctx, e.heartbeatInterval)
+	defer cancel()
+
+	var lk sync.Mutex
+	var wg sync.WaitGroup
+	resps := make([]interface{}, 0, len(e.peers))
+	for _, peer := range e.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			resp, err := e.cli.R().SetContext(ctx).SetBody(req).SetResult(newResp()).Post(peer + path)
+			if err != nil || resp.IsError() {
+				log.Debugf("replication: request %s of %s failed: %v %v", path, peer, err, resp)
+				return
+			}
+			lk.Lock()
+			defer lk.Unlock()
+			resps = append(resps, resp.Result())
+		}(peer)
+	}
+	wg.Wait()
+	return resps
+}
+
+func (e *raftElector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case votePath:
+		req := new(voteRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeError(w, errcode.WithCode(errcode.CodeInvalidArgument, err))
+			return
+		}
+		writeJSON(w, e.vote(req))
+	case heartbeatPath:
+		req := new(heartbeatRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeError(w, errcode.WithCode(errcode.CodeInvalidArgument, err))
+			return
+		}
+		writeJSON(w, e.heartbeat(req))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (e *raftElector) vote(req *voteRequest) *voteResponse {
+	pos := e.position()
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	changed := false
+	if req.Term > e.term {
+		if e.leader == e.self {
+			log.Warnf("replication: step down from the leader, %s campaigns for term %d", req.Candidate, req.Term)
+		}
+		e.term, e.votedFor, e.leader = req.Term, "", ""
+		changed = true
+	}
+	granted := false
+	if req.Term == e.term && (len(e.votedFor) == 0 || e.votedFor == req.Candidate) && !req.Position.Less(pos) {
+		e.votedFor, e.lastContact = req.Candidate, time.Now()
+		granted, changed = true, true
+	}
+	if changed {
+		e.persist()
+	}
+	return &voteResponse{Term: e.term, Granted: granted}
+}
+
+func (e *raftElector) heartbeat(req *heartbeatRequest) *heartbeatResponse {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	if req.Term < e.term {
+		return &heartbeatResponse{Term: e.term}
+	}
+	if req.Term > e.term {
+		e.term, e.votedFor = req.Term, ""
+		e.persist()
+	}
+	if e.leader != req.Leader {
+		log.Infof("replication: follow the leader %s of term %d", req.Leader, req.Term)
+	}
+	e.leader, e.lastContact = req.Leader, time.Now()
+	return &heartbeatResponse{Term: e.term, Success: true}
+}
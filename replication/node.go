@@ -0,0 +1,591 @@
+package replication
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+const (
+	streamPath = "/replication/stream"
+	usagesPath = "/replication/usages"
+	statusPath = "/replication/status"
+
+	// the position of store is persisted, so the node votes correctly after restarted
+	positionKey = "replication-position"
+	// set on the requests proxied to the leader, which are never proxied again
+	proxiedHeader = "X-Replication-Proxied"
+)
+
+// readOnlyPosts the apis which are posted but write nothing, they are served by followers
+var readOnlyPosts = map[string]struct{}{
+	"/verify":       {},
+	"/verify/batch": {},
+	"/user/verify":  {},
+}
+
+// leaderGets the apis which write nothing but are served by the leader, since they rely on what only the
+// leader knows, such as the change log of replica clients
+var leaderGets = map[string]struct{}{
+	"/replica/snapshot": {},
+	"/replica/changes":  {},
+	"/events":           {},
+	// the reaper runs on the leader, which keeps the reports in memory
+	"/maintenance/reports": {},
+}
+
+// leaderStreams the apis of `leaderGets` streaming longer than the write timeout of server
+var leaderStreams = map[string]struct{}{
+	"/events": {},
+}
+
+// Node replicates the badger store of the leader to followers, the followers serve reads and `/verify`
+// by their own stores, and proxy writes to the leader.
+// Replication is asynchronous, the writes of the leader not replicated yet may be lost when it fails.
+type Node struct {
+	cnf   *config.ReplicationConfig
+	self  string
+	peers []string
+	// requests to the peers
+	cli       *resty.Client
+	transport *http.Transport
+	elector   Elector
+
+	db    storage.Store
+	store storage.Replicable
+
+	lk       sync.Mutex
+	position Position
+	// canceled when this node steps down, nil if it's not the leader
+	leadCtx context.Context
+	proxies map[string]*httputil.ReverseProxy
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// Option sets optional parts of the node
+type Option func(*Node)
+
+// WithElector replaces the built-in elector
+func WithElector(elector Elector) Option {
+	return func(n *Node) {
+		n.elector = elector
+	}
+}
+
+// WithTLSConfig is used to request the peers over https
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(n *Node) {
+		n.cli.SetTLSClientConfig(cfg)
+		n.transport.TLSClientConfig = cfg
+	}
+}
+
+// NewNode checks cnf and returns a node not started yet, see `Start`
+func NewNode(cnf *config.ReplicationConfig, opts ...Option) (*Node, error) {
+	if len(cnf.Secret) == 0 {
+		return nil, fmt.Errorf("secret is required by replication")
+	}
+	if cnf.ElectionTimeout <= 0 || cnf.HeartbeatInterval <= 0 || cnf.HeartbeatInterval >= cnf.ElectionTimeout {
+		return nil, fmt.Errorf("heartbeat interval %s should be positive and shorter than election timeout %s",
+			cnf.HeartbeatInterval, cnf.ElectionTimeout)
+	}
+	self, err := normalizeURL(cnf.Advertise)
+	if err != nil {
+		return nil, fmt.Errorf("advertise: %w", err)
+	}
+	peers := make([]string, 0, len(cnf.Peers))
+	for _, peer := range cnf.Peers {
+		peer, err := normalizeURL(peer)
+		if err != nil {
+			return nil, fmt.Errorf("peer: %w", err)
+		}
+		if peer != self {
+			peers = append(peers, peer)
+		}
+	}
+
+	n := &Node{
+		cnf:       cnf,
+		self:      self,
+		peers:     peers,
+		cli:       resty.New().SetAuthToken(cnf.Secret).SetHeader("Accept", "application/json"),
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+		proxies:   make(map[string]*httputil.ReverseProxy),
+		ready:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n, nil
+}
+
+func normalizeURL(addr string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return "", fmt.Errorf("%s is not a http(s) url", addr)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// Start takes part in the elections and replicates store, which should be replicable
+func (n *Node) Start(store storage.Store) error {
+	replicable, ok := store.(storage.Replicable)
+	if !ok {
+		return fmt.Errorf("the store is not replicable, only badger is supported")
+	}
+	n.db, n.store = store, replicable
+
+	data, err := replicable.GetLocal(positionKey)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &n.position); err != nil {
+			return err
+		}
+	}
+	if n.elector == nil {
+		if n.elector, err = newRaftElector(n, replicable); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.wg.Add(2)
+	go func() {
+		defer n.wg.Done()
+		n.elector.Run(ctx)
+	}()
+	go func() {
+		defer n.wg.Done()
+		n.run(ctx)
+	}()
+	log.Infof("replication: start node %s with peers %v", n.self, n.peers)
+	return nil
+}
+
+// Close stops replicating, the store is still open
+func (n *Node) Close() {
+	if n.cancel == nil {
+		return
+	}
+	n.closeOnce.Do(func() {
+		n.cancel()
+		n.wg.Wait()
+		n.persistPosition()
+	})
+}
+
+// WaitReady waits until this node leads, or it has synced from the leader
+func (n *Node) WaitReady(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.ready:
+		return nil
+	}
+}
+
+// Leader returns the current leadership
+func (n *Node) Leader() Leadership {
+	return n.elector.Leader()
+}
+
+// IsLeader whether this node accepts writes
+func (n *Node) IsLeader() bool {
+	return n.elector.Leader().Self
+}
+
+// Position returns how up to date the store of this node is
+func (n *Node) Position() Position {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.position
+}
+
+func (n *Node) setPosition(pos Position) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.position = pos
+}
+
+func (n *Node) persistPosition() {
+	data, _ := json.Marshal(n.Position())
+	if err := n.store.PutLocal(positionKey, data); err != nil {
+		log.Warnf("replication: persist position: %s", err)
+	}
+}
+
+func (n *Node) isReady() bool {
+	select {
+	case <-n.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (n *Node) markReady() {
+	n.readyOnce.Do(func() {
+		close(n.ready)
+	})
+}
+
+// run leads or follows as the elector decides
+func (n *Node) run(ctx context.Context) {
+	ticker := time.NewTicker(n.cnf.HeartbeatInterval / 5)
+	defer ticker.Stop()
+
+	var current Leadership
+	var r *role
+	defer func() {
+		r.stop()
+	}()
+
+	persisted := n.Position()
+	for {
+		if leadership := n.elector.Leader(); leadership != current {
+			r.stop()
+			current, r = leadership, nil
+			if len(leadership.Addr) != 0 {
+				r = n.startRole(ctx, leadership)
+			}
+		}
+		if pos := n.Position(); pos != persisted {
+			n.persistPosition()
+			persisted = pos
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// role is what the node does under a leadership, leads or follows
+type role struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (n *Node) startRole(ctx context.Context, leadership Leadership) *role {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &role{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		if leadership.Self {
+			n.lead(ctx, leadership.Term)
+		} else {
+			n.follow(ctx, leadership)
+		}
+	}()
+	return r
+}
+
+func (r *role) stop() {
+	if r != nil {
+		r.cancel()
+		<-r.done
+	}
+}
+
+// lead serves the streams to followers and tracks the position of its own writes
+func (n *Node) lead(ctx context.Context, term uint64) {
+	log.Infof("replication: lead term %d", term)
+	n.lk.Lock()
+	n.leadCtx = ctx
+	n.lk.Unlock()
+	defer func() {
+		n.lk.Lock()
+		n.leadCtx = nil
+		n.lk.Unlock()
+	}()
+	n.markReady()
+
+	for ctx.Err() == nil {
+		err := n.store.Stream(ctx, func(batch *storage.ReplicaBatch) error {
+			// what it has at the start of term is the same as the snapshot sent to followers
+			if !batch.Snapshot || batch.Synced {
+				n.setPosition(Position{Term: term, Version: batch.Version})
+			}
+			return nil
+		})
+		if ctx.Err() == nil {
+			log.Warnf("replication: track writes: %v", err)
+			time.Sleep(n.cnf.HeartbeatInterval)
+		}
+	}
+}
+
+// follow syncs from the leader until ctx done, it retries after failures
+func (n *Node) follow(ctx context.Context, leader Leadership) {
+	for ctx.Err() == nil {
+		err := n.sync(ctx, leader)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("replication: sync from %s: %v, retry later", leader.Addr, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(n.cnf.HeartbeatInterval):
+		}
+	}
+}
+
+// streamBatch a batch of the stream from the leader
+type streamBatch struct {
+	Term uint64 `json:"term"`
+	*storage.ReplicaBatch
+}
+
+func (n *Node) sync(ctx context.Context, leader Leadership) error {
+	resp, err := n.cli.R().SetContext(ctx).SetDoNotParseResponse(true).Get(leader.Addr + streamPath)
+	if err != nil {
+		return err
+	}
+	body := resp.RawBody()
+	defer body.Close() // nolint
+	if resp.StatusCode() != http.StatusOK {
+		msg := &errcode.ErrMsg{}
+		_ = json.NewDecoder(body).Decode(msg)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode(), msg.Error)
+	}
+
+	dec := json.NewDecoder(body)
+	var snapshot []*storage.ReplicaRecord
+	for {
+		batch := &streamBatch{}
+		if err := dec.Decode(batch); err != nil {
+			return err
+		}
+		if batch.ReplicaBatch == nil {
+			continue
+		}
+		if batch.Snapshot {
+			snapshot = append(snapshot, batch.Records...)
+			if !batch.Synced {
+				continue
+			}
+			if err := n.store.ApplySnapshot(snapshot); err != nil {
+				return fmt.Errorf("apply snapshot: %w", err)
+			}
+			log.Infof("replication: synced %d records from the leader %s of term %d", len(snapshot), leader.Addr, batch.Term)
+			snapshot = nil
+			n.setPosition(Position{Term: batch.Term, Version: batch.Version})
+			n.markReady()
+			continue
+		}
+		if err := n.store.Apply(batch.Records); err != nil {
+			return fmt.Errorf("apply: %w", err)
+		}
+		n.setPosition(Position{Term: batch.Term, Version: batch.Version})
+	}
+}
+
+// UpdateTokenUsages writes the usages of tokens by the leader, since followers never write their stores
+func (n *Node) UpdateTokenUsages(usages []*storage.TokenUsage) error {
+	leader := n.Leader()
+	if leader.Self {
+		return n.db.UpdateTokenUsages(usages)
+	}
+	if len(leader.Addr) == 0 {
+		return errcode.Errorf(errcode.CodeUnavailable, "no leader to write usages of tokens")
+	}
+	resp, err := n.cli.R().SetBody(usages).SetError(&errcode.ErrMsg{}).Post(leader.Addr + usagesPath)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return resp.Error().(*errcode.ErrMsg).Err()
+	}
+	return nil
+}
+
+// Status the replication state of a node
+type Status struct {
+	Self     string     `json:"self"`
+	Leader   Leadership `json:"leader"`
+	Position Position   `json:"position"`
+	Ready    bool       `json:"ready"`
+}
+
+func (n *Node) Status() *Status {
+	return &Status{Self: n.self, Leader: n.Leader(), Position: n.Position(), Ready: n.isReady()}
+}
+
+// Handler serves the apis of replication, and proxies writes to the leader if this node is a follower
+func (n *Node) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/replication/") {
+			n.serveReplication(w, r)
+			return
+		}
+		if !n.isReady() {
+			writeError(w, errcode.Errorf(errcode.CodeUnavailable, "no leader elected or not synced from the leader yet"))
+			return
+		}
+		if byLeader(r) {
+			if leader := n.Leader(); !leader.Self {
+				n.proxy(w, r, leader)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// byLeader whether r should be served by the leader, which are writes and `leaderGets`
+func byLeader(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet:
+		_, ok := leaderGets[r.URL.Path]
+		return ok
+	case http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		_, readOnly := readOnlyPosts[r.URL.Path]
+		return !readOnly
+	}
+	return true
+}
+
+func (n *Node) proxy(w http.ResponseWriter, r *http.Request, leader Leadership) {
+	if len(leader.Addr) == 0 || len(r.Header.Get(proxiedHeader)) != 0 {
+		writeError(w, errcode.Errorf(errcode.CodeUnavailable, "no leader to write, try later"))
+		return
+	}
+	n.lk.Lock()
+	proxy, ok := n.proxies[leader.Addr]
+	if !ok {
+		target, _ := url.Parse(leader.Addr)
+		proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+				pr.SetXForwarded()
+				pr.Out.Header.Set(proxiedHeader, n.self)
+			},
+			Transport: n.transport,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				writeError(w, errcode.Errorf(errcode.CodeUnavailable, "proxy to the leader %s: %v", target, err))
+			},
+		}
+		n.proxies[leader.Addr] = proxy
+	}
+	n.lk.Unlock()
+	if _, ok := leaderStreams[r.URL.Path]; ok {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Debugf("replication: clear write deadline of %s: %s", r.URL.Path, err)
+		}
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+func (n *Node) serveReplication(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(n.cnf.Secret)) != 1 {
+		writeError(w, errcode.Errorf(errcode.CodeUnauthenticated, "invalid secret of replication"))
+		return
+	}
+	switch r.URL.Path {
+	case streamPath:
+		n.serveStream(w, r)
+	case usagesPath:
+		var usages []*storage.TokenUsage
+		if err := json.NewDecoder(r.Body).Decode(&usages); err != nil {
+			writeError(w, errcode.WithCode(errcode.CodeInvalidArgument, err))
+			return
+		}
+		if !n.IsLeader() {
+			writeError(w, errcode.Errorf(errcode.CodeUnavailable, "not the leader"))
+			return
+		}
+		if err := n.db.UpdateTokenUsages(usages); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, struct{}{})
+	case statusPath:
+		writeJSON(w, n.Status())
+	default:
+		if handler, ok := n.elector.(http.Handler); ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// serveStream streams the store to a follower until either of them steps down
+func (n *Node) serveStream(w http.ResponseWriter, r *http.Request) {
+	n.lk.Lock()
+	leadCtx := n.leadCtx
+	n.lk.Unlock()
+	leader := n.Leader()
+	if leadCtx == nil || !leader.Self {
+		writeError(w, errcode.Errorf(errcode.CodeUnavailable, "not the leader"))
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer context.AfterFunc(leadCtx, cancel)()
+
+	// the stream lasts longer than the write timeout of server
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debugf("replication: clear write deadline: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	err := n.store.Stream(ctx, func(batch *storage.ReplicaBatch) error {
+		if err := enc.Encode(&streamBatch{Term: leader.Term, ReplicaBatch: batch}); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if ctx.Err() == nil {
+		log.Warnf("replication: stream to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code, ok := errcode.CodeOf(err)
+	if !ok {
+		code = errcode.CodeUnknown
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code.HTTPStatus())
+	_ = json.NewEncoder(w).Encode(&errcode.ErrMsg{Error: err.Error(), Code: code})
+}
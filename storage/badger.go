@@ -1,17 +1,22 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
+	"gorm.io/gorm"
 
 	"github.com/filecoin-project/go-address"
 
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
@@ -19,6 +24,13 @@ var _ Store = &badgerStore{}
 
 type badgerStore struct {
 	db *badger.DB
+	// the transaction all the operations are in, set on the store passed to `Transaction`
+	txn *badger.Txn
+
+	// stops the value log GC, closed by Close
+	stop      chan struct{}
+	gcDone    chan struct{}
+	closeOnce sync.Once
 }
 
 func newBadgerStore(filePath string) (Store, error) {
@@ -26,11 +38,17 @@ func newBadgerStore(filePath string) (Store, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("open db failed :%s", err)
 	}
-	s := &badgerStore{db: db}
+	s := &badgerStore{db: db, stop: make(chan struct{}), gcDone: make(chan struct{})}
 	go func() {
+		defer close(s.gcDone)
 		ticker := time.NewTicker(5 * time.Minute)
 		defer ticker.Stop()
-		for range ticker.C {
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
 		again:
 			err := db.RunValueLogGC(0.7)
 			if err == nil {
@@ -41,6 +59,17 @@ func newBadgerStore(filePath string) (Store, error) {
 	return s, nil
 }
 
+// Close stops the value log GC and closes the db, it's safe to call more than once
+func (s *badgerStore) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.gcDone
+		err = s.db.Close()
+	})
+	return err
+}
+
 func (s *badgerStore) Put(kp *KeyPair) error {
 	return s.putBadgerObj(kp)
 }
@@ -102,6 +131,35 @@ func (s *badgerStore) UpdateToken(kp *KeyPair) error {
 	return s.putBadgerObj(kp)
 }
 
+func (s *badgerStore) UpdateTokenUsages(usages []*TokenUsage) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, usage := range usages {
+			key := tokenKey(usage.Token.String())
+			item, err := txn.Get(key)
+			if err != nil {
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					continue
+				}
+				return err
+			}
+			var kp KeyPair
+			if err = item.Value(func(val []byte) error { return kp.FromBytes(val) }); err != nil {
+				return err
+			}
+			usedTime := usage.Time
+			kp.LastUsedTime, kp.LastUsedIP = &usedTime, usage.IP
+			val, err := kp.Bytes()
+			if err != nil {
+				return err
+			}
+			if err = txn.Set(key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *badgerStore) List(skip, limit int64) ([]*KeyPair, error) {
 	var offset int64
 	var kps []*KeyPair
@@ -190,63 +248,235 @@ func (s *badgerStore) ListUsers(skip, limit int64, state core.UserState) ([]*Use
 	return users, nil
 }
 
-func (s *badgerStore) DeleteUser(name string) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		user := &User{}
-		key := userKey(name)
-		val, err := txn.Get(key)
-		if err != nil {
-			return err
+func (s *badgerStore) HasOrg(name string) (bool, error) {
+	return s.isExist(&Organization{Name: name})
+}
+
+func (s *badgerStore) GetOrg(name string) (*Organization, error) {
+	org := new(Organization)
+	return org, s.getUsableObj(orgKey(name), org)
+}
+
+func (s *badgerStore) PutOrg(org *Organization) error {
+	return s.putBadgerObj(org)
+}
+
+func (s *badgerStore) ListOrgs() ([]*Organization, error) {
+	var orgs []*Organization
+	if err := s.walkThroughPrefix([]byte(PrefixOrg), func(item *badger.Item) (bool, error) {
+		return true, item.Value(func(val []byte) error {
+			org := new(Organization)
+			if err := org.FromBytes(val); err != nil {
+				return err
+			}
+			if !org.isDeleted() {
+				orgs = append(orgs, org)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (s *badgerStore) DeleteOrg(name string) error {
+	return s.softDelObj(&Organization{Name: name})
+}
+
+func (s *badgerStore) ListOrgUsers(org string) ([]*User, error) {
+	users, err := s.ListUsers(0, 0, core.UserStateUndefined)
+	if err != nil {
+		return nil, err
+	}
+	var orgUsers []*User
+	for _, user := range users {
+		if user.Org == org {
+			orgUsers = append(orgUsers, user)
 		}
-		if err := val.Value(func(val []byte) error {
-			return user.FromBytes(val)
-		}); err != nil {
+	}
+	return orgUsers, nil
+}
+
+func (s *badgerStore) GetWebhook(name string) (*Webhook, error) {
+	webhook := new(Webhook)
+	return webhook, s.getObj(webhookKey(name), webhook)
+}
+
+func (s *badgerStore) PutWebhook(webhook *Webhook) error {
+	return s.putBadgerObj(webhook)
+}
+
+func (s *badgerStore) ListWebhooks() ([]*Webhook, error) {
+	var webhooks []*Webhook
+	if err := s.walkThroughPrefix([]byte(PrefixWebhook), func(item *badger.Item) (bool, error) {
+		return true, item.Value(func(val []byte) error {
+			webhook := new(Webhook)
+			if err := webhook.FromBytes(val); err != nil {
+				return err
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *badgerStore) DeleteWebhook(name string) error {
+	return s.update(func(txn *badger.Txn) error {
+		// the deliveries are deleted in txn as well, so they are never left without the webhook
+		tx := &badgerStore{db: s.db, txn: txn}
+		if err := tx.delObj(webhookKey(name)); err != nil {
 			return err
 		}
-		if user.isDeleted() {
-			return xerrors.Errorf("user not exist")
-		}
-		user.setDeleted()
-		data, err := user.Bytes()
+		deliveries, err := tx.filterDeliveries(func(d *WebhookDelivery) bool { return d.Webhook == name })
 		if err != nil {
 			return err
 		}
-		if err := txn.Set(key, data); err != nil {
+		return tx.delDeliveries(deliveries)
+	})
+}
+
+func (s *badgerStore) PutWebhookDeliveries(deliveries []*WebhookDelivery) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, d := range deliveries {
+			if err := putObjInTxn(txn, d); err != nil {
+				return err
+			}
+			var err error
+			if d.State == DeliveryPending {
+				err = txn.Set(pendingDeliveryKey(d.Webhook, d.Id), pendingMark)
+			} else {
+				err = txn.Delete(pendingDeliveryKey(d.Webhook, d.Id))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) ListWebhookDeliveries(webhook, state string, limit int) ([]*WebhookDelivery, error) {
+	deliveries, err := s.filterDeliveries(func(d *WebhookDelivery) bool {
+		return (len(webhook) == 0 || d.Webhook == webhook) && (len(state) == 0 || d.State == state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreateTime.After(deliveries[j].CreateTime)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// ListPendingWebhookDeliveries walks the index of the webhook only, the keys sort as the ids
+func (s *badgerStore) ListPendingWebhookDeliveries(webhook string, limit int) ([]*WebhookDelivery, error) {
+	prefix := []byte(PrefixPending + webhook + ":")
+	var deliveries []*WebhookDelivery
+	err := s.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix) && (limit <= 0 || len(deliveries) < limit); it.Next() {
+			key := it.Item().Key()
+			// ids have no ':', but names of webhooks may have
+			id := string(key[bytes.LastIndexByte(key, ':')+1:])
+			d := new(WebhookDelivery)
+			if err := getObjInTxn(txn, webhookDeliveryKey(id), d); err != nil {
+				return xerrors.Errorf("get pending delivery %s: %w", id, err)
+			}
+			// of another webhook whose name starts with `<webhook>:`
+			if d.Webhook != webhook {
+				continue
+			}
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (s *badgerStore) PruneWebhookDeliveries(before time.Time) (int, error) {
+	deliveries, err := s.filterDeliveries(func(d *WebhookDelivery) bool {
+		return d.State != DeliveryPending && d.UpdateTime.Before(before)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(deliveries), s.delDeliveries(deliveries)
+}
+
+func (s *badgerStore) filterDeliveries(filter func(*WebhookDelivery) bool) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	if err := s.walkThroughPrefix([]byte(PrefixDelivery), func(item *badger.Item) (bool, error) {
+		return true, item.Value(func(val []byte) error {
+			d := new(WebhookDelivery)
+			if err := d.FromBytes(val); err != nil {
+				return err
+			}
+			if filter(d) {
+				deliveries = append(deliveries, d)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *badgerStore) delDeliveries(deliveries []*WebhookDelivery) error {
+	keys := make([][]byte, 0, 2*len(deliveries))
+	for _, d := range deliveries {
+		keys = append(keys, d.key(), pendingDeliveryKey(d.Webhook, d.Id))
+	}
+	return s.delKeys(keys)
+}
+
+func (s *badgerStore) DeleteUser(name string, cascade bool) error {
+	return s.update(func(txn *badger.Txn) error {
+		// the cascade is read and written in txn as well, so it's all or nothing
+		tx := &badgerStore{db: s.db, txn: txn}
+		user := &User{}
+		key := userKey(name)
+		if err := getObjInTxn(txn, key, user); err != nil {
 			return err
 		}
+		if user.isDeleted() {
+			return errcode.Errorf(errcode.CodeNotFound, "user not exist")
+		}
+		user.setDeleted()
+		cascaded := &UserCascade{}
 
 		// delete miners
-		miners, err := s.ListMiners(name)
+		miners, err := tx.ListMiners(name)
 		if err != nil {
 			return err
 		}
 		minerAddrs := make([]address.Address, 0, len(miners))
 		for _, miner := range miners {
-			mKey := minerKey(miner.Miner.Address().String())
-			val, err := txn.Get(mKey)
-			if err != nil {
-				return err
-			}
 			m := &Miner{}
-			if err := val.Value(func(val []byte) error {
-				return m.FromBytes(val)
-			}); err != nil {
+			if err := getObjInTxn(txn, minerKey(miner.Miner.Address().String()), m); err != nil {
 				return err
 			}
 			m.setDeleted()
-			data, err := m.Bytes()
-			if err != nil {
-				return err
-			}
-			if err := txn.Set(mKey, data); err != nil {
+			if err := putObjInTxn(txn, m); err != nil {
 				return err
 			}
 			minerAddrs = append(minerAddrs, miner.Miner.Address())
+			cascaded.Miners = append(cascaded.Miners, miner.Miner.Address().String())
 		}
 
 		// delete signers
 		signerAddrs := make([]address.Address, 0)
-		if err := s.walkThroughPrefix([]byte(PrefixSigner), func(item *badger.Item) (isContinueWalk bool, err error) {
+		if err := tx.walkThroughPrefix([]byte(PrefixSigner), func(item *badger.Item) (isContinueWalk bool, err error) {
 			var signer Signer
 			if err := item.Value(func(val []byte) error {
 				if err := signer.FromBytes(val); err != nil {
@@ -254,10 +484,7 @@ func (s *badgerStore) DeleteUser(name string) error {
 				}
 				if signer.User == name && !signer.isDeleted() {
 					signerAddrs = append(signerAddrs, signer.Signer.Address())
-
-					if err := s.innerUnregisterSigner(signer.Signer.Address(), name); err != nil {
-						return err
-					}
+					cascaded.Signers = append(cascaded.Signers, signer.Signer.Address().String())
 				}
 				return nil
 			}); err != nil {
@@ -267,25 +494,100 @@ func (s *badgerStore) DeleteUser(name string) error {
 		}); err != nil {
 			return err
 		}
+		for _, addr := range signerAddrs {
+			if err := tx.innerUnregisterSigner(addr, name); err != nil {
+				return err
+			}
+		}
 
-		log.Infof("delete user: %s, miners: %v, signer: %v", name, minerAddrs, signerAddrs)
+		// revoke tokens
+		if cascade {
+			kps, err := tx.ByName(name)
+			if err != nil {
+				return err
+			}
+			for _, kp := range kps {
+				kp.setDeleted()
+				if err := putObjInTxn(txn, kp); err != nil {
+					return err
+				}
+				cascaded.Tokens = append(cascaded.Tokens, kp.Token)
+			}
+			user.Cascaded = cascaded
+		}
+		if err := putObjInTxn(txn, user); err != nil {
+			return err
+		}
+
+		log.Infof("delete user: %s, cascade: %v, miners: %v, signer: %v", name, cascade, minerAddrs, signerAddrs)
 		return nil
 	})
 }
 
 func (s *badgerStore) RecoverUser(name string) error {
-	var user User
-	err := s.getObj(userKey(name), &user)
-	if err != nil {
-		return err
-	}
-
-	if user.IsDeleted == core.NotDelete {
-		return xerrors.Errorf("user is not deleted")
-	}
-
-	user.IsDeleted = core.NotDelete
-	return s.putBadgerObj(&user)
+	return s.update(func(txn *badger.Txn) error {
+		var user User
+		if err := getObjInTxn(txn, userKey(name), &user); err != nil {
+			return err
+		}
+		if user.IsDeleted == core.NotDelete {
+			return xerrors.Errorf("user is not deleted")
+		}
+		user.IsDeleted = core.NotDelete
+
+		// records taken by others or purged since deleted are skipped
+		if cascaded := user.Cascaded; cascaded != nil {
+			for _, token := range cascaded.Tokens {
+				var kp KeyPair
+				if err := getObjInTxn(txn, tokenKey(token.String()), &kp); err != nil {
+					if errors.Is(err, badger.ErrKeyNotFound) {
+						continue
+					}
+					return err
+				}
+				if kp.isDeleted() {
+					kp.IsDeleted = core.NotDelete
+					if err := putObjInTxn(txn, &kp); err != nil {
+						return err
+					}
+				}
+			}
+			for _, addr := range cascaded.Miners {
+				var miner Miner
+				if err := getObjInTxn(txn, minerKey(addr), &miner); err != nil {
+					if errors.Is(err, badger.ErrKeyNotFound) {
+						continue
+					}
+					return err
+				}
+				if miner.isDeleted() && miner.User == name {
+					miner.DeletedAt = gorm.DeletedAt{}
+					miner.UpdatedAt = time.Now()
+					if err := putObjInTxn(txn, &miner); err != nil {
+						return err
+					}
+				}
+			}
+			for _, addr := range cascaded.Signers {
+				var signer Signer
+				if err := getObjInTxn(txn, signerForUserKey(addr, name), &signer); err != nil {
+					if errors.Is(err, badger.ErrKeyNotFound) {
+						continue
+					}
+					return err
+				}
+				if signer.isDeleted() {
+					signer.DeletedAt = gorm.DeletedAt{}
+					signer.UpdatedAt = time.Now()
+					if err := putObjInTxn(txn, &signer); err != nil {
+						return err
+					}
+				}
+			}
+			user.Cascaded = nil
+		}
+		return putObjInTxn(txn, &user)
+	})
 }
 
 func (s *badgerStore) GetRateLimits(name, id string) ([]*UserRateLimit, error) {
@@ -328,7 +630,8 @@ func (s *badgerStore) DelRateLimit(name, id string) error {
 	if len(name) == 0 || len(id) == 0 {
 		return errors.New("user and rate-limit id is required for removing rate limit regulation")
 	}
-	mRateLimit, err := s.listRateLimits(name, id)
+	// load all rate limits of user, the others must be kept
+	mRateLimit, err := s.listRateLimits(name, "")
 	if err != nil {
 		return err
 	}
@@ -373,6 +676,10 @@ func (s *badgerStore) getMiner(mAddr address.Address) (*Miner, error) {
 	return &miner, nil
 }
 
+func (s *badgerStore) GetMiner(mAddr address.Address) (*Miner, error) {
+	return s.getMiner(mAddr)
+}
+
 func (s *badgerStore) GetUserByMiner(mAddr address.Address) (*User, error) {
 	miner, err := s.getMiner(mAddr)
 	if err != nil {
@@ -386,11 +693,11 @@ func (s *badgerStore) UpsertMiner(mAddr address.Address, userName string, openMi
 	now := time.Now()
 	var isCreate bool
 	userkey, minerkey := userKey(userName), minerKey(mAddr.String())
-	return isCreate, s.db.Update(func(txn *badger.Txn) error {
+	return isCreate, s.update(func(txn *badger.Txn) error {
 		// this 'get(userKey)' purpose to makesure 'user' exist
 		if _, err := txn.Get(userkey); err != nil {
 			if errors.Is(err, badger.ErrKeyNotFound) {
-				return xerrors.Errorf("can't bind miner:%s to not exist user:%s",
+				return errcode.Errorf(errcode.CodeNotFound, "can't bind miner:%s to not exist user:%s",
 					mAddr.String(), userName)
 			}
 			return xerrors.Errorf("bound miner:%s to user:%s failed, %w",
@@ -490,15 +797,97 @@ func (s *badgerStore) DelMiner(miner address.Address) (bool, error) {
 	return true, nil
 }
 
+func (s *badgerStore) TransferMiner(mAddr address.Address, from, to string) (*Miner, error) {
+	var prev Miner
+	minerkey, toUserKey := minerKey(mAddr.String()), userKey(to)
+	if err := s.update(func(txn *badger.Txn) error {
+		item, err := txn.Get(minerkey)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+			}
+			return err
+		}
+		if err = item.Value(func(val []byte) error { return prev.FromBytes(val) }); err != nil {
+			return err
+		}
+		if prev.isDeleted() {
+			return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+		}
+		if prev.User != from {
+			return errcode.Errorf(errcode.CodeInvalidArgument, "miner:%s not belongs to user:%s", mAddr.String(), from)
+		}
+
+		// this 'get(userKey)' purpose to make sure target 'user' exist
+		item, err = txn.Get(toUserKey)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "can't transfer miner:%s to not exist user:%s", mAddr.String(), to)
+			}
+			return err
+		}
+		var user User
+		if err = item.Value(func(val []byte) error { return user.FromBytes(val) }); err != nil {
+			return err
+		}
+		if user.isDeleted() {
+			return errcode.Errorf(errcode.CodeNotFound, "can't transfer miner:%s to not exist user:%s", mAddr.String(), to)
+		}
+
+		miner := prev
+		miner.User = to
+		miner.UpdatedAt = time.Now()
+		val, err := miner.Bytes()
+		if err != nil {
+			return xerrors.Errorf("get miner object data failed:%w", err)
+		}
+		return txn.Set(minerkey, val)
+	}); err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
+func (s *badgerStore) UpdateMinerLabels(mAddr address.Address, set map[string]string, unset []string) (*Miner, error) {
+	var miner Miner
+	minerkey := minerKey(mAddr.String())
+	if err := s.update(func(txn *badger.Txn) error {
+		item, err := txn.Get(minerkey)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+			}
+			return err
+		}
+		if err = item.Value(func(val []byte) error { return miner.FromBytes(val) }); err != nil {
+			return err
+		}
+		if miner.isDeleted() {
+			return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+		}
+
+		miner.Labels = mergeLabels(miner.Labels, set, unset)
+		miner.UpdatedAt = time.Now()
+		val, err := miner.Bytes()
+		if err != nil {
+			return xerrors.Errorf("get miner object data failed:%w", err)
+		}
+		return txn.Set(minerkey, val)
+	}); err != nil {
+		return nil, err
+	}
+	return &miner, nil
+}
+
 func (s *badgerStore) RegisterSigner(addr address.Address, userName string) error {
 	signer := &Signer{}
 	now := time.Now()
 	userKey, signerForUserKey := userKey(userName), signerForUserKey(addr.String(), userName)
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		// this 'get(userKey)' purpose to make sure 'user' exist
 		if _, err := txn.Get(userKey); err != nil {
 			if errors.Is(err, badger.ErrKeyNotFound) {
-				return xerrors.Errorf("can't bind signer:%s to not exist user:%s",
+				return errcode.Errorf(errcode.CodeNotFound, "can't bind signer:%s to not exist user:%s",
 					addr.String(), userName)
 			}
 			return xerrors.Errorf("bound signer:%s to user:%s failed, %w",
@@ -531,6 +920,80 @@ func (s *badgerStore) RegisterSigner(addr address.Address, userName string) erro
 	})
 }
 
+func (s *badgerStore) UpdateSignerOfUser(addr address.Address, userName string, fn func(*Signer) error) (*Signer, error) {
+	var signer Signer
+	key := signerForUserKey(addr.String(), userName)
+	if err := s.update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "signer:%s not exist in user:%s", addr.String(), userName)
+			}
+			return err
+		}
+		if err = item.Value(func(val []byte) error { return signer.FromBytes(val) }); err != nil {
+			return err
+		}
+		if signer.isDeleted() {
+			return errcode.Errorf(errcode.CodeNotFound, "signer:%s not exist in user:%s", addr.String(), userName)
+		}
+
+		if err := fn(&signer); err != nil {
+			return err
+		}
+		signer.UpdatedAt = time.Now()
+		val, err := signer.Bytes()
+		if err != nil {
+			return xerrors.Errorf("get signer object data failed:%w", err)
+		}
+		return txn.Set(key, val)
+	}); err != nil {
+		return nil, err
+	}
+	return &signer, nil
+}
+
+// PutAddressMapping the mapping is saved under both the address and the ID address
+func (s *badgerStore) PutAddressMapping(addr, idAddr address.Address) error {
+	now := time.Now()
+	mapping := &AddressMapping{Address: storedAddress(addr), IDAddress: storedAddress(idAddr)}
+	return s.update(func(txn *badger.Txn) error {
+		key := addressMappingKey(addr.String())
+		if item, err := txn.Get(key); err == nil {
+			var prev AddressMapping
+			if err = item.Value(func(val []byte) error { return prev.FromBytes(val) }); err != nil {
+				return err
+			}
+			mapping.CreatedAt = prev.CreatedAt
+		} else if errors.Is(err, badger.ErrKeyNotFound) {
+			mapping.CreatedAt = now
+		} else {
+			return err
+		}
+		mapping.UpdatedAt = now
+
+		val, err := mapping.Bytes()
+		if err != nil {
+			return xerrors.Errorf("get address mapping object data failed:%w", err)
+		}
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		return txn.Set(addressMappingKey(idAddr.String()), val)
+	})
+}
+
+func (s *badgerStore) GetAddressMapping(addr address.Address) (*AddressMapping, error) {
+	var mapping AddressMapping
+	if err := s.getObj(addressMappingKey(addr.String()), &mapping); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrAddressMappingNotFound
+		}
+		return nil, err
+	}
+	return &mapping, nil
+}
+
 func (s *badgerStore) SignerExistInUser(addr address.Address, userName string) (bool, error) {
 	signer := &Signer{Signer: storedAddress(addr), User: userName}
 	return s.isExist(signer)
@@ -611,7 +1074,7 @@ func (s *badgerStore) DelSigner(addr address.Address) (bool, error) {
 
 			count++
 
-			return s.db.Update(func(txn *badger.Txn) error {
+			return s.update(func(txn *badger.Txn) error {
 				signer.setDeleted()
 				data, err := signer.Bytes()
 				if err != nil {
@@ -638,6 +1101,10 @@ func (s *badgerStore) GetUserBySigner(addr address.Address) ([]*User, error) {
 			if err := signer.FromBytes(val); err != nil {
 				return err
 			}
+			// skip the unregistered ones, including those of deleted users
+			if signer.isDeleted() {
+				return nil
+			}
 
 			user, err := s.GetUser(signer.User)
 			if err != nil {
@@ -659,3 +1126,85 @@ func (s *badgerStore) GetUserBySigner(addr address.Address) ([]*User, error) {
 
 	return users, nil
 }
+
+func (s *badgerStore) Purge(kinds []string, before time.Time, dryRun bool) (PurgeSummary, error) {
+	purgeKinds := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		purgeKinds[kind] = true
+	}
+	summary := make(PurgeSummary, len(PurgeKinds))
+	for _, kind := range PurgeKinds {
+		summary[kind] = 0
+	}
+	var keys [][]byte
+
+	// users go first, their tokens, miners and signers are purged along
+	users := make(map[string]bool)
+	if purgeKinds[PurgeKindUser] {
+		if err := s.walkThroughPrefix([]byte(PrefixUser), func(item *badger.Item) (isContinueWalk bool, err error) {
+			var user User
+			if err := item.Value(func(val []byte) error { return user.FromBytes(val) }); err != nil {
+				return false, err
+			}
+			if user.isDeleted() && user.UpdateTime.Before(before) {
+				users[user.Name] = true
+				keys = append(keys, item.KeyCopy(nil), rateLimitKey(user.Name))
+				summary[PurgeKindUser]++
+			}
+			return true, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.walkThroughPrefix([]byte(PrefixToken), func(item *badger.Item) (isContinueWalk bool, err error) {
+		var kp KeyPair
+		if err := item.Value(func(val []byte) error { return kp.FromBytes(val) }); err != nil {
+			return false, err
+		}
+		if users[kp.Name] || (purgeKinds[PurgeKindToken] && kp.deletedBefore(before)) {
+			keys = append(keys, item.KeyCopy(nil))
+			summary[PurgeKindToken]++
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.walkThroughPrefix([]byte(PrefixMiner), func(item *badger.Item) (isContinueWalk bool, err error) {
+		var miner Miner
+		if err := item.Value(func(val []byte) error { return miner.FromBytes(val) }); err != nil {
+			return false, err
+		}
+		if users[miner.User] || (purgeKinds[PurgeKindMiner] && miner.isDeleted() && miner.DeletedAt.Time.Before(before)) {
+			keys = append(keys, item.KeyCopy(nil))
+			summary[PurgeKindMiner]++
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.walkThroughPrefix([]byte(PrefixSigner), func(item *badger.Item) (isContinueWalk bool, err error) {
+		var signer Signer
+		if err := item.Value(func(val []byte) error { return signer.FromBytes(val) }); err != nil {
+			return false, err
+		}
+		if users[signer.User] || (purgeKinds[PurgeKindSigner] && signer.isDeleted() && signer.DeletedAt.Time.Before(before)) {
+			keys = append(keys, item.KeyCopy(nil))
+			summary[PurgeKindSigner]++
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(keys) == 0 {
+		return summary, nil
+	}
+	if err := s.delKeys(keys); err != nil {
+		return nil, err
+	}
+	log.Infof("purge records deleted before %s: %v", before.Format(time.RFC3339), summary)
+	return summary, nil
+}
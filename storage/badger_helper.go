@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/filecoin-project/go-address"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/log"
 	"golang.org/x/xerrors"
 )
@@ -20,6 +23,13 @@ const (
 	PrefixReqLimit Prefix = "ReqLimit:"
 	PrefixMiner    Prefix = "MINERS:"
 	PrefixSigner   Prefix = "SIGNERS:"
+	PrefixAddrMap  Prefix = "ADDRMAP:"
+	PrefixOrg      Prefix = "ORG:"
+	PrefixWebhook  Prefix = "WEBHOOK:"
+	PrefixDelivery Prefix = "DELIVERY:"
+	PrefixMeta     Prefix = "META:"
+	// index of the pending deliveries by webhook, `PENDING:<webhook>:<id>`
+	PrefixPending Prefix = "PENDING:"
 )
 
 var storeVersionKey = []byte("StoreVersion")
@@ -44,13 +54,80 @@ func signerKey(signer string) []byte {
 	return []byte(PrefixSigner + signer)
 }
 
+func orgKey(name string) []byte {
+	return []byte(PrefixOrg + name)
+}
+
+func webhookKey(name string) []byte {
+	return []byte(PrefixWebhook + name)
+}
+
+func webhookDeliveryKey(id string) []byte {
+	return []byte(PrefixDelivery + id)
+}
+
+func storeMetaKey(name string) []byte {
+	return []byte(PrefixMeta + name)
+}
+
+// pendingMark the value of the index of pending deliveries, it's not empty since an empty value is replicated as a deletion
+var pendingMark = []byte{1}
+
+func pendingDeliveryKey(webhook, id string) []byte {
+	return []byte(PrefixPending + webhook + ":" + id)
+}
+
+func addressMappingKey(addr string) []byte {
+	return []byte(PrefixAddrMap + addr)
+}
+
 func signerForUserKey(signer, userName string) []byte {
 	return []byte(fmt.Sprintf("%s%s:%s", PrefixSigner, signer, userName))
 }
 
+// update runs fn in the transaction the store is bound to, or in a new one
+func (s *badgerStore) update(fn func(txn *badger.Txn) error) error {
+	if s.txn != nil {
+		return fn(s.txn)
+	}
+	return s.db.Update(fn)
+}
+
+// view runs fn in the transaction the store is bound to, which sees the writes not committed yet, or in a new one
+func (s *badgerStore) view(fn func(txn *badger.Txn) error) error {
+	if s.txn != nil {
+		return fn(s.txn)
+	}
+	return s.db.View(fn)
+}
+
+// delKeys deletes in a batch, since there may be too many keys for a transaction,
+// they are deleted in the transaction the store is bound to if any
+func (s *badgerStore) delKeys(keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if s.txn != nil {
+		for _, key := range keys {
+			if err := s.txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
 // if key not exists, will get a badger.ErrKeyNotFound error.
 func (s *badgerStore) delObj(key []byte) error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		_, err := txn.Get(key)
 		if err != nil {
 			return err
@@ -60,7 +137,7 @@ func (s *badgerStore) delObj(key []byte) error {
 }
 
 func (s *badgerStore) softDelObj(obj softDelete) error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		key := obj.key()
 		val, err := txn.Get(key)
 		if err != nil {
@@ -72,7 +149,7 @@ func (s *badgerStore) softDelObj(obj softDelete) error {
 			return err
 		}
 		if obj.isDeleted() {
-			return xerrors.Errorf("not exist")
+			return errcode.Errorf(errcode.CodeNotFound, "not exist")
 		}
 		obj.setDeleted()
 		data, err := obj.Bytes()
@@ -85,7 +162,7 @@ func (s *badgerStore) softDelObj(obj softDelete) error {
 
 func (s *badgerStore) isExist(obj deleteVerify) (bool, error) {
 	var exist bool
-	err := s.db.View(func(txn *badger.Txn) error {
+	err := s.view(func(txn *badger.Txn) error {
 		key := obj.key()
 		val, err := txn.Get(key)
 		if err != nil {
@@ -117,13 +194,13 @@ func (s *badgerStore) put(key []byte, val iStreamableObj) error {
 	if err != nil {
 		return xerrors.Errorf("failed to marshal time :%s", err)
 	}
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		return txn.Set(key, data)
 	})
 }
 
 func (s *badgerStore) getUsableObj(key []byte, obj deleteVerify) error {
-	return s.db.View(func(txn *badger.Txn) error {
+	return s.view(func(txn *badger.Txn) error {
 		val, err := txn.Get(key)
 		if err != nil {
 			return err
@@ -141,7 +218,7 @@ func (s *badgerStore) getUsableObj(key []byte, obj deleteVerify) error {
 }
 
 func (s *badgerStore) getObj(key []byte, obj iStreamableObj) error {
-	return s.db.View(func(txn *badger.Txn) error {
+	return s.view(func(txn *badger.Txn) error {
 		val, err := txn.Get(key)
 		if err != nil {
 			return err
@@ -152,10 +229,28 @@ func (s *badgerStore) getObj(key []byte, obj iStreamableObj) error {
 	})
 }
 
+func getObjInTxn(txn *badger.Txn, key []byte, obj iStreamableObj) error {
+	val, err := txn.Get(key)
+	if err != nil {
+		return err
+	}
+	return val.Value(func(val []byte) error {
+		return obj.FromBytes(val)
+	})
+}
+
+func putObjInTxn(txn *badger.Txn, obj iBadgerObj) error {
+	data, err := obj.Bytes()
+	if err != nil {
+		return err
+	}
+	return txn.Set(obj.key(), data)
+}
+
 type fWalkCallback func(item *badger.Item) (isContinueWalk bool, err error)
 
 func (s *badgerStore) walkThroughPrefix(prefix []byte, callback fWalkCallback) error {
-	return s.db.View(func(txn *badger.Txn) error {
+	return s.view(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
@@ -171,6 +266,59 @@ func (s *badgerStore) walkThroughPrefix(prefix []byte, callback fWalkCallback) e
 	})
 }
 
+// CheckNetwork the keys of miners and signers contain the network prefix of address,
+// records written under another network are not reachable.
+func (s *badgerStore) CheckNetwork() ([]*WrongNetworkRecord, error) {
+	prefix := core.NetworkPrefix()
+	var records []*WrongNetworkRecord
+	if err := s.walkThroughPrefix([]byte(PrefixMiner), func(item *badger.Item) (isContinueWalk bool, err error) {
+		addr := strings.TrimPrefix(string(item.Key()), PrefixMiner)
+		if strings.HasPrefix(addr, prefix) {
+			return true, nil
+		}
+		var miner Miner
+		if err := item.Value(func(val []byte) error { return miner.FromBytes(val) }); err != nil {
+			return false, xerrors.Errorf("decode miner %s failed: %w", addr, err)
+		}
+		if !miner.isDeleted() {
+			records = append(records, &WrongNetworkRecord{Kind: "miner", User: miner.User, Address: addr})
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.walkThroughPrefix([]byte(PrefixSigner), func(item *badger.Item) (isContinueWalk bool, err error) {
+		key := strings.TrimPrefix(string(item.Key()), PrefixSigner)
+		if strings.HasPrefix(key, prefix) {
+			return true, nil
+		}
+		var signer Signer
+		if err := item.Value(func(val []byte) error { return signer.FromBytes(val) }); err != nil {
+			return false, xerrors.Errorf("decode signer %s failed: %w", key, err)
+		}
+		if !signer.isDeleted() {
+			records = append(records, &WrongNetworkRecord{Kind: "signer", User: signer.User, Address: strings.SplitN(key, ":", 2)[0]})
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Transaction runs 'fn' on a store whose operations are all in one badger transaction, which is committed
+// only if 'fn' returns nil. The writes in it should fit in a transaction, or `badger.ErrTxnTooBig` is returned.
+// A transaction in a transaction joins the outer one.
+func (s *badgerStore) Transaction(fn func(Store) error) error {
+	if s.txn != nil {
+		return fn(s)
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerStore{db: s.db, txn: txn})
+	})
+}
+
 func (s *badgerStore) Version() (uint64, error) {
 	var version StoreVersion
 	err := s.getObj(storeVersionKey, &version)
@@ -183,6 +331,21 @@ func (s *badgerStore) Version() (uint64, error) {
 	return version.Version, nil
 }
 
+func (s *badgerStore) UsageTrackingSince() (time.Time, error) {
+	var meta StoreMeta
+	if err := s.getObj(storeMetaKey(metaUsageTrackingSince), &meta); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, meta.Value)
+}
+
+func (s *badgerStore) SetUsageTrackingSince(since time.Time) error {
+	return s.putBadgerObj(&StoreMeta{Name: metaUsageTrackingSince, Value: since.Format(time.RFC3339Nano)})
+}
+
 func (s *badgerStore) MigrateToV1() error {
 	var users []*struct {
 		Miner, Name string
@@ -191,7 +354,7 @@ func (s *badgerStore) MigrateToV1() error {
 	prefix := []byte(PrefixUser)
 	now := time.Now()
 
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
@@ -235,7 +398,7 @@ func (s *badgerStore) MigrateToV1() error {
 }
 
 func (s *badgerStore) MigrateToV2() error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		for it.Seek([]byte(PrefixMiner)); it.ValidForPrefix([]byte(PrefixMiner)); it.Next() {
@@ -271,7 +434,7 @@ func (s *badgerStore) MigrateToV2() error {
 }
 
 func (s *badgerStore) MigrateToV3() error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		version, err := (&StoreVersion{ID: 1, Version: 3}).Bytes()
 		if err != nil {
 			return err
@@ -279,3 +442,22 @@ func (s *badgerStore) MigrateToV3() error {
 		return txn.Set(storeVersionKey, version)
 	})
 }
+
+// MigrateToV4 records the usages of tokens are tracked from now on, and indexes the pending deliveries of webhooks
+func (s *badgerStore) MigrateToV4() error {
+	pending, err := s.filterDeliveries(func(d *WebhookDelivery) bool { return d.State == DeliveryPending })
+	if err != nil {
+		return err
+	}
+	return s.update(func(txn *badger.Txn) error {
+		for _, d := range pending {
+			if err := txn.Set(pendingDeliveryKey(d.Webhook, d.Id), pendingMark); err != nil {
+				return err
+			}
+		}
+		if err := putObjInTxn(txn, &StoreMeta{Name: metaUsageTrackingSince, Value: time.Now().Format(time.RFC3339Nano)}); err != nil {
+			return err
+		}
+		return putObjInTxn(txn, &StoreVersion{ID: 1, Version: 4})
+	})
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// mysql error number of duplicate entry for key
+const mysqlErrDupEntry = 1062
+
+// IsNotFound returns true if err is caused by a record not found in store
+func IsNotFound(err error) bool {
+	return errors.Is(err, badger.ErrKeyNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// IsAlreadyExists returns true if err is caused by a record conflicting with an existing one
+func IsAlreadyExists(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlErrDupEntry
+}
+
+// IsUnavailable returns true if err is caused by the store out of service, eg. the connection to mysql is lost
+func IsUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, badger.ErrDBClosed) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) || errors.As(err, &netErr)
+}
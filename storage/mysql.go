@@ -3,6 +3,8 @@ package storage
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
@@ -62,7 +65,8 @@ func newMySQLStore(cnf *config.DBConfig) (Store, error) {
 		}
 	}
 
-	if err = session.AutoMigrate(&KeyPair{}, &User{}, &Signer{}, &UserRateLimit{}, &StoreVersion{}); err != nil {
+	if err = session.AutoMigrate(&KeyPair{}, &User{}, &Signer{}, &UserRateLimit{}, &StoreVersion{}, &AddressMapping{}, &Organization{},
+		&Webhook{}, &WebhookDelivery{}, &StoreMeta{}); err != nil {
 		return nil, err
 	}
 
@@ -94,7 +98,11 @@ func (s mysqlStore) Delete(token Token) error {
 	if !has {
 		return gorm.ErrRecordNotFound
 	}
-	return s.db.Table("token").Where("token=?", token.String()).Update("is_deleted", core.Deleted).Error
+	columns := map[string]interface{}{
+		"is_deleted":  core.Deleted,
+		"delete_time": time.Now(),
+	}
+	return s.db.Table("token").Where("token=?", token.String()).UpdateColumns(columns).Error
 }
 
 func (s mysqlStore) Recover(token Token) error {
@@ -158,6 +166,21 @@ func (s *mysqlStore) UpdateToken(kp *KeyPair) error {
 	return s.db.Table("token").Where("token = ?", kp.Token.String()).UpdateColumns(columns).Error
 }
 
+func (s *mysqlStore) UpdateTokenUsages(usages []*TokenUsage) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, usage := range usages {
+			columns := map[string]interface{}{
+				"last_used_time": usage.Time,
+				"last_used_ip":   usage.IP,
+			}
+			if err := tx.Table("token").Where("token = ?", usage.Token.String()).UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s mysqlStore) HasUser(name string) (bool, error) {
 	var count int64
 	err := s.db.Table("users").Where("name=? and is_deleted=?", name, core.NotDelete).Count(&count).Error
@@ -211,7 +234,124 @@ func (s *mysqlStore) VerifyUsers(names []string) error {
 	return nil
 }
 
-func (s *mysqlStore) DeleteUser(userName string) error {
+func (s mysqlStore) HasOrg(name string) (bool, error) {
+	var count int64
+	err := s.db.Table("orgs").Where("name=? and is_deleted=?", name, core.NotDelete).Count(&count).Error
+
+	return count > 0, err
+}
+
+func (s *mysqlStore) GetOrg(name string) (*Organization, error) {
+	var org Organization
+	err := s.db.Table("orgs").Take(&org, "name=? and is_deleted=?", name, core.NotDelete).Error
+
+	return &org, err
+}
+
+func (s *mysqlStore) PutOrg(org *Organization) error {
+	return s.db.Table("orgs").Save(org).Error
+}
+
+func (s *mysqlStore) ListOrgs() ([]*Organization, error) {
+	orgs := make([]*Organization, 0)
+	err := s.db.Table("orgs").Where("is_deleted=?", core.NotDelete).Order("createTime").Find(&orgs).Error
+
+	return orgs, err
+}
+
+func (s *mysqlStore) DeleteOrg(name string) error {
+	db := s.db.Table("orgs").Where("name=? and is_deleted=?", name, core.NotDelete).
+		Updates(map[string]interface{}{"is_deleted": core.Deleted, "updateTime": time.Now()})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) ListOrgUsers(org string) ([]*User, error) {
+	users := make([]*User, 0)
+	err := s.db.Table("users").Where("org=? and is_deleted=?", org, core.NotDelete).Order("createTime").Find(&users).Error
+
+	return users, err
+}
+
+func (s *mysqlStore) GetWebhook(name string) (*Webhook, error) {
+	var webhook Webhook
+	err := s.db.Table("webhooks").Take(&webhook, "name=?", name).Error
+
+	return &webhook, err
+}
+
+func (s *mysqlStore) PutWebhook(webhook *Webhook) error {
+	return s.db.Table("webhooks").Save(webhook).Error
+}
+
+func (s *mysqlStore) ListWebhooks() ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+	err := s.db.Table("webhooks").Order("name").Find(&webhooks).Error
+
+	return webhooks, err
+}
+
+func (s *mysqlStore) DeleteWebhook(name string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		db := tx.Table("webhooks").Where("name=?", name).Delete(&Webhook{})
+		if db.Error != nil {
+			return db.Error
+		}
+		if db.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Table("webhook_deliveries").Where("webhook=?", name).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+func (s *mysqlStore) PutWebhookDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.db.Table("webhook_deliveries").Save(deliveries).Error
+}
+
+func (s *mysqlStore) ListWebhookDeliveries(webhook, state string, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	db := s.db.Table("webhook_deliveries")
+	if len(webhook) != 0 {
+		db = db.Where("webhook=?", webhook)
+	}
+	if len(state) != 0 {
+		db = db.Where("state=?", state)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Order("createTime desc").Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (s *mysqlStore) ListPendingWebhookDeliveries(webhook string, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	db := s.db.Table("webhook_deliveries").Where("webhook=? and state=?", webhook, DeliveryPending)
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Order("id").Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (s *mysqlStore) PruneWebhookDeliveries(before time.Time) (int, error) {
+	db := s.db.Table("webhook_deliveries").Where("state<>? and updateTime<?", DeliveryPending, before).
+		Delete(&WebhookDelivery{})
+
+	return int(db.RowsAffected), db.Error
+}
+
+func (s *mysqlStore) DeleteUser(userName string, cascade bool) error {
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		user, err := s.innerGetUser(tx, userName)
 		if err != nil {
@@ -220,6 +360,7 @@ func (s *mysqlStore) DeleteUser(userName string) error {
 
 		user.IsDeleted = core.Deleted
 		user.UpdateTime = time.Now()
+		cascaded := &UserCascade{}
 
 		miners, err := s.innerListMiners(tx, userName)
 		if err != nil {
@@ -233,8 +374,18 @@ func (s *mysqlStore) DeleteUser(userName string) error {
 				return err
 			}
 			minerAddrs = append(minerAddrs, miner.Miner.Address())
+			cascaded.Miners = append(cascaded.Miners, miner.Miner.Address().String())
 		}
 
+		if cascade {
+			var signers []*Signer
+			if err := tx.Model((*Signer)(nil)).Find(&signers, "`user` = ?", userName).Error; err != nil {
+				return err
+			}
+			for _, signer := range signers {
+				cascaded.Signers = append(cascaded.Signers, signer.Signer.Address().String())
+			}
+		}
 		// delete signer of user
 		counts, err := s.innerDelSignerOfUser(tx, user.Name)
 		if err != nil {
@@ -242,11 +393,31 @@ func (s *mysqlStore) DeleteUser(userName string) error {
 		}
 		log.Infof("delete %v signers of %s", counts, userName)
 
+		// revoke tokens
+		if cascade {
+			var tokens []*KeyPair
+			if err := tx.Find(&tokens, "name = ? and is_deleted=?", userName, core.NotDelete).Error; err != nil {
+				return err
+			}
+			for _, token := range tokens {
+				cascaded.Tokens = append(cascaded.Tokens, token.Token)
+			}
+			columns := map[string]interface{}{
+				"is_deleted":  core.Deleted,
+				"delete_time": time.Now(),
+			}
+			if err := tx.Table("token").Where("name = ? and is_deleted=?", userName, core.NotDelete).
+				UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+			user.Cascaded = cascaded
+		}
+
 		if err := s.innerUpdateUser(tx, user); err != nil {
 			return err
 		}
 
-		log.Infof("delete user %s, delete miners %v", userName, minerAddrs)
+		log.Infof("delete user %s, cascade: %v, delete miners %v", userName, cascade, minerAddrs)
 		return nil
 	})
 
@@ -254,14 +425,64 @@ func (s *mysqlStore) DeleteUser(userName string) error {
 }
 
 func (s *mysqlStore) RecoverUser(userName string) error {
-	var user User
-	err := s.db.Table("users").Take(&user, "name=? and is_deleted=?", userName, core.Deleted).Error
-	if err != nil {
-		return err
-	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user User
+		err := tx.Table("users").Take(&user, "name=? and is_deleted=?", userName, core.Deleted).Error
+		if err != nil {
+			return err
+		}
+
+		user.IsDeleted = core.NotDelete
+		// records taken by others or purged since deleted are skipped
+		if cascaded := user.Cascaded; cascaded != nil {
+			if len(cascaded.Tokens) != 0 {
+				tokens := make([]string, 0, len(cascaded.Tokens))
+				for _, token := range cascaded.Tokens {
+					tokens = append(tokens, token.String())
+				}
+				if err := tx.Table("token").Where("token IN ? AND is_deleted=?", tokens, core.Deleted).
+					Update("is_deleted", core.NotDelete).Error; err != nil {
+					return err
+				}
+			}
+			detached := []struct {
+				model  interface{}
+				column string
+				addrs  []string
+			}{
+				{&Miner{}, "miner", cascaded.Miners},
+				{&Signer{}, "signer", cascaded.Signers},
+			}
+			for _, d := range detached {
+				if len(d.addrs) == 0 {
+					continue
+				}
+				stored, err := parseStoredAddresses(d.addrs)
+				if err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Model(d.model).
+					Where(fmt.Sprintf("`%s` IN ? AND `user` = ? AND deleted_at IS NOT NULL", d.column), stored, userName).
+					Update("deleted_at", nil).Error; err != nil {
+					return err
+				}
+			}
+			user.Cascaded = nil
+		}
+		return s.innerUpdateUser(tx, &user)
+	})
+}
 
-	user.IsDeleted = core.NotDelete
-	return s.innerUpdateUser(s.db, &user)
+func parseStoredAddresses(addrs []string) ([]storedAddress, error) {
+	stored := make([]storedAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		a, err := address.NewFromString(addr)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, storedAddress(a))
+	}
+	return stored, nil
 }
 
 func (s *mysqlStore) GetRateLimits(name string, id string) ([]*UserRateLimit, error) {
@@ -301,6 +522,14 @@ func (s *mysqlStore) GetUserByMiner(miner address.Address) (*User, error) {
 	return &user, nil
 }
 
+func (s *mysqlStore) GetMiner(mAddr address.Address) (*Miner, error) {
+	var miner Miner
+	if err := s.db.Take(&miner, "miner = ?", storedAddress(mAddr)).Error; err != nil {
+		return nil, err
+	}
+	return &miner, nil
+}
+
 func (s *mysqlStore) UpsertMiner(mAddr address.Address, userName string, openMining *bool) (bool, error) {
 	var isCreate bool
 	stoMiner := storedAddress(mAddr)
@@ -308,7 +537,7 @@ func (s *mysqlStore) UpsertMiner(mAddr address.Address, userName string, openMin
 		var user User
 		if err := tx.Model(&user).First(&user, "name = ?", userName).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return xerrors.Errorf("can't bind miner:%s to not exist user:%s", mAddr.String(), userName)
+				return errcode.Errorf(errcode.CodeNotFound, "can't bind miner:%s to not exist user:%s", mAddr.String(), userName)
 			}
 			return xerrors.Errorf("bind miner:%s to user:%s failed:%w", mAddr.String(), userName, err)
 		}
@@ -318,9 +547,10 @@ func (s *mysqlStore) UpsertMiner(mAddr address.Address, userName string, openMin
 		}
 		// 声明了默认值的字段, 通过结构体更新数据库时gorm库会忽略零值: 0, nil, "", false 等. 可以用map或把字段定义为指针方式避免
 		isCreate = count == 0
+		// labels are managed by `UpdateMinerLabels`, keep them untouched
 		return tx.Model(&Miner{}).
 			Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "miner"}},
-				UpdateAll: true,
+				DoUpdates: clause.AssignmentColumns([]string{"user", "open_mining", "updated_at", "deleted_at"}),
 			}).
 			Create(&Miner{Miner: stoMiner, User: user.Name, OpenMining: openMining}).Error
 	}, &sql.TxOptions{Isolation: sql.LevelDefault, ReadOnly: false})
@@ -366,25 +596,112 @@ func (s *mysqlStore) innerListMiners(tx *gorm.DB, user string) ([]*Miner, error)
 	return miners, nil
 }
 
+func (s *mysqlStore) UpdateMinerLabels(mAddr address.Address, set map[string]string, unset []string) (*Miner, error) {
+	var miner Miner
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&miner, "miner = ?", storedAddress(mAddr)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+			}
+			return err
+		}
+
+		miner.Labels = mergeLabels(miner.Labels, set, unset)
+		return tx.Model(&Miner{}).Where("id = ?", miner.ID).Update("labels", miner.Labels).Error
+	}); err != nil {
+		return nil, err
+	}
+	return &miner, nil
+}
+
+func (s *mysqlStore) TransferMiner(mAddr address.Address, from, to string) (*Miner, error) {
+	var prev Miner
+	stoMiner := storedAddress(mAddr)
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&prev, "miner = ?", stoMiner).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "miner:%s not exist", mAddr.String())
+			}
+			return err
+		}
+		if prev.User != from {
+			return errcode.Errorf(errcode.CodeInvalidArgument, "miner:%s not belongs to user:%s", mAddr.String(), from)
+		}
+		if _, err := s.innerGetUser(tx, to); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "can't transfer miner:%s to not exist user:%s", mAddr.String(), to)
+			}
+			return err
+		}
+		return tx.Model(&Miner{}).Where("id = ?", prev.ID).Update("user", to).Error
+	}, &sql.TxOptions{Isolation: sql.LevelDefault, ReadOnly: false}); err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
 func (s *mysqlStore) RegisterSigner(addr address.Address, userName string) error {
 	storedSigner := storedAddress(addr)
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		var user User
 		if err := tx.Model(&user).First(&user, "`name` = ?", userName).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return xerrors.Errorf("can't bind signer:%s to not exist user:%s", addr.String(), userName)
+				return errcode.Errorf(errcode.CodeNotFound, "can't bind signer:%s to not exist user:%s", addr.String(), userName)
 			}
 			return xerrors.Errorf("bind signer:%s to user:%s failed:%w", addr.String(), userName, err)
 		}
+		// created_at will not be updated, policy and spent are managed by `UpdateSignerOfUser`
 		return tx.Model(&Signer{}).
 			Clauses(clause.OnConflict{
 				Columns:   []clause.Column{{Name: "signer"}, {Name: "user"}},
-				UpdateAll: true, // created_at will not be updated
+				DoUpdates: clause.AssignmentColumns([]string{"updated_at", "deleted_at"}),
 			}).
 			Create(&Signer{Signer: storedSigner, User: user.Name}).Error
 	}, &sql.TxOptions{Isolation: sql.LevelDefault, ReadOnly: false})
 }
 
+func (s *mysqlStore) UpdateSignerOfUser(addr address.Address, userName string, fn func(*Signer) error) (*Signer, error) {
+	var signer Signer
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&signer, "`signer` = ? AND `user` = ?", storedAddress(addr), userName).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errcode.Errorf(errcode.CodeNotFound, "signer:%s not exist in user:%s", addr.String(), userName)
+			}
+			return err
+		}
+
+		if err := fn(&signer); err != nil {
+			return err
+		}
+		return tx.Model(&Signer{}).Where("id = ?", signer.ID).
+			Updates(map[string]interface{}{"policy": signer.Policy, "spent": signer.Spent}).Error
+	}); err != nil {
+		return nil, err
+	}
+	return &signer, nil
+}
+
+func (s *mysqlStore) PutAddressMapping(addr, idAddr address.Address) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"id_address", "updated_at"}),
+	}).Create(&AddressMapping{Address: storedAddress(addr), IDAddress: storedAddress(idAddr)}).Error
+}
+
+func (s *mysqlStore) GetAddressMapping(addr address.Address) (*AddressMapping, error) {
+	var mapping AddressMapping
+	if err := s.db.Take(&mapping, "`address` = ? OR `id_address` = ?", storedAddress(addr), storedAddress(addr)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAddressMappingNotFound
+		}
+		return nil, err
+	}
+	return &mapping, nil
+}
+
 func (s mysqlStore) SignerExistInUser(addr address.Address, userName string) (bool, error) {
 	var count int64
 	if err := s.db.Table("signers").Where("`signer` = ? AND `user` = ? AND deleted_at IS NULL", storedAddress(addr), userName).Count(&count).Error; err != nil {
@@ -446,6 +763,131 @@ func (s *mysqlStore) innerDelSignerOfUser(tx *gorm.DB, userName string) (int64,
 	return db.RowsAffected, db.Error
 }
 
+// CheckNetwork addresses are stored without network prefix in mysql,
+// rows with a prefix were written by others and can't be decoded.
+func (s *mysqlStore) CheckNetwork() ([]*WrongNetworkRecord, error) {
+	var records []*WrongNetworkRecord
+	for _, kind := range []string{"miner", "signer"} {
+		table := kind + "s"
+		var rows []struct {
+			Address string
+			User    string
+		}
+		if err := s.db.Table(table).Select(fmt.Sprintf("`%s` AS address, `user`", kind)).
+			Where(fmt.Sprintf("`%s` NOT REGEXP '^[0-9]' AND deleted_at IS NULL", kind)).
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			records = append(records, &WrongNetworkRecord{Kind: kind, User: row.User, Address: row.Address})
+		}
+	}
+	return records, nil
+}
+
+func (s *mysqlStore) Purge(kinds []string, before time.Time, dryRun bool) (PurgeSummary, error) {
+	purgeKinds := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		purgeKinds[kind] = true
+	}
+	summary := make(PurgeSummary, len(PurgeKinds))
+	for _, kind := range PurgeKinds {
+		summary[kind] = 0
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// users go first, their tokens, miners and signers are purged along
+		var users []string
+		if purgeKinds[PurgeKindUser] {
+			if err := tx.Table("users").Where("is_deleted = ? AND updateTime < ?", core.Deleted, before).
+				Pluck("name", &users).Error; err != nil {
+				return err
+			}
+		}
+
+		purges := []struct {
+			kind  string
+			model interface{}
+			cond  string
+			args  []interface{}
+			owner string
+		}{
+			{PurgeKindToken, &KeyPair{}, "is_deleted = ? AND (delete_time < ? OR (delete_time IS NULL AND createTime < ?))",
+				[]interface{}{core.Deleted, before, before}, "name"},
+			{PurgeKindMiner, &Miner{}, "deleted_at < ?", []interface{}{before}, "user"},
+			{PurgeKindSigner, &Signer{}, "deleted_at < ?", []interface{}{before}, "user"},
+		}
+		for _, purge := range purges {
+			var conds []string
+			var args []interface{}
+			if purgeKinds[purge.kind] {
+				conds = append(conds, purge.cond)
+				args = append(args, purge.args...)
+			}
+			if len(users) != 0 {
+				conds = append(conds, fmt.Sprintf("`%s` IN ?", purge.owner))
+				args = append(args, users)
+			}
+			count, err := s.innerPurge(tx, purge.model, dryRun, conds, args)
+			if err != nil {
+				return err
+			}
+			summary[purge.kind] = count
+		}
+
+		if len(users) == 0 {
+			return nil
+		}
+		if !dryRun {
+			if err := tx.Where("name IN ?", users).Delete(&UserRateLimit{}).Error; err != nil {
+				return err
+			}
+		}
+		count, err := s.innerPurge(tx, &User{}, dryRun, []string{"name IN ?"}, []interface{}{users})
+		if err != nil {
+			return err
+		}
+		summary[PurgeKindUser] = count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		log.Infof("purge records deleted before %s: %v", before.Format(time.RFC3339), summary)
+	}
+	return summary, nil
+}
+
+// innerPurge counts the rows of 'model' matching any of 'conds' if 'dryRun', otherwise deletes them
+func (s *mysqlStore) innerPurge(tx *gorm.DB, model interface{}, dryRun bool, conds []string, args []interface{}) (int, error) {
+	if len(conds) == 0 {
+		return 0, nil
+	}
+	query := strings.Join(conds, " OR ")
+	if dryRun {
+		var count int64
+		err := tx.Unscoped().Model(model).Where(query, args...).Count(&count).Error
+		return int(count), err
+	}
+	res := tx.Unscoped().Where(query, args...).Delete(model)
+	return int(res.RowsAffected), res.Error
+}
+
+// Close closes the connections to the database
+func (s *mysqlStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func (s *mysqlStore) Transaction(fn func(Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&mysqlStore{db: tx})
+	})
+}
+
 func (s *mysqlStore) Version() (uint64, error) {
 	var v StoreVersion
 	if err := s.db.Model(&StoreVersion{}).First(&v).Error; err != nil {
@@ -457,6 +899,23 @@ func (s *mysqlStore) Version() (uint64, error) {
 	return v.Version, nil
 }
 
+func (s *mysqlStore) UsageTrackingSince() (time.Time, error) {
+	var meta StoreMeta
+	if err := s.db.Table("store_metas").Where("name=?", metaUsageTrackingSince).Take(&meta).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, meta.Value)
+}
+
+func (s *mysqlStore) SetUsageTrackingSince(since time.Time) error {
+	return s.db.Table("store_metas").
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&StoreMeta{Name: metaUsageTrackingSince, Value: since.Format(time.RFC3339Nano)}).Error
+}
+
 func (s *mysqlStore) MigrateToV1() error {
 	arr := make([]*struct {
 		User  string `gorm:"column:name"`
@@ -526,3 +985,17 @@ func (s *mysqlStore) MigrateToV3() error {
 			Create(&StoreVersion{ID: 1, Version: 3}).Error
 	})
 }
+
+// MigrateToV4 records the usages of tokens are tracked from now on
+func (s *mysqlStore) MigrateToV4() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("store_metas").
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&StoreMeta{Name: metaUsageTrackingSince, Value: time.Now().Format(time.RFC3339Nano)}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&StoreVersion{}).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&StoreVersion{ID: 1, Version: 4}).Error
+	})
+}
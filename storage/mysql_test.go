@@ -4,6 +4,7 @@ package storage
 import (
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"regexp"
 	"testing"
@@ -63,6 +64,7 @@ func TestMysqlStore(t *testing.T) {
 	t.Run("mysql put token", wrapper(testMySQLPutToken, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_UPDATE_TOKEN_001, @VENUSAUTH_MYSQL_UPDATE_TOKEN_002
 	t.Run("mysql update token", wrapper(testMySQLUpdateToken, mySQLStore, mock))
+	t.Run("mysql update token usages", wrapper(testMySQLUpdateTokenUsages, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_HAS_001
 	t.Run("mysql has token", wrapper(testMySQLHasToken, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_GET_001, @VENUSAUTH_MYSQL_HAS_002
@@ -91,6 +93,18 @@ func TestMysqlStore(t *testing.T) {
 	t.Run("mysql list users", wrapper(testMySQLListUsers, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_DELETE_USER_001
 	t.Run("mysql delete user", wrapper(testMySQLDeleteUser, mySQLStore, mock))
+	t.Run("mysql cascade delete user", wrapper(testMySQLCascadeDeleteUser, mySQLStore, mock))
+	t.Run("mysql recover user", wrapper(testMySQLRecoverUser, mySQLStore, mock))
+
+	// Organization
+	t.Run("mysql get org", wrapper(testMySQLGetOrg, mySQLStore, mock))
+	t.Run("mysql delete org", wrapper(testMySQLDeleteOrg, mySQLStore, mock))
+	t.Run("mysql list org users", wrapper(testMySQLListOrgUsers, mySQLStore, mock))
+
+	// Webhook
+	t.Run("mysql delete webhook", wrapper(testMySQLDeleteWebhook, mySQLStore, mock))
+	t.Run("mysql list pending webhook deliveries", wrapper(testMySQLListPendingWebhookDeliveries, mySQLStore, mock))
+	t.Run("mysql prune webhook deliveries", wrapper(testMySQLPruneWebhookDeliveries, mySQLStore, mock))
 
 	// Rate limit
 	// stm: @VENUSAUTH_MYSQL_GET_RATE_LIMITS_001
@@ -106,12 +120,15 @@ func TestMysqlStore(t *testing.T) {
 	t.Run("mysql miner exist in user", wrapper(testMySQLMinerExistInUser, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_GET_USER_BY_MINER_001
 	t.Run("mysql get user by miner", wrapper(testMySQLGetUserByMiner, mySQLStore, mock))
+	t.Run("mysql get miner", wrapper(testMySQLGetMiner, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_LIST_MINERS_001, @VENUSAUTH_MYSQL_INNER_LIST_MINERS_001
 	t.Run("mysql list miners", wrapper(testMySQLListMiner, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_DEL_MINER_001, @VENUSAUTH_MYSQL_INNER_DEL_MINER_001
 	t.Run("mysql delete miner", wrapper(testMySQLDeleteMiner, mySQLStore, mock))
 	// stm: @VENUSAUTH_MYSQL_UPSERT_MINER_001
 	t.Run("mysql upsert miner", wrapper(testMySQLUpsertMiner, mySQLStore, mock))
+	t.Run("mysql transfer miner", wrapper(testMySQLTransferMiner, mySQLStore, mock))
+	t.Run("mysql update miner labels", wrapper(testMySQLUpdateMinerLabels, mySQLStore, mock))
 
 	// Signer
 	t.Run("mysql register signer", wrapper(testMySQLRegisterSigner, mySQLStore, mock))
@@ -119,12 +136,21 @@ func TestMysqlStore(t *testing.T) {
 	t.Run("mysql list signers", wrapper(testMySQLListSigner, mySQLStore, mock))
 	t.Run("mysql has signer", wrapper(testMySQLHasSigner, mySQLStore, mock))
 	t.Run("mysql get user by signer", wrapper(testMySQLGetUserBySigner, mySQLStore, mock))
+	t.Run("mysql update signer of user", wrapper(testMySQLUpdateSignerOfUser, mySQLStore, mock))
 	t.Run("mysql unregister signer", wrapper(testMySQLUnregisterSigner, mySQLStore, mock))
 	t.Run("mysql delete signer", wrapper(testMySQLDeleteSigner, mySQLStore, mock))
 
+	t.Run("mysql transaction", wrapper(testMySQLTransaction, mySQLStore, mock))
+	t.Run("mysql check network", wrapper(testMySQLCheckNetwork, mySQLStore, mock))
+	t.Run("mysql purge", wrapper(testMySQLPurge, mySQLStore, mock))
+	t.Run("mysql put address mapping", wrapper(testMySQLPutAddressMapping, mySQLStore, mock))
+	t.Run("mysql get address mapping", wrapper(testMySQLGetAddressMapping, mySQLStore, mock))
+
 	// Version
 	t.Run("mysql get version", wrapper(testMySQLVersion, mySQLStore, mock))
 	t.Run("mysql migrate to v1", wrapper(testMySQLMigrateToV1, mySQLStore, mock))
+	t.Run("mysql migrate to v4", wrapper(testMySQLMigrateToV4, mySQLStore, mock))
+	t.Run("mysql usage tracking since", wrapper(testMySQLUsageTrackingSince, mySQLStore, mock))
 
 	if err = mysqlShutdown(mock, sqlDB); err != nil {
 		t.Fatal(err)
@@ -144,8 +170,8 @@ func testMySQLPutToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmoc
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO `token` (`name`,`perm`,`secret`,`extra`,`token`,`createTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)")).
-		WithArgs(kp.Name, kp.Perm, kp.Secret, kp.Extra, kp.Token, kp.CreateTime, kp.IsDeleted).
+		"INSERT INTO `token` (`name`,`perm`,`secret`,`extra`,`token`,`createTime`,`is_deleted`,`description`,`labels`,`last_used_time`,`last_used_ip`,`delete_time`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)")).
+		WithArgs(kp.Name, kp.Perm, kp.Secret, kp.Extra, kp.Token, kp.CreateTime, kp.IsDeleted, kp.Description, nil, nil, kp.LastUsedIP, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -175,6 +201,30 @@ func testMySQLUpdateToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 	assert.Error(t, mySQLStore.UpdateToken(kp))
 }
 
+func testMySQLUpdateTokenUsages(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	usages := []*TokenUsage{
+		{Token: "test_token_001", Time: time.Now(), IP: "127.0.0.1"},
+		{Token: "test_token_002", Time: time.Now(), IP: "127.0.0.2"},
+	}
+	sql := "UPDATE `token` SET `last_used_ip`=?,`last_used_time`=? WHERE token = ?"
+
+	mock.ExpectBegin()
+	for _, usage := range usages {
+		mock.ExpectExec(regexp.QuoteMeta(sql)).
+			WithArgs(usage.IP, usage.Time, usage.Token).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+	assert.Nil(t, mySQLStore.UpdateTokenUsages(usages))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).
+		WithArgs(usages[0].IP, usages[0].Time, usages[0].Token).
+		WillReturnError(errSimulated)
+	mock.ExpectRollback()
+	assert.Error(t, mySQLStore.UpdateTokenUsages(usages))
+}
+
 func testMySQLHasToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
 	token := Token("test_token")
 
@@ -259,8 +309,8 @@ func testMySQLDeleteToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `token` SET `is_deleted`=? WHERE token=?")).
-		WithArgs(core.Deleted, token).
+		"UPDATE `token` SET `delete_time`=?,`is_deleted`=? WHERE token=?")).
+		WithArgs(anyTime{}, core.Deleted, token).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -320,13 +370,13 @@ func testMySQLPutUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock
 		CreateTime: now,
 	}
 
-	sql := "INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)"
+	sql := "INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`,`org`,`org_admin`,`cascaded`) VALUES (?,?,?,?,?,?,?,?,?,?)"
 	sqlMockExpect(mock, sql, false,
-		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted)
+		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Org, user.OrgAdmin, nil)
 	assert.Nil(t, mySQLStore.PutUser(user))
 
 	sqlMockExpect(mock, sql, true,
-		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted)
+		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Org, user.OrgAdmin, nil)
 	assert.Error(t, mySQLStore.PutUser(user))
 }
 
@@ -340,15 +390,15 @@ func testMySQLUpdateUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlm
 		IsDeleted:  core.NotDelete,
 	}
 
-	sql := "UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=? WHERE `id` = ?"
+	sql := "UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=?,`org`=?,`org_admin`=?,`cascaded`=? WHERE `id` = ?"
 
 	sqlMockExpect(mock, sql, false,
-		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Id)
+		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Org, user.OrgAdmin, nil, user.Id)
 	err := mySQLStore.UpdateUser(user)
 	assert.Nil(t, err)
 
 	sqlMockExpect(mock, sql, true,
-		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Id)
+		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Org, user.OrgAdmin, nil, user.Id)
 	err = mySQLStore.UpdateUser(user)
 	assert.Error(t, err)
 }
@@ -431,14 +481,229 @@ func testMySQLDeleteUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlm
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec(regexp.QuoteMeta(""+
-		"INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)")).
-		WithArgs("", user, "", 0, anyTime{}, anyTime{}, 1).
+		"INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`,`org`,`org_admin`,`cascaded`) VALUES (?,?,?,?,?,?,?,?,?,?)")).
+		WithArgs("", user, "", 0, anyTime{}, anyTime{}, 1, "", false, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
 
-	err := mySQLStore.DeleteUser(user)
+	err := mySQLStore.DeleteUser(user, false)
+	assert.Nil(t, err)
+}
+
+func testMySQLPurge(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	before := time.Now().Add(-time.Hour)
+	user := "test_user_001"
+
+	// dry run counts deleted tokens only
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT count(*) FROM `token` WHERE is_deleted = ? AND (delete_time < ? OR (delete_time IS NULL AND createTime < ?))")).
+		WithArgs(core.Deleted, before, before).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectCommit()
+	summary, err := mySQLStore.Purge([]string{PurgeKindToken}, before, true)
+	assert.Nil(t, err)
+	assert.Equal(t, PurgeSummary{PurgeKindToken: 2, PurgeKindUser: 0, PurgeKindMiner: 0, PurgeKindSigner: 0}, summary)
+
+	// purged users take their tokens, miners and signers along
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT `name` FROM `users` WHERE is_deleted = ? AND updateTime < ?")).
+		WithArgs(core.Deleted, before).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(user))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `token` WHERE `name` IN (?)")).
+		WithArgs(user).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `miners` WHERE deleted_at < ? OR `user` IN (?)")).
+		WithArgs(before, user).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `signers` WHERE `user` IN (?)")).
+		WithArgs(user).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `user_rate_limits` WHERE name IN (?)")).
+		WithArgs(user).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `users` WHERE name IN (?)")).
+		WithArgs(user).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	summary, err = mySQLStore.Purge([]string{PurgeKindUser, PurgeKindMiner}, before, false)
+	assert.Nil(t, err)
+	assert.Equal(t, PurgeSummary{PurgeKindToken: 1, PurgeKindUser: 1, PurgeKindMiner: 3, PurgeKindSigner: 2}, summary)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT `name` FROM `users` WHERE is_deleted = ? AND updateTime < ?")).
+		WithArgs(core.Deleted, before).
+		WillReturnError(errSimulated)
+	mock.ExpectRollback()
+	_, err = mySQLStore.Purge(PurgeKinds, before, false)
+	assert.Error(t, err)
+}
+
+func testMySQLCascadeDeleteUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	user := "test_user_001"
+	token := "test_token_001"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `users` WHERE name=? and is_deleted=? LIMIT 1")).
+		WithArgs(user, core.NotDelete).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("id_001", user))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE user = ? AND `miners`.`deleted_at` IS NULL")).
+		WithArgs(user).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `signers` WHERE `user` = ? AND `signers`.`deleted_at` IS NULL")).
+		WithArgs(user).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `signers` SET `deleted_at`=? WHERE `user` = ? AND `signers`.`deleted_at` IS NULL")).
+		WithArgs(anyTime{}, user).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `token` WHERE name = ? and is_deleted=?")).
+		WithArgs(user, core.NotDelete).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "token"}).AddRow(user, token))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `token` SET `delete_time`=?,`is_deleted`=? WHERE name = ? and is_deleted=?")).
+		WithArgs(anyTime{}, core.Deleted, user, core.NotDelete).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=?,`org`=?,`org_admin`=?,`cascaded`=? WHERE `id` = ?")).
+		WithArgs(user, "", 0, anyTime{}, anyTime{}, core.Deleted, "", false,
+			[]byte(`{"tokens":["test_token_001"],"miners":null,"signers":null}`), "id_001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, mySQLStore.DeleteUser(user, true))
+}
+
+func testMySQLRecoverUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	user := "test_user_001"
+	token := "test_token_001"
+	miner, err := address.NewIDAddress(1000)
+	assert.Nil(t, err)
+	cascaded := fmt.Sprintf(`{"tokens":["%s"],"miners":["%s"],"signers":null}`, token, miner)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `users` WHERE name=? and is_deleted=? LIMIT 1")).
+		WithArgs(user, core.Deleted).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "is_deleted", "cascaded"}).AddRow("id_001", user, core.Deleted, cascaded))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `token` SET `is_deleted`=? WHERE token IN (?) AND is_deleted=?")).
+		WithArgs(core.NotDelete, token, core.Deleted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `miners` SET `deleted_at`=?,`updated_at`=? WHERE `miner` IN (?) AND `user` = ? AND deleted_at IS NOT NULL")).
+		WithArgs(nil, anyTime{}, storedAddress(miner), user).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=?,`org`=?,`org_admin`=?,`cascaded`=? WHERE `id` = ?")).
+		WithArgs(user, "", 0, anyTime{}, anyTime{}, core.NotDelete, "", false, nil, "id_001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, mySQLStore.RecoverUser(user))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `users` WHERE name=? and is_deleted=? LIMIT 1")).
+		WithArgs(user, core.Deleted).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectRollback()
+	assert.Error(t, mySQLStore.RecoverUser(user))
+}
+
+func testMySQLGetOrg(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	org := "test_org_001"
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `orgs` WHERE name=? and is_deleted=? LIMIT 1")).
+		WithArgs(org, core.NotDelete).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "comment"}).AddRow(org, "comment"))
+	orgInfo, err := mySQLStore.GetOrg(org)
 	assert.Nil(t, err)
+	assert.Equal(t, org, orgInfo.Name)
+	assert.Equal(t, "comment", orgInfo.Comment)
+}
+
+func testMySQLDeleteOrg(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	org := "test_org_001"
+	sql := "UPDATE `orgs` SET `is_deleted`=?,`updateTime`=? WHERE name=? and is_deleted=?"
+
+	sqlMockExpect(mock, sql, false, core.Deleted, anyTime{}, org, core.NotDelete)
+	assert.Nil(t, mySQLStore.DeleteOrg(org))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).
+		WithArgs(core.Deleted, anyTime{}, org, core.NotDelete).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.ErrorIs(t, mySQLStore.DeleteOrg(org), gorm.ErrRecordNotFound)
+}
+
+func testMySQLListOrgUsers(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	org := "test_org_001"
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE org=? and is_deleted=? ORDER BY createTime")).
+		WithArgs(org, core.NotDelete).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "org"}).AddRow("test_user_001", org))
+	users, err := mySQLStore.ListOrgUsers(org)
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, org, users[0].Org)
+}
+
+func testMySQLDeleteWebhook(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	name := "test_webhook_001"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `webhooks` WHERE name=?")).
+		WithArgs(name).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `webhook_deliveries` WHERE webhook=?")).
+		WithArgs(name).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	assert.Nil(t, mySQLStore.DeleteWebhook(name))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `webhooks` WHERE name=?")).
+		WithArgs(name).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	assert.ErrorIs(t, mySQLStore.DeleteWebhook(name), gorm.ErrRecordNotFound)
+}
+
+func testMySQLListPendingWebhookDeliveries(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `webhook_deliveries` WHERE webhook=? and state=? ORDER BY id LIMIT 10")).
+		WithArgs("test_webhook_001", DeliveryPending).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook", "state"}).AddRow("id_001", "test_webhook_001", DeliveryPending))
+	deliveries, err := mySQLStore.ListPendingWebhookDeliveries("test_webhook_001", 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "id_001", deliveries[0].Id)
+}
+
+func testMySQLPruneWebhookDeliveries(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	before := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `webhook_deliveries` WHERE state<>? and updateTime<?")).
+		WithArgs(DeliveryPending, before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	pruned, err := mySQLStore.PruneWebhookDeliveries(before)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pruned)
 }
 
 func testMySQLGetRateLimits(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
@@ -541,6 +806,29 @@ func testMySQLGetUserByMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.
 	assert.Equal(t, userId, user.Id)
 }
 
+func testMySQLGetMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("f01000")
+	assert.Nil(t, err)
+	userName := "name"
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE miner = ? AND `miners`.`deleted_at` IS NULL LIMIT 1")).
+		WithArgs(storedAddress(addr)).
+		WillReturnRows(sqlmock.NewRows([]string{"miner", "user"}).AddRow([]byte("01000"), userName))
+
+	miner, err := mySQLStore.GetMiner(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, userName, miner.User)
+	assert.Equal(t, addr.String(), miner.Miner.Address().String())
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE miner = ? AND `miners`.`deleted_at` IS NULL LIMIT 1")).
+		WithArgs(storedAddress(addr)).
+		WillReturnRows(sqlmock.NewRows([]string{"miner", "user"}))
+	_, err = mySQLStore.GetMiner(addr)
+	assert.True(t, IsNotFound(err))
+}
+
 func testMySQLListMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
 	userName := "user_name"
 
@@ -590,10 +878,10 @@ func testMySQLUpsertMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO `miners` (`miner`,`user`,`open_mining`,`created_at`,`updated_at`,`deleted_at`) "+
-			"VALUES (?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `miner`=VALUES(`miner`),`user`=VALUES(`user`),`open_mining`=VALUES(`open_mining`),"+
+		"INSERT INTO `miners` (`miner`,`user`,`open_mining`,`labels`,`created_at`,`updated_at`,`deleted_at`) "+
+			"VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `user`=VALUES(`user`),`open_mining`=VALUES(`open_mining`),"+
 			"`updated_at`=VALUES(`updated_at`),`deleted_at`=VALUES(`deleted_at`)")).
-		WithArgs(storedAddress(addr), user, openMining, anyTime{}, anyTime{}, nil).
+		WithArgs(storedAddress(addr), user, openMining, nil, anyTime{}, anyTime{}, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
@@ -603,6 +891,149 @@ func testMySQLUpsertMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 	assert.False(t, isCreate)
 }
 
+func testMySQLTransferMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("f01000")
+	assert.Nil(t, err)
+	from, to := "from_user", "to_user"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE miner = ? AND `miners`.`deleted_at` IS NULL LIMIT 1 FOR UPDATE")).
+		WithArgs(storedAddress(addr)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "miner", "user"}).AddRow(1, []byte("01000"), from))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `users` WHERE name=? and is_deleted=? LIMIT 1")).
+		WithArgs(to, core.NotDelete).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(to))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `miners` SET `user`=?,`updated_at`=? WHERE id = ? AND `miners`.`deleted_at` IS NULL")).
+		WithArgs(to, anyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	prev, err := mySQLStore.TransferMiner(addr, from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, from, prev.User)
+
+	// miner not belongs to `from`
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE miner = ? AND `miners`.`deleted_at` IS NULL LIMIT 1 FOR UPDATE")).
+		WithArgs(storedAddress(addr)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "miner", "user"}).AddRow(1, []byte("01000"), to))
+	mock.ExpectRollback()
+
+	_, err = mySQLStore.TransferMiner(addr, from, to)
+	assert.Error(t, err)
+}
+
+func testMySQLUpdateMinerLabels(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("f01000")
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `miners` WHERE miner = ? AND `miners`.`deleted_at` IS NULL LIMIT 1 FOR UPDATE")).
+		WithArgs(storedAddress(addr)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "miner", "user", "labels"}).
+			AddRow(1, []byte("01000"), "user", []byte(`{"region":"sh","accept-deals":"true"}`)))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `miners` SET `labels`=?,`updated_at`=? WHERE id = ? AND `miners`.`deleted_at` IS NULL")).
+		WithArgs([]byte(`{"accept-deals":"false","zone":"a"}`), anyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	miner, err := mySQLStore.UpdateMinerLabels(addr, map[string]string{"accept-deals": "false", "zone": "a"}, []string{"region"})
+	assert.Nil(t, err)
+	assert.Equal(t, MinerLabels{"accept-deals": "false", "zone": "a"}, miner.Labels)
+}
+
+func testMySQLCheckNetwork(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT `miner` AS address, `user` FROM `miners` WHERE `miner` NOT REGEXP '^[0-9]' AND deleted_at IS NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"address", "user"}).AddRow("f01000", "user"))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT `signer` AS address, `user` FROM `signers` WHERE `signer` NOT REGEXP '^[0-9]' AND deleted_at IS NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"address", "user"}))
+
+	records, err := mySQLStore.CheckNetwork()
+	assert.Nil(t, err)
+	assert.Equal(t, []*WrongNetworkRecord{{Kind: "miner", User: "user", Address: "f01000"}}, records)
+}
+
+func testMySQLPutAddressMapping(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	idAddr, err := address.NewFromString("t01000")
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(
+		"INSERT INTO `address_mappings` (`address`,`id_address`,`created_at`,`updated_at`,`deleted_at`) VALUES (?,?,?,?,?) "+
+			"ON DUPLICATE KEY UPDATE `id_address`=VALUES(`id_address`),`updated_at`=VALUES(`updated_at`)")).
+		WithArgs(storedAddress(addr), storedAddress(idAddr), anyTime{}, anyTime{}, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, mySQLStore.PutAddressMapping(addr, idAddr))
+}
+
+func testMySQLGetAddressMapping(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+	idAddr, err := address.NewFromString("t01000")
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `address_mappings` WHERE (`address` = ? OR `id_address` = ?) AND `address_mappings`.`deleted_at` IS NULL LIMIT 1")).
+		WithArgs(storedAddress(idAddr), storedAddress(idAddr)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "address", "id_address"}).
+			AddRow(1, []byte(storedAddress(addr).String()), []byte(storedAddress(idAddr).String())))
+
+	mapping, err := mySQLStore.GetAddressMapping(idAddr)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, mapping.Address.Address())
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `address_mappings` WHERE (`address` = ? OR `id_address` = ?) AND `address_mappings`.`deleted_at` IS NULL LIMIT 1")).
+		WithArgs(storedAddress(addr), storedAddress(addr)).
+		WillReturnError(gorm.ErrRecordNotFound)
+	_, err = mySQLStore.GetAddressMapping(addr)
+	assert.ErrorIs(t, err, ErrAddressMappingNotFound)
+}
+
+func testMySQLTransaction(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	name, id := "name", "id"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `user_rate_limits` WHERE id = ? and name= ?")).
+		WithArgs(id, name).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := mySQLStore.Transaction(func(store Store) error {
+		return store.DelRateLimit(name, id)
+	})
+	assert.Nil(t, err)
+
+	// all operations are rolled back if any of them failed
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM `user_rate_limits` WHERE id = ? and name= ?")).
+		WithArgs(id, name).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	err = mySQLStore.Transaction(func(store Store) error {
+		if err := store.DelRateLimit(name, id); err != nil {
+			return err
+		}
+		return errors.New("mock error")
+	})
+	assert.Error(t, err)
+}
+
 func testMySQLRegisterSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
 	addr, err := address.NewFromString("t3wylwd6pclppme4qmbgwled5xpsbgwgqbn2alxa7yahg2gnbfkipsdv6m764xm5coizujmwdmkxeugplmorha")
 	assert.Nil(t, err)
@@ -615,10 +1046,9 @@ func testMySQLRegisterSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.
 		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(mockUser))
 
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO `signers` (`signer`,`user`,`created_at`,`updated_at`,`deleted_at`) "+
-			"VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE `signer`=VALUES(`signer`),`user`=VALUES(`user`),`updated_at`=VALUES(`updated_at`),"+
-			"`deleted_at`=VALUES(`deleted_at`)")).
-		WithArgs(storedAddress(addr), mockUser, anyTime{}, anyTime{}, nil).
+		"INSERT INTO `signers` (`signer`,`user`,`policy`,`spent`,`created_at`,`updated_at`,`deleted_at`) "+
+			"VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `updated_at`=VALUES(`updated_at`),`deleted_at`=VALUES(`deleted_at`)")).
+		WithArgs(storedAddress(addr), mockUser, nil, nil, anyTime{}, anyTime{}, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
@@ -642,6 +1072,31 @@ func testMySQLSignerExistInUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmo
 	assert.True(t, exist)
 }
 
+func testMySQLUpdateSignerOfUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	addr, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	assert.Nil(t, err)
+
+	mockUser := "user"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `signers` WHERE (`signer` = ? AND `user` = ?) AND `signers`.`deleted_at` IS NULL LIMIT 1 FOR UPDATE")).
+		WithArgs(storedAddress(addr), mockUser).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "signer", "user", "policy"}).
+			AddRow(1, []byte(addr.String()[1:]), mockUser, []byte(`{"maxValue":"100"}`)))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE `signers` SET `policy`=?,`spent`=?,`updated_at`=? WHERE id = ? AND `signers`.`deleted_at` IS NULL")).
+		WithArgs([]byte(`{"maxValue":"100"}`), []byte(`{"day":"2023-01-02","amount":"10"}`), anyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	signer, err := mySQLStore.UpdateSignerOfUser(addr, mockUser, func(signer *Signer) error {
+		signer.Spent = &SignerSpent{Day: "2023-01-02", Amount: "10"}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &SignerPolicy{MaxValue: "100"}, signer.Policy)
+}
+
 func testMySQLListSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
 	mockUser := "username"
 
@@ -749,6 +1204,43 @@ func testMySQLMigrateToV1(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 	assert.Nil(t, err)
 }
 
+func testMySQLMigrateToV4(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(
+		"INSERT INTO `store_metas` (`name`,`value`) VALUES (?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`)")).
+		WithArgs(metaUsageTrackingSince, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(
+		"INSERT INTO `store_versions` (`version`,`id`) VALUES (?,?) ON DUPLICATE KEY UPDATE `version`=VALUES(`version`)")).
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := mySQLStore.MigrateToV4()
+	assert.Nil(t, err)
+}
+
+func testMySQLUsageTrackingSince(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	since := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `store_metas` WHERE name=? LIMIT 1")).
+		WithArgs(metaUsageTrackingSince).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).AddRow(metaUsageTrackingSince, since.Format(time.RFC3339Nano)))
+
+	got, err := mySQLStore.UsageTrackingSince()
+	assert.Nil(t, err)
+	assert.True(t, since.Equal(got))
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT * FROM `store_metas` WHERE name=? LIMIT 1")).
+		WithArgs(metaUsageTrackingSince).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	got, err = mySQLStore.UsageTrackingSince()
+	assert.Nil(t, err)
+	assert.True(t, got.IsZero())
+}
+
 func mysqlSetup() (*mysqlStore, sqlmock.Sqlmock, *sql.DB, error) {
 	var err error
 	sqlDB, mock, err := sqlmock.New()
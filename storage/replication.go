@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+)
+
+// PrefixLocal the records of the node itself, such as the state of replication, they are never replicated
+const PrefixLocal Prefix = "LOCAL:"
+
+// markerKey is written every markerInterval to know the subscriber of a stream is ready
+const (
+	markerKey      = "replication-marker"
+	markerInterval = 10 * time.Millisecond
+)
+
+// replicaBatchSize how many records are sent in a batch of snapshot
+const replicaBatchSize = 1000
+
+// replicaQueueSize how many batches of updates a stream can fall behind, the stream fails beyond it,
+// so a slow follower never blocks the writes of leader
+const replicaQueueSize = 1024
+
+var errReplicaTooSlow = errors.New("the stream falls behind too far")
+
+// ReplicaRecord a record replicated from the leader to followers, the key is deleted if Value is empty,
+// so the store must never write an empty value, markers such as the index of pending deliveries have a non-empty one.
+type ReplicaRecord struct {
+	Key     []byte `json:"key"`
+	Value   []byte `json:"value"`
+	Version uint64 `json:"version"`
+}
+
+func (r *ReplicaRecord) deleted() bool {
+	return len(r.Value) == 0
+}
+
+// ReplicaBatch the records sent to followers, a stream starts with the batches of a snapshot
+// and the last of them is `Synced`, then the records written after the snapshot.
+type ReplicaBatch struct {
+	Snapshot bool             `json:"snapshot"`
+	Synced   bool             `json:"synced"`
+	Records  []*ReplicaRecord `json:"records"`
+	// the version of the store after the batch applied
+	Version uint64 `json:"version"`
+}
+
+// Replicable stores can be replicated from the leader to followers, only badger is replicable
+type Replicable interface {
+	// Stream sends a snapshot of all records and then the records written after it, until ctx done or send failed
+	Stream(ctx context.Context, send func(*ReplicaBatch) error) error
+	// ApplySnapshot replaces all records with the snapshot, records absent from it are deleted
+	ApplySnapshot(records []*ReplicaRecord) error
+	// Apply writes the records sent after the snapshot
+	Apply(records []*ReplicaRecord) error
+
+	// the records of the node itself, nil if not found
+	GetLocal(key string) ([]byte, error)
+	PutLocal(key string, value []byte) error
+}
+
+var _ Replicable = (*badgerStore)(nil)
+
+func isLocalKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(PrefixLocal))
+}
+
+// badgerKeyPrefix the keys badger writes for itself, they are seen by subscribers but never iterated
+var badgerKeyPrefix = []byte("!badger!")
+
+// replicated whether the record of key is sent to followers
+func replicated(key []byte) bool {
+	return !isLocalKey(key) && !bytes.HasPrefix(key, badgerKeyPrefix)
+}
+
+func (s *badgerStore) Stream(ctx context.Context, send func(*ReplicaBatch) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// subscribe before the snapshot, so nothing is missed between them
+	updates := make(chan *pb.KVList, replicaQueueSize)
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- s.db.Subscribe(ctx, func(kvs *badger.KVList) error {
+			select {
+			case updates <- kvs:
+				return nil
+			default:
+				return errReplicaTooSlow
+			}
+		}, []pb.Match{{Prefix: nil}})
+	}()
+	marker := []byte(fmt.Sprintf("%d", rand.Int63()))
+	if err := s.waitMarker(ctx, marker, updates, subErr); err != nil {
+		return err
+	}
+
+	// the updates in the snapshot are skipped
+	version, err := s.snapshot(send)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-subErr:
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		case kvs := <-updates:
+			batch := &ReplicaBatch{Version: version}
+			for _, kv := range kvs.Kv {
+				if kv.Version <= version || !replicated(kv.Key) {
+					continue
+				}
+				batch.Records = append(batch.Records, &ReplicaRecord{Key: kv.Key, Value: kv.Value, Version: kv.Version})
+				batch.Version = kv.Version
+			}
+			if len(batch.Records) == 0 {
+				continue
+			}
+			version = batch.Version
+			if err := send(batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// waitMarker writes marker until the subscriber received it, since there is no way to know it's registered
+func (s *badgerStore) waitMarker(ctx context.Context, marker []byte, updates <-chan *pb.KVList, subErr <-chan error) error {
+	ticker := time.NewTicker(markerInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.PutLocal(markerKey, marker); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-subErr:
+			return fmt.Errorf("subscribe: %v", err)
+		case kvs := <-updates:
+			for _, kv := range kvs.Kv {
+				if string(kv.Key) == PrefixLocal+markerKey && bytes.Equal(kv.Value, marker) {
+					return nil
+				}
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot sends all records in batches, returns the version of the snapshot
+func (s *badgerStore) snapshot(send func(*ReplicaBatch) error) (uint64, error) {
+	txn := s.db.NewTransaction(false)
+	defer txn.Discard()
+	version := txn.ReadTs()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	batch := &ReplicaBatch{Snapshot: true, Version: version}
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if !replicated(item.Key()) {
+			continue
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return 0, err
+		}
+		batch.Records = append(batch.Records, &ReplicaRecord{Key: item.KeyCopy(nil), Value: val, Version: item.Version()})
+		if len(batch.Records) == replicaBatchSize {
+			if err := send(batch); err != nil {
+				return 0, err
+			}
+			batch = &ReplicaBatch{Snapshot: true, Version: version}
+		}
+	}
+	batch.Synced = true
+	return version, send(batch)
+}
+
+func (s *badgerStore) ApplySnapshot(records []*ReplicaRecord) error {
+	keys := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		keys[string(r.Key)] = struct{}{}
+	}
+	var stale [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if _, ok := keys[string(key)]; !ok && replicated(key) {
+				stale = append(stale, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range stale {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		if !replicated(r.Key) {
+			continue
+		}
+		if err := wb.Set(r.Key, r.Value); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (s *badgerStore) Apply(records []*ReplicaRecord) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, r := range records {
+		if !replicated(r.Key) {
+			continue
+		}
+		var err error
+		if r.deleted() {
+			err = wb.Delete(r.Key)
+		} else {
+			err = wb.Set(r.Key, r.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (s *badgerStore) GetLocal(key string) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(PrefixLocal + key))
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (s *badgerStore) PutLocal(key string, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(PrefixLocal+key), value)
+	})
+}
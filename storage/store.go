@@ -52,6 +52,8 @@ type Store interface {
 	Has(token Token) (bool, error)
 	List(skip, limit int64) ([]*KeyPair, error)
 	UpdateToken(kp *KeyPair) error
+	// update the last used time and ip of tokens in a batch, tokens not found are ignored
+	UpdateTokenUsages(usages []*TokenUsage) error
 
 	// user
 	HasUser(name string) (bool, error)
@@ -60,9 +62,35 @@ type Store interface {
 	PutUser(*User) error
 	UpdateUser(*User) error
 	ListUsers(skip, limit int64, state core.UserState) ([]*User, error)
-	DeleteUser(name string) error
+	// delete user and detach its miners and signers, tokens of user are revoked too if 'cascade',
+	// what is deleted by cascading is recorded and recovered with user
+	DeleteUser(name string, cascade bool) error
 	RecoverUser(name string) error
 
+	// organization, owns the users in it and their miners and signers
+	HasOrg(name string) (bool, error)
+	GetOrg(name string) (*Organization, error)
+	PutOrg(*Organization) error
+	ListOrgs() ([]*Organization, error)
+	DeleteOrg(name string) error
+	// users not deleted in the organization
+	ListOrgUsers(org string) ([]*User, error)
+
+	// webhook, its deliveries are both the outbox and the log of deliveries
+	GetWebhook(name string) (*Webhook, error)
+	PutWebhook(*Webhook) error
+	ListWebhooks() ([]*Webhook, error)
+	// delete the webhook along with its deliveries
+	DeleteWebhook(name string) error
+	// insert or update deliveries
+	PutWebhookDeliveries(deliveries []*WebhookDelivery) error
+	// deliveries from the newest, of all webhooks or states if empty, all of them if limit is 0
+	ListWebhookDeliveries(webhook, state string, limit int) ([]*WebhookDelivery, error)
+	// pending deliveries of the webhook from the oldest, which is the order of their ids, all of them if limit is 0
+	ListPendingWebhookDeliveries(webhook string, limit int) ([]*WebhookDelivery, error)
+	// delete the deliveries finished before 'before', returns how many are deleted
+	PruneWebhookDeliveries(before time.Time) (int, error)
+
 	// rate limit
 	GetRateLimits(name, id string) ([]*UserRateLimit, error)
 	PutRateLimit(limit *UserRateLimit) (string, error)
@@ -74,9 +102,14 @@ type Store interface {
 	HasMiner(mAddr address.Address) (bool, error)
 	MinerExistInUser(mAddr address.Address, userName string) (bool, error)
 	GetUserByMiner(mAddr address.Address) (*User, error)
+	GetMiner(mAddr address.Address) (*Miner, error)
 	ListMiners(user string) ([]*Miner, error)
 	// first returned bool, if miner exists(true) or false
 	DelMiner(mAddr address.Address) (bool, error)
+	// rebind miner from user 'from' to user 'to' atomically, returns the binding before transfer
+	TransferMiner(mAddr address.Address, from, to string) (*Miner, error)
+	// set labels in 'set' and remove labels in 'unset' atomically, returns the miner after update
+	UpdateMinerLabels(mAddr address.Address, set map[string]string, unset []string) (*Miner, error)
 
 	// signer-user(n-n)
 	RegisterSigner(addr address.Address, userName string) error
@@ -89,11 +122,36 @@ type Store interface {
 	DelSigner(addr address.Address) (bool, error)
 	// all users including the specified signer
 	GetUserBySigner(addr address.Address) ([]*User, error)
+	// update the binding of signer and user atomically by 'fn', nothing is written if 'fn' returns an error
+	UpdateSignerOfUser(addr address.Address, userName string, fn func(*Signer) error) (*Signer, error)
+
+	// hard delete the records of 'kinds' soft-deleted before 'before', a purged user takes all its tokens,
+	// miners and signer bindings along. Nothing is deleted if 'dryRun', only the summary is returned.
+	Purge(kinds []string, before time.Time, dryRun bool) (PurgeSummary, error)
+
+	// cache of the ID address of 'addr' resolved from chain
+	PutAddressMapping(addr, idAddr address.Address) error
+	// the mapping whose address or ID address is 'addr', returns `ErrAddressMappingNotFound` if there is none
+	GetAddressMapping(addr address.Address) (*AddressMapping, error)
+
+	// miners and signers whose address was not written under the current network(`address.CurrentNetwork`)
+	CheckNetwork() ([]*WrongNetworkRecord, error)
+
+	// Transaction executes 'fn' in a transaction, which is rolled back if 'fn' returns an error,
+	// all operations should be called on the store passed to 'fn'
+	Transaction(fn func(Store) error) error
+	// Close releases the resources of the store, it shouldn't be used after closed
+	Close() error
+
+	// the time from which the usages of tokens are recorded, zero if it's never set
+	UsageTrackingSince() (time.Time, error)
+	SetUsageTrackingSince(since time.Time) error
 
 	Version() (uint64, error)
 	MigrateToV1() error
 	MigrateToV2() error
 	MigrateToV3() error
+	MigrateToV4() error
 }
 
 type KeyPair struct {
@@ -104,6 +162,25 @@ type KeyPair struct {
 	Token      Token     `gorm:"column:token;type:varchar(512);uniqueIndex:token_token_IDX,type:hash;not null"`
 	CreateTime time.Time `gorm:"column:createTime;type:datetime;NOT NULL"`
 	IsDeleted  int       `gorm:"column:is_deleted;index;default:0;NOT NULL"`
+
+	// what the token is for, not signed into the token
+	Description string      `gorm:"column:description;type:varchar(255);"`
+	Labels      TokenLabels `gorm:"column:labels;type:text"`
+	// the last time and client ip the token was verified, written by `UpdateTokenUsages`
+	LastUsedTime *time.Time `gorm:"column:last_used_time;type:datetime"`
+	LastUsedIP   string     `gorm:"column:last_used_ip;type:varchar(64);"`
+	// when the token was deleted, nil for the tokens deleted before it's recorded
+	DeleteTime *time.Time `gorm:"column:delete_time;type:datetime"`
+}
+
+// TokenLabels free-form metadata of token, shares the encoding of `MinerLabels`
+type TokenLabels = MinerLabels
+
+// TokenUsage the latest verification of a token
+type TokenUsage struct {
+	Token Token
+	Time  time.Time
+	IP    string
 }
 
 func (*KeyPair) TableName() string {
@@ -149,9 +226,35 @@ func (kp *KeyPair) isDeleted() bool {
 }
 
 func (kp *KeyPair) setDeleted() {
+	now := time.Now()
 	kp.IsDeleted = core.Deleted
+	kp.DeleteTime = &now
+}
+
+// deletedBefore returns true if token was deleted before 't', tokens without delete time are aged from their creation
+func (kp *KeyPair) deletedBefore(t time.Time) bool {
+	if !kp.isDeleted() {
+		return false
+	}
+	if kp.DeleteTime != nil {
+		return kp.DeleteTime.Before(t)
+	}
+	return kp.CreateTime.Before(t)
 }
 
+// kinds of soft-deleted records can be purged
+const (
+	PurgeKindToken  = "token"
+	PurgeKindUser   = "user"
+	PurgeKindMiner  = "miner"
+	PurgeKindSigner = "signer"
+)
+
+var PurgeKinds = []string{PurgeKindToken, PurgeKindUser, PurgeKindMiner, PurgeKindSigner}
+
+// PurgeSummary count of records purged by kind, records purged along with users are included
+type PurgeSummary map[string]int
+
 type User struct {
 	Id         string         `gorm:"column:id;type:varchar(64);primary_key"`
 	Name       string         `gorm:"column:name;type:varchar(50);uniqueIndex:users_name_IDX,type:btree;not null"`
@@ -160,6 +263,27 @@ type User struct {
 	CreateTime time.Time      `gorm:"column:createTime;type:datetime;NOT NULL"`
 	UpdateTime time.Time      `gorm:"column:updateTime;type:datetime;NOT NULL"`
 	IsDeleted  int            `gorm:"column:is_deleted;index;default:0;NOT NULL"`
+	// the organization user belongs to, empty if there is none
+	Org string `gorm:"column:org;type:varchar(50);index;default:'';NOT NULL"`
+	// whether user manages the users in the organization
+	OrgAdmin bool `gorm:"column:org_admin;default:false;NOT NULL"`
+	// records deleted along with the user by a cascading deletion, nil if it's not
+	Cascaded *UserCascade `gorm:"column:cascaded;type:text"`
+}
+
+// UserCascade records deleted along with the user, they are recovered with the user
+type UserCascade struct {
+	Tokens  []Token  `json:"tokens"`
+	Miners  []string `json:"miners"`
+	Signers []string `json:"signers"`
+}
+
+func (uc *UserCascade) Scan(value interface{}) error {
+	return scanJSON(value, uc)
+}
+
+func (uc UserCascade) Value() (driver.Value, error) {
+	return json.Marshal(uc)
 }
 
 type OrmTimestamp struct {
@@ -203,6 +327,7 @@ func (u *User) isDeleted() bool {
 
 func (u *User) setDeleted() {
 	u.IsDeleted = core.Deleted
+	u.UpdateTime = time.Now()
 }
 
 type storedAddress address.Address
@@ -224,14 +349,7 @@ func (sa *storedAddress) Scan(value interface{}) error {
 	if !isok {
 		return xerrors.New("non-string types unsupported")
 	}
-	var str string
-	if address.CurrentNetwork == address.Mainnet {
-		str = address.MainnetPrefix + string(val)
-	} else {
-		str = address.TestnetPrefix + string(val)
-	}
-
-	addr, err := address.NewFromString(str)
+	addr, err := address.NewFromString(core.NetworkPrefix() + string(val))
 	if err != nil {
 		return err
 	}
@@ -256,14 +374,210 @@ func (sa storedAddress) Value() (driver.Value, error) {
 	return sa.String(), nil
 }
 
+type Organization struct {
+	Id         string    `gorm:"column:id;type:varchar(64);primary_key"`
+	Name       string    `gorm:"column:name;type:varchar(50);uniqueIndex:orgs_name_IDX,type:btree;not null"`
+	Comment    string    `gorm:"column:comment;type:varchar(255);"`
+	CreateTime time.Time `gorm:"column:createTime;type:datetime;NOT NULL"`
+	UpdateTime time.Time `gorm:"column:updateTime;type:datetime;NOT NULL"`
+	IsDeleted  int       `gorm:"column:is_deleted;index;default:0;NOT NULL"`
+}
+
+func (*Organization) TableName() string {
+	return "orgs"
+}
+
+func (o *Organization) key() []byte {
+	return orgKey(o.Name)
+}
+
+func (o *Organization) Bytes() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+func (o *Organization) FromBytes(buff []byte) error {
+	return json.Unmarshal(buff, o)
+}
+
+func (o *Organization) isDeleted() bool {
+	return o.IsDeleted == core.Deleted
+}
+
+func (o *Organization) setDeleted() {
+	o.IsDeleted = core.Deleted
+}
+
+// Webhook an http endpoint the events are posted to, signed by `Secret`
+type Webhook struct {
+	Name string `gorm:"column:name;type:varchar(50);primary_key"`
+	URL  string `gorm:"column:url;type:varchar(512);NOT NULL"`
+	// types of the events delivered, all types if empty
+	Events WebhookEvents `gorm:"column:events;type:text"`
+	// only the events of the user if set
+	User string `gorm:"column:user;type:varchar(50);default:'';NOT NULL"`
+	// only the tokens of the permission if set, the other events are not affected
+	Perm       string    `gorm:"column:perm;type:varchar(50);default:'';NOT NULL"`
+	Secret     string    `gorm:"column:secret;type:varchar(255);NOT NULL"`
+	Disabled   bool      `gorm:"column:disabled;default:false;NOT NULL"`
+	Comment    string    `gorm:"column:comment;type:varchar(255);"`
+	CreateTime time.Time `gorm:"column:createTime;type:datetime;NOT NULL"`
+	UpdateTime time.Time `gorm:"column:updateTime;type:datetime;NOT NULL"`
+}
+
+func (*Webhook) TableName() string {
+	return "webhooks"
+}
+
+func (w *Webhook) key() []byte {
+	return webhookKey(w.Name)
+}
+
+func (w *Webhook) Bytes() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+func (w *Webhook) FromBytes(buff []byte) error {
+	return json.Unmarshal(buff, w)
+}
+
+// WebhookEvents types of the events a webhook subscribes
+type WebhookEvents []string
+
+func (we *WebhookEvents) Scan(value interface{}) error {
+	*we = nil
+	return scanJSON(value, we)
+}
+
+func (we WebhookEvents) Value() (driver.Value, error) {
+	if len(we) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(we)
+}
+
+// states of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// all the attempts failed
+	DeliveryFailed = "failed"
+)
+
+// WebhookDelivery an event to post to a webhook, the pending ones are the outbox,
+// and the finished ones are kept as the log of deliveries
+type WebhookDelivery struct {
+	// UUIDv7, which sorts as the deliveries enqueued
+	Id        string `gorm:"column:id;type:varchar(64);primary_key"`
+	Webhook   string `gorm:"column:webhook;type:varchar(50);index:webhook_deliveries_pending_IDX,priority:1;NOT NULL"`
+	EventID   string `gorm:"column:event_id;type:varchar(128);NOT NULL"`
+	EventType string `gorm:"column:event_type;type:varchar(50);NOT NULL"`
+	// the body posted
+	Payload  string `gorm:"column:payload;type:text;NOT NULL"`
+	State    string `gorm:"column:state;type:varchar(16);index:webhook_deliveries_pending_IDX,priority:2;NOT NULL"`
+	Attempts int    `gorm:"column:attempts;default:0;NOT NULL"`
+	// when the pending one is attempted next
+	NextAttempt time.Time `gorm:"column:next_attempt;type:datetime;NOT NULL"`
+	// response of the last attempt, the status code is 0 if no response got
+	StatusCode int       `gorm:"column:status_code;default:0;NOT NULL"`
+	Error      string    `gorm:"column:error;type:varchar(1024);"`
+	CreateTime time.Time `gorm:"column:createTime;type:datetime;NOT NULL"`
+	UpdateTime time.Time `gorm:"column:updateTime;type:datetime;NOT NULL"`
+}
+
+func (*WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+func (d *WebhookDelivery) key() []byte {
+	return webhookDeliveryKey(d.Id)
+}
+
+func (d *WebhookDelivery) Bytes() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (d *WebhookDelivery) FromBytes(buff []byte) error {
+	return json.Unmarshal(buff, d)
+}
+
+var ErrAddressMappingNotFound = xerrors.New("address mapping not found")
+
+// AddressMapping the ID address of an actor resolved from chain
+type AddressMapping struct {
+	ID        uint64        `gorm:"column:id;primary_key;bigint(20) unsigned AUTO_INCREMENT"`
+	Address   storedAddress `gorm:"column:address;type:varchar(256);uniqueIndex:address_idx;NOT NULL"`
+	IDAddress storedAddress `gorm:"column:id_address;type:varchar(128);index;NOT NULL"`
+	OrmTimestamp
+}
+
+func (m *AddressMapping) Bytes() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *AddressMapping) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, m)
+}
+
+// WrongNetworkRecord is a record of miner or signer which can't be found under the current network
+type WrongNetworkRecord struct {
+	// "miner" or "signer"
+	Kind string
+	User string
+	// address as it's stored
+	Address string
+}
+
 type Miner struct {
 	ID         uint64        `gorm:"column:id;primary_key;bigint(20) unsigned AUTO_INCREMENT"`
 	Miner      storedAddress `gorm:"column:miner;type:varchar(128);uniqueIndex:miner_idx;NOT NULL"`
 	User       string        `gorm:"column:user;type:varchar(50);NOT NULL"`
 	OpenMining *bool         `gorm:"column:open_mining;default:1;comment:0-false,1-true"`
+	Labels     MinerLabels   `gorm:"column:labels;type:text"`
 	OrmTimestamp
 }
 
+// MinerLabels policies and free-form metadata of miner, see `core.MinerFlags` for well known flags
+type MinerLabels map[string]string
+
+func (ml *MinerLabels) Scan(value interface{}) error {
+	*ml = nil
+	return scanJSON(value, ml)
+}
+
+func (ml MinerLabels) Value() (driver.Value, error) {
+	if len(ml) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ml)
+}
+
+func mergeLabels(labels MinerLabels, set map[string]string, unset []string) MinerLabels {
+	merged := make(MinerLabels, len(labels)+len(set))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range set {
+		merged[k] = v
+	}
+	for _, k := range unset {
+		delete(merged, k)
+	}
+	return merged
+}
+
+// Match returns true if labels satisfy all the selectors,
+// a selector is `key=value` to match the value, or `key` to match the existence of key.
+func (ml MinerLabels) Match(selectors []string) bool {
+	for _, selector := range selectors {
+		key, value, withValue := strings.Cut(selector, "=")
+		v, ok := ml[key]
+		if !ok || (withValue && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *Miner) Bytes() ([]byte, error) {
 	return json.Marshal(m)
 }
@@ -289,9 +603,63 @@ type Signer struct {
 	ID     uint64        `gorm:"column:id;primary_key;bigint(20) unsigned AUTO_INCREMENT;"`
 	Signer storedAddress `gorm:"column:signer;type:varchar(128);uniqueIndex:user_signer_idx,priority:2;NOT NULL"`
 	User   string        `gorm:"column:user;type:varchar(50);uniqueIndex:user_signer_idx,priority:1;NOT NULL"`
+	// usage policy of the signer for the user, nil means no limit
+	Policy *SignerPolicy `gorm:"column:policy;type:text"`
+	// value spent in the current day, used to check `SignerPolicy.DailyCap`
+	Spent *SignerSpent `gorm:"column:spent;type:varchar(128)"`
 	OrmTimestamp
 }
 
+// SignerPolicy values are in attoFIL
+type SignerPolicy struct {
+	// methods of message allowed to sign, empty means all methods are allowed
+	AllowedMethods []uint64 `json:"allowedMethods,omitempty"`
+	// max value per message, empty means no limit
+	MaxValue string `json:"maxValue,omitempty"`
+	// max total value of messages per day(UTC), empty means no limit
+	DailyCap string `json:"dailyCap,omitempty"`
+}
+
+func (sp *SignerPolicy) Scan(value interface{}) error {
+	return scanJSON(value, sp)
+}
+
+func (sp SignerPolicy) Value() (driver.Value, error) {
+	return json.Marshal(sp)
+}
+
+type SignerSpent struct {
+	// day in UTC, format: 2006-01-02
+	Day    string `json:"day"`
+	Amount string `json:"amount"`
+}
+
+func (ss *SignerSpent) Scan(value interface{}) error {
+	return scanJSON(value, ss)
+}
+
+func (ss SignerSpent) Value() (driver.Value, error) {
+	return json.Marshal(ss)
+}
+
+func scanJSON(value interface{}, obj interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return xerrors.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, obj)
+}
+
 func (m *Signer) Bytes() ([]byte, error) {
 	return json.Marshal(m)
 }
@@ -330,6 +698,31 @@ func (s *StoreVersion) Bytes() ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// the name of `StoreMeta` holding the time from which the usages of tokens are recorded
+const metaUsageTrackingSince = "usage_tracking_since"
+
+// StoreMeta a setting of the store itself rather than of users or tokens
+type StoreMeta struct {
+	Name  string `gorm:"column:name;type:varchar(64);primary_key"`
+	Value string `gorm:"column:value;type:varchar(256);NOT NULL"`
+}
+
+func (*StoreMeta) TableName() string {
+	return "store_metas"
+}
+
+func (m *StoreMeta) key() []byte {
+	return storeMetaKey(m.Name)
+}
+
+func (m *StoreMeta) FromBytes(bytes []byte) error {
+	return json.Unmarshal(bytes, m)
+}
+
+func (m *StoreMeta) Bytes() ([]byte, error) {
+	return json.Marshal(m)
+}
+
 // we are perpose to support limit user requests with `Service`/`Service.API` ferther,
 // so we add their declar in `UserRateLimit`
 type UserRateLimit struct {
@@ -416,4 +809,5 @@ var (
 	_ iBadgerObj = (*KeyPair)(nil)
 	_ iBadgerObj = (*mapedRatelimit)(nil)
 	_ iBadgerObj = (*StoreVersion)(nil)
+	_ iBadgerObj = (*StoreMeta)(nil)
 )
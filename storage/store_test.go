@@ -2,14 +2,18 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/badger/v3"
 	"github.com/filecoin-project/go-address"
 	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
@@ -17,6 +21,7 @@ import (
 
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
 )
 
 var (
@@ -122,13 +127,13 @@ func testDeleteUser(t *testing.T) {
 		require.Equal(t, res.State, updated.State)
 		require.Equal(t, res.Comment, updated.Comment)
 	}
-	require.Nil(t, theStore.DeleteUser(userName))
+	require.Nil(t, theStore.DeleteUser(userName, false))
 	has, err := theStore.HasUser(userName)
 	require.Nil(t, err)
 	require.False(t, has)
 
 	// delete already deleted user
-	require.Error(t, theStore.DeleteUser(userName))
+	require.Error(t, theStore.DeleteUser(userName, false))
 
 	_, err = theStore.GetUser(userName)
 	require.Error(t, err)
@@ -174,6 +179,8 @@ func testListMiners(t *testing.T) {
 	// should be a 'not found error'
 	_, err := theStore.GetUserByMiner(addr)
 	require.Error(t, err)
+	_, err = theStore.GetMiner(addr)
+	require.True(t, IsNotFound(err))
 	// make sure all miners(we just inserted) exist.
 	for u, miners := range userMiners {
 		ms, err := theStore.ListMiners(u)
@@ -190,10 +197,78 @@ func testListMiners(t *testing.T) {
 			tmpUser, err := theStore.GetUserByMiner(tmpMiner.Miner.Address())
 			require.NoError(t, err)
 			require.Equal(t, tmpUser.Name, u)
+			miner, err := theStore.GetMiner(tmpMiner.Miner.Address())
+			require.NoError(t, err)
+			require.Equal(t, u, miner.User)
 		}
 	}
 }
 
+func testTransferMiner(t *testing.T) {
+	addr, _ := address.NewFromString("t01000")
+	from, to := "test_user_001", "test_user_002"
+
+	prev, err := theStore.TransferMiner(addr, from, to)
+	require.NoError(t, err)
+	require.Equal(t, from, prev.User)
+	require.Equal(t, addr.String(), prev.Miner.Address().String())
+
+	user, err := theStore.GetUserByMiner(addr)
+	require.NoError(t, err)
+	require.Equal(t, to, user.Name)
+
+	// miner not belongs to 'from' any more
+	_, err = theStore.TransferMiner(addr, from, to)
+	require.ErrorIs(t, err, errcode.ErrInvalidArgument)
+
+	// target user not exist
+	_, err = theStore.TransferMiner(addr, to, "not-exist-user")
+	require.Error(t, err)
+
+	// miner not exist
+	notExist, _ := address.NewFromString("f0109988")
+	_, err = theStore.TransferMiner(notExist, from, to)
+	require.Error(t, err)
+
+	// transfer back
+	prev, err = theStore.TransferMiner(addr, to, from)
+	require.NoError(t, err)
+	require.Equal(t, to, prev.User)
+	exist, err := theStore.MinerExistInUser(addr, from)
+	require.NoError(t, err)
+	require.True(t, exist)
+}
+
+func testUpdateMinerLabels(t *testing.T) {
+	addr, _ := address.NewFromString("t01000")
+
+	miner, err := theStore.UpdateMinerLabels(addr, map[string]string{core.MinerFlagAcceptDeals: "true", "region": "sh"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, MinerLabels{core.MinerFlagAcceptDeals: "true", "region": "sh"}, miner.Labels)
+
+	miner, err = theStore.UpdateMinerLabels(addr, map[string]string{"zone": "a"}, []string{"region"})
+	require.NoError(t, err)
+	require.Equal(t, MinerLabels{core.MinerFlagAcceptDeals: "true", "zone": "a"}, miner.Labels)
+
+	// labels are kept after upsert
+	openMining := false
+	_, err = theStore.UpsertMiner(addr, miner.User, &openMining)
+	require.NoError(t, err)
+	miners, err := theStore.ListMiners(miner.User)
+	require.NoError(t, err)
+	for _, m := range miners {
+		if m.Miner.Address() == addr {
+			require.Equal(t, miner.Labels, m.Labels)
+			require.True(t, m.Labels.Match([]string{core.MinerFlagAcceptDeals + "=true", "zone"}))
+			require.False(t, m.Labels.Match([]string{"region"}))
+		}
+	}
+
+	notExist, _ := address.NewFromString("f0109988")
+	_, err = theStore.UpdateMinerLabels(notExist, map[string]string{"zone": "a"}, nil)
+	require.Error(t, err)
+}
+
 func testDelMiners(t *testing.T) {
 	for userName, miners := range userMiners {
 		for m := range miners {
@@ -255,6 +330,14 @@ func testGetUserBySigner(t *testing.T) {
 	}
 	require.Contains(t, userNames, "test_user_002")
 	require.Contains(t, userNames, "test_user_003")
+
+	// the users unregistered the signer are excluded
+	require.NoError(t, theStore.UnregisterSigner(addr, "test_user_002"))
+	users, err = theStore.GetUserBySigner(addr)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "test_user_003", users[0].Name)
+	require.NoError(t, theStore.RegisterSigner(addr, "test_user_002"))
 }
 
 func testListSigners(t *testing.T) {
@@ -274,6 +357,44 @@ func testListSigners(t *testing.T) {
 	}
 }
 
+func testUpdateSignerOfUser(t *testing.T) {
+	addr, _ := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	userName := "test_user_003"
+
+	policy := &SignerPolicy{AllowedMethods: []uint64{0, 2}, MaxValue: "100", DailyCap: "1000"}
+	signer, err := theStore.UpdateSignerOfUser(addr, userName, func(signer *Signer) error {
+		signer.Policy = policy
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, policy, signer.Policy)
+
+	// nothing is written if 'fn' fails
+	_, err = theStore.UpdateSignerOfUser(addr, userName, func(signer *Signer) error {
+		signer.Policy = nil
+		return fmt.Errorf("rejected")
+	})
+	require.Error(t, err)
+
+	// policy is kept after register again, and only bound to the user
+	require.NoError(t, theStore.RegisterSigner(addr, userName))
+	signers, err := theStore.ListSigner(userName)
+	require.NoError(t, err)
+	for _, s := range signers {
+		if s.Signer.Address() == addr {
+			require.Equal(t, policy, s.Policy)
+		}
+	}
+	signers, err = theStore.ListSigner("test_user_002")
+	require.NoError(t, err)
+	for _, s := range signers {
+		require.Nil(t, s.Policy)
+	}
+
+	_, err = theStore.UpdateSignerOfUser(addr, "test_user_001", func(signer *Signer) error { return nil })
+	require.Error(t, err)
+}
+
 func testUnregisterSigner(t *testing.T) {
 	// test signer in multi users
 	signer := "t3r47fkdzfmtex5ic3jnwlzc7bkpbj7s4d6limyt4f57t3cuqq5nuvhvwv2cu2a6iga2s64vjqcxjqiezyjooq"
@@ -355,6 +476,35 @@ func testTokens(t *testing.T) {
 	}
 }
 
+func testTokenUsages(t *testing.T) {
+	token := *originTokens["test-token-01"]
+	token.Token = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJuYW1lIjoidGVzdC11c2FnZSIsInBlcm0iOiJyZWFkIiwiZXh0IjoiIn0.usage"
+	token.Description = "token of usage test"
+	token.Labels = TokenLabels{"owner": "ops"}
+	require.NoError(t, theStore.Put(&token))
+
+	res, err := theStore.Get(token.Token)
+	require.NoError(t, err)
+	require.Equal(t, token.Description, res.Description)
+	require.Equal(t, token.Labels, res.Labels)
+	require.Nil(t, res.LastUsedTime)
+
+	usedTime := time.Now().Truncate(time.Second)
+	require.NoError(t, theStore.UpdateTokenUsages([]*TokenUsage{
+		{Token: token.Token, Time: usedTime, IP: "127.0.0.1"},
+		// tokens not found are ignored
+		{Token: "not exist", Time: usedTime, IP: "127.0.0.1"},
+	}))
+	res, err = theStore.Get(token.Token)
+	require.NoError(t, err)
+	require.NotNil(t, res.LastUsedTime)
+	require.True(t, usedTime.Equal(*res.LastUsedTime))
+	require.Equal(t, "127.0.0.1", res.LastUsedIP)
+	// others are kept
+	require.Equal(t, token.Description, res.Description)
+	require.Equal(t, token.Labels, res.Labels)
+}
+
 func testRatelimit(t *testing.T) {
 	for _, l := range originLimits {
 		_, err := theStore.PutRateLimit(l)
@@ -368,6 +518,355 @@ func testRatelimit(t *testing.T) {
 		require.Equal(t, 0, len(limit))
 	}
 	require.Error(t, theStore.DelRateLimit("", ""))
+
+	// other rate limits of the user are kept
+	first := &UserRateLimit{Name: "test_user_limits", Service: "sophon-messager", ReqLimit: ReqLimit{Cap: 10, ResetDur: time.Minute}}
+	second := &UserRateLimit{Name: "test_user_limits", Service: "sophon-miner", ReqLimit: ReqLimit{Cap: 10, ResetDur: time.Minute}}
+	for _, l := range []*UserRateLimit{first, second} {
+		_, err := theStore.PutRateLimit(l)
+		require.NoError(t, err)
+	}
+	require.NoError(t, theStore.DelRateLimit(first.Name, first.Id))
+	limits, err := theStore.GetRateLimits(first.Name, "")
+	require.NoError(t, err)
+	require.Len(t, limits, 1)
+	require.Equal(t, second, limits[0])
+}
+
+func testCheckNetwork(t *testing.T) {
+	records, err := theStore.CheckNetwork()
+	require.NoError(t, err)
+	require.Len(t, records, 0)
+
+	userName := "test_user_mainnet"
+	require.NoError(t, theStore.PutUser(&User{Id: uuid.NewString(), Name: userName, CreateTime: time.Now(), UpdateTime: time.Now()}))
+	miner, _ := address.NewFromString("f01999")
+	signer, _ := address.NewFromString("f1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+
+	// write records under another network
+	origin := address.CurrentNetwork
+	address.CurrentNetwork = address.Mainnet
+	if origin == address.Mainnet {
+		address.CurrentNetwork = address.Testnet
+	}
+	openMining := true
+	_, err = theStore.UpsertMiner(miner, userName, &openMining)
+	require.NoError(t, err)
+	require.NoError(t, theStore.RegisterSigner(signer, userName))
+	address.CurrentNetwork = origin
+
+	records, err = theStore.CheckNetwork()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "miner", records[0].Kind)
+	require.Equal(t, userName, records[0].User)
+	require.Equal(t, "signer", records[1].Kind)
+	require.Equal(t, userName, records[1].User)
+
+	// unreachable under the current network
+	has, err := theStore.HasMiner(miner)
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func testOrg(t *testing.T) {
+	orgName := "test_org_001"
+	has, err := theStore.HasOrg(orgName)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	now := time.Now()
+	require.NoError(t, theStore.PutOrg(&Organization{Id: uuid.NewString(), Name: orgName, CreateTime: now, UpdateTime: now}))
+	org, err := theStore.GetOrg(orgName)
+	require.NoError(t, err)
+	require.Equal(t, orgName, org.Name)
+	orgs, err := theStore.ListOrgs()
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+
+	userName := "test_org_user_001"
+	require.NoError(t, theStore.PutUser(&User{Id: uuid.NewString(), Name: userName, Org: orgName, CreateTime: now, UpdateTime: now}))
+	users, err := theStore.ListOrgUsers(orgName)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, userName, users[0].Name)
+	require.NoError(t, theStore.DeleteUser(userName, false))
+	users, err = theStore.ListOrgUsers(orgName)
+	require.NoError(t, err)
+	require.Len(t, users, 0)
+
+	require.NoError(t, theStore.DeleteOrg(orgName))
+	has, err = theStore.HasOrg(orgName)
+	require.NoError(t, err)
+	require.False(t, has)
+	_, err = theStore.GetOrg(orgName)
+	require.Error(t, err)
+	require.Error(t, theStore.DeleteOrg(orgName))
+	orgs, err = theStore.ListOrgs()
+	require.NoError(t, err)
+	require.Len(t, orgs, 0)
+}
+
+func testAddressMapping(t *testing.T) {
+	robust, _ := address.NewFromString("t3wylwd6pclppme4qmbgwled5xpsbgwgqbn2alxa7yahg2gnbfkipsdv6m764xm5coizujmwdmkxeugplmorha")
+	idAddr, _ := address.NewFromString("t01888")
+
+	_, err := theStore.GetAddressMapping(robust)
+	require.ErrorIs(t, err, ErrAddressMappingNotFound)
+
+	require.NoError(t, theStore.PutAddressMapping(robust, idAddr))
+	// found by both addresses
+	for _, addr := range []address.Address{robust, idAddr} {
+		mapping, err := theStore.GetAddressMapping(addr)
+		require.NoError(t, err)
+		require.Equal(t, robust, mapping.Address.Address())
+		require.Equal(t, idAddr, mapping.IDAddress.Address())
+	}
+}
+
+func testPurge(t *testing.T) {
+	purged, live := "purge_user", "purge_live"
+	for _, name := range []string{purged, live} {
+		require.NoError(t, theStore.PutUser(&User{
+			Id:         uuid.NewString(),
+			Name:       name,
+			CreateTime: time.Now(),
+			UpdateTime: time.Now(),
+		}))
+	}
+	purgedToken := *originTokens["test-token-01"]
+	purgedToken.Name, purgedToken.Token = purged, "purge.token.of.purged"
+	liveToken := *originTokens["test-token-02"]
+	liveToken.Name, liveToken.Token = live, "purge.token.of.live"
+	require.NoError(t, theStore.Put(&purgedToken))
+	require.NoError(t, theStore.Put(&liveToken))
+	require.NoError(t, theStore.Delete(liveToken.Token))
+
+	miner, err := address.NewFromString("t01100")
+	require.NoError(t, err)
+	_, err = theStore.UpsertMiner(miner, purged, nil)
+	require.NoError(t, err)
+	signer, err := address.NewFromString("t1mpvdqt2acgihevibd4greavlsfn3dfph5sckc2a")
+	require.NoError(t, err)
+	require.NoError(t, theStore.RegisterSigner(signer, purged))
+	require.NoError(t, theStore.DeleteUser(purged, false))
+
+	// records deleted after 'before' are kept
+	summary, err := theStore.Purge(PurgeKinds, time.Now().Add(-time.Hour), true)
+	require.NoError(t, err)
+	require.Len(t, summary, len(PurgeKinds))
+
+	before := time.Now().Add(time.Second)
+	dryRun, err := theStore.Purge([]string{PurgeKindUser}, before, true)
+	require.NoError(t, err)
+	for _, kind := range PurgeKinds {
+		require.GreaterOrEqual(t, dryRun[kind], 1, kind)
+	}
+	// nothing is deleted by dry run
+	summary, err = theStore.Purge([]string{PurgeKindUser}, before, true)
+	require.NoError(t, err)
+	require.Equal(t, dryRun, summary)
+
+	summary, err = theStore.Purge([]string{PurgeKindUser}, before, false)
+	require.NoError(t, err)
+	require.Equal(t, dryRun, summary)
+	require.Error(t, theStore.RecoverUser(purged))
+	require.Error(t, theStore.Recover(purgedToken.Token))
+	has, err := theStore.MinerExistInUser(miner, purged)
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = theStore.SignerExistInUser(signer, purged)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	summary, err = theStore.Purge([]string{PurgeKindUser}, before, true)
+	require.NoError(t, err)
+	for _, kind := range PurgeKinds {
+		require.Zero(t, summary[kind], kind)
+	}
+
+	// the deleted token of live user is purged only with kind token
+	require.NoError(t, theStore.Recover(liveToken.Token))
+	require.NoError(t, theStore.Delete(liveToken.Token))
+	_, err = theStore.Purge([]string{PurgeKindToken}, before, false)
+	require.NoError(t, err)
+	require.Error(t, theStore.Recover(liveToken.Token))
+	has, err = theStore.HasUser(live)
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
+func testCascadeDeleteUser(t *testing.T) {
+	name := "cascade_user"
+	require.NoError(t, theStore.PutUser(&User{
+		Id:         uuid.NewString(),
+		Name:       name,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}))
+	token := *originTokens["test-token-01"]
+	token.Name, token.Token = name, "cascade.token.of.user"
+	require.NoError(t, theStore.Put(&token))
+	miner, err := address.NewFromString("t01200")
+	require.NoError(t, err)
+	_, err = theStore.UpsertMiner(miner, name, nil)
+	require.NoError(t, err)
+	signer, err := address.NewFromString("t1sgeoaugenqnzftqp7wvwqebcozkxa5y7i56sy2q")
+	require.NoError(t, err)
+	require.NoError(t, theStore.RegisterSigner(signer, name))
+
+	require.NoError(t, theStore.DeleteUser(name, true))
+	has, err := theStore.Has(token.Token)
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = theStore.MinerExistInUser(miner, name)
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = theStore.SignerExistInUser(signer, name)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// the miner taken by others since deleted is not recovered
+	other := "cascade_other"
+	require.NoError(t, theStore.PutUser(&User{Id: uuid.NewString(), Name: other, CreateTime: time.Now(), UpdateTime: time.Now()}))
+	_, err = theStore.UpsertMiner(miner, other, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, theStore.RecoverUser(name))
+	has, err = theStore.Has(token.Token)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = theStore.SignerExistInUser(signer, name)
+	require.NoError(t, err)
+	require.True(t, has)
+	user, err := theStore.GetUserByMiner(miner)
+	require.NoError(t, err)
+	require.Equal(t, other, user.Name)
+	user, err = theStore.GetUser(name)
+	require.NoError(t, err)
+	require.Nil(t, user.Cascaded)
+}
+
+func testCascadeDeleteUserFailed(t *testing.T) {
+	if cfg.Type != "badger" {
+		t.Skip("the failure is injected into badger")
+	}
+	name := "cascade_failed_user"
+	require.NoError(t, theStore.PutUser(&User{Id: uuid.NewString(), Name: name, CreateTime: time.Now(), UpdateTime: time.Now()}))
+	miner, err := address.NewFromString("t01201")
+	require.NoError(t, err)
+	_, err = theStore.UpsertMiner(miner, name, nil)
+	require.NoError(t, err)
+	signer, err := address.NewFromString("t1uqtvvwkkfkkez52ocnqe6vg74qewiwja4t2tiba")
+	require.NoError(t, err)
+	require.NoError(t, theStore.RegisterSigner(signer, name))
+
+	// a broken token fails the cascade after the miners and signers are detached
+	db := theStore.(*badgerStore).db
+	broken := tokenKey("cascade.broken.token")
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(broken, []byte("broken"))
+	}))
+	require.Error(t, theStore.DeleteUser(name, true))
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(broken)
+	}))
+
+	// nothing of the cascade is committed
+	has, err := theStore.HasUser(name)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = theStore.MinerExistInUser(miner, name)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = theStore.SignerExistInUser(signer, name)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	require.NoError(t, theStore.DeleteUser(name, true))
+	has, err = theStore.HasUser(name)
+	require.NoError(t, err)
+	require.False(t, has)
+	require.NoError(t, theStore.RecoverUser(name))
+	has, err = theStore.SignerExistInUser(signer, name)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = theStore.MinerExistInUser(miner, name)
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
+func testWebhook(t *testing.T) {
+	name := "test_webhook_001"
+	_, err := theStore.GetWebhook(name)
+	require.True(t, IsNotFound(err))
+
+	now := time.Now()
+	webhook := &Webhook{Name: name, URL: "http://127.0.0.1/hook", Events: WebhookEvents{"user_created"},
+		Secret: "secret", CreateTime: now, UpdateTime: now}
+	require.NoError(t, theStore.PutWebhook(webhook))
+	res, err := theStore.GetWebhook(name)
+	require.NoError(t, err)
+	require.Equal(t, webhook.URL, res.URL)
+	require.Equal(t, webhook.Events, res.Events)
+	webhooks, err := theStore.ListWebhooks()
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+
+	newDelivery := func(webhook, state string, created, next time.Time) *WebhookDelivery {
+		return &WebhookDelivery{Id: uuid.Must(uuid.NewV7()).String(), Webhook: webhook, EventID: uuid.NewString(), EventType: "user_created",
+			Payload: "{}", State: state, NextAttempt: next, CreateTime: created, UpdateTime: created}
+	}
+	delivered := newDelivery(name, DeliveryDelivered, now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	due := newDelivery(name, DeliveryPending, now.Add(-2*time.Hour), now.Add(-time.Minute))
+	later := newDelivery(name, DeliveryPending, now.Add(-time.Hour), now.Add(time.Hour))
+	// the name of the webhook starts with the name of the other one
+	other := newDelivery(name+":other", DeliveryPending, now.Add(-time.Hour), now.Add(-time.Hour))
+	require.NoError(t, theStore.PutWebhookDeliveries([]*WebhookDelivery{later, delivered, due, other}))
+
+	deliveries, err := theStore.ListPendingWebhookDeliveries(name, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, due.Id, deliveries[0].Id)
+	require.Equal(t, later.Id, deliveries[1].Id)
+	deliveries, err = theStore.ListPendingWebhookDeliveries(name, 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, due.Id, deliveries[0].Id)
+	require.NoError(t, theStore.PutWebhookDeliveries([]*WebhookDelivery{{Id: other.Id, Webhook: other.Webhook, State: DeliveryDelivered,
+		CreateTime: other.CreateTime, UpdateTime: now.Add(-2 * time.Hour)}}))
+	deliveries, err = theStore.ListWebhookDeliveries(name, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	require.Equal(t, later.Id, deliveries[0].Id)
+	deliveries, err = theStore.ListWebhookDeliveries("", DeliveryPending, 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, later.Id, deliveries[0].Id)
+
+	// updated as delivered, the finished ones are pruned
+	due.State, due.Attempts, due.StatusCode = DeliveryDelivered, 1, 200
+	require.NoError(t, theStore.PutWebhookDeliveries([]*WebhookDelivery{due}))
+	deliveries, err = theStore.ListPendingWebhookDeliveries(name, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, later.Id, deliveries[0].Id)
+	pruned, err := theStore.PruneWebhookDeliveries(now.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+	deliveries, err = theStore.ListWebhookDeliveries(name, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	// the deliveries are deleted along with the webhook
+	require.NoError(t, theStore.DeleteWebhook(name))
+	require.True(t, IsNotFound(theStore.DeleteWebhook(name)))
+	deliveries, err = theStore.ListWebhookDeliveries("", "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 0)
+	webhooks, err = theStore.ListWebhooks()
+	require.NoError(t, err)
+	require.Len(t, webhooks, 0)
 }
 
 func TestStore(t *testing.T) {
@@ -377,12 +876,15 @@ func TestStore(t *testing.T) {
 	t.Run("add miners", testAddMiner)
 	// stm: @VENUSAUTH_BADGER_GET_USER_BY_MINER_001, @VENUSAUTH_BADGER_GET_USER_BY_MINER_002
 	t.Run("get miners", testListMiners)
+	t.Run("transfer miner", testTransferMiner)
+	t.Run("update miner labels", testUpdateMinerLabels)
 	t.Run("add signers", testAddSigner)
 	t.Run("signer exist in user", testSignerExistInUser)
 	// stm: @VENUSAUTH_BADGER_HAS_001
 	t.Run("has signer", testHasSigner)
 	t.Run("list signers", testListSigners)
 	t.Run("get user by signer", testGetUserBySigner)
+	t.Run("update signer of user", testUpdateSignerOfUser)
 	// stm: @VENUSAUTH_BADGER_DELETE_001, @VENUSAUTH_BADGER_GET_USER_001, @VENUSAUTH_BADGER_GET_USER_RECORD_001, @VENUSAUTH_BADGER_UPDATE_USER_001
 	// stm: @VENUSAUTH_BADGER_HAS_USER_001, @VENUSAUTH_BADGER_HAS_MINER_001, @VENUSAUTH_BADGER_DELETE_USER_001
 	// stm: @VENUSAUTH_BADGER_DELETE_USER_003
@@ -394,8 +896,186 @@ func TestStore(t *testing.T) {
 
 	// stm: @VENUSAUTH_BADGER_HAS_001, @VENUSAUTH_BADGER_GET_001, @VENUSAUTH_BADGER_BY_NAME_001, @VENUSAUTH_BADGER_LIST_001
 	t.Run("test token", testTokens)
+	t.Run("token usages", testTokenUsages)
 	// stm: @VENUSAUTH_BADGER_GET_RATE_LIMITS_001, @VENUSAUTH_BADGER_DEL_RATE_LIMITS_001, @VENUSAUTH_BADGER_DEL_RATE_LIMITS_002
 	t.Run("test ratelimit", testRatelimit)
+	t.Run("check network", testCheckNetwork)
+	t.Run("address mapping", testAddressMapping)
+	t.Run("organization", testOrg)
+	t.Run("webhook", testWebhook)
+	t.Run("purge", testPurge)
+	t.Run("cascade delete user", testCascadeDeleteUser)
+	t.Run("cascade delete user failed", testCascadeDeleteUserFailed)
+	t.Run("transaction", testTransaction)
+}
+
+func testTransaction(t *testing.T) {
+	newUser := func(name string) *User {
+		return &User{Id: uuid.NewString(), Name: name, State: core.UserStateEnabled, CreateTime: time.Now(), UpdateTime: time.Now()}
+	}
+	mAddr, err := address.NewIDAddress(1300)
+	require.NoError(t, err)
+	sAddr, err := address.NewFromString("t1mpvdqt2acgihevibd4greavlsfn3dfph5sckc2a")
+	require.NoError(t, err)
+
+	// nothing is written if it failed, though the writes are seen in it
+	errAbort := errors.New("abort")
+	err = theStore.Transaction(func(store Store) error {
+		require.NoError(t, store.PutUser(newUser("test_txn_aborted")))
+		_, err := store.UpsertMiner(mAddr, "test_txn_aborted", nil)
+		require.NoError(t, err)
+		require.NoError(t, store.RegisterSigner(sAddr, "test_txn_aborted"))
+		user, err := store.GetUserByMiner(mAddr)
+		require.NoError(t, err)
+		require.Equal(t, "test_txn_aborted", user.Name)
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	has, err := theStore.HasUser("test_txn_aborted")
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = theStore.HasMiner(mAddr)
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = theStore.SignerExistInUser(sAddr, "test_txn_aborted")
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, theStore.Transaction(func(store Store) error {
+		require.NoError(t, store.PutUser(newUser("test_txn_committed")))
+		require.NoError(t, store.RegisterSigner(sAddr, "test_txn_committed"))
+		// a transaction in it joins the outer one
+		return store.Transaction(func(store Store) error {
+			_, err := store.UpsertMiner(mAddr, "test_txn_committed", nil)
+			if err != nil {
+				return err
+			}
+			_, err = store.DelSigner(sAddr)
+			return err
+		})
+	}))
+	user, err := theStore.GetUserByMiner(mAddr)
+	require.NoError(t, err)
+	require.Equal(t, "test_txn_committed", user.Name)
+	has, err = theStore.SignerExistInUser(sAddr, "test_txn_committed")
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestCloseStore(t *testing.T) {
+	if cfg.Type != "badger" {
+		t.Skip("reopening is tested on badger only")
+	}
+	dataPath := t.TempDir()
+	for i := 0; i < 5; i++ {
+		store, err := NewStore(&config.DBConfig{Type: config.Badger}, dataPath)
+		require.NoError(t, err)
+		// users put by the former runs are persisted
+		users, err := store.ListUsers(0, 0, core.UserStateUndefined)
+		require.NoError(t, err)
+		require.Len(t, users, i)
+		require.NoError(t, store.PutUser(&User{
+			Id:         uuid.NewString(),
+			Name:       fmt.Sprintf("test_close_user_%d", i),
+			State:      core.UserStateEnabled,
+			CreateTime: time.Now(),
+			UpdateTime: time.Now(),
+		}))
+		require.NoError(t, store.Close())
+		// closing again does nothing
+		require.NoError(t, store.Close())
+	}
+}
+
+func TestReplicaStream(t *testing.T) {
+	if cfg.Type != "badger" {
+		t.Skip("only badger is replicable")
+	}
+	newUser := func(name string) *User {
+		return &User{
+			Id:         uuid.NewString(),
+			Name:       name,
+			State:      core.UserStateEnabled,
+			CreateTime: time.Now(),
+			UpdateTime: time.Now(),
+		}
+	}
+	leader, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+	require.NoError(t, err)
+	defer leader.Close() // nolint
+	follower, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+	require.NoError(t, err)
+	defer follower.Close() // nolint
+
+	newDelivery := func() *WebhookDelivery {
+		now := time.Now()
+		return &WebhookDelivery{Id: uuid.NewString(), Webhook: "test_replica_webhook", State: DeliveryPending,
+			NextAttempt: now, CreateTime: now, UpdateTime: now}
+	}
+	pendingIDs := func(store Store) []string {
+		deliveries, err := store.ListPendingWebhookDeliveries("test_replica_webhook", 0)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(deliveries))
+		for _, d := range deliveries {
+			ids = append(ids, d.Id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	require.NoError(t, leader.PutUser(newUser("test_replica_user_1")))
+	require.NoError(t, leader.PutWebhookDeliveries([]*WebhookDelivery{newDelivery()}))
+	require.NoError(t, leader.(Replicable).PutLocal("test-local", []byte("leader")))
+	// records only the follower has are dropped by the snapshot, except the local ones
+	require.NoError(t, follower.PutUser(newUser("test_replica_stale")))
+	require.NoError(t, follower.(Replicable).PutLocal("test-local", []byte("follower")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	synced := make(chan struct{})
+	var snapshot []*ReplicaRecord
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- leader.(Replicable).Stream(ctx, func(batch *ReplicaBatch) error {
+			if !batch.Snapshot {
+				return follower.(Replicable).Apply(batch.Records)
+			}
+			snapshot = append(snapshot, batch.Records...)
+			if !batch.Synced {
+				return nil
+			}
+			defer close(synced)
+			return follower.(Replicable).ApplySnapshot(snapshot)
+		})
+	}()
+	<-synced
+	has, err := follower.HasUser("test_replica_user_1")
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = follower.HasUser("test_replica_stale")
+	require.NoError(t, err)
+	require.False(t, has)
+	local, err := follower.(Replicable).GetLocal("test-local")
+	require.NoError(t, err)
+	require.Equal(t, "follower", string(local))
+	// the pending deliveries are indexed on the follower as well, so it delivers them after elected
+	require.Len(t, pendingIDs(follower), 1)
+	require.Equal(t, pendingIDs(leader), pendingIDs(follower))
+
+	// records written after the snapshot are streamed
+	require.NoError(t, leader.PutUser(newUser("test_replica_user_2")))
+	require.Eventually(t, func() bool {
+		has, err := follower.HasUser("test_replica_user_2")
+		return err == nil && has
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, leader.PutWebhookDeliveries([]*WebhookDelivery{newDelivery()}))
+	require.Eventually(t, func() bool {
+		return len(pendingIDs(follower)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, pendingIDs(leader), pendingIDs(follower))
+
+	cancel()
+	require.ErrorIs(t, <-streamErr, context.Canceled)
 }
 
 func setup(cfg *config.DBConfig) error {
@@ -411,15 +1091,10 @@ func setup(cfg *config.DBConfig) error {
 }
 
 func shutdown() error {
-	if mysqlStore, isok := theStore.(*mysqlStore); isok {
-		sqldb, err := mysqlStore.db.DB()
-		if err != nil {
-			return err
-		}
-		return sqldb.Close()
+	if err := theStore.Close(); err != nil {
+		return err
 	}
-	if badgerStroe, isok := theStore.(*badgerStore); isok {
-		_ = badgerStroe.db.Close()
+	if cfg.Type == "badger" {
 		fmt.Printf("shutdown, remove dir:%s\n", cfg.DSN)
 		return os.RemoveAll(cfg.DSN)
 	}
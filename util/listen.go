@@ -0,0 +1,97 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// UnixSocketMode unix sockets are accessible to the owner and the group only
+const UnixSocketMode = 0o660
+
+// UnixSocketPath returns the path of addr if it's a unix multiaddr, such as /unix/run/sophon-auth.sock
+func UnixSocketPath(addr string) (string, bool) {
+	ma, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return "", false
+	}
+	path, err := ma.ValueForProtocol(multiaddr.P_UNIX)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Listen listens on addr, either `host:port` or a multiaddr such as /ip4/127.0.0.1/tcp/8989 and /unix/run/sophon-auth.sock,
+// the socket file of a unix address left by a stopped process is removed before listening.
+func Listen(addr string) (net.Listener, error) {
+	ma, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return net.Listen("tcp", addr)
+	}
+
+	if path, isUnix := UnixSocketPath(addr); isUnix {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial("unix", path); err == nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("socket %s is in use", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("remove stale socket %s: %w", path, err)
+			}
+		}
+		return listenUnix(path)
+	}
+	lst, err := manet.Listen(ma)
+	if err != nil {
+		return nil, err
+	}
+	return manet.NetListener(lst), nil
+}
+
+// unixListener removes the socket file moved to path when closed
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
+
+// listenUnix creates the socket in a directory beside path accessible to the owner only,
+// and moves it to path after chmod, so it's never accessible to others with the process umask.
+func listenUnix(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("create directory for socket %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir) // nolint
+
+	tmp := filepath.Join(dir, filepath.Base(path))
+	lst, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket file is moved, it's removed by unixListener
+	lst.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, UnixSocketMode); err != nil {
+		_ = lst.Close()
+		return nil, fmt.Errorf("chmod socket %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = lst.Close()
+		return nil, fmt.Errorf("move socket to %s: %w", path, err)
+	}
+	return &unixListener{UnixListener: lst, path: path}, nil
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:0", "/ip4/127.0.0.1/tcp/0"} {
+		lst, err := Listen(addr)
+		require.NoError(t, err)
+		assert.Equal(t, "tcp", lst.Addr().Network())
+		assert.NoError(t, lst.Close())
+	}
+
+	_, err := Listen("/ip4/127.0.0.1/udp/0")
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "auth.sock")
+	addr := "/unix" + path
+	socketPath, ok := UnixSocketPath(addr)
+	assert.True(t, ok)
+	assert.Equal(t, path, socketPath)
+	_, ok = UnixSocketPath("/ip4/127.0.0.1/tcp/0")
+	assert.False(t, ok)
+
+	lst, err := Listen(addr)
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(UnixSocketMode), fi.Mode().Perm())
+	assert.Equal(t, path, lst.Addr().String())
+	// the directory the socket created in is removed
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// the socket in use is not taken over
+	_, err = Listen(addr)
+	assert.Error(t, err)
+
+	require.NoError(t, lst.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// the socket file left by a stopped process is removed
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	lst, err = Listen(addr)
+	require.NoError(t, err)
+	assert.NoError(t, lst.Close())
+}